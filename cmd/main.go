@@ -6,6 +6,7 @@ import (
 	"backend/internal/db/minio"
 	"backend/internal/db/mysql"
 	"backend/internal/route"
+	"backend/internal/service"
 	"backend/pkg/logger"
 	"backend/pkg/utils"
 	"context"
@@ -125,6 +126,27 @@ func main() {
 	//注册路由
 	route.RegisterRoutes(r)
 
+	// 启动后台任务
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	service.NewFileCatalogService().Start(jobCtx, cfg.FileCatalog)
+	service.NewUploadSessionService().Start(jobCtx, cfg.UploadEvent)
+	service.NewMultipartUploadService().Start(jobCtx, cfg.Multipart)
+	service.NewFileArchiveService().Start(jobCtx, cfg.FileArchive)
+	service.NewRetentionService().Start(jobCtx, cfg.Retention)
+	service.NewRollupService().Start(jobCtx, cfg.Rollup)
+	service.NewSeriesArchiveService().Start(jobCtx, cfg.SeriesArchive)
+	service.NewSeriesOutboxService().Start(jobCtx, cfg.SeriesOutbox)
+	service.NewIngestService().Start(jobCtx, cfg.Ingest)
+	service.NewIdempotencyService().Start(jobCtx, cfg.Idempotency)
+	service.ConfigureQuality(cfg.Quality)
+	if err := service.ConfigureFirmware(cfg.Firmware); err != nil {
+		logger.L().Error("加载固件配置失败", logger.WithError(err))
+		os.Exit(1)
+	}
+	service.NewAnomalyService().Start(jobCtx, cfg.Anomaly)
+	service.NewCompletenessService().Start(jobCtx, cfg.Completeness)
+
 	// 启动服务器
 	Addr := cfg.Server.Host + ":" + cfg.Server.Port
 	srv := &http.Server{
@@ -145,6 +167,7 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit // 阻塞，直到收到信号
 	logger.L().Info("开始优雅关闭服务器...")
+	stopJobs()
 
 	// 设置一个优雅关闭的超时时间
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -88,6 +88,147 @@ type ServerConfig struct {
 type JWTConfig struct {
 	Secret string `yaml:"secret"`
 }
+// ==================== 文件目录 配置 ====================
+// FileCatalogConfig 文件目录（metadata与MinIO一致性）配置
+type FileCatalogConfig struct {
+	OutboxInterval    int  `yaml:"outbox_interval"`     // 删除补偿任务重试间隔（秒），默认60
+	ReconcileInterval int  `yaml:"reconcile_interval"`  // 定时对账间隔（分钟），0表示不定时对账
+	ReconcileAutoFix  bool `yaml:"reconcile_auto_fix"`  // 定时对账是否自动修复
+	OrphanGracePeriod int  `yaml:"orphan_grace_period"` // 未登记对象的宽限期（分钟），默认60，避免误判上传中的文件
+}
+
+// ==================== 上传事件 配置 ====================
+// UploadEventConfig MinIO存储事件（自动确认上传）配置
+type UploadEventConfig struct {
+	WebhookToken string   `yaml:"webhook_token"` // MinIO webhook目标的auth_token，为空表示不接收webhook
+	Listen       bool     `yaml:"listen"`        // 是否通过ListenBucketNotification订阅存储事件
+	Buckets      []string `yaml:"buckets"`       // 订阅的bucket，默认image/video/audio/file
+}
+
+// ==================== 分片上传 配置 ====================
+// MultipartUploadConfig 分片上传配置
+type MultipartUploadConfig struct {
+	PartSize        int `yaml:"part_size"`        // 分片大小（MB），默认16，最小5
+	SessionTTL      int `yaml:"session_ttl"`      // 分片上传会话有效期（小时），默认24
+	CleanupInterval int `yaml:"cleanup_interval"` // 清理未完成分片上传的间隔（分钟），默认60
+}
+
+// ==================== 文件打包 配置 ====================
+// FileArchiveConfig 批量下载（异步打包）配置
+type FileArchiveConfig struct {
+	Retention       int `yaml:"retention"`        // 打包生成的ZIP保留时间（小时），默认24
+	CleanupInterval int `yaml:"cleanup_interval"` // 清理过期ZIP的间隔（分钟），默认60
+}
+
+// ==================== 数据保留 配置 ====================
+// RetentionConfig 数据保留策略执行配置
+type RetentionConfig struct {
+	Interval        int  `yaml:"interval"`          // 定时执行间隔（分钟），0表示不定时执行
+	DryRun          bool `yaml:"dry_run"`           // 定时执行时只生成报告不删除
+	SyncInfluxDB    bool `yaml:"sync_influxdb"`     // 是否将时序策略同步为InfluxDB数据库保留期
+	DeleteBatchSize int  `yaml:"delete_batch_size"` // 每批删除的元数据数量，默认500
+}
+
+// ==================== 时序汇总 配置 ====================
+// RollupConfig 时序数据汇总（1m/1h/1d）配置
+type RollupConfig struct {
+	Interval        int                       `yaml:"interval"`         // 汇总任务执行间隔（分钟），0表示不执行
+	Lag             int                       `yaml:"lag"`              // 汇总延迟（分钟），等待迟到的数据，默认2
+	InitialLookback int                       `yaml:"initial_lookback"` // 首次汇总时回溯的时间（小时），默认24，更早的数据通过回填计算
+	Measurements    []RollupMeasurementConfig `yaml:"measurements"`     // 需要汇总的measurement
+}
+
+// RollupMeasurementConfig 单个measurement的汇总配置
+type RollupMeasurementConfig struct {
+	Name   string   `yaml:"name"`
+	Fields []string `yaml:"fields"` // 汇总的数值字段，默认["value"]
+}
+
+// ==================== 时序归档 配置 ====================
+// SeriesArchiveConfig 时序数据冷存储归档（Parquet）配置
+type SeriesArchiveConfig struct {
+	Interval       int      `yaml:"interval"`         // 归档任务执行间隔（分钟），0表示不执行
+	OlderThan      int      `yaml:"older_than"`       // 归档早于多少天的数据，默认30
+	MaxDaysPerRun  int      `yaml:"max_days_per_run"` // 每次最多归档的天数，默认7
+	Measurements   []string `yaml:"measurements"`     // 需要归档的measurement
+	ExpireInfluxDB bool     `yaml:"expire_influxdb"`  // 归档完成后将InfluxDB数据库保留期设为older_than加2天
+}
+
+// ==================== 时序写入补偿 配置 ====================
+// SeriesOutboxConfig 时序数据写入补偿（InfluxDB与MySQL一致性）配置
+type SeriesOutboxConfig struct {
+	Interval   int `yaml:"interval"`    // 补偿任务执行间隔（秒），默认30
+	StuckAfter int `yaml:"stuck_after"` // 超过该时间（秒）仍未完成的写入由补偿任务处理，默认120
+}
+
+// ==================== 写入管道 配置 ====================
+// IngestConfig 时序数据异步写入管道配置
+type IngestConfig struct {
+	QueueSize     int    `yaml:"queue_size"`     // 队列容量（上传请求数），默认10000，队列满时返回429
+	Workers       int    `yaml:"workers"`        // 写入协程数，默认2
+	BatchSize     int    `yaml:"batch_size"`     // 每批合并写入的最大点数，默认5000
+	FlushInterval int    `yaml:"flush_interval"` // 未满一批时的最长等待时间（毫秒），默认1000
+	WALDir        string `yaml:"wal_dir"`        // InfluxDB不可用时暂存数据的目录，默认data/ingest_wal
+	WALMaxSize    int    `yaml:"wal_max_size"`   // WAL最大容量（MB），默认1024，超过时返回503
+	RetryInterval int    `yaml:"retry_interval"` // 重新写入WAL中数据的间隔（秒），默认10
+}
+
+// ==================== 幂等键 配置 ====================
+// IdempotencyConfig Idempotency-Key 幂等请求配置
+type IdempotencyConfig struct {
+	TTL             int `yaml:"ttl"`              // 保存响应的时间（小时），默认24
+	WaitTimeout     int `yaml:"wait_timeout"`     // 相同幂等键的并发请求最长等待时间（秒），默认10
+	ProcessingLease int `yaml:"processing_lease"` // 处理租约（秒），默认60，处理期间定期续期，进程退出后租约到期即可由重试请求接管
+	CleanupInterval int `yaml:"cleanup_interval"` // 过期记录清理间隔（分钟），默认60
+}
+
+// ==================== 数据质量评分 配置 ====================
+// QualityConfig 上传时序数据时服务端计算质量评分的配置
+type QualityConfig struct {
+	Enabled         bool    `yaml:"enabled"`          // 是否由服务端计算quality_score（关闭时使用客户端提供的值）
+	FlatlineMinRun  int     `yaml:"flatline_min_run"` // 连续多少个相同数值视为卡死，默认10
+	SpikeThreshold  float64 `yaml:"spike_threshold"`  // 突变判定的稳健z分数阈值，默认6
+	JitterTolerance float64 `yaml:"jitter_tolerance"` // 采样间隔允许偏离预期的比例，默认0.5
+}
+
+// ==================== 异常检测 配置 ====================
+// AnomalyConfig 时序数据异常检测配置
+type AnomalyConfig struct {
+	Enabled       bool     `yaml:"enabled"`
+	Measurements  []string `yaml:"measurements"`   // 检测的measurement，为空表示全部
+	Alpha         float64  `yaml:"alpha"`          // EWMA平滑系数（0-1），越大基线适应越快，默认0.05
+	ZThreshold    float64  `yaml:"z_threshold"`    // z分数绝对值超过该值判定为异常，默认4
+	MinSamples    int      `yaml:"min_samples"`    // 基线学习的最少样本数，之前只学习不判定，默认30
+	QueueSize     int      `yaml:"queue_size"`     // 待检测上传的队列长度，队列满时跳过检测，默认1000
+	FlushInterval int      `yaml:"flush_interval"` // 基线保存间隔（秒），默认60
+}
+
+// ==================== 数据完整性报告 配置 ====================
+// CompletenessConfig 数据完整性报告配置
+type CompletenessConfig struct {
+	Daily        bool                   `yaml:"daily"`        // 是否每天生成前一天的报告（CSV写入archive bucket）
+	RunAt        string                 `yaml:"run_at"`       // 每天生成报告的时间（HH:MM），默认01:00
+	Measurements []string               `yaml:"measurements"` // 每个设备都检查的measurement（另外检查schema中与当期上传过的measurement）
+	GapFactor    float64                `yaml:"gap_factor"`   // 相邻数据点间隔超过预期间隔多少倍视为缺口，默认3
+	Mail         CompletenessMailConfig `yaml:"mail"`
+}
+
+// CompletenessMailConfig 每日报告邮件配置（host为空时不发送）
+type CompletenessMailConfig struct {
+	Host     string   `yaml:"host"`
+	Port     int      `yaml:"port"` // 默认587（STARTTLS）
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+// ==================== 固件 配置 ====================
+// FirmwareConfig 固件/OTA配置
+type FirmwareConfig struct {
+	PublicKey string `yaml:"public_key"` // 固件签名公钥（base64编码的Ed25519公钥），为空时不接受带签名的固件
+}
+
 // ==================== 主配置结构 ====================
 // Config 应用配置（集中管理所有配置）
 type Config struct {
@@ -97,6 +238,21 @@ type Config struct {
 	Server   ServerConfig   `yaml:"server"`
 	Logger   LoggerConfig   `yaml:"logger"`
 	JWT      JWTConfig      `yaml:"jwt"`
+
+	FileCatalog   FileCatalogConfig     `yaml:"file_catalog"`
+	UploadEvent   UploadEventConfig     `yaml:"upload_event"`
+	Multipart     MultipartUploadConfig `yaml:"multipart_upload"`
+	FileArchive   FileArchiveConfig     `yaml:"file_archive"`
+	Retention     RetentionConfig       `yaml:"retention"`
+	Rollup        RollupConfig          `yaml:"rollup"`
+	SeriesArchive SeriesArchiveConfig   `yaml:"series_archive"`
+	SeriesOutbox  SeriesOutboxConfig    `yaml:"series_outbox"`
+	Ingest        IngestConfig          `yaml:"ingest"`
+	Idempotency   IdempotencyConfig     `yaml:"idempotency"`
+	Quality       QualityConfig         `yaml:"quality"`
+	Anomaly       AnomalyConfig         `yaml:"anomaly"`
+	Completeness  CompletenessConfig    `yaml:"completeness"`
+	Firmware      FirmwareConfig        `yaml:"firmware"`
 }
 
 // InitConfig 初始化配置（从YAML文件加载）
@@ -0,0 +1,27 @@
+package influxdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"backend/internal/model"
+)
+
+// QueryDevicePoints 获取设备在[from, to)内的原始数据点（含全部tag与字段，按时间升序）
+func (c *InfluxDBClient) QueryDevicePoints(measurement, devID string, from, to time.Time) ([]model.Point, error) {
+	sql := fmt.Sprintf(`SELECT * FROM "%s" WHERE dev_id = '%s' AND time >= '%s' AND time < '%s' ORDER BY time`,
+		measurement, devID, from.Format(time.RFC3339Nano), to.Format(time.RFC3339Nano))
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	result, err := c.queryOnce(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	points, _ := result.([]model.Point)
+	for i := range points {
+		points[i].Measurement = measurement
+	}
+	return points, nil
+}
@@ -44,6 +44,7 @@ var InfluxDBCli *InfluxDBClient
 
 type InfluxDBClient struct {
 	Client *influxdb3.Client
+	cfg    config.InfluxDBConfig // 调用HTTP配置接口（如设置保留期）时使用
 }
 
 // GetInfluxDBClient 获取InfluxDB客户端
@@ -56,8 +57,8 @@ func GetInfluxDBClient(cfg config.InfluxDBConfig) (*InfluxDBClient, error) {
 	if err != nil {
 		return nil, err
 	}
-	InfluxDBCli = &InfluxDBClient{Client: client}
-	return &InfluxDBClient{Client: client}, nil
+	InfluxDBCli = &InfluxDBClient{Client: client, cfg: cfg}
+	return InfluxDBCli, nil
 }
 
 // ensureDatabaseExists 确保数据库存在，如果不存在则创建
@@ -145,6 +146,38 @@ func InitInfluxDBClient(cfg config.InfluxDBConfig) (*influxdb3.Client, error) {
 	return client, nil
 }
 
+// SetRetentionPeriod 设置数据库保留期（如 "30d"），超过保留期的数据由InfluxDB自动删除
+func (c *InfluxDBClient) SetRetentionPeriod(period string) error {
+	apiURL := fmt.Sprintf("%s/api/v3/configure/database", c.cfg.Host)
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"db":               c.cfg.Database,
+		"retention_period": period,
+	})
+	if err != nil {
+		return fmt.Errorf("编码请求体失败: %v", err)
+	}
+
+	req, err := http.NewRequest("PUT", apiURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.cfg.Token))
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("发送请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 && resp.StatusCode != 204 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("设置保留期失败，状态码: %d, 响应: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
 func (c *InfluxDBClient) Close() error {
 	if c.Client != nil {
 		return c.Client.Close()
@@ -245,7 +278,7 @@ func (c *InfluxDBClient) WritePoints(points []model.Point) error {
 			end = len(points)
 		}
 		batchPoints := points[i:end]
-		err := c.WriteBatchOnce(batchPoints)
+		err := c.writeBatchWithRetry(batchPoints)
 		if err != nil {
 			return fmt.Errorf("批量写入InfluxDB失败: %v", err)
 		}
@@ -253,7 +286,24 @@ func (c *InfluxDBClient) WritePoints(points []model.Point) error {
 	return nil
 }
 
-// WriteBatchOnce 一次性写入一批数据
+// writeBatchWithRetry 写入一批数据（简单重试）
+func (c *InfluxDBClient) writeBatchWithRetry(batch []model.Point) error {
+	var lastErr error
+	for attempt := 0; attempt <= MaxRetries; attempt++ {
+		if err := c.WriteBatchOnce(batch); err != nil {
+			if !isRetryable(err) || attempt == MaxRetries {
+				return err
+			}
+			lastErr = err
+			time.Sleep(time.Duration(attempt+1) * 200 * time.Millisecond)
+			continue
+		}
+		return nil
+	}
+	return lastErr
+}
+
+// WriteBatchOnce 一次性写入一批数据（不重试，由调用方决定重试或暂存）
 func (c *InfluxDBClient) WriteBatchOnce(batch []model.Point) error {
 	sdkPoints := make([]*influxdb3.Point, 0, len(batch))
 	for _, p := range batch {
@@ -269,23 +319,9 @@ func (c *InfluxDBClient) WriteBatchOnce(batch []model.Point) error {
 		sdkPoints = append(sdkPoints, pt)
 	}
 
-	// 带超时 & 简单重试
 	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
 	defer cancel()
-
-	var lastErr error
-	for attempt := 0; attempt <= MaxRetries; attempt++ {
-		if err := c.Client.WritePoints(ctx, sdkPoints); err != nil {
-			if !isRetryable(err) || attempt == MaxRetries {
-				return err
-			}
-			lastErr = err
-			time.Sleep(time.Duration(attempt+1) * 200 * time.Millisecond)
-			continue
-		}
-		return nil
-	}
-	return lastErr
+	return c.Client.WritePoints(ctx, sdkPoints)
 }
 
 // isRetryable 判断是否可重试
@@ -318,10 +354,16 @@ func (c *InfluxDBClient) Query(opts QueryOptions) (interface{}, error) {
 		opts.DownsampleEvery = step
 	}
 
-	// 1. 拼 SQL
-	sql, err := buildQuerySQL(opts)
-	if err != nil {
-		return nil, err
+	// 1. 拼 SQL（有满足分辨率的汇总数据时查询汇总measurement）
+	var sql string
+	if level, ok := chooseRollup(opts); ok {
+		sql = buildRollupQuerySQL(opts, level)
+	} else {
+		var err error
+		sql, err = buildQuerySQL(opts)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	logger.L().Info("构建SQL语句完成", logger.WithAny("sql",sql))
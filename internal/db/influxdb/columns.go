@@ -0,0 +1,31 @@
+package influxdb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// MeasurementColumns 获取measurement已有的列名（tag、field与time），measurement不存在时返回空
+func (c *InfluxDBClient) MeasurementColumns(measurement string) (map[string]bool, error) {
+	sql := fmt.Sprintf(`SELECT column_name FROM information_schema.columns
+		WHERE table_schema = 'iox' AND table_name = '%s'`, strings.ReplaceAll(measurement, "'", "''"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	it, err := c.Client.Query(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]bool)
+	for it.Next() {
+		if name, ok := it.Value()["column_name"].(string); ok && name != "" {
+			columns[name] = true
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
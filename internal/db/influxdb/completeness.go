@@ -0,0 +1,80 @@
+package influxdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SeriesCoverage 获取设备在[from, to)内的数据点数量（按不同时间戳）与首尾时间
+func (c *InfluxDBClient) SeriesCoverage(measurement, devID string, from, to time.Time) (int64, time.Time, time.Time, error) {
+	sql := fmt.Sprintf(`SELECT COUNT(DISTINCT time) AS received, MIN(time) AS first, MAX(time) AS last
+		FROM "%s" WHERE dev_id = '%s' AND time >= '%s' AND time < '%s'`,
+		measurement, devID, from.Format(time.RFC3339Nano), to.Format(time.RFC3339Nano))
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	it, err := c.Client.Query(ctx, sql)
+	if err != nil {
+		return 0, time.Time{}, time.Time{}, err
+	}
+
+	var count int64
+	var first, last time.Time
+	for it.Next() {
+		row := it.Value()
+		count = rowInt(row["received"])
+		first, _ = rowTime(row["first"])
+		last, _ = rowTime(row["last"])
+	}
+	if err := it.Err(); err != nil {
+		return 0, time.Time{}, time.Time{}, err
+	}
+	return count, first, last, nil
+}
+
+// FindGaps 获取[from, to)内相邻数据点间隔超过threshold的区间（按时间升序，最多limit个）
+func (c *InfluxDBClient) FindGaps(measurement, devID string, from, to time.Time, threshold time.Duration, limit int) ([][2]time.Time, error) {
+	sql := fmt.Sprintf(`SELECT prev_time, time FROM (
+			SELECT time, LAG(time) OVER (ORDER BY time) AS prev_time
+			FROM (SELECT DISTINCT time FROM "%s" WHERE dev_id = '%s' AND time >= '%s' AND time < '%s')
+		) WHERE prev_time IS NOT NULL AND CAST(time AS BIGINT) - CAST(prev_time AS BIGINT) > %d
+		ORDER BY time LIMIT %d`,
+		measurement, devID, from.Format(time.RFC3339Nano), to.Format(time.RFC3339Nano), threshold.Nanoseconds(), limit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	it, err := c.Client.Query(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+
+	var gaps [][2]time.Time
+	for it.Next() {
+		row := it.Value()
+		start, ok1 := rowTime(row["prev_time"])
+		end, ok2 := rowTime(row["time"])
+		if ok1 && ok2 {
+			gaps = append(gaps, [2]time.Time{start, end})
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return gaps, nil
+}
+
+// rowInt 查询结果中的整数列
+func rowInt(v interface{}) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case uint64:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
@@ -0,0 +1,198 @@
+package influxdb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/internal/model"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+// ioxColumnTypeKey InfluxDB 3返回的Arrow列元数据（tag/field/timestamp），写入Parquet时一并保存
+const ioxColumnTypeKey = "iox::column::type"
+
+// ExportParquet 将[from, to)内某设备的原始数据按时间顺序写为Parquet，返回写入的行数
+func (c *InfluxDBClient) ExportParquet(ctx context.Context, measurement, devID string, from, to time.Time, w io.Writer) (int64, error) {
+	sql := fmt.Sprintf(`SELECT * FROM "%s" WHERE dev_id = '%s' AND time >= '%s' AND time < '%s' ORDER BY time`,
+		measurement, devID, from.Format(time.RFC3339Nano), to.Format(time.RFC3339Nano))
+	it, err := c.Client.Query(ctx, sql)
+	if err != nil {
+		return 0, err
+	}
+	reader := it.Raw()
+	defer reader.Release()
+
+	props := parquet.NewWriterProperties(parquet.WithCompression(compress.Codecs.Snappy))
+	writer, err := pqarrow.NewFileWriter(reader.Schema(), w, props, pqarrow.NewArrowWriterProperties(pqarrow.WithStoreSchema()))
+	if err != nil {
+		return 0, err
+	}
+
+	var rows int64
+	for reader.Next() {
+		record := reader.Record()
+		if err := writer.WriteBuffered(record); err != nil {
+			writer.Close()
+			return 0, err
+		}
+		rows += record.NumRows()
+	}
+	if err := reader.Err(); err != nil && err != io.EOF {
+		writer.Close()
+		return 0, err
+	}
+	if err := writer.Close(); err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+// ListDeviceIDs 获取[from, to)内有数据的设备
+func (c *InfluxDBClient) ListDeviceIDs(measurement string, from, to time.Time) ([]string, error) {
+	sql := fmt.Sprintf(`SELECT DISTINCT dev_id FROM "%s" WHERE time >= '%s' AND time < '%s'`,
+		measurement, from.Format(time.RFC3339Nano), to.Format(time.RFC3339Nano))
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	it, err := c.Client.Query(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+
+	var devIDs []string
+	for it.Next() {
+		if devID, ok := it.Value()["dev_id"].(string); ok && devID != "" {
+			devIDs = append(devIDs, devID)
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return devIDs, nil
+}
+
+// EarliestTime 获取measurement最早的数据时间，没有数据时返回false
+func (c *InfluxDBClient) EarliestTime(measurement string) (time.Time, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	it, err := c.Client.Query(ctx, fmt.Sprintf(`SELECT MIN(time) AS earliest FROM "%s"`, measurement))
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	var earliest time.Time
+	found := false
+	for it.Next() {
+		earliest, found = rowTime(it.Value()["earliest"])
+	}
+	if err := it.Err(); err != nil {
+		return time.Time{}, false, err
+	}
+	return earliest, found, nil
+}
+
+// ReadParquetPoints 读取ExportParquet写入的Parquet文件，转换为与Query一致的数据点（时间戳为Unix秒）
+func ReadParquetPoints(ctx context.Context, r parquet.ReaderAtSeeker, measurement string) ([]model.Point, error) {
+	pf, err := file.NewParquetReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer pf.Close()
+
+	fr, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{BatchSize: 64 * 1024}, memory.DefaultAllocator)
+	if err != nil {
+		return nil, err
+	}
+	rr, err := fr.GetRecordReader(ctx, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer rr.Release()
+
+	var points []model.Point
+	for rr.Next() {
+		record := rr.Record()
+		schema := record.Schema()
+		for row := 0; row < int(record.NumRows()); row++ {
+			p := model.Point{
+				Measurement: measurement,
+				Tags:        make(map[string]string),
+				Fields:      make(map[string]interface{}),
+			}
+			for i, field := range schema.Fields() {
+				col := record.Column(i)
+				if col.IsNull(row) {
+					continue
+				}
+				switch parquetColumnKind(field) {
+				case "timestamp":
+					if ts, ok := col.(*array.Timestamp); ok {
+						unit := field.Type.(*arrow.TimestampType).Unit
+						p.Timestamp = ts.Value(row).ToTime(unit).Unix()
+					}
+				case "tag":
+					p.Tags[field.Name] = col.ValueStr(row)
+				default:
+					p.Fields[field.Name] = arrowValue(col, row)
+				}
+			}
+			points = append(points, p)
+		}
+	}
+	if err := rr.Err(); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return points, nil
+}
+
+// parquetColumnKind 根据InfluxDB列元数据判断列类型；元数据缺失时time列为时间、字符串列为tag
+func parquetColumnKind(field arrow.Field) string {
+	if columnType, ok := field.Metadata.GetValue(ioxColumnTypeKey); ok {
+		switch {
+		case strings.HasSuffix(columnType, "::timestamp"):
+			return "timestamp"
+		case strings.HasSuffix(columnType, "::tag"):
+			return "tag"
+		}
+		return "field"
+	}
+	if field.Name == "time" && field.Type.ID() == arrow.TIMESTAMP {
+		return "timestamp"
+	}
+	if field.Type.ID() == arrow.STRING || field.Type.ID() == arrow.DICTIONARY {
+		return "tag"
+	}
+	return "field"
+}
+
+// arrowValue 读取字段值（与QueryPointValue返回的类型一致）
+func arrowValue(col arrow.Array, row int) interface{} {
+	switch a := col.(type) {
+	case *array.Float64:
+		return a.Value(row)
+	case *array.Int64:
+		return a.Value(row)
+	case *array.Uint64:
+		return a.Value(row)
+	case *array.Boolean:
+		return a.Value(row)
+	case *array.String:
+		return a.Value(row)
+	}
+	s := col.ValueStr(row)
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return s
+}
@@ -0,0 +1,233 @@
+package influxdb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/internal/model"
+
+	"github.com/apache/arrow-go/v18/arrow"
+)
+
+// rollupStats 每个字段生成的汇总字段后缀
+var rollupStats = []string{"min", "max", "mean", "count"}
+
+var (
+	rollupMu sync.RWMutex
+	// rollupStates 已启用汇总的measurement：汇总的字段与各粒度的覆盖范围（范围内的汇总数据完整）
+	rollupStates = make(map[string]*rollupState)
+)
+
+type rollupState struct {
+	fields map[string]bool
+	ranges map[string]rollupRange
+}
+
+// rollupRange 汇总数据完整的范围[start, watermark)
+type rollupRange struct {
+	start     time.Time
+	watermark time.Time
+}
+
+// RollupMeasurement 汇总结果的measurement名称，如 temperature_rollup_1m
+func RollupMeasurement(measurement, level string) string {
+	return measurement + "_rollup_" + level
+}
+
+// RegisterRollup 登记measurement的汇总字段，Query据此选择汇总数据
+func RegisterRollup(measurement string, fields []string) {
+	rollupMu.Lock()
+	defer rollupMu.Unlock()
+	state := &rollupState{fields: make(map[string]bool), ranges: make(map[string]rollupRange)}
+	if old, ok := rollupStates[measurement]; ok {
+		state.ranges = old.ranges
+	}
+	for _, f := range fields {
+		state.fields[f] = true
+	}
+	rollupStates[measurement] = state
+}
+
+// SetRollupWatermark 更新汇总覆盖起点与水位线（覆盖起点只会向前扩展）
+func SetRollupWatermark(measurement, level string, coverageStart, watermark time.Time) {
+	rollupMu.Lock()
+	defer rollupMu.Unlock()
+	if state, ok := rollupStates[measurement]; ok {
+		if old, ok := state.ranges[level]; ok && old.start.Before(coverageStart) {
+			coverageStart = old.start
+		}
+		state.ranges[level] = rollupRange{start: coverageStart, watermark: watermark}
+	}
+}
+
+// TrimRollupCoverage 将所有汇总的覆盖起点推后到since（数据库保留期删除了更早的汇总数据）
+func TrimRollupCoverage(since time.Time) {
+	rollupMu.Lock()
+	defer rollupMu.Unlock()
+	for _, state := range rollupStates {
+		for level, r := range state.ranges {
+			if r.start.Before(since) {
+				r.start = since
+				state.ranges[level] = r
+			}
+		}
+	}
+}
+
+// chooseRollup 选择满足查询分辨率的最粗汇总粒度：
+// 下采样间隔是粒度的整数倍、查询范围在覆盖起点与水位线之内，且只按dev_id过滤value字段
+func chooseRollup(opts QueryOptions) (model.RollupLevel, bool) {
+	if opts.DownsampleEvery <= 0 || opts.Aggregate == "" {
+		return model.RollupLevel{}, false
+	}
+	if _, ok := rollupAggregateExpr(opts.Aggregate); !ok {
+		return model.RollupLevel{}, false
+	}
+	for k := range opts.Tags {
+		if k != "dev_id" {
+			return model.RollupLevel{}, false
+		}
+	}
+
+	rollupMu.RLock()
+	defer rollupMu.RUnlock()
+	state, ok := rollupStates[opts.Measurement]
+	if !ok || !state.fields["value"] {
+		return model.RollupLevel{}, false
+	}
+	for i := len(model.RollupLevels) - 1; i >= 0; i-- {
+		level := model.RollupLevels[i]
+		// 下采样窗口不是汇总窗口的整数倍时，汇总窗口会跨越下采样边界
+		if level.Every > opts.DownsampleEvery || opts.DownsampleEvery%level.Every != 0 {
+			continue
+		}
+		r, ok := state.ranges[level.Name]
+		if ok && !opts.TimeRange.Start.Before(r.start) && !opts.TimeRange.End.After(r.watermark) {
+			return level, true
+		}
+	}
+	return model.RollupLevel{}, false
+}
+
+// rollupAggregateExpr 在汇总数据上计算聚合的表达式（均值按count加权）
+func rollupAggregateExpr(aggregate string) (string, bool) {
+	switch strings.ToLower(aggregate) {
+	case "mean", "avg":
+		return "SUM(value_mean * value_count) / SUM(value_count)", true
+	case "max":
+		return "MAX(value_max)", true
+	case "min":
+		return "MIN(value_min)", true
+	case "count":
+		return "SUM(value_count)", true
+	case "sum":
+		return "SUM(value_mean * value_count)", true
+	}
+	return "", false
+}
+
+// buildRollupQuerySQL 基于汇总数据构建下采样查询（输出列与原始数据的下采样查询一致）
+func buildRollupQuerySQL(opts QueryOptions, level model.RollupLevel) string {
+	expr, _ := rollupAggregateExpr(opts.Aggregate)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("SELECT time_bucket('%s', time) AS bucket, %s AS value", opts.DownsampleEvery.String(), expr))
+	sb.WriteString(" FROM ")
+	sb.WriteString(`"` + RollupMeasurement(opts.Measurement, level.Name) + `"`)
+
+	conds := []string{
+		fmt.Sprintf("time >= '%s'", opts.TimeRange.Start.Format(time.RFC3339Nano)),
+		fmt.Sprintf("time <= '%s'", opts.TimeRange.End.Format(time.RFC3339Nano)),
+	}
+	for k, v := range opts.Tags {
+		conds = append(conds, fmt.Sprintf(`%s = '%s'`, k, v))
+	}
+	sb.WriteString(" WHERE ")
+	sb.WriteString(strings.Join(conds, " AND "))
+	sb.WriteString(" GROUP BY bucket ORDER BY bucket")
+	if opts.LimitPoints > 0 {
+		sb.WriteString(fmt.Sprintf(" LIMIT %d", opts.LimitPoints))
+	}
+	return sb.String()
+}
+
+// ComputeRollup 计算[from, to)内按dev_id分组的汇总数据点
+// source为空时从原始measurement计算，否则从更细一级的汇总结果计算
+func (c *InfluxDBClient) ComputeRollup(measurement string, fields []string, source string, level model.RollupLevel, from, to time.Time) ([]model.Point, error) {
+	var selects []string
+	table := measurement
+	for _, f := range fields {
+		if source == "" {
+			selects = append(selects,
+				fmt.Sprintf(`MIN("%s") AS "%s_min"`, f, f),
+				fmt.Sprintf(`MAX("%s") AS "%s_max"`, f, f),
+				fmt.Sprintf(`AVG("%s") AS "%s_mean"`, f, f),
+				fmt.Sprintf(`COUNT("%s") AS "%s_count"`, f, f))
+		} else {
+			table = RollupMeasurement(measurement, source)
+			selects = append(selects,
+				fmt.Sprintf(`MIN("%s_min") AS "%s_min"`, f, f),
+				fmt.Sprintf(`MAX("%s_max") AS "%s_max"`, f, f),
+				fmt.Sprintf(`SUM("%s_mean" * "%s_count") / SUM("%s_count") AS "%s_mean"`, f, f, f, f),
+				fmt.Sprintf(`SUM("%s_count") AS "%s_count"`, f, f))
+		}
+	}
+	sql := fmt.Sprintf(`SELECT date_bin(INTERVAL '%d seconds', time) AS bucket, dev_id, %s FROM "%s"
+		WHERE time >= '%s' AND time < '%s' GROUP BY bucket, dev_id ORDER BY bucket`,
+		int64(level.Every/time.Second), strings.Join(selects, ", "), table,
+		from.Format(time.RFC3339Nano), to.Format(time.RFC3339Nano))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	it, err := c.Client.Query(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+
+	rollupName := RollupMeasurement(measurement, level.Name)
+	var points []model.Point
+	for it.Next() {
+		row := it.Value()
+		bucket, ok := rowTime(row["bucket"])
+		if !ok {
+			continue
+		}
+		devID, _ := row["dev_id"].(string)
+		fieldValues := make(map[string]interface{})
+		for _, f := range fields {
+			for _, stat := range rollupStats {
+				name := f + "_" + stat
+				if v, ok := row[name]; ok && v != nil {
+					fieldValues[name] = v
+				}
+			}
+		}
+		if len(fieldValues) == 0 {
+			continue
+		}
+		points = append(points, model.Point{
+			Measurement: rollupName,
+			Tags:        map[string]string{"dev_id": devID},
+			Fields:      fieldValues,
+			Timestamp:   bucket.Unix(),
+		})
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return points, nil
+}
+
+// rowTime 解析查询结果中的时间列
+func rowTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case arrow.Timestamp:
+		return t.ToTime(arrow.Nanosecond), true
+	}
+	return time.Time{}, false
+}
@@ -4,13 +4,18 @@ import (
 	"backend/config"
 	"backend/pkg/logger"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/notification"
 )
 
 var MinIOCli *MinIOClient
@@ -65,12 +70,18 @@ func InitMinIOClient(cfg config.MinIOConfig) (*minio.Client, error) {
 	return client, nil
 }
 
+var (
+	// FileBuckets 设备文件所在的bucket（以metadata表为目录，按文件类型选择，其他类型使用file）
+	FileBuckets = []string{"image", "video", "audio", "file"}
+	// Buckets 启动时确保存在的bucket：设备文件bucket，以及固件与打包/归档bucket（不由metadata表记录）
+	Buckets = append(append([]string{}, FileBuckets...), "firmware", "archive")
+)
+
 // initBuckets 初始化MinIO bucket（确保bucket存在）
 func initBuckets(client *minio.Client) error {
 	ctx := context.Background()
-	buckets := []string{"image", "video", "audio"}
 
-	for _, bucketName := range buckets {
+	for _, bucketName := range Buckets {
 		exists, err := client.BucketExists(ctx, bucketName)
 		if err != nil {
 			return fmt.Errorf("检查bucket %s 失败: %v", bucketName, err)
@@ -158,6 +169,33 @@ func (c *MinIOClient) PutObjectFromReader(bucketName, objectName string, reader
 	return nil
 }
 
+// PutObjectStream 上传长度未知的流（按partSize分片上传，限制内存占用）
+func (c *MinIOClient) PutObjectStream(bucketName, objectName string, reader io.Reader, contentType string, partSize uint64) (int64, error) {
+	ctx := context.Background()
+
+	// 检查bucket是否存在
+	exists, err := c.Client.BucketExists(ctx, bucketName)
+	if err != nil {
+		return 0, fmt.Errorf("检查bucket失败: %v", err)
+	}
+	if !exists {
+		err = c.CreateBucket(bucketName)
+		if err != nil {
+			return 0, fmt.Errorf("Bucket %s 不存在,创建bucket失败: %v", bucketName, err)
+		}
+	}
+
+	info, err := c.Client.PutObject(ctx, bucketName, objectName, reader, -1, minio.PutObjectOptions{
+		ContentType: contentType,
+		PartSize:    partSize,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("上传文件失败: %v", err)
+	}
+
+	return info.Size, nil
+}
+
 // DownloadFile 从MinIO下载文件到本地
 func (c *MinIOClient) DownloadFile(bucketName, objectName, filePath string) (string, error) {
 	ctx := context.Background()
@@ -174,6 +212,18 @@ func (c *MinIOClient) DownloadFile(bucketName, objectName, filePath string) (str
 	return presignedURL.String(), nil
 }
 
+// PresignedGetObject 生成预签名GET URL（不强制浏览器下载）
+func (c *MinIOClient) PresignedGetObject(bucketName, objectName string, expiry time.Duration) (string, error) {
+	ctx := context.Background()
+
+	presignedURL, err := c.Client.PresignedGetObject(ctx, bucketName, objectName, expiry, nil)
+	if err != nil {
+		return "", fmt.Errorf("生成预签名GET URL失败: %v", err)
+	}
+
+	return presignedURL.String(), nil
+}
+
 // GetObjectAsReader 从MinIO获取文件作为Reader
 func (c *MinIOClient) GetObjectAsReader(bucketName, objectName string) (*minio.Object, error) {
 	ctx := context.Background()
@@ -198,13 +248,22 @@ func (c *MinIOClient) DeleteObject(bucketName, objectName string) error {
 	return nil
 }
 
+// IsNotFound 判断错误是否为对象不存在
+func IsNotFound(err error) bool {
+	var resp minio.ErrorResponse
+	if errors.As(err, &resp) {
+		return resp.Code == "NoSuchKey" || resp.StatusCode == http.StatusNotFound
+	}
+	return false
+}
+
 // GetObjectInfo 获取文件信息
 func (c *MinIOClient) GetObjectInfo(bucketName, objectName string) (minio.ObjectInfo, error) {
 	ctx := context.Background()
 
 	info, err := c.Client.StatObject(ctx, bucketName, objectName, minio.StatObjectOptions{})
 	if err != nil {
-		return info, fmt.Errorf("获取文件信息失败: %v", err)
+		return info, fmt.Errorf("获取文件信息失败: %w", err)
 	}
 
 	return info, nil
@@ -219,6 +278,22 @@ func (c *MinIOClient) ListObjects(bucketName string, prefix string, recursive bo
 	})
 }
 
+// ListObjectsAfter 按字典序列出前缀下 startAfter 之后的文件（调用方取消ctx即可提前结束列举）
+func (c *MinIOClient) ListObjectsAfter(ctx context.Context, bucketName, prefix, startAfter string) <-chan minio.ObjectInfo {
+	return c.Client.ListObjects(ctx, bucketName, minio.ListObjectsOptions{
+		Prefix:     prefix,
+		StartAfter: startAfter,
+		Recursive:  true,
+	})
+}
+
+// ListenObjectCreated 订阅bucket的对象创建事件（MinIO扩展API，ctx取消后通道关闭）
+func (c *MinIOClient) ListenObjectCreated(ctx context.Context, bucketName string) <-chan notification.Info {
+	return c.Client.ListenBucketNotification(ctx, bucketName, "", "", []string{
+		string(notification.ObjectCreatedAll),
+	})
+}
+
 // CreateBucket 创建bucket
 func (c *MinIOClient) CreateBucket(bucketName string) error {
 	ctx := context.Background()
@@ -256,3 +331,93 @@ func (c *MinIOClient) PresignedPutObject(bucketName, objectName string, expiry t
 
 	return presignedURL.String(), nil
 }
+
+// NewMultipartUpload 初始化分片上传，返回MinIO的uploadId
+func (c *MinIOClient) NewMultipartUpload(bucketName, objectName, contentType string) (string, error) {
+	ctx := context.Background()
+
+	// 确保bucket存在
+	exists, err := c.Client.BucketExists(ctx, bucketName)
+	if err != nil {
+		return "", fmt.Errorf("检查bucket失败: %v", err)
+	}
+	if !exists {
+		err = c.CreateBucket(bucketName)
+		if err != nil {
+			return "", fmt.Errorf("Bucket %s 不存在,创建bucket失败: %v", bucketName, err)
+		}
+	}
+
+	core := minio.Core{Client: c.Client}
+	uploadID, err := core.NewMultipartUpload(ctx, bucketName, objectName, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	if err != nil {
+		return "", fmt.Errorf("初始化分片上传失败: %v", err)
+	}
+	return uploadID, nil
+}
+
+// PresignedUploadPart 生成单个分片的预签名PUT URL
+func (c *MinIOClient) PresignedUploadPart(bucketName, objectName, uploadID string, partNumber int, expiry time.Duration) (string, error) {
+	params := url.Values{}
+	params.Set("uploadId", uploadID)
+	params.Set("partNumber", strconv.Itoa(partNumber))
+
+	presignedURL, err := c.Client.Presign(context.Background(), http.MethodPut, bucketName, objectName, expiry, params)
+	if err != nil {
+		return "", fmt.Errorf("生成分片预签名URL失败: %v", err)
+	}
+	return presignedURL.String(), nil
+}
+
+// ListObjectParts 列出分片上传中已上传的全部分片
+func (c *MinIOClient) ListObjectParts(bucketName, objectName, uploadID string) ([]minio.ObjectPart, error) {
+	ctx := context.Background()
+	core := minio.Core{Client: c.Client}
+
+	parts := make([]minio.ObjectPart, 0)
+	marker := 0
+	for {
+		result, err := core.ListObjectParts(ctx, bucketName, objectName, uploadID, marker, 1000)
+		if err != nil {
+			return nil, fmt.Errorf("列出已上传分片失败: %v", err)
+		}
+		parts = append(parts, result.ObjectParts...)
+		if !result.IsTruncated {
+			return parts, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
+
+// CompleteMultipartUpload 合并分片完成上传（etags: 分片号 -> ETag）
+func (c *MinIOClient) CompleteMultipartUpload(bucketName, objectName, uploadID string, etags map[int]string) error {
+	parts := make([]minio.CompletePart, 0, len(etags))
+	for partNumber, etag := range etags {
+		parts = append(parts, minio.CompletePart{PartNumber: partNumber, ETag: etag})
+	}
+	// 分片需按分片号升序提交
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+
+	core := minio.Core{Client: c.Client}
+	_, err := core.CompleteMultipartUpload(context.Background(), bucketName, objectName, uploadID, parts, minio.PutObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("完成分片上传失败: %v", err)
+	}
+	return nil
+}
+
+// AbortMultipartUpload 取消分片上传并清理已上传的分片
+func (c *MinIOClient) AbortMultipartUpload(bucketName, objectName, uploadID string) error {
+	core := minio.Core{Client: c.Client}
+	if err := core.AbortMultipartUpload(context.Background(), bucketName, objectName, uploadID); err != nil {
+		return fmt.Errorf("取消分片上传失败: %v", err)
+	}
+	return nil
+}
+
+// ListIncompleteUploads 列出bucket中未完成的分片上传
+func (c *MinIOClient) ListIncompleteUploads(ctx context.Context, bucketName string) <-chan minio.ObjectMultipartInfo {
+	return c.Client.ListIncompleteUploads(ctx, bucketName, "", true)
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"backend/internal/service"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AnomalyHandler struct {
+	anomalyService *service.AnomalyService
+}
+
+func NewAnomalyHandler() *AnomalyHandler {
+	return &AnomalyHandler{
+		anomalyService: service.NewAnomalyService(),
+	}
+}
+
+// GetBaselines 获取设备的异常检测基线（dev_id必填，measurement可选）
+func (h *AnomalyHandler) GetBaselines(c *gin.Context) {
+	devID, err := utils.ConvertToInt64(c.Query("dev_id"))
+	if err != nil || devID == 0 {
+		Error(c, CodeBadRequest, "dev_id无效")
+		return
+	}
+
+	baselines, err := h.anomalyService.GetBaselines(devID, c.Query("measurement"))
+	if err != nil {
+		logger.L().Error("获取异常检测基线失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "获取异常检测基线成功", baselines)
+}
+
+// ResetBaselines 删除设备的异常检测基线并重新学习（如更换传感器后）
+func (h *AnomalyHandler) ResetBaselines(c *gin.Context) {
+	devID, err := utils.ConvertToInt64(c.Query("dev_id"))
+	if err != nil || devID == 0 {
+		Error(c, CodeBadRequest, "dev_id无效")
+		return
+	}
+
+	deleted, err := h.anomalyService.ResetBaselines(devID, c.Query("measurement"))
+	if err != nil {
+		logger.L().Error("重置异常检测基线失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "重置异常检测基线成功", gin.H{"deleted": deleted})
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"backend/internal/middleware"
+	"backend/internal/model"
+	"backend/internal/service"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CalibrationHandler struct {
+	calibrationService *service.CalibrationService
+}
+
+func NewCalibrationHandler() *CalibrationHandler {
+	return &CalibrationHandler{
+		calibrationService: service.NewCalibrationService(),
+	}
+}
+
+// GetProfiles 获取设备的校准配置，支持按measurement、field筛选
+func (h *CalibrationHandler) GetProfiles(c *gin.Context) {
+	devID, err := model.StringToID(c.Param("dev_id"))
+	if err != nil {
+		Error(c, CodeBadRequest, "无效的设备ID")
+		return
+	}
+
+	profiles, err := h.calibrationService.GetProfiles(devID.Int64(), c.Query("measurement"), c.Query("field"))
+	if err != nil {
+		logger.L().Error("获取校准配置失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "获取校准配置成功", profiles)
+}
+
+// CreateProfile 创建校准配置
+func (h *CalibrationHandler) CreateProfile(c *gin.Context) {
+	devID, err := model.StringToID(c.Param("dev_id"))
+	if err != nil {
+		Error(c, CodeBadRequest, "无效的设备ID")
+		return
+	}
+	var req model.CreateCalibrationProfileReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	currentUID, _ := middleware.GetCurrentUserID(c)
+
+	profile, err := h.calibrationService.CreateProfile(devID.Int64(), &req, currentUID)
+	if err != nil {
+		logger.L().Error("创建校准配置失败", logger.WithError(err))
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	SuccessWithCode(c, 201, "创建校准配置成功", profile)
+}
+
+// UpdateProfile 修正校准配置，recompute为true时异步重新计算历史数据
+func (h *CalibrationHandler) UpdateProfile(c *gin.Context) {
+	devID, err := model.StringToID(c.Param("dev_id"))
+	if err != nil {
+		Error(c, CodeBadRequest, "无效的设备ID")
+		return
+	}
+	var req model.UpdateCalibrationProfileReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	profile, err := h.calibrationService.UpdateProfile(devID.Int64(), &req)
+	if err != nil {
+		logger.L().Error("更新校准配置失败", logger.WithError(err))
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	if req.Recompute {
+		SuccessWithCode(c, 202, "更新校准配置成功，已开始重新计算历史数据", profile)
+		return
+	}
+	Success(c, "更新校准配置成功", profile)
+}
+
+// DeleteProfile 删除校准配置
+func (h *CalibrationHandler) DeleteProfile(c *gin.Context) {
+	devID, err := model.StringToID(c.Param("dev_id"))
+	if err != nil {
+		Error(c, CodeBadRequest, "无效的设备ID")
+		return
+	}
+	profileID, err := utils.ConvertToInt64(c.Query("profile_id"))
+	if err != nil || profileID == 0 {
+		Error(c, CodeBadRequest, "无效的校准配置ID")
+		return
+	}
+
+	if err := h.calibrationService.DeleteProfile(devID.Int64(), profileID); err != nil {
+		logger.L().Error("删除校准配置失败", logger.WithError(err))
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	Success(c, "删除校准配置成功", nil)
+}
+
+// Recompute 按当前校准系数重新计算历史数据（异步执行）
+func (h *CalibrationHandler) Recompute(c *gin.Context) {
+	devID, err := model.StringToID(c.Param("dev_id"))
+	if err != nil {
+		Error(c, CodeBadRequest, "无效的设备ID")
+		return
+	}
+	var req model.RecomputeCalibrationReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	if err := h.calibrationService.Recompute(devID.Int64(), req.ProfileID); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	SuccessWithCode(c, 202, "已开始重新计算历史数据", nil)
+}
@@ -51,4 +51,14 @@ func Error(c *gin.Context, code int, message string) {
 		Data: nil,
 	})
 	c.Abort()
+}
+
+// ErrorWithData 错误响应（附带错误详情）
+func ErrorWithData(c *gin.Context, code int, message string, data interface{}) {
+	c.JSON(code, CommonResponse{
+		Code: code,
+		Message: message,
+		Data: data,
+	})
+	c.Abort()
 }
\ No newline at end of file
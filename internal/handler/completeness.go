@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"backend/internal/model"
+	"backend/internal/service"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CompletenessHandler struct {
+	completenessService *service.CompletenessService
+}
+
+func NewCompletenessHandler() *CompletenessHandler {
+	return &CompletenessHandler{
+		completenessService: service.NewCompletenessService(),
+	}
+}
+
+// GetReport 获取数据完整性报告
+// dev_id、dev_type、measurement可选；start_time/end_time为Unix秒，默认最近24小时；
+// below只返回完整性低于该百分比的记录；format=csv时返回CSV文件
+func (h *CompletenessHandler) GetReport(c *gin.Context) {
+	query := &model.CompletenessQuery{
+		DevType:     c.Query("dev_type"),
+		Measurement: c.Query("measurement"),
+	}
+	if v := c.Query("dev_id"); v != "" {
+		devID, err := utils.ConvertToInt64(v)
+		if err != nil || devID == 0 {
+			Error(c, CodeBadRequest, "dev_id无效")
+			return
+		}
+		query.DevID = devID
+	}
+
+	query.EndTime = utils.GetCurrentTime()
+	if v := c.Query("end_time"); v != "" {
+		endTime, err := utils.ConvertToInt64(v)
+		if err != nil || endTime <= 0 {
+			Error(c, CodeBadRequest, "end_time无效")
+			return
+		}
+		query.EndTime = time.Unix(endTime, 0)
+	}
+	query.StartTime = query.EndTime.Add(-model.DefaultCompletenessWindow)
+	if v := c.Query("start_time"); v != "" {
+		startTime, err := utils.ConvertToInt64(v)
+		if err != nil || startTime <= 0 {
+			Error(c, CodeBadRequest, "start_time无效")
+			return
+		}
+		query.StartTime = time.Unix(startTime, 0)
+	}
+	if !query.EndTime.After(query.StartTime) {
+		Error(c, CodeBadRequest, "结束时间必须晚于开始时间")
+		return
+	}
+	if query.EndTime.Sub(query.StartTime) > model.MaxCompletenessRangeDays*24*time.Hour {
+		Error(c, CodeBadRequest, fmt.Sprintf("时间范围不能超过%d天", model.MaxCompletenessRangeDays))
+		return
+	}
+
+	if v := c.Query("below"); v != "" {
+		below, err := strconv.ParseFloat(v, 64)
+		if err != nil || below <= 0 || below > 100 {
+			Error(c, CodeBadRequest, "below应为0~100之间的百分比")
+			return
+		}
+		query.Below = below
+	}
+
+	report, err := h.completenessService.GetReport(query)
+	if err != nil {
+		logger.L().Error("生成数据完整性报告失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	if c.Query("format") == "csv" {
+		data, err := service.CompletenessCSV(report)
+		if err != nil {
+			logger.L().Error("导出数据完整性报告失败", logger.WithError(err))
+			Error(c, CodeInternalServerError, err.Error())
+			return
+		}
+		filename := fmt.Sprintf("completeness-%s-%s.csv", query.StartTime.Format("20060102150405"), query.EndTime.Format("20060102150405"))
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+		c.Data(200, "text/csv; charset=utf-8", data)
+		return
+	}
+
+	Success(c, "获取数据完整性报告成功", report)
+}
+
+// GetDailyReport 获取每日数据完整性报告CSV的下载地址（date为YYYY-MM-DD，默认昨天）
+func (h *CompletenessHandler) GetDailyReport(c *gin.Context) {
+	date := c.Query("date")
+	if date == "" {
+		date = utils.GetCurrentTime().AddDate(0, 0, -1).Format("2006-01-02")
+	}
+
+	url, err := h.completenessService.GetDailyReportURL(date)
+	if err != nil {
+		logger.L().Error("获取每日数据完整性报告失败", logger.WithError(err))
+		Error(c, CodeNotFound, err.Error())
+		return
+	}
+
+	Success(c, "获取每日数据完整性报告成功", gin.H{"date": date, "url": url})
+}
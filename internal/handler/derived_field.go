@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"errors"
+
+	"backend/internal/middleware"
+	"backend/internal/model"
+	"backend/internal/service"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DerivedFieldHandler struct {
+	derivedService *service.DerivedFieldService
+}
+
+func NewDerivedFieldHandler() *DerivedFieldHandler {
+	return &DerivedFieldHandler{
+		derivedService: service.NewDerivedFieldService(),
+	}
+}
+
+// CreateField 创建派生字段
+func (h *DerivedFieldHandler) CreateField(c *gin.Context) {
+	var req model.CreateDerivedFieldReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	currentUID, _ := middleware.GetCurrentUserID(c)
+	role, _ := middleware.GetCurrentUserRole(c)
+
+	field, err := h.derivedService.CreateField(&req, currentUID, role)
+	if err != nil {
+		logger.L().Error("创建派生字段失败", logger.WithError(err))
+		derivedFieldError(c, err)
+		return
+	}
+
+	SuccessWithCode(c, 201, "创建派生字段成功", field)
+}
+
+// GetFields 获取派生字段，支持按dev_type、measurement筛选
+func (h *DerivedFieldHandler) GetFields(c *gin.Context) {
+	currentUID, _ := middleware.GetCurrentUserID(c)
+	role, _ := middleware.GetCurrentUserRole(c)
+
+	fields, err := h.derivedService.GetFields(c.Query("dev_type"), c.Query("measurement"), currentUID, role)
+	if err != nil {
+		logger.L().Error("获取派生字段失败", logger.WithError(err))
+		derivedFieldError(c, err)
+		return
+	}
+
+	Success(c, "获取派生字段成功", fields)
+}
+
+// UpdateField 更新派生字段
+func (h *DerivedFieldHandler) UpdateField(c *gin.Context) {
+	var req model.UpdateDerivedFieldReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	currentUID, _ := middleware.GetCurrentUserID(c)
+	role, _ := middleware.GetCurrentUserRole(c)
+
+	field, err := h.derivedService.UpdateField(&req, currentUID, role)
+	if err != nil {
+		logger.L().Error("更新派生字段失败", logger.WithError(err))
+		derivedFieldError(c, err)
+		return
+	}
+
+	Success(c, "更新派生字段成功", field)
+}
+
+// DeleteField 删除派生字段
+func (h *DerivedFieldHandler) DeleteField(c *gin.Context) {
+	fieldID, err := utils.ConvertToInt64(c.Query("field_id"))
+	if err != nil || fieldID == 0 {
+		Error(c, CodeBadRequest, "无效的派生字段ID")
+		return
+	}
+
+	currentUID, _ := middleware.GetCurrentUserID(c)
+	role, _ := middleware.GetCurrentUserRole(c)
+
+	if err := h.derivedService.DeleteField(fieldID, currentUID, role); err != nil {
+		logger.L().Error("删除派生字段失败", logger.WithError(err))
+		derivedFieldError(c, err)
+		return
+	}
+
+	Success(c, "删除派生字段成功", nil)
+}
+
+// EvaluateField 试算表达式（不保存），用于定义派生字段前检查表达式
+func (h *DerivedFieldHandler) EvaluateField(c *gin.Context) {
+	var req model.EvaluateDerivedFieldReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	result, err := h.derivedService.Evaluate(&req)
+	if err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	Success(c, "试算表达式成功", result)
+}
+
+// derivedFieldError 权限错误返回403
+func derivedFieldError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrDerivedFieldForbidden) {
+		Error(c, CodeForbidden, err.Error())
+		return
+	}
+	Error(c, CodeInternalServerError, err.Error())
+}
@@ -172,3 +172,46 @@ func (h *DeviceHandler) GetDeviceStatistics(c *gin.Context) {
 
 	Success(c, "获取设备统计信息成功", stats)
 }
+
+// IssueDeviceToken 签发设备凭证（设备端接口使用）
+func (h *DeviceHandler) IssueDeviceToken(c *gin.Context) {
+	devID, err := model.StringToID(c.Query("dev_id"))
+	if err != nil {
+		Error(c, CodeBadRequest, "无效的设备ID")
+		return
+	}
+
+	// 获取当前用户信息
+	currentUID, _ := middleware.GetCurrentUserID(c)
+	role, _ := middleware.GetCurrentUserRole(c)
+
+	result, err := h.deviceService.IssueDeviceToken(devID.Int64(), currentUID, role)
+	if err != nil {
+		logger.L().Error("签发设备凭证失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "签发设备凭证成功", result)
+}
+
+// RevokeDeviceTokens 吊销设备已签发的全部设备凭证
+func (h *DeviceHandler) RevokeDeviceTokens(c *gin.Context) {
+	devID, err := model.StringToID(c.Query("dev_id"))
+	if err != nil {
+		Error(c, CodeBadRequest, "无效的设备ID")
+		return
+	}
+
+	// 获取当前用户信息
+	currentUID, _ := middleware.GetCurrentUserID(c)
+	role, _ := middleware.GetCurrentUserRole(c)
+
+	if err := h.deviceService.RevokeDeviceTokens(devID.Int64(), currentUID, role); err != nil {
+		logger.L().Error("吊销设备凭证失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "吊销设备凭证成功", nil)
+}
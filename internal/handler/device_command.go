@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"backend/internal/middleware"
+	"backend/internal/model"
+	"backend/internal/service"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DeviceCommandHandler struct {
+	commandService *service.DeviceCommandService
+}
+
+func NewDeviceCommandHandler() *DeviceCommandHandler {
+	return &DeviceCommandHandler{commandService: service.NewDeviceCommandService()}
+}
+
+// CreateCommand 下发设备命令
+func (h *DeviceCommandHandler) CreateCommand(c *gin.Context) {
+	var req model.CreateDeviceCommandReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	if req.DevID.IsZero() {
+		Error(c, CodeBadRequest, "dev_id不能为空")
+		return
+	}
+
+	currentUID, _ := middleware.GetCurrentUserID(c)
+	role, _ := middleware.GetCurrentUserRole(c)
+
+	cmd, err := h.commandService.CreateCommand(&req, currentUID, role)
+	if err != nil {
+		logger.L().Error("下发设备命令失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	SuccessWithCode(c, 201, "下发设备命令成功", cmd)
+}
+
+// GetCommands 查询设备命令历史
+func (h *DeviceCommandHandler) GetCommands(c *gin.Context) {
+	devID, err := model.StringToID(c.Query("dev_id"))
+	if err != nil {
+		Error(c, CodeBadRequest, "无效的设备ID")
+		return
+	}
+	status := c.Query("status")
+
+	pageInt, _ := utils.ConvertToInt64(c.Query("page"))
+	if pageInt <= 0 {
+		pageInt = 1
+	}
+	pageSizeInt, _ := utils.ConvertToInt64(c.Query("page_size"))
+	if pageSizeInt <= 0 {
+		pageSizeInt = 10
+	}
+
+	currentUID, _ := middleware.GetCurrentUserID(c)
+	role, _ := middleware.GetCurrentUserRole(c)
+
+	commands, total, err := h.commandService.GetCommands(devID.Int64(), status, int(pageInt), int(pageSizeInt), currentUID, role)
+	if err != nil {
+		logger.L().Error("查询设备命令历史失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	totalPages := (total + pageSizeInt - 1) / pageSizeInt
+	if totalPages == 0 {
+		totalPages = 1
+	}
+
+	Success(c, "查询设备命令历史成功", gin.H{
+		"items": commands,
+		"pagination": gin.H{
+			"page":        pageInt,
+			"page_size":   pageSizeInt,
+			"total":       total,
+			"total_pages": totalPages,
+		},
+	})
+}
+
+// PollCommands 设备拉取待执行命令（设备凭证认证）
+func (h *DeviceCommandHandler) PollCommands(c *gin.Context) {
+	devID, exists := middleware.GetCurrentDeviceID(c)
+	if !exists {
+		Error(c, CodeUnauthorized, "未认证")
+		return
+	}
+	limit, _ := utils.ConvertToInt64(c.Query("limit"))
+
+	commands, err := h.commandService.PollCommands(devID, int(limit))
+	if err != nil {
+		logger.L().Error("拉取设备命令失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "拉取设备命令成功", gin.H{"commands": commands})
+}
+
+// AckCommand 设备回执命令执行结果（设备凭证认证）
+func (h *DeviceCommandHandler) AckCommand(c *gin.Context) {
+	devID, exists := middleware.GetCurrentDeviceID(c)
+	if !exists {
+		Error(c, CodeUnauthorized, "未认证")
+		return
+	}
+
+	var req model.AckDeviceCommandReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	cmd, err := h.commandService.AckCommand(devID, &req)
+	if err != nil {
+		logger.L().Error("设备命令回执失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "设备命令回执成功", cmd)
+}
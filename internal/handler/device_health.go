@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"backend/internal/middleware"
+	"backend/internal/model"
+	"backend/internal/service"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DeviceHealthHandler struct {
+	healthService *service.DeviceHealthService
+}
+
+func NewDeviceHealthHandler() *DeviceHealthHandler {
+	return &DeviceHealthHandler{healthService: service.NewDeviceHealthService()}
+}
+
+// GetDeviceHealth 获取设备健康历史与趋势
+// start_time/end_time 为Unix秒，默认最近7天
+func (h *DeviceHealthHandler) GetDeviceHealth(c *gin.Context) {
+	devID, err := model.StringToID(c.Param("dev_id"))
+	if err != nil {
+		Error(c, CodeBadRequest, "无效的设备ID")
+		return
+	}
+	startTime, _ := utils.ConvertToInt64(c.Query("start_time"))
+	endTime, _ := utils.ConvertToInt64(c.Query("end_time"))
+
+	currentUID, _ := middleware.GetCurrentUserID(c)
+	role, _ := middleware.GetCurrentUserRole(c)
+
+	report, err := h.healthService.GetHealth(devID.Int64(), startTime, endTime, currentUID, role)
+	if err != nil {
+		logger.L().Error("获取设备健康历史失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "获取设备健康历史成功", report)
+}
+
+// Heartbeat 设备心跳（设备凭证认证），可携带健康指标
+func (h *DeviceHealthHandler) Heartbeat(c *gin.Context) {
+	devID, exists := middleware.GetCurrentDeviceID(c)
+	if !exists {
+		Error(c, CodeUnauthorized, "未认证")
+		return
+	}
+
+	var health model.DeviceHealth
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&health); err != nil {
+			Error(c, CodeBadRequest, err.Error())
+			return
+		}
+	}
+
+	if err := h.healthService.RecordHealth(devID, &health); err != nil {
+		logger.L().Error("设备心跳失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "设备心跳成功", gin.H{"server_time": utils.GetCurrentTime().Unix()})
+}
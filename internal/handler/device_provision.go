@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"errors"
+	"strings"
+
+	"backend/internal/middleware"
+	"backend/internal/model"
+	"backend/internal/service"
+	"backend/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DeviceProvisionHandler struct {
+	provisionService *service.DeviceProvisionService
+}
+
+func NewDeviceProvisionHandler() *DeviceProvisionHandler {
+	return &DeviceProvisionHandler{provisionService: service.NewDeviceProvisionService()}
+}
+
+// ProvisionDevices 批量预注册设备
+// 支持三种请求格式：JSON {"devices": [...]}、text/csv 请求体、multipart 表单中的 file 字段（CSV）
+func (h *DeviceProvisionHandler) ProvisionDevices(c *gin.Context) {
+	var items []model.ProvisionDeviceItem
+
+	contentType := c.ContentType()
+	switch {
+	case strings.HasPrefix(contentType, "multipart/form-data"):
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			Error(c, CodeBadRequest, "缺少CSV文件(file)")
+			return
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			Error(c, CodeBadRequest, "读取CSV文件失败")
+			return
+		}
+		defer file.Close()
+		items, err = service.ParseProvisionCSV(file)
+		if err != nil {
+			Error(c, CodeBadRequest, err.Error())
+			return
+		}
+	case contentType == "text/csv":
+		var err error
+		items, err = service.ParseProvisionCSV(c.Request.Body)
+		if err != nil {
+			Error(c, CodeBadRequest, err.Error())
+			return
+		}
+	default:
+		var req model.ProvisionDevicesReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			Error(c, CodeBadRequest, err.Error())
+			return
+		}
+		items = req.Devices
+	}
+
+	currentUID, _ := middleware.GetCurrentUserID(c)
+
+	results, err := h.provisionService.ProvisionDevices(items, currentUID)
+	if err != nil {
+		logger.L().Error("批量预注册设备失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	SuccessWithCode(c, 201, "批量预注册设备成功", gin.H{
+		"items": results,
+		"total": len(results),
+	})
+}
+
+// ClaimDevice 用户使用认领码认领设备
+func (h *DeviceProvisionHandler) ClaimDevice(c *gin.Context) {
+	var req model.ClaimDeviceReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	currentUID, _ := middleware.GetCurrentUserID(c)
+
+	device, err := h.provisionService.ClaimDevice(req.ClaimCode, currentUID)
+	if err != nil {
+		logger.L().Error("认领设备失败", logger.WithError(err))
+		switch {
+		case errors.Is(err, service.ErrClaimCodeInvalid):
+			Error(c, CodeNotFound, err.Error())
+		case errors.Is(err, service.ErrDeviceAlreadyClaimed):
+			Error(c, CodeConflict, err.Error())
+		default:
+			Error(c, CodeInternalServerError, err.Error())
+		}
+		return
+	}
+
+	Success(c, "认领设备成功", device)
+}
+
+// Bootstrap 设备使用引导密钥换取运行凭证
+func (h *DeviceProvisionHandler) Bootstrap(c *gin.Context) {
+	var req model.DeviceBootstrapReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	result, err := h.provisionService.Bootstrap(&req)
+	if err != nil {
+		logger.L().Error("设备引导失败", logger.WithError(err))
+		if errors.Is(err, service.ErrBootstrapSecretWrong) {
+			Error(c, CodeUnauthorized, err.Error())
+		} else {
+			Error(c, CodeInternalServerError, err.Error())
+		}
+		return
+	}
+
+	Success(c, "设备引导成功", result)
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"errors"
+	"io"
+
+	"backend/internal/middleware"
+	"backend/internal/model"
+	"backend/internal/service"
+	"backend/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DeviceShadowHandler struct {
+	shadowService *service.DeviceShadowService
+}
+
+func NewDeviceShadowHandler() *DeviceShadowHandler {
+	return &DeviceShadowHandler{shadowService: service.NewDeviceShadowService()}
+}
+
+// GetDeviceShadow 获取设备影子（包含desired/reported/delta）
+func (h *DeviceShadowHandler) GetDeviceShadow(c *gin.Context) {
+	devID, err := model.StringToID(c.Param("dev_id"))
+	if err != nil {
+		Error(c, CodeBadRequest, "无效的设备ID")
+		return
+	}
+
+	currentUID, _ := middleware.GetCurrentUserID(c)
+	role, _ := middleware.GetCurrentUserRole(c)
+
+	shadow, err := h.shadowService.GetShadow(devID.Int64(), currentUID, role)
+	if err != nil {
+		logger.L().Error("获取设备影子失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "获取设备影子成功", shadow)
+}
+
+// UpdateDeviceShadow 部分更新设备影子
+func (h *DeviceShadowHandler) UpdateDeviceShadow(c *gin.Context) {
+	devID, err := model.StringToID(c.Param("dev_id"))
+	if err != nil {
+		Error(c, CodeBadRequest, "无效的设备ID")
+		return
+	}
+
+	var req model.UpdateDeviceShadowReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	currentUID, _ := middleware.GetCurrentUserID(c)
+	role, _ := middleware.GetCurrentUserRole(c)
+
+	shadow, err := h.shadowService.UpdateShadow(devID.Int64(), &req, currentUID, role)
+	if err != nil {
+		logger.L().Error("更新设备影子失败", logger.WithError(err))
+		switch {
+		case errors.Is(err, service.ErrShadowVersionConflict):
+			Error(c, CodeConflict, err.Error())
+		case errors.Is(err, service.ErrShadowReportedReadOnly):
+			Error(c, CodeForbidden, err.Error())
+		default:
+			Error(c, CodeInternalServerError, err.Error())
+		}
+		return
+	}
+
+	Success(c, "更新设备影子成功", shadow)
+}
+
+// ReportDeviceShadow 设备上报影子的reported状态（设备凭证认证）
+func (h *DeviceShadowHandler) ReportDeviceShadow(c *gin.Context) {
+	devID, exists := middleware.GetCurrentDeviceID(c)
+	if !exists {
+		Error(c, CodeUnauthorized, "未认证")
+		return
+	}
+
+	var req model.ReportDeviceShadowReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	shadow, err := h.shadowService.ReportShadow(devID, &req)
+	if err != nil {
+		logger.L().Error("上报设备影子失败", logger.WithError(err))
+		if errors.Is(err, service.ErrShadowVersionConflict) {
+			Error(c, CodeConflict, err.Error())
+		} else {
+			Error(c, CodeInternalServerError, err.Error())
+		}
+		return
+	}
+
+	Success(c, "上报设备影子成功", shadow)
+}
+
+// SubscribeDeviceShadow 以SSE方式推送设备影子变更事件
+func (h *DeviceShadowHandler) SubscribeDeviceShadow(c *gin.Context) {
+	devID, err := model.StringToID(c.Param("dev_id"))
+	if err != nil {
+		Error(c, CodeBadRequest, "无效的设备ID")
+		return
+	}
+
+	currentUID, _ := middleware.GetCurrentUserID(c)
+	role, _ := middleware.GetCurrentUserRole(c)
+
+	events, cancel, err := h.shadowService.SubscribeShadow(devID.Int64(), currentUID, role)
+	if err != nil {
+		logger.L().Error("订阅设备影子失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+	defer cancel()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(event.Type, event)
+			return true
+		}
+	})
+}
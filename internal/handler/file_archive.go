@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"fmt"
+
+	"backend/internal/middleware"
+	"backend/internal/model"
+	"backend/internal/service"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type FileArchiveHandler struct {
+	archiveService *service.FileArchiveService
+}
+
+func NewFileArchiveHandler() *FileArchiveHandler {
+	return &FileArchiveHandler{
+		archiveService: service.NewFileArchiveService(),
+	}
+}
+
+// DownloadArchive 批量下载：按时间范围或文件key把设备文件打包成ZIP流式返回
+func (h *FileArchiveHandler) DownloadArchive(c *gin.Context) {
+	var req model.FileArchiveReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	currentUID, _ := middleware.GetCurrentUserID(c)
+	role, _ := middleware.GetCurrentUserRole(c)
+
+	entries, err := h.archiveService.ResolveEntries(&req, currentUID, role, model.MaxStreamArchiveFiles)
+	if err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	// 开始写入ZIP后无法再返回JSON错误，失败只记录日志（客户端得到不完整的ZIP）
+	filename := fmt.Sprintf("%d_%s.zip", req.DevID.Int64(), req.BucketName)
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(200)
+	if _, err := h.archiveService.WriteArchive(c.Request.Context(), c.Writer, req.BucketName, entries); err != nil {
+		logger.L().Error("批量下载文件失败", logger.WithError(err), logger.WithInt64("dev_id", req.DevID.Int64()))
+	}
+}
+
+// CreateArchiveTask 创建异步打包任务（文件较多时使用）
+func (h *FileArchiveHandler) CreateArchiveTask(c *gin.Context) {
+	var req model.FileArchiveReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	currentUID, _ := middleware.GetCurrentUserID(c)
+	role, _ := middleware.GetCurrentUserRole(c)
+
+	task, err := h.archiveService.CreateTask(&req, currentUID, role)
+	if err != nil {
+		logger.L().Error("创建打包任务失败", logger.WithError(err))
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	SuccessWithCode(c, 202, "打包任务已创建", task)
+}
+
+// GetArchiveTask 查询打包任务，完成后返回下载URL
+func (h *FileArchiveHandler) GetArchiveTask(c *gin.Context) {
+	taskID, err := utils.ConvertToInt64(c.Query("task_id"))
+	if err != nil || taskID == 0 {
+		Error(c, CodeBadRequest, "task_id无效")
+		return
+	}
+
+	currentUID, _ := middleware.GetCurrentUserID(c)
+	role, _ := middleware.GetCurrentUserRole(c)
+
+	task, err := h.archiveService.GetTask(taskID, currentUID, role)
+	if err != nil {
+		logger.L().Error("查询打包任务失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "查询打包任务成功", task)
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"time"
+
+	"backend/internal/middleware"
+	"backend/internal/model"
+	"backend/internal/service"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type FileCatalogHandler struct {
+	catalogService    *service.FileCatalogService
+	derivativeService *service.DerivativeService
+}
+
+func NewFileCatalogHandler() *FileCatalogHandler {
+	return &FileCatalogHandler{
+		catalogService:    service.NewFileCatalogService(),
+		derivativeService: service.NewDerivativeService(),
+	}
+}
+
+// SearchFiles 从文件目录（metadata）中查询文件
+func (h *FileCatalogHandler) SearchFiles(c *gin.Context) {
+	pageInt, _ := utils.ConvertToInt64(c.Query("page"))
+	if pageInt <= 0 {
+		pageInt = 1
+	}
+	pageSizeInt, _ := utils.ConvertToInt64(c.Query("page_size"))
+	if pageSizeInt <= 0 {
+		pageSizeInt = 10
+	}
+	devID, _ := utils.ConvertToInt64(c.Query("dev_id"))
+
+	query := &model.FileCatalogQuery{
+		Page:        int(pageInt),
+		PageSize:    int(pageSizeInt),
+		DevID:       devID,
+		BucketName:  c.Query("bucket_name"),
+		Keyword:     c.Query("keyword"),
+		ContentType: c.Query("content_type"),
+	}
+	if v, err := utils.ConvertToInt64(c.Query("start_time")); err == nil && v > 0 {
+		query.StartTime = &v
+	}
+	if v, err := utils.ConvertToInt64(c.Query("end_time")); err == nil && v > 0 {
+		query.EndTime = &v
+	}
+
+	currentUID, _ := middleware.GetCurrentUserID(c)
+	role, _ := middleware.GetCurrentUserRole(c)
+
+	files, total, err := h.catalogService.SearchFiles(query, currentUID, role)
+	if err != nil {
+		logger.L().Error("查询文件目录失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	totalPages := (total + pageSizeInt - 1) / pageSizeInt
+	if totalPages == 0 {
+		totalPages = 1
+	}
+
+	Success(c, "查询文件目录成功", gin.H{
+		"items": files,
+		"pagination": gin.H{
+			"page":        pageInt,
+			"page_size":   pageSizeInt,
+			"total":       total,
+			"total_pages": totalPages,
+		},
+	})
+}
+
+// ReconcileFiles 文件对账（metadata与MinIO），fix=false时只返回报告
+func (h *FileCatalogHandler) ReconcileFiles(c *gin.Context) {
+	var req model.ReconcileFilesReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	// 宽限期（分钟），不传时使用默认宽限期（60分钟），传0时不跳过新上传的对象
+	grace := time.Duration(-1)
+	if graceStr := c.Query("grace_minutes"); graceStr != "" {
+		graceMinutes, err := utils.ConvertToInt64(graceStr)
+		if err != nil || graceMinutes < 0 {
+			Error(c, CodeBadRequest, "无效的grace_minutes")
+			return
+		}
+		grace = time.Duration(graceMinutes) * time.Minute
+	}
+
+	report, err := h.catalogService.Reconcile(req.BucketName, req.DevID.Int64(), req.Fix, grace)
+	if err != nil {
+		logger.L().Error("文件对账失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "文件对账完成", report)
+}
+
+// GenerateDerivatives 重新生成文件的缩略图等派生文件
+func (h *FileCatalogHandler) GenerateDerivatives(c *gin.Context) {
+	var req model.GenerateDerivativesReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	derivatives, err := h.derivativeService.Regenerate(req.BucketName, req.BucketKey)
+	if err != nil {
+		logger.L().Error("生成派生文件失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "生成派生文件成功", gin.H{"derivatives": derivatives})
+}
@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"backend/internal/middleware"
+	"backend/internal/model"
+	"backend/internal/service"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type FirmwareHandler struct {
+	firmwareService *service.FirmwareService
+}
+
+func NewFirmwareHandler() *FirmwareHandler {
+	return &FirmwareHandler{firmwareService: service.NewFirmwareService()}
+}
+
+// CreateFirmware 创建固件版本（返回上传URL）
+func (h *FirmwareHandler) CreateFirmware(c *gin.Context) {
+	var req model.CreateFirmwareReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	currentUID, _ := middleware.GetCurrentUserID(c)
+
+	result, err := h.firmwareService.CreateFirmware(&req, currentUID)
+	if err != nil {
+		logger.L().Error("创建固件版本失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	SuccessWithCode(c, 201, "创建固件版本成功", result)
+}
+
+// ConfirmFirmware 确认固件上传完成并校验
+func (h *FirmwareHandler) ConfirmFirmware(c *gin.Context) {
+	fwID, err := utils.ConvertToInt64(c.Query("fw_id"))
+	if err != nil || fwID == 0 {
+		Error(c, CodeBadRequest, "无效的固件ID")
+		return
+	}
+
+	fw, err := h.firmwareService.ConfirmFirmware(fwID)
+	if err != nil {
+		logger.L().Error("确认固件上传失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "确认固件上传成功", fw)
+}
+
+// GetFirmwares 获取固件版本列表
+func (h *FirmwareHandler) GetFirmwares(c *gin.Context) {
+	devType := c.Query("dev_type")
+	devModel := c.Query("model")
+
+	pageInt, _ := utils.ConvertToInt64(c.Query("page"))
+	if pageInt <= 0 {
+		pageInt = 1
+	}
+	pageSizeInt, _ := utils.ConvertToInt64(c.Query("page_size"))
+	if pageSizeInt <= 0 {
+		pageSizeInt = 10
+	}
+
+	firmwares, total, err := h.firmwareService.GetFirmwares(devType, devModel, int(pageInt), int(pageSizeInt))
+	if err != nil {
+		logger.L().Error("获取固件版本列表失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	totalPages := (total + pageSizeInt - 1) / pageSizeInt
+	if totalPages == 0 {
+		totalPages = 1
+	}
+
+	Success(c, "获取固件版本列表成功", gin.H{
+		"items": firmwares,
+		"pagination": gin.H{
+			"page":        pageInt,
+			"page_size":   pageSizeInt,
+			"total":       total,
+			"total_pages": totalPages,
+		},
+	})
+}
+
+// DeleteFirmware 删除固件版本
+func (h *FirmwareHandler) DeleteFirmware(c *gin.Context) {
+	fwID, err := utils.ConvertToInt64(c.Query("fw_id"))
+	if err != nil || fwID == 0 {
+		Error(c, CodeBadRequest, "无效的固件ID")
+		return
+	}
+
+	if err := h.firmwareService.DeleteFirmware(fwID); err != nil {
+		logger.L().Error("删除固件版本失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "删除固件版本成功", nil)
+}
+
+// CreateRollout 创建灰度发布
+func (h *FirmwareHandler) CreateRollout(c *gin.Context) {
+	var req model.CreateRolloutReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	currentUID, _ := middleware.GetCurrentUserID(c)
+
+	rollout, err := h.firmwareService.CreateRollout(&req, currentUID)
+	if err != nil {
+		logger.L().Error("创建灰度发布失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	SuccessWithCode(c, 201, "创建灰度发布成功", rollout)
+}
+
+// UpdateRollout 更新灰度发布（调整比例/暂停/恢复）
+func (h *FirmwareHandler) UpdateRollout(c *gin.Context) {
+	var req model.UpdateRolloutReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	rollout, err := h.firmwareService.UpdateRollout(&req)
+	if err != nil {
+		logger.L().Error("更新灰度发布失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "更新灰度发布成功", rollout)
+}
+
+// GetRolloutProgress 获取灰度发布进度
+func (h *FirmwareHandler) GetRolloutProgress(c *gin.Context) {
+	rolloutID, err := utils.ConvertToInt64(c.Query("rollout_id"))
+	if err != nil || rolloutID == 0 {
+		Error(c, CodeBadRequest, "无效的灰度发布ID")
+		return
+	}
+
+	progress, err := h.firmwareService.GetRolloutProgress(rolloutID)
+	if err != nil {
+		logger.L().Error("获取灰度发布进度失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "获取灰度发布进度成功", progress)
+}
+
+// CheckUpdate 设备检查固件更新（设备凭证认证）
+func (h *FirmwareHandler) CheckUpdate(c *gin.Context) {
+	devID, exists := middleware.GetCurrentDeviceID(c)
+	if !exists {
+		Error(c, CodeUnauthorized, "未认证")
+		return
+	}
+
+	result, err := h.firmwareService.CheckUpdate(devID)
+	if err != nil {
+		logger.L().Error("检查固件更新失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "检查固件更新成功", result)
+}
+
+// ReportVersion 设备上报当前固件版本（设备凭证认证）
+func (h *FirmwareHandler) ReportVersion(c *gin.Context) {
+	devID, exists := middleware.GetCurrentDeviceID(c)
+	if !exists {
+		Error(c, CodeUnauthorized, "未认证")
+		return
+	}
+
+	var req model.FirmwareReportReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	if err := h.firmwareService.ReportVersion(devID, req.Version); err != nil {
+		logger.L().Error("上报固件版本失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "上报固件版本成功", nil)
+}
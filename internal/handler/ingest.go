@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"backend/internal/service"
+	"backend/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IngestHandler struct {
+	ingestService *service.IngestService
+}
+
+func NewIngestHandler() *IngestHandler {
+	return &IngestHandler{
+		ingestService: service.NewIngestService(),
+	}
+}
+
+// GetStats 获取时序写入管道状态（队列长度、WAL占用、InfluxDB是否可用）
+func (h *IngestHandler) GetStats(c *gin.Context) {
+	stats, err := h.ingestService.GetStats()
+	if err != nil {
+		logger.L().Error("获取写入管道状态失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "获取写入管道状态成功", stats)
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"backend/internal/middleware"
+	"backend/internal/model"
+	"backend/internal/service"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MeasurementSchemaHandler struct {
+	schemaService *service.MeasurementSchemaService
+}
+
+func NewMeasurementSchemaHandler() *MeasurementSchemaHandler {
+	return &MeasurementSchemaHandler{
+		schemaService: service.NewMeasurementSchemaService(),
+	}
+}
+
+// CreateSchema 创建时序数据schema
+func (h *MeasurementSchemaHandler) CreateSchema(c *gin.Context) {
+	var req model.CreateMeasurementSchemaReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	currentUID, _ := middleware.GetCurrentUserID(c)
+
+	schema, err := h.schemaService.CreateSchema(&req, currentUID)
+	if err != nil {
+		logger.L().Error("创建schema失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	SuccessWithCode(c, 201, "创建schema成功", schema)
+}
+
+// GetSchemas 获取时序数据schema，支持按dev_id（设备所属类型）、dev_type、measurement筛选
+func (h *MeasurementSchemaHandler) GetSchemas(c *gin.Context) {
+	measurement := c.Query("measurement")
+
+	var schemas []*model.MeasurementSchema
+	var err error
+	if devIDStr := c.Query("dev_id"); devIDStr != "" {
+		devID, convErr := utils.ConvertToInt64(devIDStr)
+		if convErr != nil || devID == 0 {
+			Error(c, CodeBadRequest, "dev_id无效")
+			return
+		}
+		schemas, err = h.schemaService.GetDeviceSchemas(devID, measurement)
+	} else {
+		schemas, err = h.schemaService.GetSchemas(c.Query("dev_type"), measurement)
+	}
+	if err != nil {
+		logger.L().Error("获取schema失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "获取schema成功", schemas)
+}
+
+// UpdateSchema 更新时序数据schema
+func (h *MeasurementSchemaHandler) UpdateSchema(c *gin.Context) {
+	var req model.UpdateMeasurementSchemaReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	schema, err := h.schemaService.UpdateSchema(&req)
+	if err != nil {
+		logger.L().Error("更新schema失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "更新schema成功", schema)
+}
+
+// DeleteSchema 删除时序数据schema
+func (h *MeasurementSchemaHandler) DeleteSchema(c *gin.Context) {
+	schemaID, err := utils.ConvertToInt64(c.Query("schema_id"))
+	if err != nil || schemaID == 0 {
+		Error(c, CodeBadRequest, "无效的schema ID")
+		return
+	}
+
+	if err := h.schemaService.DeleteSchema(schemaID); err != nil {
+		logger.L().Error("删除schema失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "删除schema成功", nil)
+}
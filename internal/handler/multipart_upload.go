@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"backend/internal/middleware"
+	"backend/internal/model"
+	"backend/internal/service"
+	"backend/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MultipartUploadHandler struct {
+	multipartService *service.MultipartUploadService
+}
+
+func NewMultipartUploadHandler() *MultipartUploadHandler {
+	return &MultipartUploadHandler{multipartService: service.NewMultipartUploadService()}
+}
+
+// InitUpload 初始化分片上传
+func (h *MultipartUploadHandler) InitUpload(c *gin.Context) {
+	var req model.InitMultipartUploadReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	currentUID, _ := middleware.GetCurrentUserID(c)
+	role, _ := middleware.GetCurrentUserRole(c)
+
+	info, err := h.multipartService.InitUpload(&req, currentUID, role)
+	if err != nil {
+		logger.L().Error("初始化分片上传失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	SuccessWithCode(c, 201, "初始化分片上传成功", info)
+}
+
+// PresignParts 获取分片上传URL
+func (h *MultipartUploadHandler) PresignParts(c *gin.Context) {
+	var req model.PresignUploadPartsReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	currentUID, _ := middleware.GetCurrentUserID(c)
+	role, _ := middleware.GetCurrentUserRole(c)
+
+	urls, err := h.multipartService.PresignParts(&req, currentUID, role)
+	if err != nil {
+		logger.L().Error("获取分片上传URL失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "获取分片上传URL成功", gin.H{
+		"upload_id":  req.UploadID,
+		"parts":      urls,
+		"expires_in": 900,
+	})
+}
+
+// ListParts 获取已上传的分片（断点续传）
+func (h *MultipartUploadHandler) ListParts(c *gin.Context) {
+	uploadID := c.Query("upload_id")
+	if uploadID == "" {
+		Error(c, CodeBadRequest, "upload_id不能为空")
+		return
+	}
+
+	currentUID, _ := middleware.GetCurrentUserID(c)
+	role, _ := middleware.GetCurrentUserRole(c)
+
+	session, parts, err := h.multipartService.ListParts(uploadID, currentUID, role)
+	if err != nil {
+		logger.L().Error("获取已上传分片失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "获取已上传分片成功", gin.H{
+		"upload_id": uploadID,
+		"part_size": session.PartSize,
+		"file_size": session.FileSize,
+		"expire_at": session.ExpireAt,
+		"parts":     parts,
+	})
+}
+
+// CompleteUpload 完成分片上传
+func (h *MultipartUploadHandler) CompleteUpload(c *gin.Context) {
+	var req model.CompleteMultipartUploadReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	currentUID, _ := middleware.GetCurrentUserID(c)
+	role, _ := middleware.GetCurrentUserRole(c)
+
+	dataID, err := h.multipartService.Complete(&req, currentUID, role)
+	if err != nil {
+		logger.L().Error("完成分片上传失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	SuccessWithCode(c, 201, "完成分片上传成功", gin.H{"data_id": dataID})
+}
+
+// AbortUpload 取消分片上传
+func (h *MultipartUploadHandler) AbortUpload(c *gin.Context) {
+	var req model.AbortMultipartUploadReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	currentUID, _ := middleware.GetCurrentUserID(c)
+	role, _ := middleware.GetCurrentUserRole(c)
+
+	if err := h.multipartService.Abort(req.UploadID, currentUID, role); err != nil {
+		logger.L().Error("取消分片上传失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "取消分片上传成功", nil)
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"backend/internal/middleware"
+	"backend/internal/model"
+	"backend/internal/service"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RetentionHandler struct {
+	retentionService *service.RetentionService
+}
+
+func NewRetentionHandler() *RetentionHandler {
+	return &RetentionHandler{
+		retentionService: service.NewRetentionService(),
+	}
+}
+
+// CreatePolicy 创建数据保留策略
+func (h *RetentionHandler) CreatePolicy(c *gin.Context) {
+	var req model.CreateRetentionPolicyReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	currentUID, _ := middleware.GetCurrentUserID(c)
+
+	policy, err := h.retentionService.CreatePolicy(&req, currentUID)
+	if err != nil {
+		logger.L().Error("创建保留策略失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	SuccessWithCode(c, 201, "创建保留策略成功", policy)
+}
+
+// GetPolicies 获取数据保留策略列表
+func (h *RetentionHandler) GetPolicies(c *gin.Context) {
+	policies, err := h.retentionService.GetPolicies()
+	if err != nil {
+		logger.L().Error("获取保留策略失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "获取保留策略成功", policies)
+}
+
+// UpdatePolicy 更新数据保留策略
+func (h *RetentionHandler) UpdatePolicy(c *gin.Context) {
+	var req model.UpdateRetentionPolicyReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	policy, err := h.retentionService.UpdatePolicy(&req)
+	if err != nil {
+		logger.L().Error("更新保留策略失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "更新保留策略成功", policy)
+}
+
+// DeletePolicy 删除数据保留策略
+func (h *RetentionHandler) DeletePolicy(c *gin.Context) {
+	policyID, err := utils.ConvertToInt64(c.Query("policy_id"))
+	if err != nil || policyID == 0 {
+		Error(c, CodeBadRequest, "无效的策略ID")
+		return
+	}
+
+	if err := h.retentionService.DeletePolicy(policyID); err != nil {
+		logger.L().Error("删除保留策略失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "删除保留策略成功", nil)
+}
+
+// EnforcePolicies 立即执行保留策略，dry_run=true时只返回将被删除的数据报告
+func (h *RetentionHandler) EnforcePolicies(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true"
+
+	report, err := h.retentionService.Enforce(dryRun)
+	if err != nil {
+		logger.L().Error("执行保留策略失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "执行保留策略完成", report)
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"backend/internal/model"
+	"backend/internal/service"
+	"backend/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RollupHandler struct {
+	rollupService *service.RollupService
+}
+
+func NewRollupHandler() *RollupHandler {
+	return &RollupHandler{
+		rollupService: service.NewRollupService(),
+	}
+}
+
+// GetStatus 获取时序汇总状态（各measurement各粒度的水位线）
+func (h *RollupHandler) GetStatus(c *gin.Context) {
+	statuses, err := h.rollupService.GetStatus()
+	if err != nil {
+		logger.L().Error("获取汇总状态失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "获取汇总状态成功", statuses)
+}
+
+// Backfill 重新计算指定时间范围内的汇总数据（异步执行）
+func (h *RollupHandler) Backfill(c *gin.Context) {
+	var req model.RollupBackfillReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	if err := h.rollupService.Backfill(&req); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	SuccessWithCode(c, 202, "已开始回填汇总数据", nil)
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 
 	"backend/internal/middleware"
@@ -45,13 +46,39 @@ func (h *SensorDataHandler) UploadSensorData(c *gin.Context) {
 		return
 	}
 
-	dataID, err := h.sensorDataService.UploadSensorData(&req)
+	currentUID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		Error(c, CodeUnauthorized, "未认证")
+		return
+	}
+	role, _ := middleware.GetCurrentUserRole(c)
+
+	dataID, err := h.sensorDataService.UploadSensorData(&req, currentUID, role)
 	if err != nil {
-		logger.L().Error("上传传感器数据失败", logger.WithError(err))
-		Error(c, CodeInternalServerError, err.Error())
+		var schemaErr *service.SchemaValidationError
+		switch {
+		case errors.As(err, &schemaErr):
+			ErrorWithData(c, CodeBadRequest, schemaErr.Error(), gin.H{"violations": schemaErr.Violations, "truncated": schemaErr.Truncated})
+		case errors.Is(err, service.ErrUploadLocationMismatch):
+			Error(c, CodeBadRequest, err.Error())
+		case errors.Is(err, service.ErrUploadConfirmForbidden), errors.Is(err, service.ErrHealthForbidden):
+			Error(c, CodeForbidden, err.Error())
+		case errors.Is(err, service.ErrIngestQueueFull):
+			Error(c, CodeTooManyRequests, err.Error())
+		case errors.Is(err, service.ErrIngestUnavailable):
+			Error(c, CodeServiceUnavailable, err.Error())
+		default:
+			logger.L().Error("上传传感器数据失败", logger.WithError(err))
+			Error(c, CodeInternalServerError, err.Error())
+		}
 		return
 	}
 
+	// 时序数据异步写入时返回202（数据已进入写入队列）
+	if req.Metadata.DataType == model.DataTypeSeries && h.sensorDataService.AsyncIngest() {
+		SuccessWithCode(c, 202, "传感器数据已进入写入队列", gin.H{"data_id": dataID})
+		return
+	}
 	SuccessWithCode(c, 201, "上传传感器数据成功", gin.H{"data_id": dataID})
 }
 
@@ -74,8 +101,9 @@ func (h *SensorDataHandler) GetPresignedPutURL(c *gin.Context) {
 		Error(c, CodeUnauthorized, "未认证")
 		return
 	}
+	role, _ := middleware.GetCurrentUserRole(c)
 
-	result, err := h.sensorDataService.GetPresignedPutURL(devID, req.Filename, req.BucketName, req.ContentType, currentUID)
+	result, err := h.sensorDataService.GetPresignedPutURL(devID, &req, currentUID, role)
 	if err != nil {
 		logger.L().Error("生成预签名URL失败", logger.WithError(err))
 		Error(c, CodeInternalServerError, err.Error())
@@ -105,15 +133,19 @@ func (h *SensorDataHandler) GetSeriesData(c *gin.Context) {
 	}
 	req.Tags["dev_id"] = req.DevID.String()
 
-	points, err := h.sensorDataService.GetSeriesData(req.Measurement, req.DevID.Int64(), currentUID, req.StartTime, req.EndTime,
-		req.Tags, req.Fields, req.DownSampleInterval, req.Aggregate, req.LimitPoints, role)
+	points, units, err := h.sensorDataService.GetSeriesData(req.Measurement, req.DevID.Int64(), currentUID, req.StartTime, req.EndTime,
+		req.Tags, req.Fields, req.DownSampleInterval, req.Aggregate, req.LimitPoints, req.Units, role)
+	if errors.Is(err, service.ErrUnitConversion) {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
 	if err != nil {
 		logger.L().Error("查询时序数据失败", logger.WithError(err))
 		Error(c, CodeInternalServerError, err.Error())
 		return
 	}
 
-	Success(c, "查询时序数据成功", gin.H{"points": points})
+	Success(c, "查询时序数据成功", gin.H{"points": points, "units": units})
 }
 
 // GetSensorDataStatistic 时序数据统计
@@ -140,14 +172,18 @@ func (h *SensorDataHandler) GetSensorDataStatistic(c *gin.Context) {
 }
 
 // GetFileList 获取文件列表
+// 使用start-after游标分页：首页不传start_after，后续页传上一页返回的next_start_after
 func (h *SensorDataHandler) GetFileList(c *gin.Context) {
-	page, _ := utils.ConvertToInt64(c.Query("page"))
 	pageSize, _ := utils.ConvertToInt64(c.Query("page_size"))
 	bucketName := c.Query("bucket_name")
 	devID, _ := utils.ConvertToInt64(c.Query("dev_id"))
+	withPreview, _ := utils.ConvertToBool(c.Query("with_preview"))
 
-	if page <= 0 || pageSize <= 0 {
-		Error(c, CodeBadRequest, "page和page_size必须大于0")
+	if pageSize <= 0 {
+		pageSize = 10
+	}
+	if pageSize > 1000 {
+		Error(c, CodeBadRequest, "page_size不能超过1000")
 		return
 	}
 	if bucketName == "" || devID == 0 {
@@ -158,25 +194,30 @@ func (h *SensorDataHandler) GetFileList(c *gin.Context) {
 	role, _ := middleware.GetCurrentUserRole(c)
 	currentUID, _ := middleware.GetCurrentUserID(c)
 
-	fileList, total, err := h.sensorDataService.GetFileList(int(page), int(pageSize), bucketName, devID, role, currentUID)
+	query := &model.FileListQuery{
+		BucketName:  bucketName,
+		DevID:       devID,
+		PageSize:    int(pageSize),
+		StartAfter:  c.Query("start_after"),
+		StartDate:   c.Query("start_date"),
+		EndDate:     c.Query("end_date"),
+		WithPreview: withPreview,
+	}
+
+	result, err := h.sensorDataService.GetFileList(query, role, currentUID)
 	if err != nil {
 		logger.L().Error("获取文件列表失败", logger.WithError(err))
 		Error(c, CodeInternalServerError, err.Error())
 		return
 	}
 
-	totalPages := (total + pageSize - 1) / pageSize
-	if totalPages == 0 {
-		totalPages = 1
-	}
-
 	Success(c, "获取文件列表成功", gin.H{
-		"items": fileList,
+		"items": result.Items,
 		"pagination": gin.H{
-			"page":        page,
-			"page_size":   pageSize,
-			"total":       total,
-			"total_pages": totalPages,
+			"page_size":        pageSize,
+			"start_after":      query.StartAfter,
+			"next_start_after": result.NextStartAfter,
+			"has_more":         result.HasMore,
 		},
 	})
 }
@@ -191,7 +232,10 @@ func (h *SensorDataHandler) DownloadFile(c *gin.Context) {
 		return
 	}
 
-	url, err := h.sensorDataService.DownloadFile(bucketName, bucketKey)
+	currentUID, _ := middleware.GetCurrentUserID(c)
+	role, _ := middleware.GetCurrentUserRole(c)
+
+	url, err := h.sensorDataService.DownloadFile(bucketName, bucketKey, currentUID, role)
 	if err != nil {
 		logger.L().Error("获取下载URL失败", logger.WithError(err))
 		Error(c, CodeInternalServerError, err.Error())
@@ -201,6 +245,29 @@ func (h *SensorDataHandler) DownloadFile(c *gin.Context) {
 	Success(c, "获取下载URL成功", gin.H{"download_url": url})
 }
 
+// GetFilePreview 获取文件预览URL（按需生成）
+func (h *SensorDataHandler) GetFilePreview(c *gin.Context) {
+	bucketName := c.Query("bucket_name")
+	bucketKey := c.Query("bucket_key")
+
+	if bucketName == "" || bucketKey == "" {
+		Error(c, CodeBadRequest, "bucket_name和bucket_key不能为空")
+		return
+	}
+
+	currentUID, _ := middleware.GetCurrentUserID(c)
+	role, _ := middleware.GetCurrentUserRole(c)
+
+	url, err := h.sensorDataService.GetFilePreviewURL(bucketName, bucketKey, currentUID, role)
+	if err != nil {
+		logger.L().Error("获取预览URL失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "获取预览URL成功", gin.H{"preview_url": url})
+}
+
 // DeleteSeriesData 删除时序数据元数据
 func (h *SensorDataHandler) DeleteSeriesData(c *gin.Context) {
 	var req model.DeleteSeriesDataRequest
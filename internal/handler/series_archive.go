@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"backend/internal/service"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SeriesArchiveHandler struct {
+	archiveService *service.SeriesArchiveService
+}
+
+func NewSeriesArchiveHandler() *SeriesArchiveHandler {
+	return &SeriesArchiveHandler{
+		archiveService: service.NewSeriesArchiveService(),
+	}
+}
+
+// GetArchives 获取时序数据归档清单（measurement、dev_id、start_time/end_time为Unix秒）
+func (h *SeriesArchiveHandler) GetArchives(c *gin.Context) {
+	measurement := c.Query("measurement")
+	if measurement == "" {
+		Error(c, CodeBadRequest, "measurement不能为空")
+		return
+	}
+	devID, err := utils.ConvertToInt64(c.Query("dev_id"))
+	if err != nil || devID == 0 {
+		Error(c, CodeBadRequest, "无效的设备ID")
+		return
+	}
+	startTime, err := utils.ConvertToInt64(c.Query("start_time"))
+	if err != nil {
+		Error(c, CodeBadRequest, "无效的开始时间")
+		return
+	}
+	endTime, err := utils.ConvertToInt64(c.Query("end_time"))
+	if err != nil || endTime < startTime {
+		Error(c, CodeBadRequest, "无效的结束时间")
+		return
+	}
+
+	archives, err := h.archiveService.GetArchives(measurement, devID, startTime, endTime)
+	if err != nil {
+		logger.L().Error("获取归档清单失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "获取归档清单成功", archives)
+}
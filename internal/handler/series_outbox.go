@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"backend/internal/service"
+	"backend/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SeriesOutboxHandler struct {
+	outboxService *service.SeriesOutboxService
+}
+
+func NewSeriesOutboxHandler() *SeriesOutboxHandler {
+	return &SeriesOutboxHandler{
+		outboxService: service.NewSeriesOutboxService(),
+	}
+}
+
+// GetStats 获取时序写入补偿统计（未完成、卡住与已补偿的写入）
+func (h *SeriesOutboxHandler) GetStats(c *gin.Context) {
+	stats, err := h.outboxService.GetStats()
+	if err != nil {
+		logger.L().Error("获取时序写入补偿统计失败", logger.WithError(err))
+		Error(c, CodeInternalServerError, err.Error())
+		return
+	}
+
+	Success(c, "获取时序写入补偿统计成功", stats)
+}
@@ -0,0 +1,18 @@
+package handler
+
+import (
+	"backend/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UnitHandler struct{}
+
+func NewUnitHandler() *UnitHandler {
+	return &UnitHandler{}
+}
+
+// GetUnits 获取支持转换的单位（按量纲分组）
+func (h *UnitHandler) GetUnits(c *gin.Context) {
+	Success(c, "获取单位成功", utils.SupportedUnits())
+}
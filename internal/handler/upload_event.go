@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"backend/internal/model"
+	"backend/internal/service"
+	"backend/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UploadEventHandler struct {
+	uploadService *service.UploadSessionService
+}
+
+func NewUploadEventHandler() *UploadEventHandler {
+	return &UploadEventHandler{uploadService: service.NewUploadSessionService()}
+}
+
+// HandleBucketEvents MinIO webhook目标：接收存储事件并自动确认上传会话
+func (h *UploadEventHandler) HandleBucketEvents(c *gin.Context) {
+	if !service.VerifyWebhookToken(c.GetHeader("Authorization")) {
+		Error(c, CodeUnauthorized, "无效的webhook令牌")
+		return
+	}
+
+	var notification model.BucketNotification
+	if err := c.ShouldBindJSON(&notification); err != nil {
+		Error(c, CodeBadRequest, err.Error())
+		return
+	}
+
+	completed := h.uploadService.HandleBucketEvents(notification.Records)
+	if completed > 0 {
+		logger.L().Info("处理存储事件", logger.WithString("event_name", notification.EventName),
+			logger.WithInt("completed", completed))
+	}
+
+	Success(c, "处理存储事件成功", gin.H{"completed": completed})
+}
@@ -1,7 +1,10 @@
 package middleware
 
 import (
+	"backend/internal/model"
+	"backend/internal/service"
 	"backend/pkg/utils"
+	"errors"
 	"net/http"
 	"strings"
 
@@ -55,6 +58,12 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// 设备凭证不能访问用户接口
+		if claims.Role == model.RoleDevice {
+			errorResponse(c, http.StatusUnauthorized, "设备凭证不能访问用户接口")
+			return
+		}
+
 		// 将用户信息存储到上下文
 		c.Set("uid", claims.UID)
 		c.Set("role", claims.Role)
@@ -64,6 +73,50 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 	}
 }
 
+// DeviceAuthMiddleware 设备认证中间件（要求role=device的设备凭证，且设备仍然存在、凭证未被吊销）
+func DeviceAuthMiddleware() gin.HandlerFunc {
+	deviceService := service.NewDeviceService()
+
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			errorResponse(c, http.StatusUnauthorized, "缺少Authorization头")
+			return
+		}
+
+		parts := strings.SplitN(authHeader, " ", 2)
+		if len(parts) != 2 || parts[0] != "Bearer" || parts[1] == "" {
+			errorResponse(c, http.StatusUnauthorized, "Authorization格式错误，应为: Bearer <token>")
+			return
+		}
+
+		claims, err := utils.ParseToken(parts[1])
+		if err != nil {
+			errorResponse(c, http.StatusUnauthorized, "无效的token: "+err.Error())
+			return
+		}
+		if claims.Role != model.RoleDevice || claims.DevID == 0 {
+			errorResponse(c, http.StatusUnauthorized, "需要设备凭证")
+			return
+		}
+		if err := deviceService.ValidateDeviceToken(claims.DevID, claims.TokenVersion); err != nil {
+			if errors.Is(err, service.ErrDeviceTokenRevoked) {
+				errorResponse(c, http.StatusUnauthorized, err.Error())
+				return
+			}
+			errorResponse(c, http.StatusInternalServerError, "校验设备凭证失败")
+			return
+		}
+
+		// 将设备信息存储到上下文
+		c.Set("dev_id", claims.DevID)
+		c.Set("role", claims.Role)
+		c.Set("claims", claims)
+
+		c.Next()
+	}
+}
+
 // AdminOnlyMiddleware 仅管理员中间件
 func AdminOnlyMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -101,3 +154,13 @@ func GetCurrentUserRole(c *gin.Context) (string, bool) {
 	roleStr, ok := role.(string)
 	return roleStr, ok
 }
+
+// GetCurrentDeviceID 从上下文获取当前设备ID（设备凭证认证后可用）
+func GetCurrentDeviceID(c *gin.Context) (int64, bool) {
+	devID, exists := c.Get("dev_id")
+	if !exists {
+		return 0, false
+	}
+	devIDInt64, ok := devID.(int64)
+	return devIDInt64, ok
+}
@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"backend/internal/model"
+	"backend/internal/service"
+	"backend/pkg/logger"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// idempotentReplayedHeader 标记响应为保存的首次响应
+const idempotentReplayedHeader = "Idempotent-Replayed"
+
+// idempotencyWriter 记录响应体，供请求结束后保存
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(data []byte) (int, error) {
+	if w.body.Len() <= service.MaxIdempotentResponseSize {
+		w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	if w.body.Len() <= service.MaxIdempotentResponseSize {
+		w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware Idempotency-Key 幂等中间件（需放在认证中间件之后）
+// 未携带幂等键的请求不受影响；同一调用方重复使用幂等键时返回首次请求保存的响应
+func IdempotencyMiddleware() gin.HandlerFunc {
+	idempotencyService := service.NewIdempotencyService()
+	return func(c *gin.Context) {
+		key := c.GetHeader(model.IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > model.MaxIdempotencyKeyLength {
+			errorResponse(c, http.StatusBadRequest, "Idempotency-Key长度不能超过"+strconv.Itoa(model.MaxIdempotencyKeyLength))
+			return
+		}
+
+		scope, ok := idempotencyScope(c)
+		if !ok {
+			errorResponse(c, http.StatusUnauthorized, "未认证")
+			return
+		}
+
+		// 请求体需读入内存计算摘要，限制大小（包括multipart上传）
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, service.MaxIdempotentRequestSize))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				errorResponse(c, http.StatusRequestEntityTooLarge,
+					"携带Idempotency-Key的请求体不能超过"+strconv.Itoa(service.MaxIdempotentRequestSize>>20)+"MB")
+				return
+			}
+			errorResponse(c, http.StatusBadRequest, "读取请求体失败")
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.New()
+		hash.Write([]byte(c.Request.Method + " " + c.Request.URL.RequestURI() + "\n"))
+		hash.Write(body)
+		requestHash := hex.EncodeToString(hash.Sum(nil))
+
+		replay, err := idempotencyService.Begin(scope, key, c.Request.Method, c.FullPath(), requestHash)
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrIdempotencyKeyMismatch):
+				errorResponse(c, http.StatusUnprocessableEntity, err.Error())
+			case errors.Is(err, service.ErrIdempotencyInProgress):
+				errorResponse(c, http.StatusConflict, err.Error())
+			default:
+				logger.L().Error("幂等键处理失败", logger.WithError(err))
+				errorResponse(c, http.StatusInternalServerError, "幂等键处理失败")
+			}
+			return
+		}
+		if replay != nil {
+			c.Header(idempotentReplayedHeader, "true")
+			c.Data(replay.ResponseCode, replay.ContentType, replay.ResponseBody)
+			c.Abort()
+			return
+		}
+
+		writer := &idempotencyWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		stopHold := idempotencyService.Hold(scope, key)
+		defer func() {
+			stopHold()
+			// 处理过程中panic时释放幂等键，允许客户端重试
+			if r := recover(); r != nil {
+				_ = idempotencyService.Finish(scope, key, http.StatusInternalServerError, "", nil)
+				panic(r)
+			}
+		}()
+
+		c.Next()
+
+		if err := idempotencyService.Finish(scope, key, writer.Status(), writer.Header().Get("Content-Type"), writer.body.Bytes()); err != nil {
+			logger.L().Error("保存幂等响应失败", logger.WithError(err))
+		}
+	}
+}
+
+// idempotencyScope 幂等键作用域：设备凭证按设备，用户凭证按用户
+func idempotencyScope(c *gin.Context) (string, bool) {
+	if devID, ok := GetCurrentDeviceID(c); ok {
+		return "d:" + strconv.FormatInt(devID, 10), true
+	}
+	if uid, ok := GetCurrentUserID(c); ok {
+		return "u:" + strconv.FormatInt(uid, 10), true
+	}
+	return "", false
+}
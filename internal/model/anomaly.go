@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+const (
+	AnomalyAlertPrefix       = "检测到异常数据" // 异常告警消息前缀（用于去重）
+	AnomalyMeasurementSuffix = "_anomaly"   // 异常评分写入的measurement后缀：{measurement}_anomaly
+	AnomalySeasonBuckets     = 24           // 季节性基线按一天中的小时分桶
+)
+
+// AnomalyStat 指数加权（EWMA）均值与方差
+type AnomalyStat struct {
+	Mean     float64 `json:"mean"`
+	Variance float64 `json:"variance"`
+	Count    int64   `json:"count"` // 已学习的样本数
+}
+
+// AnomalyBaseline 设备某个measurement字段的基线：滚动基线与按小时的季节性基线
+type AnomalyBaseline struct {
+	DevID       int64         `json:"dev_id"`
+	Measurement string        `json:"measurement"`
+	Field       string        `json:"field"`
+	Overall     AnomalyStat   `json:"overall"`
+	Hourly      []AnomalyStat `json:"hourly"` // 长度为 AnomalySeasonBuckets，按数据点的本地时间小时
+	UpdateAt    time.Time     `json:"update_at"`
+}
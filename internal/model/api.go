@@ -2,9 +2,10 @@ package model
 
 // UploadSensorDataRequest 上传传感器数据请求
 type UploadSensorDataRequest struct {
-	Metadata   Metadata   `json:"metadata"`
-	SeriesData SeriesData `json:"series_data" binding:"omitempty"`
-	FileData   FileData   `json:"file_data" binding:"omitempty"`
+	Metadata   Metadata      `json:"metadata"`
+	SeriesData SeriesData    `json:"series_data" binding:"omitempty"`
+	FileData   FileData      `json:"file_data" binding:"omitempty"`
+	Health     *DeviceHealth `json:"health,omitempty"` // 可选：随数据一起上报设备健康指标
 }
 
 // UpdateUserInfoRequest 更新用户信息请求
@@ -25,6 +26,7 @@ type GetSeriesDataRequest struct {
 	Aggregate          string             `json:"aggregate"`
 	DownSampleInterval string             `json:"down_sample_interval"`
 	LimitPoints        int                `json:"limit_points"`
+	Units              map[string]string  `json:"units"` // 字段 -> 返回的单位，如 {"temperature": "°C"}
 }
 
 // DeleteSeriesDataRequest 删除时序数据请求
@@ -46,4 +48,7 @@ type GetPresignedPutURLReq struct {
 	Filename    string `json:"filename" binding:"required"`
 	BucketName  string `json:"bucket_name"`
 	ContentType string `json:"content_type"`
+	// 可选：文件SHA-256（十六进制），用于重复检测与上传后校验
+	SHA256         string `json:"sha256" binding:"omitempty,len=64,hexadecimal"`
+	AllowDuplicate bool   `json:"allow_duplicate"` // 设备已有相同内容的文件时仍然上传
 }
@@ -0,0 +1,67 @@
+package model
+
+import "time"
+
+// 校准类型
+const (
+	CalibrationTypeLinear     = "linear"     // coefficients为[offset, gain]：y = offset + gain*x
+	CalibrationTypePolynomial = "polynomial" // coefficients按升幂：y = c0 + c1*x + c2*x² + ...
+)
+
+const (
+	MaxCalibrationDegree   = 5             // 多项式最高次数
+	CalibrationRawSuffix   = "_raw"        // 保留原始值时写入 {field}_raw
+	CalibrationMetadataKey = "calibration" // metadata.extra_data中记录上传使用的校准配置
+)
+
+// CalibrationProfile 设备字段的校准配置：上传时按数据点时间使用valid_from不晚于该时间的最新配置
+type CalibrationProfile struct {
+	ProfileID    int64     `json:"profile_id"`
+	DevID        DeviceID  `json:"dev_id"`
+	Measurement  string    `json:"measurement"`
+	Field        string    `json:"field"`
+	Type         string    `json:"type"`
+	Coefficients []float64 `json:"coefficients"`
+	ValidFrom    time.Time `json:"valid_from"`
+	Version      int       `json:"version"` // 每次修正系数加1
+	KeepRaw      bool      `json:"keep_raw"`
+	Description  string    `json:"description"`
+	CreateBy     int64     `json:"create_by"`
+	CreateAt     time.Time `json:"create_at"`
+	UpdateAt     time.Time `json:"update_at"`
+}
+
+// CalibrationApplied 上传使用的校准配置（记录在metadata.extra_data.calibration）
+type CalibrationApplied struct {
+	ProfileID   int64  `json:"profile_id"`
+	Measurement string `json:"measurement"`
+	Field       string `json:"field"`
+	Version     int    `json:"version"`
+}
+
+// CreateCalibrationProfileReq 创建校准配置请求
+type CreateCalibrationProfileReq struct {
+	Measurement  string    `json:"measurement" binding:"required,max=100"`
+	Field        string    `json:"field" binding:"required,max=64"`
+	Type         string    `json:"type" binding:"required,oneof=linear polynomial"`
+	Coefficients []float64 `json:"coefficients" binding:"required,min=1"`
+	ValidFrom    int64     `json:"valid_from"` // Unix秒，默认当前时间
+	KeepRaw      bool      `json:"keep_raw"`
+	Description  string    `json:"description" binding:"max=255"`
+}
+
+// UpdateCalibrationProfileReq 修正校准配置请求（只更新提供的字段）
+// recompute为true时按新系数重新计算该配置有效期内已保留原始值的历史数据
+type UpdateCalibrationProfileReq struct {
+	ProfileID    int64     `json:"profile_id" binding:"required"`
+	Type         *string   `json:"type" binding:"omitempty,oneof=linear polynomial"`
+	Coefficients []float64 `json:"coefficients" binding:"omitempty,min=1"`
+	KeepRaw      *bool     `json:"keep_raw"`
+	Description  *string   `json:"description" binding:"omitempty,max=255"`
+	Recompute    bool      `json:"recompute"`
+}
+
+// RecomputeCalibrationReq 重新计算历史校准值请求
+type RecomputeCalibrationReq struct {
+	ProfileID int64 `json:"profile_id" binding:"required"`
+}
@@ -0,0 +1,52 @@
+package model
+
+import "time"
+
+const (
+	MaxCompletenessGaps       = 100 // 每个设备每个measurement最多列出的缺口数量
+	MaxCompletenessRangeDays  = 31  // 报告时间范围上限（天）
+	CompletenessReportPrefix  = "reports/completeness"
+	DefaultCompletenessWindow = 24 * time.Hour
+)
+
+// CompletenessGap 数据缺口：相邻数据点间隔超过预期间隔gap_factor倍的区间
+type CompletenessGap struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Seconds int64     `json:"seconds"`
+}
+
+// CompletenessEntry 设备某个measurement的数据完整性
+type CompletenessEntry struct {
+	DevID            DeviceID          `json:"dev_id"`
+	DevName          string            `json:"dev_name"`
+	DevType          string            `json:"dev_type"`
+	Measurement      string            `json:"measurement"`
+	ExpectedInterval float64           `json:"expected_interval"` // 预期采样间隔（秒），未配置采样频率/上报间隔时为0
+	Expected         int64             `json:"expected"`          // 预期数据点数量（按不同时间戳）
+	Received         int64             `json:"received"`
+	Completeness     float64           `json:"completeness"` // 完整率（%）
+	MissingSeconds   int64             `json:"missing_seconds"`
+	Gaps             []CompletenessGap `json:"gaps"`
+	GapsTruncated    bool              `json:"gaps_truncated,omitempty"`
+	Error            string            `json:"error,omitempty"`
+}
+
+// CompletenessReport 数据完整性报告
+type CompletenessReport struct {
+	StartTime   time.Time           `json:"start_time"`
+	EndTime     time.Time           `json:"end_time"`
+	Devices     int                 `json:"devices"`
+	Entries     []CompletenessEntry `json:"entries"`
+	GeneratedAt time.Time           `json:"generated_at"`
+}
+
+// CompletenessQuery 报告查询条件
+type CompletenessQuery struct {
+	DevID       int64  // 为0表示全部设备
+	DevType     string // 为空表示全部类型
+	Measurement string // 为空表示设备的全部measurement
+	StartTime   time.Time
+	EndTime     time.Time
+	Below       float64 // 只返回完整率低于该值的记录，为0表示全部
+}
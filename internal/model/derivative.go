@@ -0,0 +1,33 @@
+package model
+
+// DerivativePrefix 派生文件（缩略图等）在原bucket中的key前缀：derivatives/{原始key}/{名称}{扩展名}
+const DerivativePrefix = "derivatives/"
+
+// DefaultThumbnailName 文件列表中返回的缩略图
+const DefaultThumbnailName = "thumb_256"
+
+// Derivative 派生文件信息（保存在 metadata.extra_data.derivatives 中，按名称索引）
+type Derivative struct {
+	Key         string `json:"key"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+	Processor   string `json:"processor"`
+}
+
+// DerivativeOutput 派生处理器的输出
+type DerivativeOutput struct {
+	Name        string // 派生文件名称，如 thumb_256
+	Ext         string // 扩展名，如 .jpg
+	ContentType string
+	Data        []byte
+	Width       int
+	Height      int
+}
+
+// GenerateDerivativesReq 重新生成派生文件请求
+type GenerateDerivativesReq struct {
+	BucketName string `json:"bucket_name" binding:"required"`
+	BucketKey  string `json:"bucket_key" binding:"required"`
+}
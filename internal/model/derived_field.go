@@ -0,0 +1,54 @@
+package model
+
+import "time"
+
+// 派生字段计算方式
+const (
+	DerivedModeQuery  = "query"  // 查询时计算，不写入数据
+	DerivedModeIngest = "ingest" // 上传时计算并写入派生measurement
+)
+
+// DerivedMeasurementSuffix 上传时计算的派生字段写入 {measurement}_derived
+const DerivedMeasurementSuffix = "_derived"
+
+// DerivedField 派生字段：按设备类型与measurement定义的表达式（如由温度与湿度计算体感温度）
+// 表达式语法见 utils.CompileExpr，变量为同一数据点的字段
+type DerivedField struct {
+	FieldID     int64     `json:"field_id"`
+	DevType     string    `json:"dev_type"`
+	Measurement string    `json:"measurement"`
+	Name        string    `json:"name"`
+	Expression  string    `json:"expression"`
+	Mode        string    `json:"mode"`
+	Unit        string    `json:"unit"`
+	Description string    `json:"description"`
+	CreateBy    int64     `json:"create_by"`
+	CreateAt    time.Time `json:"create_at"`
+	UpdateAt    time.Time `json:"update_at"`
+}
+
+// CreateDerivedFieldReq 创建派生字段请求
+type CreateDerivedFieldReq struct {
+	DevType     string `json:"dev_type" binding:"required,max=30"`
+	Measurement string `json:"measurement" binding:"required,max=100"`
+	Name        string `json:"name" binding:"required,max=64"`
+	Expression  string `json:"expression" binding:"required,max=1024"`
+	Mode        string `json:"mode" binding:"omitempty,oneof=query ingest"` // 默认query
+	Unit        string `json:"unit" binding:"max=20"`
+	Description string `json:"description" binding:"max=255"`
+}
+
+// UpdateDerivedFieldReq 更新派生字段请求（只更新提供的字段）
+type UpdateDerivedFieldReq struct {
+	FieldID     int64   `json:"field_id" binding:"required"`
+	Expression  *string `json:"expression" binding:"omitempty,max=1024"`
+	Mode        *string `json:"mode" binding:"omitempty,oneof=query ingest"`
+	Unit        *string `json:"unit" binding:"omitempty,max=20"`
+	Description *string `json:"description" binding:"omitempty,max=255"`
+}
+
+// EvaluateDerivedFieldReq 试算表达式请求（不保存）
+type EvaluateDerivedFieldReq struct {
+	Expression string           `json:"expression" binding:"required,max=1024"`
+	Points     []map[string]any `json:"points" binding:"required,min=1,max=1000"` // 按时间顺序的字段值，可包含timestamp
+}
@@ -0,0 +1,48 @@
+package model
+
+import "time"
+
+const (
+	CommandStatusPending   = "pending"   // 等待设备拉取
+	CommandStatusDelivered = "delivered" // 已下发给设备
+	CommandStatusSucceeded = "succeeded" // 设备执行成功
+	CommandStatusFailed    = "failed"    // 设备执行失败
+	CommandStatusExpired   = "expired"   // 超过TTL未完成
+)
+
+const (
+	DefaultCommandTTL = 3600      // 默认TTL（秒）
+	MaxCommandTTL     = 7 * 86400 // 最大TTL（秒）
+)
+
+// DeviceCommand 设备下行命令
+type DeviceCommand struct {
+	CmdID       int64                  `json:"cmd_id" db:"cmd_id"`
+	DevID       DeviceID               `json:"dev_id" db:"dev_id"`
+	Command     string                 `json:"command" db:"command"` // 命令名称，如 reboot/calibrate/sample_now
+	Payload     map[string]interface{} `json:"payload" db:"payload"`
+	Status      string                 `json:"status" db:"status"` // pending/delivered/succeeded/failed/expired
+	Result      map[string]interface{} `json:"result,omitempty" db:"result"`
+	IssuedBy    int64                  `json:"issued_by" db:"issued_by"` // 下发命令的用户ID
+	IssuerName  string                 `json:"issuer_name,omitempty"`    // 下发命令的用户名（查询历史时填充）
+	TTL         int                    `json:"ttl" db:"ttl"`             // 有效期（秒）
+	ExpireAt    time.Time              `json:"expire_at" db:"expire_at"`
+	CreateAt    time.Time              `json:"create_at" db:"create_at"`
+	DeliveredAt *time.Time             `json:"delivered_at,omitempty" db:"delivered_at"`
+	FinishedAt  *time.Time             `json:"finished_at,omitempty" db:"finished_at"`
+}
+
+// CreateDeviceCommandReq 创建设备命令请求
+type CreateDeviceCommandReq struct {
+	DevID   DeviceID               `json:"dev_id" binding:"required"`
+	Command string                 `json:"command" binding:"required,max=50"`
+	Payload map[string]interface{} `json:"payload"`
+	TTL     int                    `json:"ttl"` // 秒，为空使用默认值
+}
+
+// AckDeviceCommandReq 设备回执请求
+type AckDeviceCommandReq struct {
+	CmdID  int64                  `json:"cmd_id" binding:"required"`
+	Status string                 `json:"status" binding:"required,oneof=succeeded failed"`
+	Result map[string]interface{} `json:"result"`
+}
@@ -0,0 +1,55 @@
+package model
+
+import "time"
+
+// DeviceHealthMeasurement 设备健康指标在InfluxDB中的measurement
+const DeviceHealthMeasurement = "device_health"
+
+const (
+	LowBatteryThreshold        = 20        // 低电量告警阈值（%）
+	LowBatteryRecoverThreshold = 30        // 电量恢复到该值以上时自动解除低电量告警（%）
+	LowBatteryAlertPrefix      = "设备电量低"   // 低电量告警消息前缀（用于去重和自动解除）
+	DefaultHealthRangeSeconds  = 7 * 86400 // 健康历史默认查询范围（秒）
+)
+
+// 健康指标字段名
+const (
+	HealthFieldBattery     = "battery"     // 电量（%）
+	HealthFieldRSSI        = "rssi"        // 信号强度（dBm）
+	HealthFieldTemperature = "temperature" // 设备温度（℃）
+	HealthFieldUptime      = "uptime"      // 运行时长（秒）
+)
+
+// DeviceHealth 设备健康指标（随数据上传或心跳上报，未上报的指标为空）
+type DeviceHealth struct {
+	Battery     *float64 `json:"battery,omitempty" binding:"omitempty,min=0,max=100"`
+	RSSI        *float64 `json:"rssi,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	Uptime      *int64   `json:"uptime,omitempty" binding:"omitempty,min=0"`
+	Timestamp   int64    `json:"timestamp,omitempty"` // Unix秒，为空使用服务器时间
+}
+
+// IsEmpty 是否没有任何健康指标
+func (h *DeviceHealth) IsEmpty() bool {
+	return h == nil || (h.Battery == nil && h.RSSI == nil && h.Temperature == nil && h.Uptime == nil)
+}
+
+// HealthMetricTrend 单个健康指标在查询范围内的统计与趋势
+type HealthMetricTrend struct {
+	Latest       float64 `json:"latest"`
+	Min          float64 `json:"min"`
+	Max          float64 `json:"max"`
+	Avg          float64 `json:"avg"`
+	Count        int     `json:"count"`
+	SlopePerHour float64 `json:"slope_per_hour"` // 线性回归斜率（每小时变化量）
+}
+
+// DeviceHealthReport 设备健康历史与趋势
+type DeviceHealthReport struct {
+	DevID          DeviceID                      `json:"dev_id"`
+	StartTime      int64                         `json:"start_time"`
+	EndTime        int64                         `json:"end_time"`
+	History        []Point                       `json:"history"`
+	Trends         map[string]*HealthMetricTrend `json:"trends"`
+	BatteryEmptyAt *time.Time                    `json:"battery_empty_at,omitempty"` // 按当前放电斜率预测的电量耗尽时间
+}
@@ -0,0 +1,61 @@
+package model
+
+import "time"
+
+const (
+	MaxProvisionBatchSize = 1000 // 单次批量预注册的最大设备数
+	ClaimCodeGroups       = 3    // 认领码分组数（XXXX-XXXX-XXXX）
+	BootstrapSecretBytes  = 32   // 引导密钥字节数
+)
+
+// ProvisionQRScheme 认领二维码内容前缀
+const ProvisionQRScheme = "sensorhub://claim"
+
+// DeviceProvision 设备预注册记录（认领码和引导密钥只保存哈希）
+type DeviceProvision struct {
+	DevID               DeviceID   `json:"dev_id" db:"dev_id"`
+	ClaimCodeHash       string     `json:"-" db:"claim_code_hash"`
+	BootstrapSecretHash string     `json:"-" db:"bootstrap_secret_hash"`
+	ClaimedBy           *int64     `json:"claimed_by,omitempty" db:"claimed_by"`
+	ClaimedAt           *time.Time `json:"claimed_at,omitempty" db:"claimed_at"`
+	LastBootstrapAt     *time.Time `json:"last_bootstrap_at,omitempty" db:"last_bootstrap_at"`
+	CreateBy            int64      `json:"create_by" db:"create_by"`
+	CreateAt            time.Time  `json:"create_at" db:"create_at"`
+}
+
+// ProvisionDeviceItem 批量预注册的单个设备（JSON或CSV的一行）
+type ProvisionDeviceItem struct {
+	DevName          string `json:"dev_name"`
+	DevType          string `json:"dev_type" binding:"required"`
+	Model            string `json:"model"`
+	Version          string `json:"version"`
+	SamplingRate     int    `json:"sampling_rate"`
+	UploadInterval   int    `json:"upload_interval"`
+	OfflineThreshold int    `json:"offline_threshold"`
+}
+
+// ProvisionDevicesReq 批量预注册请求
+type ProvisionDevicesReq struct {
+	Devices []ProvisionDeviceItem `json:"devices" binding:"required,min=1,dive"`
+}
+
+// ProvisionedDevice 预注册结果（认领码和引导密钥明文仅在此返回一次）
+type ProvisionedDevice struct {
+	DevID           DeviceID `json:"dev_id"`
+	DevName         string   `json:"dev_name"`
+	DevType         string   `json:"dev_type"`
+	ClaimCode       string   `json:"claim_code"`
+	BootstrapSecret string   `json:"bootstrap_secret"`
+	QRPayload       string   `json:"qr_payload"`
+}
+
+// ClaimDeviceReq 用户认领设备请求
+type ClaimDeviceReq struct {
+	ClaimCode string `json:"claim_code" binding:"required"`
+}
+
+// DeviceBootstrapReq 设备用引导密钥换取运行凭证请求
+type DeviceBootstrapReq struct {
+	DevID           DeviceID `json:"dev_id" binding:"required"`
+	BootstrapSecret string   `json:"bootstrap_secret" binding:"required"`
+}
@@ -0,0 +1,44 @@
+package model
+
+import "time"
+
+const (
+	ShadowEventUpdated = "updated" // 影子文档已更新
+	ShadowEventDelta   = "delta"   // desired 与 reported 存在差异
+)
+
+// DeviceShadow 设备影子（存储在device表的shadow字段中）
+type DeviceShadow struct {
+	DevID    DeviceID               `json:"dev_id"`
+	Desired  map[string]interface{} `json:"desired"`  // 期望状态（由用户/平台设置）
+	Reported map[string]interface{} `json:"reported"` // 上报状态（由设备上报）
+	Delta    map[string]interface{} `json:"delta"`    // desired 中与 reported 不一致的部分（计算得出，不存储）
+	Version  int64                  `json:"version"`  // 版本号，每次更新+1，用于乐观锁
+	UpdateAt time.Time              `json:"update_at"`
+}
+
+// ShadowState 影子状态（desired/reported）
+type ShadowState struct {
+	Desired  map[string]interface{} `json:"desired"`
+	Reported map[string]interface{} `json:"reported"`
+}
+
+// UpdateDeviceShadowReq 更新设备影子请求（部分更新，值为null表示删除该键；reported只能由设备上报）
+type UpdateDeviceShadowReq struct {
+	State   ShadowState `json:"state" binding:"required"`
+	Version *int64      `json:"version"` // 可选：期望的当前版本号，不一致时返回冲突
+}
+
+// ReportDeviceShadowReq 设备上报影子请求（只能更新reported，值为null表示删除该键）
+type ReportDeviceShadowReq struct {
+	Reported map[string]interface{} `json:"reported" binding:"required"`
+	Version  *int64                 `json:"version"` // 可选：期望的当前版本号，不一致时返回冲突
+}
+
+// ShadowEvent 影子变更事件
+type ShadowEvent struct {
+	Type    string        `json:"type"` // updated/delta
+	DevID   DeviceID      `json:"dev_id"`
+	Version int64         `json:"version"`
+	Shadow  *DeviceShadow `json:"shadow"`
+}
@@ -0,0 +1,52 @@
+package model
+
+import "time"
+
+// ArchiveBucketName 异步打包生成的ZIP存放的bucket
+const ArchiveBucketName = "archive"
+
+const (
+	ArchiveTaskStatusPending   = "pending"   // 等待打包
+	ArchiveTaskStatusRunning   = "running"   // 打包中
+	ArchiveTaskStatusSucceeded = "succeeded" // 已生成，可下载
+	ArchiveTaskStatusFailed    = "failed"    // 打包失败
+	ArchiveTaskStatusExpired   = "expired"   // 超过保留时间，ZIP已删除
+)
+
+const (
+	MaxStreamArchiveFiles = 2000  // 同步流式下载的文件数上限
+	MaxAsyncArchiveFiles  = 50000 // 异步打包的文件数上限
+)
+
+// FileArchiveReq 批量下载请求：按时间范围或指定文件key打包设备文件
+type FileArchiveReq struct {
+	DevID      DeviceID `json:"dev_id" binding:"required"`
+	BucketName string   `json:"bucket_name" binding:"required"`
+	StartTime  *int64   `json:"start_time"`                         // Unix秒，按文件上传时间过滤
+	EndTime    *int64   `json:"end_time"`                           // Unix秒
+	Keys       []string `json:"keys" binding:"omitempty,max=10000"` // 指定文件key（指定时忽略时间范围）
+}
+
+// ArchiveEntry 打包的单个文件
+type ArchiveEntry struct {
+	BucketKey   string
+	Name        string // ZIP内的路径
+	ContentType string
+	Modified    time.Time
+}
+
+// FileArchiveTask 异步打包任务
+type FileArchiveTask struct {
+	TaskID      int64      `json:"task_id"`
+	DevID       DeviceID   `json:"dev_id"`
+	BucketName  string     `json:"bucket_name"`
+	Status      string     `json:"status"` // pending/running/succeeded/failed/expired
+	FileCount   int        `json:"file_count"`
+	Size        int64      `json:"size"`                  // ZIP大小（字节）
+	ArchiveKey  string     `json:"archive_key,omitempty"` // archive bucket中的对象key
+	ErrorMsg    string     `json:"error_msg,omitempty"`
+	UID         int64      `json:"uid"`
+	DownloadURL string     `json:"download_url,omitempty"` // 查询成功任务时生成
+	CreateAt    time.Time  `json:"create_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
@@ -0,0 +1,84 @@
+package model
+
+import "time"
+
+const (
+	FileOutboxStatusPending = "pending" // 等待删除MinIO对象
+	FileOutboxStatusDone    = "done"    // 已删除
+	FileOutboxStatusFailed  = "failed"  // 超过最大重试次数
+)
+
+const MaxFileOutboxAttempts = 10 // 删除补偿最大重试次数
+
+// FileEntry 文件目录条目（来自metadata表，data_type=file_data）
+type FileEntry struct {
+	DataID       int64                  `json:"data_id"`
+	DevID        DeviceID               `json:"dev_id"`
+	BucketName   string                 `json:"bucket_name"`
+	BucketKey    string                 `json:"bucket_key"`
+	Filename     string                 `json:"filename"`
+	ContentType  string                 `json:"content_type"`
+	Size         int64                  `json:"size,omitempty"`
+	ThumbnailURL string                 `json:"thumbnail_url,omitempty"` // 默认缩略图（仅图片）
+	QualityScore string                 `json:"quality_score"`
+	ExtraData    map[string]interface{} `json:"extra_data,omitempty"`
+	Timestamp    time.Time              `json:"timestamp"`
+}
+
+// FileCatalogQuery 文件目录查询条件
+type FileCatalogQuery struct {
+	Page        int
+	PageSize    int
+	DevID       int64  // 为0表示不限设备（普通用户限定为有权限的设备）
+	BucketName  string // 精确匹配
+	Keyword     string // 匹配文件名或bucket_key
+	ContentType string // 前缀匹配，如 image/
+	StartTime   *int64 // Unix秒
+	EndTime     *int64 // Unix秒
+}
+
+// FileDeleteOutbox 文件删除补偿记录：metadata删除与MinIO删除之间的待办
+type FileDeleteOutbox struct {
+	ID         int64     `json:"id"`
+	DataID     int64     `json:"data_id"`
+	BucketName string    `json:"bucket_name"`
+	BucketKey  string    `json:"bucket_key"`
+	Status     string    `json:"status"`
+	Attempts   int       `json:"attempts"`
+	LastError  string    `json:"last_error,omitempty"`
+	CreateAt   time.Time `json:"create_at"`
+	UpdateAt   time.Time `json:"update_at"`
+}
+
+// ReconcileFilesReq 文件对账请求
+type ReconcileFilesReq struct {
+	BucketName string   `json:"bucket_name" binding:"required"`
+	DevID      DeviceID `json:"dev_id"` // 为空表示整个bucket
+	Fix        bool     `json:"fix"`    // false只生成报告
+}
+
+// OrphanMetadata 对象已不存在的metadata记录
+type OrphanMetadata struct {
+	DataID    int64    `json:"data_id"`
+	DevID     DeviceID `json:"dev_id"`
+	BucketKey string   `json:"bucket_key"`
+}
+
+// ReconcileReport 文件对账报告
+type ReconcileReport struct {
+	BucketName      string           `json:"bucket_name"`
+	DevID           DeviceID         `json:"dev_id,omitempty"`
+	ScannedObjects  int              `json:"scanned_objects"`
+	ScannedMetadata int              `json:"scanned_metadata"`
+	OrphanObjects   []string         `json:"orphan_objects"`  // MinIO中存在但没有metadata记录的对象
+	OrphanMetadata  []OrphanMetadata `json:"orphan_metadata"` // metadata存在但MinIO对象已丢失
+	// 原始文件已没有metadata的派生文件（缩略图等）
+	OrphanDerivatives  []string  `json:"orphan_derivatives"`
+	Fixed              bool      `json:"fixed"`
+	AdoptedObjects     int       `json:"adopted_objects"`     // 修复：为孤立对象补建的metadata数
+	RemovedMetadata    int       `json:"removed_metadata"`    // 修复：删除的孤立metadata数
+	RemovedDerivatives int       `json:"removed_derivatives"` // 修复：删除的孤立派生文件数
+	Errors             []string  `json:"errors,omitempty"`
+	StartedAt          time.Time `json:"started_at"`
+	FinishedAt         time.Time `json:"finished_at"`
+}
@@ -0,0 +1,92 @@
+package model
+
+import "time"
+
+const (
+	FirmwareBucketName = "firmware" // 固件存储bucket
+)
+
+const (
+	FirmwareStatusUploading = "uploading" // 等待上传
+	FirmwareStatusReady     = "ready"     // 已上传并校验通过
+)
+
+const (
+	RolloutStrategyPercentage = "percentage"  // 按百分比灰度
+	RolloutStrategyDeviceList = "device_list" // 按设备列表灰度
+
+	RolloutStatusActive    = "active"    // 进行中
+	RolloutStatusPaused    = "paused"    // 已暂停
+	RolloutStatusCompleted = "completed" // 已完成
+)
+
+// Firmware 固件版本
+type Firmware struct {
+	FwID        int64     `json:"fw_id"`
+	DevType     string    `json:"dev_type"`   // 适用设备类型
+	Model       string    `json:"model"`      // 适用硬件型号，为空表示该设备类型的所有型号
+	Version     string    `json:"version"`    // 固件版本
+	BucketKey   string    `json:"bucket_key"` // 在firmware bucket中的对象key
+	Size        int64     `json:"size"`       // 文件大小（字节）
+	Checksum    string    `json:"checksum"`   // SHA-256（十六进制）
+	Signature   string    `json:"signature"`  // 固件签名（由构建流水线生成，设备端校验）
+	ReleaseNote string    `json:"release_note"`
+	Status      string    `json:"status"` // uploading/ready
+	CreateBy    int64     `json:"create_by"`
+	CreateAt    time.Time `json:"create_at"`
+}
+
+// CreateFirmwareReq 创建固件版本请求
+type CreateFirmwareReq struct {
+	DevType     string `json:"dev_type" binding:"required"`
+	Model       string `json:"model"`
+	Version     string `json:"version" binding:"required"`
+	Filename    string `json:"filename" binding:"required"`
+	Checksum    string `json:"checksum" binding:"required,len=64,hexadecimal"`
+	Signature   string `json:"signature"`
+	ReleaseNote string `json:"release_note"`
+}
+
+// FirmwareRollout 固件灰度发布
+type FirmwareRollout struct {
+	RolloutID  int64      `json:"rollout_id"`
+	FwID       int64      `json:"fw_id"`
+	Strategy   string     `json:"strategy"`   // percentage/device_list
+	Percentage int        `json:"percentage"` // 0-100，strategy=percentage时有效
+	DevIDs     []DeviceID `json:"dev_ids"`    // strategy=device_list时有效
+	Status     string     `json:"status"`     // active/paused/completed
+	CreateBy   int64      `json:"create_by"`
+	CreateAt   time.Time  `json:"create_at"`
+	UpdateAt   time.Time  `json:"update_at"`
+}
+
+// CreateRolloutReq 创建灰度发布请求
+type CreateRolloutReq struct {
+	FwID       int64      `json:"fw_id" binding:"required"`
+	Strategy   string     `json:"strategy" binding:"required,oneof=percentage device_list"`
+	Percentage int        `json:"percentage" binding:"omitempty,min=0,max=100"`
+	DevIDs     []DeviceID `json:"dev_ids"`
+}
+
+// UpdateRolloutReq 更新灰度发布请求（调整比例/暂停/恢复）
+type UpdateRolloutReq struct {
+	RolloutID  int64  `json:"rollout_id" binding:"required"`
+	Status     string `json:"status" binding:"omitempty,oneof=active paused completed"`
+	Percentage *int   `json:"percentage" binding:"omitempty,min=0,max=100"`
+}
+
+// RolloutProgress 灰度发布进度
+type RolloutProgress struct {
+	RolloutID int64   `json:"rollout_id"`
+	Version   string  `json:"version"`
+	Targeted  int     `json:"targeted"` // 命中灰度的设备数
+	Updated   int     `json:"updated"`  // 已上报新版本的设备数
+	Pending   int     `json:"pending"`  // 尚未升级的设备数
+	Percent   float64 `json:"percent"`  // 完成百分比
+	Status    string  `json:"status"`
+}
+
+// FirmwareReportReq 设备上报当前固件版本请求
+type FirmwareReportReq struct {
+	Version string `json:"version" binding:"required"`
+}
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// IdempotencyKeyHeader 客户端提供幂等键的请求头
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+const MaxIdempotencyKeyLength = 255
+
+const (
+	IdempotencyStatusProcessing = "processing" // 首次请求处理中
+	IdempotencyStatusCompleted  = "completed"  // 已保存响应，重复请求直接返回
+)
+
+// IdempotencyRecord 幂等键记录：同一调用方（用户或设备）同一幂等键的首次请求与响应
+type IdempotencyRecord struct {
+	Scope        string    `json:"scope"` // u:{uid} 或 d:{dev_id}
+	Key          string    `json:"key"`
+	Method       string    `json:"method"`
+	Path         string    `json:"path"`
+	RequestHash  string    `json:"request_hash"` // 方法、路径与请求体的SHA-256
+	Status       string    `json:"status"`
+	ResponseCode int       `json:"response_code"`
+	ResponseBody []byte    `json:"-"`
+	ContentType  string    `json:"content_type"`
+	CreateAt     time.Time `json:"create_at"`
+	LockedUntil  time.Time `json:"locked_until"` // 处理租约：processing记录超过该时间未续期时可被重试请求接管
+	ExpireAt     time.Time `json:"expire_at"`
+}
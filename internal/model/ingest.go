@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// IngestJob 写入队列中的一次时序数据上传
+type IngestJob struct {
+	Metadata *Metadata `json:"metadata"`
+	Points   []Point   `json:"points"`
+}
+
+// IngestBatch 合并写入的一批上传（InfluxDB不可用时整批写入WAL）
+type IngestBatch struct {
+	Jobs     []*IngestJob `json:"jobs"`
+	CreateAt time.Time    `json:"create_at"`
+}
+
+// IngestWALSegment WAL中的一个文件（对应一批未写入InfluxDB的上传）
+type IngestWALSegment struct {
+	Name string
+	Size int64
+}
+
+// IngestStats 写入管道状态
+type IngestStats struct {
+	QueueLength   int   `json:"queue_length"`
+	QueueCapacity int   `json:"queue_capacity"`
+	Workers       int   `json:"workers"`
+	WALSegments   int   `json:"wal_segments"`
+	WALBytes      int64 `json:"wal_bytes"`
+	WALMaxBytes   int64 `json:"wal_max_bytes"`
+	InfluxDown    bool  `json:"influx_down"` // 最近一次写入失败，新的批次直接写入WAL
+}
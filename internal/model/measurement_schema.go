@@ -0,0 +1,82 @@
+package model
+
+import "time"
+
+// 字段类型
+const (
+	SchemaFieldTypeFloat  = "float"
+	SchemaFieldTypeInt    = "int"
+	SchemaFieldTypeBool   = "bool"
+	SchemaFieldTypeString = "string"
+)
+
+// MaxSchemaViolations 校验失败时最多返回的错误数量
+const MaxSchemaViolations = 100
+
+// MeasurementSchema 时序数据schema：按设备类型与measurement定义允许的字段与tag
+// 上传的数据点按schema校验，没有schema的measurement不校验
+type MeasurementSchema struct {
+	SchemaID    int64         `json:"schema_id"`
+	DevType     string        `json:"dev_type"`
+	Measurement string        `json:"measurement"`
+	Description string        `json:"description"`
+	Fields      []SchemaField `json:"fields"`
+	Tags        []SchemaTag   `json:"tags"`
+	Strict      bool          `json:"strict"` // 拒绝未定义的字段与tag
+	Coerce      bool          `json:"coerce"` // 允许将字符串等值转换为字段类型（如"12.3"转换为12.3）
+	Version     int           `json:"version"`
+	CreateBy    int64         `json:"create_by"`
+	CreateAt    time.Time     `json:"create_at"`
+	UpdateAt    time.Time     `json:"update_at"`
+}
+
+// SchemaField 字段定义
+type SchemaField struct {
+	Name        string   `json:"name" binding:"required,max=64"`
+	Type        string   `json:"type" binding:"required,oneof=float int bool string"`
+	Unit        string   `json:"unit,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Min         *float64 `json:"min,omitempty"`        // 数值字段的最小值（含）
+	Max         *float64 `json:"max,omitempty"`        // 数值字段的最大值（含）
+	NormalMin   *float64 `json:"normal_min,omitempty"` // 正常范围下限，超出不拒绝，降低质量评分
+	NormalMax   *float64 `json:"normal_max,omitempty"` // 正常范围上限
+	Required    bool     `json:"required"`
+}
+
+// SchemaTag tag定义
+type SchemaTag struct {
+	Name        string   `json:"name" binding:"required,max=64"`
+	Description string   `json:"description,omitempty"`
+	Values      []string `json:"values,omitempty"` // 允许的取值，为空表示不限
+	Required    bool     `json:"required"`
+}
+
+// CreateMeasurementSchemaReq 创建schema请求
+type CreateMeasurementSchemaReq struct {
+	DevType     string        `json:"dev_type" binding:"required,max=30"`
+	Measurement string        `json:"measurement" binding:"required,max=100"`
+	Description string        `json:"description" binding:"max=255"`
+	Fields      []SchemaField `json:"fields" binding:"required,min=1,dive"`
+	Tags        []SchemaTag   `json:"tags" binding:"omitempty,dive"`
+	Strict      bool          `json:"strict"`
+	Coerce      bool          `json:"coerce"`
+}
+
+// UpdateMeasurementSchemaReq 更新schema请求（只更新提供的字段）
+type UpdateMeasurementSchemaReq struct {
+	SchemaID    int64         `json:"schema_id" binding:"required"`
+	Description *string       `json:"description" binding:"omitempty,max=255"`
+	Fields      []SchemaField `json:"fields" binding:"omitempty,min=1,dive"` // 提供时整体替换
+	Tags        []SchemaTag   `json:"tags" binding:"omitempty,dive"`         // 提供时整体替换（[]表示清空）
+	Strict      *bool         `json:"strict"`
+	Coerce      *bool         `json:"coerce"`
+}
+
+// SchemaViolation 数据点不符合schema的原因
+type SchemaViolation struct {
+	Index       int    `json:"index"` // 数据点在series_data.points中的下标
+	Measurement string `json:"measurement"`
+	Field       string `json:"field,omitempty"`
+	Tag         string `json:"tag,omitempty"`
+	Message     string `json:"message"`
+}
@@ -0,0 +1,38 @@
+package model
+
+// 质量检查项
+const (
+	QualityCheckCompleteness = "completeness" // 缺失采样：实际点数与设备采样频率推算的点数之比
+	QualityCheckRange        = "range"        // 超出schema正常范围的数值
+	QualityCheckFlatline     = "flatline"     // 连续不变的数值（传感器卡死）
+	QualityCheckSpike        = "spike"        // 突变的数值
+	QualityCheckJitter       = "jitter"       // 采样间隔与预期间隔的偏差
+)
+
+// QualityAbnormalThreshold 低于该评分的数据视为异常
+const QualityAbnormalThreshold = 30
+
+// QualityReport 数据质量评分结果，记录在metadata.extra_data.quality
+type QualityReport struct {
+	Score      float64        `json:"score"` // 0-100，各检查项按权重加权
+	Model      string         `json:"model"` // 评分模型名称
+	PointCount int            `json:"point_count"`
+	Checks     []QualityCheck `json:"checks"` // 适用的检查项（没有可检查的数据时不列出）
+}
+
+// QualityCheck 单个检查项的结果
+type QualityCheck struct {
+	Name    string  `json:"name"`
+	Score   float64 `json:"score"` // 0-100
+	Weight  float64 `json:"weight"`
+	Checked int     `json:"checked"` // 参与检查的样本数
+	Failed  int     `json:"failed"`  // 不合格的样本数
+	Detail  string  `json:"detail,omitempty"`
+}
+
+// QualityInput 评分输入：一次上传的数据点及设备、schema信息
+type QualityInput struct {
+	Device  *Device
+	Points  []Point
+	Schemas map[string]*MeasurementSchema // 按measurement，没有schema的measurement不检查范围
+}
@@ -0,0 +1,78 @@
+package model
+
+import "time"
+
+// RetentionPolicy 数据保留策略：超过保留天数的数据由定时任务删除
+// 同一条数据命中多个策略时，以保留时间最长的策略为准
+type RetentionPolicy struct {
+	PolicyID      int64     `json:"policy_id"`
+	Name          string    `json:"name"`
+	DevType       string    `json:"dev_type"`    // 设备类型，为空表示所有设备
+	DataType      string    `json:"data_type"`   // time_series/file_data
+	Measurement   string    `json:"measurement"` // data_type=time_series时可选，匹配extra_data.measurement
+	BucketName    string    `json:"bucket_name"` // data_type=file_data时可选
+	RetentionDays int       `json:"retention_days"`
+	Enabled       bool      `json:"enabled"`
+	CreateBy      int64     `json:"create_by"`
+	CreateAt      time.Time `json:"create_at"`
+	UpdateAt      time.Time `json:"update_at"`
+}
+
+// CreateRetentionPolicyReq 创建保留策略请求
+type CreateRetentionPolicyReq struct {
+	Name          string `json:"name" binding:"required,max=100"`
+	DevType       string `json:"dev_type"`
+	DataType      string `json:"data_type" binding:"required,oneof=time_series file_data"`
+	Measurement   string `json:"measurement"`
+	BucketName    string `json:"bucket_name"`
+	RetentionDays int    `json:"retention_days" binding:"required,min=1"`
+	Enabled       *bool  `json:"enabled"` // 为空默认启用
+}
+
+// UpdateRetentionPolicyReq 更新保留策略请求（只更新提供的字段）
+type UpdateRetentionPolicyReq struct {
+	PolicyID      int64   `json:"policy_id" binding:"required"`
+	Name          *string `json:"name" binding:"omitempty,max=100"`
+	RetentionDays *int    `json:"retention_days" binding:"omitempty,min=1"`
+	Enabled       *bool   `json:"enabled"`
+}
+
+// RetentionReport 保留策略执行报告（dry_run时只统计不删除）
+type RetentionReport struct {
+	DryRun       bool                    `json:"dry_run"`
+	Policies     []RetentionPolicyReport `json:"policies"`
+	InfluxPeriod string                  `json:"influx_retention_period,omitempty"` // 同步到InfluxDB数据库的保留期
+	InfluxError  string                  `json:"influx_retention_error,omitempty"`  // 未同步保留期的原因
+	StartedAt    time.Time               `json:"started_at"`
+	FinishedAt   time.Time               `json:"finished_at"`
+}
+
+// RetentionPolicyReport 单个策略的执行结果
+type RetentionPolicyReport struct {
+	PolicyID        int64     `json:"policy_id"`
+	Name            string    `json:"name"`
+	DataType        string    `json:"data_type"`
+	Cutoff          time.Time `json:"cutoff"`           // 早于该时间的数据过期
+	ExpiredMetadata int64     `json:"expired_metadata"` // 过期的元数据数量
+	DeletedMetadata int64     `json:"deleted_metadata"`
+	DeletedFiles    int       `json:"deleted_files"`
+	ExpiredArchives int64     `json:"expired_archives"` // 过期的时序归档（Parquet）数量
+	DeletedArchives int       `json:"deleted_archives"`
+	SampleKeys      []string  `json:"sample_keys,omitempty"` // 过期文件示例（dry_run）
+	Error           string    `json:"error,omitempty"`
+}
+
+// Cutoff 过期时间点：早于该时间的数据过期
+func (p *RetentionPolicy) Cutoff(now time.Time) time.Time {
+	return now.AddDate(0, 0, -p.RetentionDays)
+}
+
+// Overlaps 两个策略覆盖的数据是否可能重叠（维度为空表示不限）
+func (p *RetentionPolicy) Overlaps(other *RetentionPolicy) bool {
+	if p.DataType != other.DataType {
+		return false
+	}
+	overlap := func(a, b string) bool { return a == "" || b == "" || a == b }
+	return overlap(p.DevType, other.DevType) && overlap(p.Measurement, other.Measurement) &&
+		overlap(p.BucketName, other.BucketName)
+}
@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+// RollupLevel 时序数据汇总粒度
+type RollupLevel struct {
+	Name  string        // 1m/1h/1d
+	Every time.Duration // 汇总窗口
+}
+
+// RollupLevels 支持的汇总粒度（由细到粗，粗粒度由上一级汇总结果计算）
+var RollupLevels = []RollupLevel{
+	{Name: "1m", Every: time.Minute},
+	{Name: "1h", Every: time.Hour},
+	{Name: "1d", Every: 24 * time.Hour},
+}
+
+// RollupWatermark 汇总水位线：[CoverageStart, Watermark)内的汇总数据已计算完成
+type RollupWatermark struct {
+	Measurement   string    `json:"measurement"`
+	Level         string    `json:"level"`
+	CoverageStart time.Time `json:"coverage_start"`
+	Watermark     time.Time `json:"watermark"`
+	UpdateAt      time.Time `json:"update_at"`
+}
+
+// RollupStatus measurement的汇总状态
+type RollupStatus struct {
+	Measurement string            `json:"measurement"`
+	Fields      []string          `json:"fields"`
+	Watermarks  []RollupWatermark `json:"watermarks"`
+}
+
+// RollupBackfillReq 重新计算历史汇总请求（用于迟到数据或新启用汇总的measurement）
+type RollupBackfillReq struct {
+	Measurement string `json:"measurement" binding:"required"`
+	StartTime   int64  `json:"start_time" binding:"required"` // Unix秒
+	EndTime     int64  `json:"end_time" binding:"required"`   // Unix秒
+}
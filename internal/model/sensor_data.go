@@ -21,9 +21,28 @@ type FileData struct {
 
 type FileList struct {
 	BucketKey    string `json:"bucket_key"`
-	PreviewUrl   string `json:"preview_url"`
+	PreviewUrl   string `json:"preview_url,omitempty"`   // 仅在with_preview=true时生成
+	ThumbnailURL string `json:"thumbnail_url,omitempty"` // 仅在with_preview=true且已生成缩略图时返回
 	Name         string `json:"name"`
 	ContentType  string `json:"content_type"`
 	LastModified string `json:"last_modified"`
 	Size         int64  `json:"size"`
 }
+
+// FileListQuery 文件列表查询条件（基于metadata目录，bucket_key start-after游标分页）
+type FileListQuery struct {
+	BucketName  string
+	DevID       int64
+	PageSize    int
+	StartAfter  string // 游标：上一页返回的next_start_after
+	StartDate   string // 起始日期 YYYY-MM-DD（含），按key中的YYYY/MM/DD过滤
+	EndDate     string // 结束日期 YYYY-MM-DD（含）
+	WithPreview bool   // 是否为本页文件生成预览URL
+}
+
+// FileListPage 文件列表分页结果
+type FileListPage struct {
+	Items          []FileList `json:"items"`
+	NextStartAfter string     `json:"next_start_after,omitempty"`
+	HasMore        bool       `json:"has_more"`
+}
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// SeriesArchivePrefix 时序归档在archive bucket中的前缀
+const SeriesArchivePrefix = "timeseries"
+
+// SeriesArchive 时序数据归档清单：某measurement某设备一天的数据对应一个Parquet文件
+type SeriesArchive struct {
+	ArchiveID   int64     `json:"archive_id"`
+	Measurement string    `json:"measurement"`
+	DevID       DeviceID  `json:"dev_id"`
+	Day         time.Time `json:"day"` // UTC日期
+	BucketName  string    `json:"bucket_name"`
+	ObjectKey   string    `json:"object_key"`
+	RowCount    int64     `json:"row_count"`
+	Size        int64     `json:"size"`
+	CreateAt    time.Time `json:"create_at"`
+}
+
+// SeriesArchiveWatermark measurement的归档进度（该日期之前的数据已归档）
+type SeriesArchiveWatermark struct {
+	Measurement string    `json:"measurement"`
+	ArchivedTo  time.Time `json:"archived_to"`
+	UpdateAt    time.Time `json:"update_at"`
+}
@@ -0,0 +1,41 @@
+package model
+
+import "time"
+
+const (
+	SeriesOutboxStatusQueued     = "queued"     // 已进入写入队列，由写入管道写入InfluxDB
+	SeriesOutboxStatusPending    = "pending"    // 已记录写入意图，InfluxDB写入结果未知
+	SeriesOutboxStatusWritten    = "written"    // InfluxDB已写入，等待创建metadata
+	SeriesOutboxStatusCompleted  = "completed"  // metadata已创建
+	SeriesOutboxStatusTombstoned = "tombstoned" // 已补偿：不创建metadata，已写入的数据点在查询时过滤
+)
+
+const MaxSeriesOutboxAttempts = 5 // 时序写入补偿最大重试次数，超过后标记为tombstoned
+
+// SeriesWriteOutbox 时序数据写入记录：InfluxDB写入与metadata创建之间的待办
+type SeriesWriteOutbox struct {
+	DataID       int64     `json:"data_id"`
+	DevID        DeviceID  `json:"dev_id"`
+	Status       string    `json:"status"`
+	PointCount   int       `json:"point_count"`
+	MinTimestamp int64     `json:"min_timestamp"` // 数据点时间范围（Unix秒），用于查询时过滤tombstone
+	MaxTimestamp int64     `json:"max_timestamp"`
+	Attempts     int       `json:"attempts"`
+	LastError    string    `json:"last_error,omitempty"`
+	CreateAt     time.Time `json:"create_at"`
+	UpdateAt     time.Time `json:"update_at"`
+	// 重试所需的完整写入内容，完成或补偿后清空
+	Metadata *Metadata `json:"-"`
+	Points   []Point   `json:"-"`
+}
+
+// SeriesOutboxStats 时序写入补偿统计
+type SeriesOutboxStats struct {
+	Queued        int64                `json:"queued"`
+	Pending       int64                `json:"pending"`
+	Written       int64                `json:"written"`
+	Tombstoned    int64                `json:"tombstoned"`
+	Stuck         int64                `json:"stuck"`                     // 超过stuck_after仍未完成的记录
+	OldestStuckAt *time.Time           `json:"oldest_stuck_at,omitempty"` // 最早的未完成记录创建时间
+	StuckEntries  []*SeriesWriteOutbox `json:"stuck_entries"`             // 最早的若干条未完成记录
+}
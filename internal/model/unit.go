@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// MetadataUnitsKey 上传时在metadata.extra_data中声明字段单位，如 {"units": {"temperature": "°F"}}
+const MetadataUnitsKey = "units"
+
+// FieldUnit 设备字段的存储单位（schema没有定义单位时，以设备首次声明的单位为准，之后声明的单位转换为该单位写入）
+type FieldUnit struct {
+	DevID       int64     `json:"dev_id"`
+	Measurement string    `json:"measurement"`
+	Field       string    `json:"field"`
+	Unit        string    `json:"unit"`
+	CreateAt    time.Time `json:"create_at"`
+}
@@ -0,0 +1,136 @@
+package model
+
+import "time"
+
+const (
+	UploadSessionStatusPending   = "pending"   // 已签发上传URL，等待上传完成
+	UploadSessionStatusCompleted = "completed" // 已确认（显式确认或存储事件），已创建metadata
+	UploadSessionStatusExpired   = "expired"   // 超时未确认
+	UploadSessionStatusAborted   = "aborted"   // 分片上传已取消
+	UploadSessionStatusRejected  = "rejected"  // 内容校验失败（SHA-256不一致），对象已删除
+)
+
+const (
+	UploadSourceConfirm = "confirm" // 客户端显式调用file_data确认
+	UploadSourceEvent   = "event"   // MinIO存储事件自动确认
+)
+
+// UploadSession 文件上传会话（预签名PUT URL与metadata之间的关联）
+type UploadSession struct {
+	UploadID    string     `json:"upload_id"`
+	DevID       DeviceID   `json:"dev_id"`
+	BucketName  string     `json:"bucket_name"`
+	BucketKey   string     `json:"bucket_key"`
+	Filename    string     `json:"filename"`
+	ContentType string     `json:"content_type"`
+	UID         int64      `json:"uid"`
+	Status      string     `json:"status"`
+	DataID      int64      `json:"data_id,omitempty"` // 确认后生成的metadata data_id
+	Size        int64      `json:"size,omitempty"`
+	ETag        string     `json:"etag,omitempty"`
+	Source      string     `json:"source,omitempty"` // confirm/event
+	SHA256      string     `json:"sha256,omitempty"` // 客户端声明的SHA-256（十六进制），确认时校验
+	CreateAt    time.Time  `json:"create_at"`
+	ExpireAt    time.Time  `json:"expire_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	// 分片上传（为空表示单个预签名PUT上传）
+	MultipartUploadID string `json:"-"`                   // MinIO的uploadId，不返回给客户端
+	PartSize          int64  `json:"part_size,omitempty"` // 分片大小（字节）
+	FileSize          int64  `json:"file_size,omitempty"` // 客户端声明的文件大小（字节）
+}
+
+// ObjectStat MinIO对象信息
+type ObjectStat struct {
+	Size         int64
+	ETag         string
+	ContentType  string
+	LastModified time.Time
+}
+
+// BucketNotification MinIO存储事件通知（webhook请求体，与ListenBucketNotification的记录格式一致）
+type BucketNotification struct {
+	EventName string              `json:"EventName"`
+	Key       string              `json:"Key"`
+	Records   []BucketEventRecord `json:"Records"`
+}
+
+// BucketEventRecord 单条存储事件（S3事件格式，只保留需要的字段）
+type BucketEventRecord struct {
+	EventName string `json:"eventName"`
+	EventTime string `json:"eventTime"`
+	S3        struct {
+		Bucket struct {
+			Name string `json:"name"`
+		} `json:"bucket"`
+		Object struct {
+			Key         string `json:"key"` // URL编码
+			Size        int64  `json:"size,omitempty"`
+			ETag        string `json:"eTag,omitempty"`
+			ContentType string `json:"contentType,omitempty"`
+		} `json:"object"`
+	} `json:"s3"`
+}
+
+// InitMultipartUploadReq 初始化分片上传请求
+type InitMultipartUploadReq struct {
+	DevID       DeviceID `json:"dev_id" binding:"required"`
+	Filename    string   `json:"filename" binding:"required"`
+	BucketName  string   `json:"bucket_name"`
+	ContentType string   `json:"content_type"`
+	FileSize    int64    `json:"file_size" binding:"required,gt=0"` // 文件大小（字节），用于计算分片大小
+	// 可选：文件SHA-256（十六进制），用于重复检测与上传后校验
+	SHA256         string `json:"sha256" binding:"omitempty,len=64,hexadecimal"`
+	AllowDuplicate bool   `json:"allow_duplicate"` // 设备已有相同内容的文件时仍然上传
+}
+
+// MultipartUploadInfo 初始化分片上传结果
+// duplicate=true时表示设备已有相同内容的文件，不创建上传，bucket_name/bucket_key/data_id为已有文件
+type MultipartUploadInfo struct {
+	UploadID   string    `json:"upload_id,omitempty"`
+	BucketName string    `json:"bucket_name"`
+	BucketKey  string    `json:"bucket_key"`
+	PartSize   int64     `json:"part_size,omitempty"`
+	PartCount  int       `json:"part_count,omitempty"`
+	ExpireAt   time.Time `json:"expire_at,omitempty"`
+	Duplicate  bool      `json:"duplicate"`
+	DataID     int64     `json:"data_id,omitempty"`
+}
+
+// PresignUploadPartsReq 获取分片上传URL请求（按需获取，分片号从1开始）
+type PresignUploadPartsReq struct {
+	UploadID    string `json:"upload_id" binding:"required"`
+	PartNumbers []int  `json:"part_numbers" binding:"required,min=1,max=100"`
+}
+
+// UploadPartURL 分片预签名URL
+type UploadPartURL struct {
+	PartNumber int    `json:"part_number"`
+	URL        string `json:"url"`
+}
+
+// UploadedPart 已上传的分片（用于断点续传）
+type UploadedPart struct {
+	PartNumber   int       `json:"part_number"`
+	ETag         string    `json:"etag"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// CompletedPart 完成上传时提交的分片
+type CompletedPart struct {
+	PartNumber int    `json:"part_number" binding:"required"`
+	ETag       string `json:"etag" binding:"required"`
+}
+
+// CompleteMultipartUploadReq 完成分片上传请求（parts为空时使用服务端已上传的全部分片）
+type CompleteMultipartUploadReq struct {
+	UploadID     string          `json:"upload_id" binding:"required"`
+	Parts        []CompletedPart `json:"parts" binding:"omitempty,dive"`
+	QualityScore string          `json:"quality_score"`
+	ExtraData    map[string]any  `json:"extra_data"`
+}
+
+// AbortMultipartUploadReq 取消分片上传请求
+type AbortMultipartUploadReq struct {
+	UploadID string `json:"upload_id" binding:"required"`
+}
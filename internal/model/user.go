@@ -5,6 +5,7 @@ import "time"
 const (
 	RoleAdmin = "admin"
 	RoleUser = "user"
+	RoleDevice = "device" // 设备凭证（仅用于设备端接口）
 )
 
 type User struct{
@@ -0,0 +1,86 @@
+package repo
+
+import (
+	"encoding/json"
+	"strings"
+
+	"backend/internal/db/mysql"
+	"backend/internal/model"
+)
+
+type AnomalyRepository struct{}
+
+func NewAnomalyRepository() *AnomalyRepository {
+	return &AnomalyRepository{}
+}
+
+// ListBaselines 获取设备的异常检测基线，measurement为空表示全部
+func (r *AnomalyRepository) ListBaselines(devID int64, measurement string) ([]*model.AnomalyBaseline, error) {
+	query := `SELECT dev_id, measurement, field, mean, variance, sample_count, hourly, update_at
+		FROM anomaly_baseline WHERE dev_id = ?`
+	args := []interface{}{devID}
+	if measurement != "" {
+		query += " AND measurement = ?"
+		args = append(args, measurement)
+	}
+	query += " ORDER BY measurement ASC, field ASC"
+
+	rows, err := mysql.MysqlCli.Client.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	baselines := make([]*model.AnomalyBaseline, 0)
+	for rows.Next() {
+		b := &model.AnomalyBaseline{}
+		var hourlyJSON string
+		if err := rows.Scan(&b.DevID, &b.Measurement, &b.Field, &b.Overall.Mean, &b.Overall.Variance, &b.Overall.Count,
+			&hourlyJSON, &b.UpdateAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(hourlyJSON), &b.Hourly); err != nil {
+			return nil, err
+		}
+		baselines = append(baselines, b)
+	}
+	return baselines, rows.Err()
+}
+
+// SaveBaselines 批量保存基线（存在则覆盖）
+func (r *AnomalyRepository) SaveBaselines(baselines []*model.AnomalyBaseline) error {
+	if len(baselines) == 0 {
+		return nil
+	}
+	placeholders := make([]string, 0, len(baselines))
+	args := make([]interface{}, 0, len(baselines)*8)
+	for _, b := range baselines {
+		hourlyJSON, err := json.Marshal(b.Hourly)
+		if err != nil {
+			return err
+		}
+		placeholders = append(placeholders, "(?, ?, ?, ?, ?, ?, ?, ?)")
+		args = append(args, b.DevID, b.Measurement, b.Field, b.Overall.Mean, b.Overall.Variance, b.Overall.Count,
+			string(hourlyJSON), b.UpdateAt)
+	}
+	_, err := mysql.MysqlCli.Client.Exec(`INSERT INTO anomaly_baseline (dev_id, measurement, field, mean, variance,
+		sample_count, hourly, update_at) VALUES `+strings.Join(placeholders, ", ")+`
+		ON DUPLICATE KEY UPDATE mean = VALUES(mean), variance = VALUES(variance), sample_count = VALUES(sample_count),
+		hourly = VALUES(hourly), update_at = VALUES(update_at)`, args...)
+	return err
+}
+
+// DeleteBaselines 删除设备的基线（重新学习），measurement为空表示全部，返回删除数量
+func (r *AnomalyRepository) DeleteBaselines(devID int64, measurement string) (int64, error) {
+	query := `DELETE FROM anomaly_baseline WHERE dev_id = ?`
+	args := []interface{}{devID}
+	if measurement != "" {
+		query += " AND measurement = ?"
+		args = append(args, measurement)
+	}
+	result, err := mysql.MysqlCli.Client.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,128 @@
+package repo
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"backend/internal/db/influxdb"
+	"backend/internal/db/mysql"
+	"backend/internal/model"
+)
+
+type CalibrationRepository struct{}
+
+func NewCalibrationRepository() *CalibrationRepository {
+	return &CalibrationRepository{}
+}
+
+const calibrationProfileColumns = `profile_id, dev_id, measurement, field, type, coefficients, valid_from, version,
+	keep_raw, description, create_by, create_at, update_at`
+
+// CreateProfile 创建校准配置（同一设备字段的valid_from唯一）
+func (r *CalibrationRepository) CreateProfile(profile *model.CalibrationProfile) error {
+	coefficientsJSON, err := json.Marshal(profile.Coefficients)
+	if err != nil {
+		return err
+	}
+	_, err = mysql.MysqlCli.Client.Exec(`INSERT INTO calibration_profile (profile_id, dev_id, measurement, field, type,
+		coefficients, valid_from, version, keep_raw, description, create_by, create_at, update_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		profile.ProfileID, profile.DevID, profile.Measurement, profile.Field, profile.Type, string(coefficientsJSON),
+		profile.ValidFrom, profile.Version, profile.KeepRaw, profile.Description, profile.CreateBy, profile.CreateAt,
+		profile.UpdateAt)
+	if err != nil && strings.Contains(err.Error(), "Duplicate entry") {
+		return errors.New("该设备字段在相同生效时间已存在校准配置")
+	}
+	return err
+}
+
+// GetProfile 获取校准配置
+func (r *CalibrationRepository) GetProfile(profileID int64) (*model.CalibrationProfile, error) {
+	query := `SELECT ` + calibrationProfileColumns + ` FROM calibration_profile WHERE profile_id = ?`
+	profile, err := scanCalibrationProfile(mysql.MysqlCli.Client.QueryRow(query, profileID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("校准配置不存在")
+		}
+		return nil, err
+	}
+	return profile, nil
+}
+
+// ListProfiles 获取设备的校准配置（按measurement、字段、生效时间升序），measurement/field为空表示不限
+func (r *CalibrationRepository) ListProfiles(devID int64, measurement, field string) ([]*model.CalibrationProfile, error) {
+	query := `SELECT ` + calibrationProfileColumns + ` FROM calibration_profile WHERE dev_id = ?`
+	args := []interface{}{devID}
+	if measurement != "" {
+		query += " AND measurement = ?"
+		args = append(args, measurement)
+	}
+	if field != "" {
+		query += " AND field = ?"
+		args = append(args, field)
+	}
+	query += " ORDER BY measurement ASC, field ASC, valid_from ASC"
+
+	rows, err := mysql.MysqlCli.Client.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := make([]*model.CalibrationProfile, 0)
+	for rows.Next() {
+		profile, err := scanCalibrationProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, rows.Err()
+}
+
+// UpdateProfile 更新校准配置
+func (r *CalibrationRepository) UpdateProfile(profile *model.CalibrationProfile) error {
+	coefficientsJSON, err := json.Marshal(profile.Coefficients)
+	if err != nil {
+		return err
+	}
+	_, err = mysql.MysqlCli.Client.Exec(`UPDATE calibration_profile SET type = ?, coefficients = ?, version = ?,
+		keep_raw = ?, description = ?, update_at = ? WHERE profile_id = ?`,
+		profile.Type, string(coefficientsJSON), profile.Version, profile.KeepRaw, profile.Description, profile.UpdateAt,
+		profile.ProfileID)
+	return err
+}
+
+// DeleteProfile 删除校准配置
+func (r *CalibrationRepository) DeleteProfile(profileID int64) error {
+	_, err := mysql.MysqlCli.Client.Exec(`DELETE FROM calibration_profile WHERE profile_id = ?`, profileID)
+	return err
+}
+
+// QueryDevicePoints 获取设备在[from, to)内的原始数据点（含全部tag与字段）
+func (r *CalibrationRepository) QueryDevicePoints(measurement string, devID int64, from, to time.Time) ([]model.Point, error) {
+	if influxdb.InfluxDBCli == nil {
+		return nil, fmt.Errorf("InfluxDB客户端未初始化")
+	}
+	return influxdb.InfluxDBCli.QueryDevicePoints(measurement, fmt.Sprintf("%d", devID), from, to)
+}
+
+// scanCalibrationProfile 扫描校准配置
+func scanCalibrationProfile(row rowScanner) (*model.CalibrationProfile, error) {
+	profile := &model.CalibrationProfile{}
+	var coefficientsJSON string
+	err := row.Scan(&profile.ProfileID, &profile.DevID, &profile.Measurement, &profile.Field, &profile.Type,
+		&coefficientsJSON, &profile.ValidFrom, &profile.Version, &profile.KeepRaw, &profile.Description,
+		&profile.CreateBy, &profile.CreateAt, &profile.UpdateAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(coefficientsJSON), &profile.Coefficients); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
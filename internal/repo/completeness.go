@@ -0,0 +1,77 @@
+package repo
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+
+	"backend/internal/db/influxdb"
+	"backend/internal/db/minio"
+	"backend/internal/db/mysql"
+	"backend/internal/model"
+)
+
+type CompletenessRepository struct{}
+
+func NewCompletenessRepository() *CompletenessRepository {
+	return &CompletenessRepository{}
+}
+
+// GetCoverage 获取设备在[from, to)内的数据点数量与首尾时间
+func (r *CompletenessRepository) GetCoverage(measurement string, devID int64, from, to time.Time) (int64, time.Time, time.Time, error) {
+	if influxdb.InfluxDBCli == nil {
+		return 0, time.Time{}, time.Time{}, fmt.Errorf("InfluxDB客户端未初始化")
+	}
+	return influxdb.InfluxDBCli.SeriesCoverage(measurement, strconv.FormatInt(devID, 10), from, to)
+}
+
+// FindGaps 获取设备在[from, to)内间隔超过threshold的相邻数据点
+func (r *CompletenessRepository) FindGaps(measurement string, devID int64, from, to time.Time, threshold time.Duration, limit int) ([][2]time.Time, error) {
+	if influxdb.InfluxDBCli == nil {
+		return nil, fmt.Errorf("InfluxDB客户端未初始化")
+	}
+	return influxdb.InfluxDBCli.FindGaps(measurement, strconv.FormatInt(devID, 10), from, to, threshold, limit)
+}
+
+// ListSeriesMeasurements 获取设备在[from, to)内上传过的时序数据measurement（按metadata.extra_data.measurement）
+func (r *CompletenessRepository) ListSeriesMeasurements(devID int64, from, to time.Time) ([]string, error) {
+	rows, err := mysql.MysqlCli.Client.Query(`SELECT DISTINCT `+seriesMeasurementExpr+` FROM metadata
+		WHERE dev_id = ? AND data_type = ? AND timestamp >= ? AND timestamp < ? AND `+seriesMeasurementExpr+` IS NOT NULL`,
+		devID, model.DataTypeSeries, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	measurements := make([]string, 0)
+	for rows.Next() {
+		var m string
+		if err := rows.Scan(&m); err != nil {
+			return nil, err
+		}
+		if m != "" {
+			measurements = append(measurements, m)
+		}
+	}
+	return measurements, rows.Err()
+}
+
+// SaveReport 保存报告文件到archive bucket
+func (r *CompletenessRepository) SaveReport(objectKey string, data []byte, contentType string) error {
+	if minio.MinIOCli == nil {
+		return fmt.Errorf("MinIO客户端未初始化")
+	}
+	return minio.MinIOCli.PutObjectFromReader(model.ArchiveBucketName, objectKey, bytes.NewReader(data), int64(len(data)), contentType)
+}
+
+// PresignReport 生成报告文件的下载URL（报告不存在时返回错误）
+func (r *CompletenessRepository) PresignReport(objectKey string) (string, error) {
+	if minio.MinIOCli == nil {
+		return "", fmt.Errorf("MinIO客户端未初始化")
+	}
+	if _, err := minio.MinIOCli.GetObjectInfo(model.ArchiveBucketName, objectKey); err != nil {
+		return "", fmt.Errorf("报告不存在")
+	}
+	return minio.MinIOCli.PresignedGetObject(model.ArchiveBucketName, objectKey, PresignedURLExpiry)
+}
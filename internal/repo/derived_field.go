@@ -0,0 +1,117 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"backend/internal/db/influxdb"
+	"backend/internal/db/mysql"
+	"backend/internal/model"
+)
+
+type DerivedFieldRepository struct{}
+
+func NewDerivedFieldRepository() *DerivedFieldRepository {
+	return &DerivedFieldRepository{}
+}
+
+const derivedFieldColumns = `field_id, dev_type, measurement, name, expression, mode, unit, description,
+	create_by, create_at, update_at`
+
+// CreateField 创建派生字段（同一设备类型与measurement下名称唯一）
+func (r *DerivedFieldRepository) CreateField(field *model.DerivedField) error {
+	_, err := mysql.MysqlCli.Client.Exec(`INSERT INTO derived_field (field_id, dev_type, measurement, name, expression,
+		mode, unit, description, create_by, create_at, update_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		field.FieldID, field.DevType, field.Measurement, field.Name, field.Expression, field.Mode, field.Unit,
+		field.Description, field.CreateBy, field.CreateAt, field.UpdateAt)
+	if err != nil && strings.Contains(err.Error(), "Duplicate entry") {
+		return errors.New("该设备类型的measurement已存在同名派生字段")
+	}
+	return err
+}
+
+// GetField 获取派生字段
+func (r *DerivedFieldRepository) GetField(fieldID int64) (*model.DerivedField, error) {
+	query := `SELECT ` + derivedFieldColumns + ` FROM derived_field WHERE field_id = ?`
+	field, err := scanDerivedField(mysql.MysqlCli.Client.QueryRow(query, fieldID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("派生字段不存在")
+		}
+		return nil, err
+	}
+	return field, nil
+}
+
+// ListFields 获取派生字段列表，devTypes/measurement/mode为空表示不限
+func (r *DerivedFieldRepository) ListFields(devTypes []string, measurement, mode string) ([]*model.DerivedField, error) {
+	query := `SELECT ` + derivedFieldColumns + ` FROM derived_field WHERE 1 = 1`
+	args := make([]interface{}, 0, len(devTypes)+2)
+	if len(devTypes) > 0 {
+		query += " AND dev_type IN (?" + strings.Repeat(", ?", len(devTypes)-1) + ")"
+		for _, devType := range devTypes {
+			args = append(args, devType)
+		}
+	}
+	if measurement != "" {
+		query += " AND measurement = ?"
+		args = append(args, measurement)
+	}
+	if mode != "" {
+		query += " AND mode = ?"
+		args = append(args, mode)
+	}
+	query += " ORDER BY dev_type ASC, measurement ASC, name ASC"
+
+	rows, err := mysql.MysqlCli.Client.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fields := make([]*model.DerivedField, 0)
+	for rows.Next() {
+		field, err := scanDerivedField(rows)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+	return fields, rows.Err()
+}
+
+// UpdateField 更新派生字段
+func (r *DerivedFieldRepository) UpdateField(field *model.DerivedField) error {
+	_, err := mysql.MysqlCli.Client.Exec(`UPDATE derived_field SET expression = ?, mode = ?, unit = ?, description = ?,
+		update_at = ? WHERE field_id = ?`,
+		field.Expression, field.Mode, field.Unit, field.Description, field.UpdateAt, field.FieldID)
+	return err
+}
+
+// DeleteField 删除派生字段
+func (r *DerivedFieldRepository) DeleteField(fieldID int64) error {
+	_, err := mysql.MysqlCli.Client.Exec(`DELETE FROM derived_field WHERE field_id = ?`, fieldID)
+	return err
+}
+
+// scanDerivedField 扫描派生字段
+// GetMeasurementColumns 获取InfluxDB中measurement已有的列名（tag、field与time）
+func (r *DerivedFieldRepository) GetMeasurementColumns(measurement string) (map[string]bool, error) {
+	if influxdb.InfluxDBCli == nil {
+		return nil, fmt.Errorf("InfluxDB客户端未初始化")
+	}
+	return influxdb.InfluxDBCli.MeasurementColumns(measurement)
+}
+
+func scanDerivedField(row rowScanner) (*model.DerivedField, error) {
+	field := &model.DerivedField{}
+	err := row.Scan(&field.FieldID, &field.DevType, &field.Measurement, &field.Name, &field.Expression, &field.Mode,
+		&field.Unit, &field.Description, &field.CreateBy, &field.CreateAt, &field.UpdateAt)
+	if err != nil {
+		return nil, err
+	}
+	return field, nil
+}
@@ -7,6 +7,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"time"
 )
 
 type DeviceRepository struct{}
@@ -54,6 +55,29 @@ func (r *DeviceRepository) GetDevice(devID int64) (*model.Device, error) {
 	return device, nil
 }
 
+// GetDeviceTokenVersion 获取设备当前的凭证版本号（设备不存在时返回sql.ErrNoRows）
+func (r *DeviceRepository) GetDeviceTokenVersion(devID int64) (int64, error) {
+	var version int64
+	err := mysql.MysqlCli.Client.QueryRow("SELECT token_version FROM device WHERE dev_id = ?", devID).Scan(&version)
+	return version, err
+}
+
+// IncrDeviceTokenVersion 递增设备凭证版本号，使已签发的设备凭证全部失效
+func (r *DeviceRepository) IncrDeviceTokenVersion(devID int64) error {
+	result, err := mysql.MysqlCli.Client.Exec("UPDATE device SET token_version = token_version + 1 WHERE dev_id = ?", devID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
 // GetDevices 获取设备列表（分页）
 func (r *DeviceRepository) GetDevices(page, pageSize int, devType string, devStatus *int, keyword, sortBy, sortOrder string) ([]*model.Device, int64, error) {
 	whereClause := "WHERE 1=1"
@@ -153,6 +177,18 @@ func (r *DeviceRepository) UpdateDevice(device *model.Device) error {
 	return nil
 }
 
+// UpdateDeviceLiveness 更新设备在线状态和最新电量（battery为nil时保留原值）
+func (r *DeviceRepository) UpdateDeviceLiveness(devID int64, devStatus int, battery *int, updateAt time.Time) error {
+	if battery != nil {
+		_, err := mysql.MysqlCli.Client.Exec(`UPDATE device SET dev_status = ?, dev_power = ?, update_at = ? WHERE dev_id = ?`,
+			devStatus, *battery, updateAt, devID)
+		return err
+	}
+	_, err := mysql.MysqlCli.Client.Exec(`UPDATE device SET dev_status = ?, update_at = ? WHERE dev_id = ?`,
+		devStatus, updateAt, devID)
+	return err
+}
+
 // DeleteDevice 删除设备（级联删除user_dev中的绑定关系）
 func (r *DeviceRepository) DeleteDevice(devID int64) error {
 	// 开启事务
@@ -0,0 +1,211 @@
+package repo
+
+import (
+	"backend/internal/db/mysql"
+	"backend/internal/model"
+	"backend/pkg/utils"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+type DeviceCommandRepository struct{}
+
+func NewDeviceCommandRepository() *DeviceCommandRepository {
+	return &DeviceCommandRepository{}
+}
+
+const deviceCommandColumns = `c.cmd_id, c.dev_id, c.command, c.payload, c.status, c.result, c.issued_by,
+	c.ttl, c.expire_at, c.create_at, c.delivered_at, c.finished_at`
+
+// CreateDeviceCommand 创建设备命令
+func (r *DeviceCommandRepository) CreateDeviceCommand(cmd *model.DeviceCommand) error {
+	payloadJSON, _ := json.Marshal(cmd.Payload)
+
+	query := `INSERT INTO device_command (cmd_id, dev_id, command, payload, status, issued_by, ttl, expire_at, create_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := mysql.MysqlCli.Client.Exec(query,
+		cmd.CmdID, cmd.DevID, cmd.Command, string(payloadJSON), cmd.Status,
+		cmd.IssuedBy, cmd.TTL, cmd.ExpireAt, cmd.CreateAt)
+	return err
+}
+
+// GetDeviceCommand 获取设备命令
+func (r *DeviceCommandRepository) GetDeviceCommand(cmdID int64) (*model.DeviceCommand, error) {
+	query := `SELECT ` + deviceCommandColumns + `, IFNULL(u.username, '')
+		FROM device_command c LEFT JOIN user u ON c.issued_by = u.uid
+		WHERE c.cmd_id = ?`
+	cmd, err := scanDeviceCommand(mysql.MysqlCli.Client.QueryRow(query, cmdID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("命令不存在")
+		}
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// GetDeviceCommands 获取设备命令历史（分页，按创建时间倒序）
+func (r *DeviceCommandRepository) GetDeviceCommands(devID int64, status string, page, pageSize int) ([]*model.DeviceCommand, int64, error) {
+	whereClause := "WHERE c.dev_id = ?"
+	args := []interface{}{devID}
+
+	if !utils.IsEmpty(status) {
+		whereClause += " AND c.status = ?"
+		args = append(args, status)
+	}
+
+	var total int64
+	countQuery := "SELECT COUNT(*) FROM device_command c " + whereClause
+	if err := mysql.MysqlCli.Client.QueryRow(countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	query := `SELECT ` + deviceCommandColumns + `, IFNULL(u.username, '')
+		FROM device_command c LEFT JOIN user u ON c.issued_by = u.uid
+		` + whereClause + `
+		ORDER BY c.cmd_id DESC
+		LIMIT ? OFFSET ?`
+	args = append(args, pageSize, offset)
+
+	rows, err := mysql.MysqlCli.Client.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	commands := make([]*model.DeviceCommand, 0)
+	for rows.Next() {
+		cmd, err := scanDeviceCommand(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		commands = append(commands, cmd)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return commands, total, nil
+}
+
+// ExpireDeviceCommands 将已超过TTL且未完成的命令标记为expired
+func (r *DeviceCommandRepository) ExpireDeviceCommands(devID int64, now time.Time) error {
+	query := `UPDATE device_command SET status = ?, finished_at = ?
+		WHERE dev_id = ? AND status IN (?, ?) AND expire_at < ?`
+	_, err := mysql.MysqlCli.Client.Exec(query,
+		model.CommandStatusExpired, now, devID,
+		model.CommandStatusPending, model.CommandStatusDelivered, now)
+	return err
+}
+
+// DeliverPendingCommands 按FIFO顺序取出设备待下发的命令并标记为delivered（事务内加锁，避免重复下发）
+func (r *DeviceCommandRepository) DeliverPendingCommands(devID int64, limit int, now time.Time) ([]*model.DeviceCommand, error) {
+	tx, err := mysql.MysqlCli.Client.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	query := `SELECT ` + deviceCommandColumns + `, ''
+		FROM device_command c
+		WHERE c.dev_id = ? AND c.status = ? AND c.expire_at >= ?
+		ORDER BY c.cmd_id ASC
+		LIMIT ? FOR UPDATE`
+	rows, err := tx.Query(query, devID, model.CommandStatusPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	commands := make([]*model.DeviceCommand, 0)
+	for rows.Next() {
+		var cmd *model.DeviceCommand
+		cmd, err = scanDeviceCommand(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		commands = append(commands, cmd)
+	}
+	// 结果集中途出错时回滚，不能当作没有更多命令
+	if err = rows.Err(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	rows.Close()
+
+	for _, cmd := range commands {
+		_, err = tx.Exec(`UPDATE device_command SET status = ?, delivered_at = ? WHERE cmd_id = ?`,
+			model.CommandStatusDelivered, now, cmd.CmdID)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Status = model.CommandStatusDelivered
+		deliveredAt := now
+		cmd.DeliveredAt = &deliveredAt
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return commands, nil
+}
+
+// FinishDeviceCommand 设备回执：将已下发（或待下发）的命令标记为最终状态
+func (r *DeviceCommandRepository) FinishDeviceCommand(cmdID, devID int64, status string, result map[string]interface{}, now time.Time) error {
+	resultJSON, _ := json.Marshal(result)
+
+	query := `UPDATE device_command SET status = ?, result = ?, finished_at = ?
+		WHERE cmd_id = ? AND dev_id = ? AND status IN (?, ?)`
+	res, err := mysql.MysqlCli.Client.Exec(query, status, string(resultJSON), now,
+		cmdID, devID, model.CommandStatusPending, model.CommandStatusDelivered)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return errors.New("命令不存在、不属于该设备或已结束")
+	}
+	return nil
+}
+
+// rowScanner 兼容 *sql.Row 和 *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanDeviceCommand 扫描一行设备命令（最后一列为下发用户名）
+func scanDeviceCommand(row rowScanner) (*model.DeviceCommand, error) {
+	cmd := &model.DeviceCommand{}
+	var payloadJSON, resultJSON sql.NullString
+	var deliveredAt, finishedAt sql.NullTime
+
+	err := row.Scan(&cmd.CmdID, &cmd.DevID, &cmd.Command, &payloadJSON, &cmd.Status, &resultJSON,
+		&cmd.IssuedBy, &cmd.TTL, &cmd.ExpireAt, &cmd.CreateAt, &deliveredAt, &finishedAt, &cmd.IssuerName)
+	if err != nil {
+		return nil, err
+	}
+
+	if payloadJSON.Valid {
+		json.Unmarshal([]byte(payloadJSON.String), &cmd.Payload)
+	}
+	if resultJSON.Valid {
+		json.Unmarshal([]byte(resultJSON.String), &cmd.Result)
+	}
+	if deliveredAt.Valid {
+		cmd.DeliveredAt = &deliveredAt.Time
+	}
+	if finishedAt.Valid {
+		cmd.FinishedAt = &finishedAt.Time
+	}
+
+	return cmd, nil
+}
@@ -0,0 +1,167 @@
+package repo
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"backend/internal/db/mysql"
+	"backend/internal/model"
+)
+
+var (
+	ErrClaimCodeInvalid     = errors.New("认领码无效")
+	ErrDeviceAlreadyClaimed = errors.New("设备已被认领")
+)
+
+type DeviceProvisionRepository struct{}
+
+func NewDeviceProvisionRepository() *DeviceProvisionRepository {
+	return &DeviceProvisionRepository{}
+}
+
+// CreateProvisionedDevices 批量创建设备及其预注册记录（同一事务，任一失败整体回滚）
+func (r *DeviceProvisionRepository) CreateProvisionedDevices(devices []*model.Device, provisions []*model.DeviceProvision) error {
+	if len(devices) != len(provisions) {
+		return errors.New("设备与预注册记录数量不一致")
+	}
+
+	tx, err := mysql.MysqlCli.Client.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	deviceQuery := `INSERT INTO device (dev_id, dev_name, dev_status, dev_type, dev_power,
+		model, version, sampling_rate, offline_threshold, upload_interval, extended_config, create_at, update_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	provisionQuery := `INSERT INTO device_provision (dev_id, claim_code_hash, bootstrap_secret_hash, create_by, create_at)
+		VALUES (?, ?, ?, ?, ?)`
+
+	for i, device := range devices {
+		extendedConfigJSON, _ := json.Marshal(device.ExtendedConfig)
+		_, err = tx.Exec(deviceQuery,
+			device.DevID, device.DevName, device.DevStatus, device.DevType, device.DevPower,
+			device.Model, device.Version, device.SamplingRate, device.OfflineThreshold, device.UploadInterval,
+			string(extendedConfigJSON), device.CreateAt, device.UpdateAt)
+		if err != nil {
+			err = fmt.Errorf("第%d个设备(%s)创建失败: %w", i+1, device.DevName, err)
+			return err
+		}
+
+		p := provisions[i]
+		_, err = tx.Exec(provisionQuery, p.DevID, p.ClaimCodeHash, p.BootstrapSecretHash, p.CreateBy, p.CreateAt)
+		if err != nil {
+			err = fmt.Errorf("第%d个设备(%s)预注册失败: %w", i+1, device.DevName, err)
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetDeviceProvision 获取设备的预注册记录
+func (r *DeviceProvisionRepository) GetDeviceProvision(devID int64) (*model.DeviceProvision, error) {
+	p := &model.DeviceProvision{}
+	var claimedBy sql.NullInt64
+	var claimedAt, lastBootstrapAt sql.NullTime
+
+	query := `SELECT dev_id, claim_code_hash, bootstrap_secret_hash, claimed_by, claimed_at,
+		last_bootstrap_at, create_by, create_at
+		FROM device_provision WHERE dev_id = ?`
+	err := mysql.MysqlCli.Client.QueryRow(query, devID).Scan(
+		&p.DevID, &p.ClaimCodeHash, &p.BootstrapSecretHash, &claimedBy, &claimedAt,
+		&lastBootstrapAt, &p.CreateBy, &p.CreateAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if claimedBy.Valid {
+		p.ClaimedBy = &claimedBy.Int64
+	}
+	if claimedAt.Valid {
+		p.ClaimedAt = &claimedAt.Time
+	}
+	if lastBootstrapAt.Valid {
+		p.LastBootstrapAt = &lastBootstrapAt.Time
+	}
+	return p, nil
+}
+
+// ClaimDevice 使用认领码认领设备：标记预注册记录已认领，并将用户绑定为rw权限（事务内加锁，认领码只能使用一次）
+func (r *DeviceProvisionRepository) ClaimDevice(claimCodeHash string, uid int64, maxUsers int, now time.Time) (int64, error) {
+	tx, err := mysql.MysqlCli.Client.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var devID int64
+	var claimedBy sql.NullInt64
+	err = tx.QueryRow(`SELECT dev_id, claimed_by FROM device_provision WHERE claim_code_hash = ? FOR UPDATE`,
+		claimCodeHash).Scan(&devID, &claimedBy)
+	if err == sql.ErrNoRows {
+		err = ErrClaimCodeInvalid
+		return 0, err
+	}
+	if err != nil {
+		return 0, err
+	}
+	if claimedBy.Valid {
+		err = ErrDeviceAlreadyClaimed
+		return 0, err
+	}
+
+	// 已绑定的用户直接提升为rw，否则检查绑定数量上限
+	var bound int
+	err = tx.QueryRow("SELECT COUNT(*) FROM user_dev WHERE dev_id = ? AND uid = ?", devID, uid).Scan(&bound)
+	if err != nil {
+		return 0, err
+	}
+	if bound > 0 {
+		_, err = tx.Exec("UPDATE user_dev SET permission_level = ? WHERE dev_id = ? AND uid = ?",
+			model.PermissionLevelReadWrite, devID, uid)
+	} else {
+		var userCount int
+		err = tx.QueryRow("SELECT COUNT(*) FROM user_dev WHERE dev_id = ?", devID).Scan(&userCount)
+		if err != nil {
+			return 0, err
+		}
+		if userCount >= maxUsers {
+			err = fmt.Errorf("设备最多只能绑定%d个用户", maxUsers)
+			return 0, err
+		}
+		_, err = tx.Exec(`INSERT INTO user_dev (uid, dev_id, permission_level, bind_at) VALUES (?, ?, ?, ?)`,
+			uid, devID, model.PermissionLevelReadWrite, now)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`UPDATE device_provision SET claimed_by = ?, claimed_at = ? WHERE dev_id = ?`, uid, now, devID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return devID, nil
+}
+
+// UpdateLastBootstrapAt 记录设备最近一次引导时间
+func (r *DeviceProvisionRepository) UpdateLastBootstrapAt(devID int64, now time.Time) error {
+	_, err := mysql.MysqlCli.Client.Exec(`UPDATE device_provision SET last_bootstrap_at = ? WHERE dev_id = ?`, now, devID)
+	return err
+}
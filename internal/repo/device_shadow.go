@@ -0,0 +1,68 @@
+package repo
+
+import (
+	"backend/internal/db/mysql"
+	"backend/internal/model"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrShadowVersionConflict 影子版本冲突
+var ErrShadowVersionConflict = errors.New("设备影子版本冲突，请重新获取后再更新")
+
+type DeviceShadowRepository struct{}
+
+func NewDeviceShadowRepository() *DeviceShadowRepository {
+	return &DeviceShadowRepository{}
+}
+
+// GetDeviceShadow 获取设备影子（设备不存在时返回sql.ErrNoRows）
+func (r *DeviceShadowRepository) GetDeviceShadow(devID int64) (*model.DeviceShadow, error) {
+	shadow := &model.DeviceShadow{DevID: model.Int64ToID(devID)}
+	var shadowJSON sql.NullString
+
+	query := `SELECT shadow, shadow_version, update_at FROM device WHERE dev_id = ?`
+	err := mysql.MysqlCli.Client.QueryRow(query, devID).Scan(&shadowJSON, &shadow.Version, &shadow.UpdateAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if shadowJSON.Valid {
+		var state model.ShadowState
+		if err := json.Unmarshal([]byte(shadowJSON.String), &state); err == nil {
+			shadow.Desired = state.Desired
+			shadow.Reported = state.Reported
+		}
+	}
+	if shadow.Desired == nil {
+		shadow.Desired = make(map[string]interface{})
+	}
+	if shadow.Reported == nil {
+		shadow.Reported = make(map[string]interface{})
+	}
+
+	return shadow, nil
+}
+
+// UpdateDeviceShadow 更新设备影子（乐观锁：仅当数据库中版本号等于expectedVersion时更新，版本号+1）
+func (r *DeviceShadowRepository) UpdateDeviceShadow(devID int64, state *model.ShadowState, expectedVersion int64, updateAt time.Time) error {
+	shadowJSON, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE device SET shadow = ?, shadow_version = shadow_version + 1, update_at = ?
+		WHERE dev_id = ? AND shadow_version = ?`
+	result, err := mysql.MysqlCli.Client.Exec(query, string(shadowJSON), updateAt, devID, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrShadowVersionConflict
+	}
+	return nil
+}
@@ -205,6 +205,28 @@ func (r *DeviceUserRepository) GetUserDeviceIDs(uid int64) ([]int64, error) {
 	return devIDs, nil
 }
 
+// GetUserReadableDevTypes 获取用户有读权限的设备所属的设备类型
+func (r *DeviceUserRepository) GetUserReadableDevTypes(uid int64) ([]string, error) {
+	query := `SELECT DISTINCT d.dev_type FROM user_dev ud
+		INNER JOIN device d ON ud.dev_id = d.dev_id
+		WHERE ud.uid = ? AND ud.permission_level IN (?, ?)`
+	rows, err := mysql.MysqlCli.Client.Query(query, uid, model.PermissionLevelRead, model.PermissionLevelReadWrite)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devTypes := make([]string, 0)
+	for rows.Next() {
+		var devType string
+		if err := rows.Scan(&devType); err != nil {
+			return nil, err
+		}
+		devTypes = append(devTypes, devType)
+	}
+	return devTypes, rows.Err()
+}
+
 // GetUserDeviceStatistics 获取用户设备统计信息
 func (r *DeviceUserRepository) GetUserDeviceStatistics(uid int64) (map[string]interface{}, error) {
 	stats := make(map[string]interface{})
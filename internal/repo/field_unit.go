@@ -0,0 +1,50 @@
+package repo
+
+import (
+	"strings"
+
+	"backend/internal/db/mysql"
+	"backend/internal/model"
+)
+
+type FieldUnitRepository struct{}
+
+func NewFieldUnitRepository() *FieldUnitRepository {
+	return &FieldUnitRepository{}
+}
+
+// GetFieldUnits 获取设备measurement各字段的存储单位
+func (r *FieldUnitRepository) GetFieldUnits(devID int64, measurement string) (map[string]string, error) {
+	rows, err := mysql.MysqlCli.Client.Query(`SELECT field, unit FROM field_unit WHERE dev_id = ? AND measurement = ?`,
+		devID, measurement)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	units := make(map[string]string)
+	for rows.Next() {
+		var field, unit string
+		if err := rows.Scan(&field, &unit); err != nil {
+			return nil, err
+		}
+		units[field] = unit
+	}
+	return units, rows.Err()
+}
+
+// SaveFieldUnits 记录字段的存储单位（已有记录时保留原单位）
+func (r *FieldUnitRepository) SaveFieldUnits(units []model.FieldUnit) error {
+	if len(units) == 0 {
+		return nil
+	}
+	placeholders := make([]string, 0, len(units))
+	args := make([]interface{}, 0, len(units)*5)
+	for _, u := range units {
+		placeholders = append(placeholders, "(?, ?, ?, ?, ?)")
+		args = append(args, u.DevID, u.Measurement, u.Field, u.Unit, u.CreateAt)
+	}
+	_, err := mysql.MysqlCli.Client.Exec(`INSERT INTO field_unit (dev_id, measurement, field, unit, create_at)
+		VALUES `+strings.Join(placeholders, ", ")+` ON DUPLICATE KEY UPDATE unit = unit`, args...)
+	return err
+}
@@ -0,0 +1,133 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"backend/internal/db/minio"
+	"backend/internal/db/mysql"
+	"backend/internal/model"
+)
+
+// archivePartSize 流式上传ZIP的分片大小
+const archivePartSize = 16 << 20
+
+type FileArchiveRepository struct{}
+
+func NewFileArchiveRepository() *FileArchiveRepository {
+	return &FileArchiveRepository{}
+}
+
+const fileArchiveTaskColumns = `task_id, dev_id, bucket_name, status, file_count, size, archive_key, error_msg,
+	uid, create_at, finished_at`
+
+// CreateArchiveTask 创建打包任务
+func (r *FileArchiveRepository) CreateArchiveTask(task *model.FileArchiveTask) error {
+	_, err := mysql.MysqlCli.Client.Exec(`INSERT INTO file_archive_task (task_id, dev_id, bucket_name, status, file_count, uid, create_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		task.TaskID, task.DevID, task.BucketName, task.Status, task.FileCount, task.UID, task.CreateAt)
+	return err
+}
+
+// GetArchiveTask 获取打包任务
+func (r *FileArchiveRepository) GetArchiveTask(taskID int64) (*model.FileArchiveTask, error) {
+	query := `SELECT ` + fileArchiveTaskColumns + ` FROM file_archive_task WHERE task_id = ?`
+	task, err := scanFileArchiveTask(mysql.MysqlCli.Client.QueryRow(query, taskID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("打包任务不存在")
+		}
+		return nil, err
+	}
+	return task, nil
+}
+
+// UpdateArchiveTaskStatus 更新打包任务状态（running）
+func (r *FileArchiveRepository) UpdateArchiveTaskStatus(taskID int64, status string) error {
+	_, err := mysql.MysqlCli.Client.Exec(`UPDATE file_archive_task SET status = ? WHERE task_id = ?`, status, taskID)
+	return err
+}
+
+// FinishArchiveTask 记录打包结果（succeeded/failed）
+func (r *FileArchiveRepository) FinishArchiveTask(task *model.FileArchiveTask) error {
+	_, err := mysql.MysqlCli.Client.Exec(`UPDATE file_archive_task
+		SET status = ?, file_count = ?, size = ?, archive_key = ?, error_msg = ?, finished_at = ?
+		WHERE task_id = ?`,
+		task.Status, task.FileCount, task.Size, task.ArchiveKey, task.ErrorMsg, task.FinishedAt, task.TaskID)
+	return err
+}
+
+// FailInterruptedArchiveTasks 将未完成的任务标记为失败（服务重启后打包进度丢失）
+func (r *FileArchiveRepository) FailInterruptedArchiveTasks(now time.Time) (int64, error) {
+	result, err := mysql.MysqlCli.Client.Exec(`UPDATE file_archive_task SET status = ?, error_msg = ?, finished_at = ?
+		WHERE status IN (?, ?)`,
+		model.ArchiveTaskStatusFailed, "服务重启，打包中断", now,
+		model.ArchiveTaskStatusPending, model.ArchiveTaskStatusRunning)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetExpiredArchiveTasks 获取完成时间早于before的成功任务（ZIP待删除）
+func (r *FileArchiveRepository) GetExpiredArchiveTasks(before time.Time, limit int) ([]*model.FileArchiveTask, error) {
+	query := `SELECT ` + fileArchiveTaskColumns + ` FROM file_archive_task
+		WHERE status = ? AND finished_at < ? ORDER BY finished_at ASC LIMIT ?`
+	rows, err := mysql.MysqlCli.Client.Query(query, model.ArchiveTaskStatusSucceeded, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := make([]*model.FileArchiveTask, 0)
+	for rows.Next() {
+		task, err := scanFileArchiveTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// PutArchive 将ZIP流上传到archive bucket，返回对象大小
+func (r *FileArchiveRepository) PutArchive(archiveKey string, reader io.Reader) (int64, error) {
+	if minio.MinIOCli == nil {
+		return 0, fmt.Errorf("MinIO客户端未初始化")
+	}
+	return minio.MinIOCli.PutObjectStream(model.ArchiveBucketName, archiveKey, reader, "application/zip", archivePartSize)
+}
+
+// DeleteArchive 删除ZIP
+func (r *FileArchiveRepository) DeleteArchive(archiveKey string) error {
+	if minio.MinIOCli == nil {
+		return fmt.Errorf("MinIO客户端未初始化")
+	}
+	return minio.MinIOCli.DeleteObject(model.ArchiveBucketName, archiveKey)
+}
+
+// PresignedArchiveURL 生成ZIP的预签名下载URL
+func (r *FileArchiveRepository) PresignedArchiveURL(archiveKey string) (string, error) {
+	if minio.MinIOCli == nil {
+		return "", fmt.Errorf("MinIO客户端未初始化")
+	}
+	return minio.MinIOCli.PresignedGetObject(model.ArchiveBucketName, archiveKey, PresignedURLExpiry)
+}
+
+// scanFileArchiveTask 扫描打包任务
+func scanFileArchiveTask(row rowScanner) (*model.FileArchiveTask, error) {
+	task := &model.FileArchiveTask{}
+	var finishedAt sql.NullTime
+	err := row.Scan(&task.TaskID, &task.DevID, &task.BucketName, &task.Status, &task.FileCount, &task.Size,
+		&task.ArchiveKey, &task.ErrorMsg, &task.UID, &task.CreateAt, &finishedAt)
+	if err != nil {
+		return nil, err
+	}
+	if finishedAt.Valid {
+		task.FinishedAt = &finishedAt.Time
+	}
+	return task, nil
+}
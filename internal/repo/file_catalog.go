@@ -0,0 +1,383 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"backend/internal/db/minio"
+	"backend/internal/db/mysql"
+	"backend/internal/model"
+	"backend/pkg/utils"
+)
+
+// metadata中文件信息（extra_data JSON）的取值表达式
+const (
+	fileBucketNameExpr = "JSON_UNQUOTE(JSON_EXTRACT(extra_data, '$.bucket_name'))"
+	fileBucketKeyExpr  = "JSON_UNQUOTE(JSON_EXTRACT(extra_data, '$.bucket_key'))"
+	fileFilenameExpr   = "JSON_UNQUOTE(JSON_EXTRACT(extra_data, '$.filename'))"
+	fileContentExpr    = "JSON_UNQUOTE(JSON_EXTRACT(extra_data, '$.content_type'))"
+)
+
+type FileCatalogRepository struct{}
+
+// FileBuckets 设备文件所在的bucket（对账、存储事件与分片清理覆盖的范围）
+func FileBuckets() []string {
+	return append([]string{}, minio.FileBuckets...)
+}
+
+func NewFileCatalogRepository() *FileCatalogRepository {
+	return &FileCatalogRepository{}
+}
+
+// SearchFiles 从metadata中分页查询文件（data_type=file_data）
+// devIDs 非nil时限定在这些设备范围内（普通用户有权限的设备）
+func (r *FileCatalogRepository) SearchFiles(query *model.FileCatalogQuery, devIDs []int64) ([]*model.Metadata, int64, error) {
+	whereClause := "WHERE data_type = ?"
+	args := []interface{}{model.DataTypeFileData}
+
+	if query.DevID > 0 {
+		whereClause += " AND dev_id = ?"
+		args = append(args, query.DevID)
+	}
+	if devIDs != nil {
+		if len(devIDs) == 0 {
+			return []*model.Metadata{}, 0, nil
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(devIDs)), ",")
+		whereClause += " AND dev_id IN (" + placeholders + ")"
+		for _, id := range devIDs {
+			args = append(args, id)
+		}
+	}
+	if !utils.IsEmpty(query.BucketName) {
+		whereClause += " AND " + fileBucketNameExpr + " = ?"
+		args = append(args, query.BucketName)
+	}
+	if !utils.IsEmpty(query.Keyword) {
+		whereClause += " AND (" + fileFilenameExpr + " LIKE ? OR " + fileBucketKeyExpr + " LIKE ?)"
+		keywordPattern := "%" + query.Keyword + "%"
+		args = append(args, keywordPattern, keywordPattern)
+	}
+	if !utils.IsEmpty(query.ContentType) {
+		whereClause += " AND " + fileContentExpr + " LIKE ?"
+		args = append(args, query.ContentType+"%")
+	}
+	if query.StartTime != nil {
+		whereClause += " AND timestamp >= FROM_UNIXTIME(?)"
+		args = append(args, *query.StartTime)
+	}
+	if query.EndTime != nil {
+		whereClause += " AND timestamp <= FROM_UNIXTIME(?)"
+		args = append(args, *query.EndTime)
+	}
+
+	// 查询总数
+	var total int64
+	err := mysql.MysqlCli.Client.QueryRow("SELECT COUNT(*) FROM metadata "+whereClause, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	offset := (query.Page - 1) * query.PageSize
+	listQuery := `SELECT data_id, dev_id, data_type, quality_score, extra_data, timestamp
+		FROM metadata ` + whereClause + " ORDER BY timestamp DESC, data_id DESC LIMIT ? OFFSET ?"
+	rows, err := mysql.MysqlCli.Client.Query(listQuery, append(args, query.PageSize, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	metadataList := make([]*model.Metadata, 0)
+	for rows.Next() {
+		metadata := &model.Metadata{}
+		var extraDataJSON sql.NullString
+		err := rows.Scan(&metadata.DataID, &metadata.DevID, &metadata.DataType,
+			&metadata.QualityScore, &extraDataJSON, &metadata.Timestamp)
+		if err != nil {
+			return nil, 0, err
+		}
+		if extraDataJSON.Valid {
+			json.Unmarshal([]byte(extraDataJSON.String), &metadata.ExtraData)
+		}
+		metadataList = append(metadataList, metadata)
+	}
+
+	return metadataList, total, nil
+}
+
+// GetFileMetadataKeys 获取bucket中（可限定设备）所有文件metadata，按bucket_key索引
+func (r *FileCatalogRepository) GetFileMetadataKeys(bucketName string, devID int64) (map[string]model.OrphanMetadata, error) {
+	query := `SELECT data_id, dev_id, ` + fileBucketKeyExpr + `
+		FROM metadata WHERE data_type = ? AND ` + fileBucketNameExpr + ` = ?`
+	args := []interface{}{model.DataTypeFileData, bucketName}
+	if devID > 0 {
+		query += " AND dev_id = ?"
+		args = append(args, devID)
+	}
+
+	rows, err := mysql.MysqlCli.Client.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make(map[string]model.OrphanMetadata)
+	for rows.Next() {
+		var m model.OrphanMetadata
+		var bucketKey sql.NullString
+		if err := rows.Scan(&m.DataID, &m.DevID, &bucketKey); err != nil {
+			return nil, err
+		}
+		m.BucketKey = bucketKey.String
+		keys[m.BucketKey] = m
+	}
+	return keys, nil
+}
+
+// DeleteFileWithOutbox 删除文件的metadata记录并写入删除补偿记录（同一事务）
+// 文件的派生文件（缩略图等）一并登记，返回全部补偿记录；MinIO对象由调用方随后删除，失败时由补偿任务重试
+func (r *FileCatalogRepository) DeleteFileWithOutbox(outbox *model.FileDeleteOutbox) (outboxes []*model.FileDeleteOutbox, err error) {
+	tx, err := mysql.MysqlCli.Client.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var dataID sql.NullInt64
+	var extraDataJSON sql.NullString
+	err = tx.QueryRow(`SELECT data_id, extra_data FROM metadata
+		WHERE data_type = ? AND `+fileBucketNameExpr+` = ? AND `+fileBucketKeyExpr+` = ?
+		LIMIT 1 FOR UPDATE`, model.DataTypeFileData, outbox.BucketName, outbox.BucketKey).Scan(&dataID, &extraDataJSON)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	err = nil
+	outbox.DataID = dataID.Int64
+
+	outboxes = []*model.FileDeleteOutbox{outbox}
+	if extraDataJSON.Valid {
+		var extra struct {
+			Derivatives map[string]model.Derivative `json:"derivatives"`
+		}
+		json.Unmarshal([]byte(extraDataJSON.String), &extra)
+		for _, d := range extra.Derivatives {
+			outboxes = append(outboxes, &model.FileDeleteOutbox{
+				ID:         utils.GetDefaultSnowflake().Generate(),
+				DataID:     outbox.DataID,
+				BucketName: outbox.BucketName,
+				BucketKey:  d.Key,
+				Status:     outbox.Status,
+				CreateAt:   outbox.CreateAt,
+				UpdateAt:   outbox.UpdateAt,
+			})
+		}
+	}
+
+	_, err = tx.Exec(`DELETE FROM metadata
+		WHERE data_type = ? AND `+fileBucketNameExpr+` = ? AND `+fileBucketKeyExpr+` = ?`,
+		model.DataTypeFileData, outbox.BucketName, outbox.BucketKey)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, o := range outboxes {
+		_, err = tx.Exec(`INSERT INTO file_delete_outbox (id, data_id, bucket_name, bucket_key, status, attempts, create_at, update_at)
+			VALUES (?, ?, ?, ?, ?, 0, ?, ?)`,
+			o.ID, o.DataID, o.BucketName, o.BucketKey, o.Status, o.CreateAt, o.UpdateAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return outboxes, nil
+}
+
+// GetFileMetadataByKeys 批量获取bucket中指定key的文件metadata（按bucket_key索引）
+func (r *FileCatalogRepository) GetFileMetadataByKeys(bucketName string, keys []string) (map[string]*model.Metadata, error) {
+	result := make(map[string]*model.Metadata, len(keys))
+	if len(keys) == 0 {
+		return result, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(keys)), ",")
+	query := `SELECT data_id, dev_id, data_type, quality_score, extra_data, timestamp
+		FROM metadata WHERE data_type = ? AND ` + fileBucketNameExpr + ` = ? AND ` + fileBucketKeyExpr + ` IN (` + placeholders + `)`
+	args := []interface{}{model.DataTypeFileData, bucketName}
+	for _, key := range keys {
+		args = append(args, key)
+	}
+
+	rows, err := mysql.MysqlCli.Client.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		metadata := &model.Metadata{}
+		var extraDataJSON sql.NullString
+		if err := rows.Scan(&metadata.DataID, &metadata.DevID, &metadata.DataType,
+			&metadata.QualityScore, &extraDataJSON, &metadata.Timestamp); err != nil {
+			return nil, err
+		}
+		if extraDataJSON.Valid {
+			json.Unmarshal([]byte(extraDataJSON.String), &metadata.ExtraData)
+		}
+		if key, ok := metadata.ExtraData["bucket_key"].(string); ok {
+			result[key] = metadata
+		}
+	}
+	return result, nil
+}
+
+// ListDeviceFilesAfterKey 按bucket_key升序获取设备在bucket中key在(startAfter, endBefore)内的文件metadata（最多limit条）
+// endBefore 为空表示不限；只返回key在设备前缀 "{dev_id}/" 下的文件（与按对象前缀列举一致）
+func (r *FileCatalogRepository) ListDeviceFilesAfterKey(bucketName string, devID int64, startAfter, endBefore string, limit int) ([]*model.Metadata, error) {
+	query := `SELECT data_id, dev_id, data_type, quality_score, extra_data, timestamp
+		FROM metadata WHERE data_type = ? AND dev_id = ? AND ` + fileBucketNameExpr + ` = ? AND ` + fileBucketKeyExpr + ` LIKE CONCAT(?, '/%') AND ` + fileBucketKeyExpr + ` > ?`
+	args := []interface{}{model.DataTypeFileData, devID, bucketName, fmt.Sprintf("%d", devID), startAfter}
+	if endBefore != "" {
+		query += " AND " + fileBucketKeyExpr + " < ?"
+		args = append(args, endBefore)
+	}
+	query += " ORDER BY " + fileBucketKeyExpr + " ASC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := mysql.MysqlCli.Client.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metadataList := make([]*model.Metadata, 0)
+	for rows.Next() {
+		metadata := &model.Metadata{}
+		var extraDataJSON sql.NullString
+		if err := rows.Scan(&metadata.DataID, &metadata.DevID, &metadata.DataType,
+			&metadata.QualityScore, &extraDataJSON, &metadata.Timestamp); err != nil {
+			return nil, err
+		}
+		if extraDataJSON.Valid {
+			json.Unmarshal([]byte(extraDataJSON.String), &metadata.ExtraData)
+		}
+		metadataList = append(metadataList, metadata)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return metadataList, nil
+}
+
+// ListDeviceFiles 获取设备在bucket中指定时间范围内的文件metadata（按上传时间升序，最多limit条）
+func (r *FileCatalogRepository) ListDeviceFiles(devID int64, bucketName string, startTime, endTime *int64, limit int) ([]*model.Metadata, error) {
+	query := `SELECT data_id, dev_id, data_type, quality_score, extra_data, timestamp
+		FROM metadata WHERE data_type = ? AND dev_id = ? AND ` + fileBucketNameExpr + ` = ?`
+	args := []interface{}{model.DataTypeFileData, devID, bucketName}
+	if startTime != nil {
+		query += " AND timestamp >= FROM_UNIXTIME(?)"
+		args = append(args, *startTime)
+	}
+	if endTime != nil {
+		query += " AND timestamp <= FROM_UNIXTIME(?)"
+		args = append(args, *endTime)
+	}
+	query += " ORDER BY timestamp ASC, data_id ASC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := mysql.MysqlCli.Client.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metadataList := make([]*model.Metadata, 0)
+	for rows.Next() {
+		metadata := &model.Metadata{}
+		var extraDataJSON sql.NullString
+		if err := rows.Scan(&metadata.DataID, &metadata.DevID, &metadata.DataType,
+			&metadata.QualityScore, &extraDataJSON, &metadata.Timestamp); err != nil {
+			return nil, err
+		}
+		if extraDataJSON.Valid {
+			json.Unmarshal([]byte(extraDataJSON.String), &metadata.ExtraData)
+		}
+		metadataList = append(metadataList, metadata)
+	}
+	return metadataList, nil
+}
+
+// GetPendingOutbox 获取待处理的删除补偿记录
+func (r *FileCatalogRepository) GetPendingOutbox(limit int) ([]*model.FileDeleteOutbox, error) {
+	query := `SELECT id, data_id, bucket_name, bucket_key, status, attempts, last_error, create_at, update_at
+		FROM file_delete_outbox WHERE status = ? ORDER BY id ASC LIMIT ?`
+	rows, err := mysql.MysqlCli.Client.Query(query, model.FileOutboxStatusPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]*model.FileDeleteOutbox, 0)
+	for rows.Next() {
+		e := &model.FileDeleteOutbox{}
+		var lastError sql.NullString
+		if err := rows.Scan(&e.ID, &e.DataID, &e.BucketName, &e.BucketKey, &e.Status, &e.Attempts,
+			&lastError, &e.CreateAt, &e.UpdateAt); err != nil {
+			return nil, err
+		}
+		e.LastError = lastError.String
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// GetPendingOutboxKeys 获取bucket中待删除对象的key集合（对账时跳过）
+func (r *FileCatalogRepository) GetPendingOutboxKeys(bucketName string) (map[string]bool, error) {
+	rows, err := mysql.MysqlCli.Client.Query(`SELECT bucket_key FROM file_delete_outbox WHERE bucket_name = ? AND status = ?`,
+		bucketName, model.FileOutboxStatusPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make(map[string]bool)
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys[key] = true
+	}
+	return keys, nil
+}
+
+// UpdateOutboxStatus 更新删除补偿记录状态
+func (r *FileCatalogRepository) UpdateOutboxStatus(id int64, status string, attempts int, lastError string, now time.Time) error {
+	_, err := mysql.MysqlCli.Client.Exec(`UPDATE file_delete_outbox SET status = ?, attempts = ?, last_error = ?, update_at = ? WHERE id = ?`,
+		status, attempts, lastError, now, id)
+	return err
+}
+
+// WalkObjects 遍历bucket中指定前缀下的所有对象
+func (r *FileCatalogRepository) WalkObjects(bucketName, prefix string, fn func(key string, size int64, contentType string, lastModified time.Time)) error {
+	if minio.MinIOCli == nil {
+		return fmt.Errorf("MinIO客户端未初始化")
+	}
+	for object := range minio.MinIOCli.ListObjectsAfter(context.Background(), bucketName, prefix, "") {
+		if object.Err != nil {
+			return object.Err
+		}
+		fn(object.Key, object.Size, object.ContentType, object.LastModified)
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package repo
+
+import (
+	"backend/internal/db/minio"
+	"backend/internal/db/mysql"
+	"backend/internal/model"
+	"backend/pkg/utils"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+type FirmwareRepository struct{}
+
+func NewFirmwareRepository() *FirmwareRepository {
+	return &FirmwareRepository{}
+}
+
+// DeviceVersion 设备当前版本（用于统计灰度进度）
+type DeviceVersion struct {
+	DevID   int64
+	Model   string
+	Version string
+}
+
+const firmwareColumns = `fw_id, dev_type, model, version, bucket_key, size, checksum, signature,
+	release_note, status, create_by, create_at`
+
+// CreateFirmware 创建固件版本
+func (r *FirmwareRepository) CreateFirmware(fw *model.Firmware) error {
+	query := "INSERT INTO firmware (fw_id, dev_type, `model`, `version`, bucket_key, size, checksum, signature," +
+		" release_note, status, create_by, create_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	_, err := mysql.MysqlCli.Client.Exec(query,
+		fw.FwID, fw.DevType, fw.Model, fw.Version, fw.BucketKey, fw.Size, fw.Checksum, fw.Signature,
+		fw.ReleaseNote, fw.Status, fw.CreateBy, fw.CreateAt)
+	return err
+}
+
+// GetFirmware 获取固件版本
+func (r *FirmwareRepository) GetFirmware(fwID int64) (*model.Firmware, error) {
+	fw := &model.Firmware{}
+	query := "SELECT " + firmwareColumns + " FROM firmware WHERE fw_id = ?"
+	err := mysql.MysqlCli.Client.QueryRow(query, fwID).Scan(
+		&fw.FwID, &fw.DevType, &fw.Model, &fw.Version, &fw.BucketKey, &fw.Size, &fw.Checksum, &fw.Signature,
+		&fw.ReleaseNote, &fw.Status, &fw.CreateBy, &fw.CreateAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("固件不存在")
+		}
+		return nil, err
+	}
+	return fw, nil
+}
+
+// GetExpiredUpload 获取指定设备类型/型号/版本下创建时间早于before且仍处于uploading状态的固件，不存在时返回nil
+func (r *FirmwareRepository) GetExpiredUpload(devType, devModel, version string, before time.Time) (*model.Firmware, error) {
+	fw := &model.Firmware{}
+	query := "SELECT " + firmwareColumns + " FROM firmware WHERE dev_type = ? AND `model` = ? AND `version` = ? AND status = ? AND create_at < ?"
+	err := mysql.MysqlCli.Client.QueryRow(query, devType, devModel, version, model.FirmwareStatusUploading, before).Scan(
+		&fw.FwID, &fw.DevType, &fw.Model, &fw.Version, &fw.BucketKey, &fw.Size, &fw.Checksum, &fw.Signature,
+		&fw.ReleaseNote, &fw.Status, &fw.CreateBy, &fw.CreateAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return fw, nil
+}
+
+// GetFirmwares 获取固件版本列表（分页）
+func (r *FirmwareRepository) GetFirmwares(devType, devModel string, page, pageSize int) ([]*model.Firmware, int64, error) {
+	whereClause := "WHERE 1=1"
+	args := []interface{}{}
+
+	if !utils.IsEmpty(devType) {
+		whereClause += " AND dev_type = ?"
+		args = append(args, devType)
+	}
+	if !utils.IsEmpty(devModel) {
+		whereClause += " AND `model` = ?"
+		args = append(args, devModel)
+	}
+
+	var total int64
+	if err := mysql.MysqlCli.Client.QueryRow("SELECT COUNT(*) FROM firmware "+whereClause, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	query := "SELECT " + firmwareColumns + " FROM firmware " + whereClause + " ORDER BY create_at DESC LIMIT ? OFFSET ?"
+	args = append(args, pageSize, offset)
+
+	rows, err := mysql.MysqlCli.Client.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	firmwares := make([]*model.Firmware, 0)
+	for rows.Next() {
+		fw := &model.Firmware{}
+		err := rows.Scan(
+			&fw.FwID, &fw.DevType, &fw.Model, &fw.Version, &fw.BucketKey, &fw.Size, &fw.Checksum, &fw.Signature,
+			&fw.ReleaseNote, &fw.Status, &fw.CreateBy, &fw.CreateAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		firmwares = append(firmwares, fw)
+	}
+
+	return firmwares, total, nil
+}
+
+// UpdateFirmwareStatus 更新固件状态和文件大小
+func (r *FirmwareRepository) UpdateFirmwareStatus(fwID int64, status string, size int64) error {
+	_, err := mysql.MysqlCli.Client.Exec("UPDATE firmware SET status = ?, size = ? WHERE fw_id = ?", status, size, fwID)
+	return err
+}
+
+// DeleteFirmware 删除固件版本（级联删除灰度发布记录）
+func (r *FirmwareRepository) DeleteFirmware(fwID int64) error {
+	tx, err := mysql.MysqlCli.Client.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.Exec("DELETE FROM firmware_rollout WHERE fw_id = ?", fwID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM firmware WHERE fw_id = ?", fwID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CreateRollout 创建灰度发布
+func (r *FirmwareRepository) CreateRollout(rollout *model.FirmwareRollout) error {
+	devIDsJSON, _ := json.Marshal(rollout.DevIDs)
+
+	query := `INSERT INTO firmware_rollout (rollout_id, fw_id, strategy, percentage, dev_ids, status, create_by, create_at, update_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := mysql.MysqlCli.Client.Exec(query,
+		rollout.RolloutID, rollout.FwID, rollout.Strategy, rollout.Percentage, string(devIDsJSON),
+		rollout.Status, rollout.CreateBy, rollout.CreateAt, rollout.UpdateAt)
+	return err
+}
+
+// GetRollout 获取灰度发布
+func (r *FirmwareRepository) GetRollout(rolloutID int64) (*model.FirmwareRollout, error) {
+	query := `SELECT rollout_id, fw_id, strategy, percentage, dev_ids, status, create_by, create_at, update_at
+		FROM firmware_rollout WHERE rollout_id = ?`
+	rollout, err := scanRollout(mysql.MysqlCli.Client.QueryRow(query, rolloutID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("灰度发布不存在")
+		}
+		return nil, err
+	}
+	return rollout, nil
+}
+
+// UpdateRollout 更新灰度发布状态和比例
+func (r *FirmwareRepository) UpdateRollout(rollout *model.FirmwareRollout) error {
+	_, err := mysql.MysqlCli.Client.Exec(
+		"UPDATE firmware_rollout SET status = ?, percentage = ?, update_at = ? WHERE rollout_id = ?",
+		rollout.Status, rollout.Percentage, rollout.UpdateAt, rollout.RolloutID)
+	return err
+}
+
+// GetActiveRollouts 获取适用于指定设备类型/型号的进行中灰度发布（按创建时间倒序）
+func (r *FirmwareRepository) GetActiveRollouts(devType, devModel string) ([]*model.FirmwareRollout, error) {
+	query := `SELECT r.rollout_id, r.fw_id, r.strategy, r.percentage, r.dev_ids, r.status, r.create_by, r.create_at, r.update_at
+		FROM firmware_rollout r
+		INNER JOIN firmware f ON r.fw_id = f.fw_id
+		WHERE r.status = ? AND f.status = ? AND f.dev_type = ? AND (f.model = '' OR f.model = ?)
+		ORDER BY r.create_at DESC`
+	rows, err := mysql.MysqlCli.Client.Query(query,
+		model.RolloutStatusActive, model.FirmwareStatusReady, devType, devModel)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rollouts := make([]*model.FirmwareRollout, 0)
+	for rows.Next() {
+		rollout, err := scanRollout(rows)
+		if err != nil {
+			return nil, err
+		}
+		rollouts = append(rollouts, rollout)
+	}
+	return rollouts, nil
+}
+
+// GetDeviceVersions 获取指定设备类型（及型号）下所有设备的当前版本
+func (r *FirmwareRepository) GetDeviceVersions(devType, devModel string) ([]*DeviceVersion, error) {
+	query := "SELECT dev_id, IFNULL(`model`, ''), IFNULL(`version`, '') FROM device WHERE dev_type = ?"
+	args := []interface{}{devType}
+	if !utils.IsEmpty(devModel) {
+		query += " AND `model` = ?"
+		args = append(args, devModel)
+	}
+
+	rows, err := mysql.MysqlCli.Client.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make([]*DeviceVersion, 0)
+	for rows.Next() {
+		v := &DeviceVersion{}
+		if err := rows.Scan(&v.DevID, &v.Model, &v.Version); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
+
+// UpdateDeviceVersion 更新设备上报的版本号
+func (r *FirmwareRepository) UpdateDeviceVersion(devID int64, version string, updateAt time.Time) error {
+	_, err := mysql.MysqlCli.Client.Exec("UPDATE device SET `version` = ?, update_at = ? WHERE dev_id = ?",
+		version, updateAt, devID)
+	return err
+}
+
+// PresignedPutFirmware 生成固件上传的预签名PUT URL
+func (r *FirmwareRepository) PresignedPutFirmware(objectName string, expiry time.Duration) (string, error) {
+	if minio.MinIOCli == nil {
+		return "", fmt.Errorf("MinIO客户端未初始化")
+	}
+	return minio.MinIOCli.PresignedPutObject(model.FirmwareBucketName, objectName, expiry)
+}
+
+// PresignedGetFirmware 生成固件下载的预签名GET URL
+func (r *FirmwareRepository) PresignedGetFirmware(objectName string, expiry time.Duration) (string, error) {
+	if minio.MinIOCli == nil {
+		return "", fmt.Errorf("MinIO客户端未初始化")
+	}
+	return minio.MinIOCli.PresignedGetObject(model.FirmwareBucketName, objectName, expiry)
+}
+
+// OpenFirmware 打开固件对象（调用方负责关闭）
+func (r *FirmwareRepository) OpenFirmware(objectName string) (io.ReadCloser, error) {
+	if minio.MinIOCli == nil {
+		return nil, fmt.Errorf("MinIO客户端未初始化")
+	}
+	return minio.MinIOCli.GetObjectAsReader(model.FirmwareBucketName, objectName)
+}
+
+// DeleteFirmwareObject 删除固件对象
+func (r *FirmwareRepository) DeleteFirmwareObject(objectName string) error {
+	if minio.MinIOCli == nil {
+		return fmt.Errorf("MinIO客户端未初始化")
+	}
+	return minio.MinIOCli.DeleteObject(model.FirmwareBucketName, objectName)
+}
+
+// scanRollout 扫描一行灰度发布记录
+func scanRollout(row rowScanner) (*model.FirmwareRollout, error) {
+	rollout := &model.FirmwareRollout{}
+	var devIDsJSON sql.NullString
+
+	err := row.Scan(&rollout.RolloutID, &rollout.FwID, &rollout.Strategy, &rollout.Percentage, &devIDsJSON,
+		&rollout.Status, &rollout.CreateBy, &rollout.CreateAt, &rollout.UpdateAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if devIDsJSON.Valid {
+		json.Unmarshal([]byte(devIDsJSON.String), &rollout.DevIDs)
+	}
+	if rollout.DevIDs == nil {
+		rollout.DevIDs = []model.DeviceID{}
+	}
+	return rollout, nil
+}
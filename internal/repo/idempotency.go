@@ -0,0 +1,100 @@
+package repo
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"backend/internal/db/mysql"
+	"backend/internal/model"
+)
+
+type IdempotencyRepository struct{}
+
+func NewIdempotencyRepository() *IdempotencyRepository {
+	return &IdempotencyRepository{}
+}
+
+// Reserve 占用幂等键：插入processing记录，返回true；键已存在且未过期时返回false
+// 已过期的记录，以及处理租约已到期的processing记录（处理请求的进程已退出）直接由本次请求接管
+func (r *IdempotencyRepository) Reserve(rec *model.IdempotencyRecord) (bool, error) {
+	_, err := mysql.MysqlCli.Client.Exec(`INSERT INTO idempotency_key (scope, idem_key, method, path, request_hash,
+		status, response_code, create_at, locked_until, expire_at)
+		VALUES (?, ?, ?, ?, ?, ?, 0, ?, ?, ?)`,
+		rec.Scope, rec.Key, rec.Method, rec.Path, rec.RequestHash, model.IdempotencyStatusProcessing,
+		rec.CreateAt, rec.LockedUntil, rec.ExpireAt)
+	if err == nil {
+		return true, nil
+	}
+	if !strings.Contains(err.Error(), "Duplicate entry") {
+		return false, err
+	}
+
+	result, err := mysql.MysqlCli.Client.Exec(`UPDATE idempotency_key
+		SET method = ?, path = ?, request_hash = ?, status = ?, response_code = 0, response_body = NULL,
+			content_type = '', create_at = ?, locked_until = ?, expire_at = ?
+		WHERE scope = ? AND idem_key = ? AND (expire_at < ? OR (status = ? AND locked_until < ?))`,
+		rec.Method, rec.Path, rec.RequestHash, model.IdempotencyStatusProcessing, rec.CreateAt, rec.LockedUntil, rec.ExpireAt,
+		rec.Scope, rec.Key, rec.CreateAt, model.IdempotencyStatusProcessing, rec.CreateAt)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// Get 获取幂等键记录，不存在时返回nil
+func (r *IdempotencyRepository) Get(scope, key string) (*model.IdempotencyRecord, error) {
+	rec := &model.IdempotencyRecord{}
+	var body sql.NullString
+	err := mysql.MysqlCli.Client.QueryRow(`SELECT scope, idem_key, method, path, request_hash, status,
+		response_code, response_body, content_type, create_at, locked_until, expire_at
+		FROM idempotency_key WHERE scope = ? AND idem_key = ?`, scope, key).Scan(
+		&rec.Scope, &rec.Key, &rec.Method, &rec.Path, &rec.RequestHash, &rec.Status,
+		&rec.ResponseCode, &body, &rec.ContentType, &rec.CreateAt, &rec.LockedUntil, &rec.ExpireAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rec.ResponseBody = []byte(body.String)
+	return rec, nil
+}
+
+// Renew 续期处理中记录的处理租约
+func (r *IdempotencyRepository) Renew(scope, key string, lockedUntil time.Time) error {
+	_, err := mysql.MysqlCli.Client.Exec(`UPDATE idempotency_key SET locked_until = ?
+		WHERE scope = ? AND idem_key = ? AND status = ?`,
+		lockedUntil, scope, key, model.IdempotencyStatusProcessing)
+	return err
+}
+
+// Complete 保存首次请求的响应
+func (r *IdempotencyRepository) Complete(scope, key string, code int, contentType string, body []byte) error {
+	_, err := mysql.MysqlCli.Client.Exec(`UPDATE idempotency_key
+		SET status = ?, response_code = ?, content_type = ?, response_body = ?
+		WHERE scope = ? AND idem_key = ? AND status = ?`,
+		model.IdempotencyStatusCompleted, code, contentType, string(body),
+		scope, key, model.IdempotencyStatusProcessing)
+	return err
+}
+
+// Release 删除处理中的记录（请求失败，允许客户端用同一幂等键重试）
+func (r *IdempotencyRepository) Release(scope, key string) error {
+	_, err := mysql.MysqlCli.Client.Exec(`DELETE FROM idempotency_key WHERE scope = ? AND idem_key = ? AND status = ?`,
+		scope, key, model.IdempotencyStatusProcessing)
+	return err
+}
+
+// DeleteExpired 删除过期的记录
+func (r *IdempotencyRepository) DeleteExpired(now time.Time, limit int) (int64, error) {
+	result, err := mysql.MysqlCli.Client.Exec(`DELETE FROM idempotency_key WHERE expire_at < ? LIMIT ?`, now, limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
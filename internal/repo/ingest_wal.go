@@ -0,0 +1,108 @@
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"backend/internal/model"
+	"backend/pkg/utils"
+)
+
+const ingestWALExt = ".wal"
+
+// IngestWALRepository 写入管道的磁盘暂存（WAL）：每批未能写入InfluxDB的上传保存为一个文件
+type IngestWALRepository struct {
+	dir string
+}
+
+func NewIngestWALRepository(dir string) *IngestWALRepository {
+	return &IngestWALRepository{dir: dir}
+}
+
+// Append 写入一批上传，返回文件大小（先写临时文件再重命名，避免读取到不完整的文件）
+func (r *IngestWALRepository) Append(batch *model.IngestBatch) (int64, error) {
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		return 0, err
+	}
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return 0, err
+	}
+
+	name := fmt.Sprintf("%020d%s", utils.GetDefaultSnowflake().Generate(), ingestWALExt)
+	tmpPath := filepath.Join(r.dir, name+".tmp")
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return 0, err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return 0, err
+	}
+	if err := os.Rename(tmpPath, filepath.Join(r.dir, name)); err != nil {
+		os.Remove(tmpPath)
+		return 0, err
+	}
+	return int64(len(data)), nil
+}
+
+// List 按写入顺序列出WAL文件
+func (r *IngestWALRepository) List() ([]model.IngestWALSegment, error) {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	segments := make([]model.IngestWALSegment, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ingestWALExt) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		segments = append(segments, model.IngestWALSegment{Name: e.Name(), Size: info.Size()})
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].Name < segments[j].Name })
+	return segments, nil
+}
+
+// Read 读取WAL文件
+func (r *IngestWALRepository) Read(name string) (*model.IngestBatch, error) {
+	data, err := os.ReadFile(filepath.Join(r.dir, name))
+	if err != nil {
+		return nil, err
+	}
+	batch := &model.IngestBatch{}
+	if err := json.Unmarshal(data, batch); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// Remove 删除已写入InfluxDB的WAL文件
+func (r *IngestWALRepository) Remove(name string) error {
+	err := os.Remove(filepath.Join(r.dir, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,132 @@
+package repo
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"backend/internal/db/mysql"
+	"backend/internal/model"
+)
+
+type MeasurementSchemaRepository struct{}
+
+func NewMeasurementSchemaRepository() *MeasurementSchemaRepository {
+	return &MeasurementSchemaRepository{}
+}
+
+const measurementSchemaColumns = `schema_id, dev_type, measurement, description, fields, tags, strict, coerce,
+	version, create_by, create_at, update_at`
+
+// CreateSchema 创建schema（同一设备类型与measurement只能有一个schema）
+func (r *MeasurementSchemaRepository) CreateSchema(schema *model.MeasurementSchema) error {
+	fieldsJSON, err := json.Marshal(schema.Fields)
+	if err != nil {
+		return err
+	}
+	tagsJSON, err := json.Marshal(schema.Tags)
+	if err != nil {
+		return err
+	}
+	_, err = mysql.MysqlCli.Client.Exec(`INSERT INTO measurement_schema (schema_id, dev_type, measurement, description,
+		fields, tags, strict, coerce, version, create_by, create_at, update_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		schema.SchemaID, schema.DevType, schema.Measurement, schema.Description, string(fieldsJSON), string(tagsJSON),
+		schema.Strict, schema.Coerce, schema.Version, schema.CreateBy, schema.CreateAt, schema.UpdateAt)
+	if err != nil && strings.Contains(err.Error(), "Duplicate entry") {
+		return errors.New("该设备类型的measurement已存在schema")
+	}
+	return err
+}
+
+// GetSchema 获取schema
+func (r *MeasurementSchemaRepository) GetSchema(schemaID int64) (*model.MeasurementSchema, error) {
+	query := `SELECT ` + measurementSchemaColumns + ` FROM measurement_schema WHERE schema_id = ?`
+	schema, err := scanMeasurementSchema(mysql.MysqlCli.Client.QueryRow(query, schemaID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("schema不存在")
+		}
+		return nil, err
+	}
+	return schema, nil
+}
+
+// ListSchemas 获取schema列表，devType/measurement为空表示不限
+func (r *MeasurementSchemaRepository) ListSchemas(devType, measurement string) ([]*model.MeasurementSchema, error) {
+	query := `SELECT ` + measurementSchemaColumns + ` FROM measurement_schema WHERE 1 = 1`
+	args := make([]interface{}, 0, 2)
+	if devType != "" {
+		query += " AND dev_type = ?"
+		args = append(args, devType)
+	}
+	if measurement != "" {
+		query += " AND measurement = ?"
+		args = append(args, measurement)
+	}
+	query += " ORDER BY dev_type ASC, measurement ASC"
+
+	rows, err := mysql.MysqlCli.Client.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schemas := make([]*model.MeasurementSchema, 0)
+	for rows.Next() {
+		schema, err := scanMeasurementSchema(rows)
+		if err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, schema)
+	}
+	return schemas, rows.Err()
+}
+
+// UpdateSchema 更新schema（版本号加1）
+func (r *MeasurementSchemaRepository) UpdateSchema(schema *model.MeasurementSchema) error {
+	fieldsJSON, err := json.Marshal(schema.Fields)
+	if err != nil {
+		return err
+	}
+	tagsJSON, err := json.Marshal(schema.Tags)
+	if err != nil {
+		return err
+	}
+	_, err = mysql.MysqlCli.Client.Exec(`UPDATE measurement_schema SET description = ?, fields = ?, tags = ?, strict = ?,
+		coerce = ?, version = ?, update_at = ? WHERE schema_id = ?`,
+		schema.Description, string(fieldsJSON), string(tagsJSON), schema.Strict, schema.Coerce, schema.Version,
+		schema.UpdateAt, schema.SchemaID)
+	return err
+}
+
+// DeleteSchema 删除schema
+func (r *MeasurementSchemaRepository) DeleteSchema(schemaID int64) error {
+	_, err := mysql.MysqlCli.Client.Exec(`DELETE FROM measurement_schema WHERE schema_id = ?`, schemaID)
+	return err
+}
+
+// scanMeasurementSchema 扫描schema
+func scanMeasurementSchema(row rowScanner) (*model.MeasurementSchema, error) {
+	schema := &model.MeasurementSchema{}
+	var fieldsJSON, tagsJSON sql.NullString
+	err := row.Scan(&schema.SchemaID, &schema.DevType, &schema.Measurement, &schema.Description, &fieldsJSON, &tagsJSON,
+		&schema.Strict, &schema.Coerce, &schema.Version, &schema.CreateBy, &schema.CreateAt, &schema.UpdateAt)
+	if err != nil {
+		return nil, err
+	}
+	schema.Fields = make([]model.SchemaField, 0)
+	schema.Tags = make([]model.SchemaTag, 0)
+	if fieldsJSON.Valid {
+		if err := json.Unmarshal([]byte(fieldsJSON.String), &schema.Fields); err != nil {
+			return nil, err
+		}
+	}
+	if tagsJSON.Valid {
+		if err := json.Unmarshal([]byte(tagsJSON.String), &schema.Tags); err != nil {
+			return nil, err
+		}
+	}
+	return schema, nil
+}
@@ -51,6 +51,71 @@ func (r *MetadataRepository) GetMetadata(dataID int64) (*model.Metadata, error)
 	return metadata, nil
 }
 
+// GetFileMetadataByBucketKey 根据bucket_name和bucket_key获取文件元数据
+func (r *MetadataRepository) GetFileMetadataByBucketKey(bucketName, bucketKey string) (*model.Metadata, error) {
+	metadata := &model.Metadata{}
+	var extraDataJSON sql.NullString
+
+	query := `SELECT data_id, dev_id, data_type, quality_score, extra_data, timestamp
+		FROM metadata
+		WHERE data_type = ?
+		AND JSON_UNQUOTE(JSON_EXTRACT(extra_data, '$.bucket_name')) = ?
+		AND JSON_UNQUOTE(JSON_EXTRACT(extra_data, '$.bucket_key')) = ?
+		LIMIT 1`
+
+	err := mysql.MysqlCli.Client.QueryRow(query, model.DataTypeFileData, bucketName, bucketKey).Scan(
+		&metadata.DataID, &metadata.DevID, &metadata.DataType,
+		&metadata.QualityScore, &extraDataJSON, &metadata.Timestamp)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if extraDataJSON.Valid {
+		json.Unmarshal([]byte(extraDataJSON.String), &metadata.ExtraData)
+	}
+
+	return metadata, nil
+}
+
+// GetFileMetadataBySHA256 获取设备中内容相同（SHA-256一致）的最早一个文件
+func (r *MetadataRepository) GetFileMetadataBySHA256(devID int64, sha256 string) (*model.Metadata, error) {
+	metadata := &model.Metadata{}
+	var extraDataJSON sql.NullString
+
+	query := `SELECT data_id, dev_id, data_type, quality_score, extra_data, timestamp
+		FROM metadata
+		WHERE dev_id = ? AND data_type = ?
+		AND JSON_UNQUOTE(JSON_EXTRACT(extra_data, '$.sha256')) = ?
+		ORDER BY timestamp ASC
+		LIMIT 1`
+
+	err := mysql.MysqlCli.Client.QueryRow(query, devID, model.DataTypeFileData, sha256).Scan(
+		&metadata.DataID, &metadata.DevID, &metadata.DataType,
+		&metadata.QualityScore, &extraDataJSON, &metadata.Timestamp)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if extraDataJSON.Valid {
+		json.Unmarshal([]byte(extraDataJSON.String), &metadata.ExtraData)
+	}
+
+	return metadata, nil
+}
+
+// SetFileDerivatives 更新文件metadata的派生文件信息（只修改extra_data.derivatives）
+func (r *MetadataRepository) SetFileDerivatives(dataID int64, derivatives map[string]model.Derivative) error {
+	derivativesJSON, _ := json.Marshal(derivatives)
+
+	query := `UPDATE metadata
+		SET extra_data = JSON_SET(COALESCE(extra_data, JSON_OBJECT()), '$.derivatives', CAST(? AS JSON))
+		WHERE data_id = ?`
+	_, err := mysql.MysqlCli.Client.Exec(query, string(derivativesJSON), dataID)
+	return err
+}
+
 // GetMetadataList 获取元数据列表（分页）
 // 注意：uid参数已废弃，但保留以兼容旧代码
 func (r *MetadataRepository) GetMetadataList(page, pageSize int, dataType string, startTime, endTime *int64,
@@ -0,0 +1,269 @@
+package repo
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"backend/internal/db/influxdb"
+	"backend/internal/db/mysql"
+	"backend/internal/model"
+)
+
+type RetentionRepository struct{}
+
+func NewRetentionRepository() *RetentionRepository {
+	return &RetentionRepository{}
+}
+
+const retentionPolicyColumns = `policy_id, name, dev_type, data_type, measurement, bucket_name, retention_days,
+	enabled, create_by, create_at, update_at`
+
+// metadata中时序数据的measurement取值表达式
+const seriesMeasurementExpr = "JSON_UNQUOTE(JSON_EXTRACT(extra_data, '$.measurement'))"
+
+// CreatePolicy 创建保留策略
+func (r *RetentionRepository) CreatePolicy(policy *model.RetentionPolicy) error {
+	_, err := mysql.MysqlCli.Client.Exec(`INSERT INTO retention_policy (policy_id, name, dev_type, data_type, measurement,
+		bucket_name, retention_days, enabled, create_by, create_at, update_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		policy.PolicyID, policy.Name, policy.DevType, policy.DataType, policy.Measurement, policy.BucketName,
+		policy.RetentionDays, policy.Enabled, policy.CreateBy, policy.CreateAt, policy.UpdateAt)
+	return err
+}
+
+// GetPolicy 获取保留策略
+func (r *RetentionRepository) GetPolicy(policyID int64) (*model.RetentionPolicy, error) {
+	query := `SELECT ` + retentionPolicyColumns + ` FROM retention_policy WHERE policy_id = ?`
+	policy, err := scanRetentionPolicy(mysql.MysqlCli.Client.QueryRow(query, policyID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("保留策略不存在")
+		}
+		return nil, err
+	}
+	return policy, nil
+}
+
+// ListPolicies 获取保留策略列表，enabledOnly为true时只返回启用的策略
+func (r *RetentionRepository) ListPolicies(enabledOnly bool) ([]*model.RetentionPolicy, error) {
+	query := `SELECT ` + retentionPolicyColumns + ` FROM retention_policy`
+	if enabledOnly {
+		query += " WHERE enabled = 1"
+	}
+	query += " ORDER BY policy_id ASC"
+
+	rows, err := mysql.MysqlCli.Client.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := make([]*model.RetentionPolicy, 0)
+	for rows.Next() {
+		policy, err := scanRetentionPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// UpdatePolicy 更新保留策略（名称、保留天数、启用状态）
+func (r *RetentionRepository) UpdatePolicy(policy *model.RetentionPolicy) error {
+	_, err := mysql.MysqlCli.Client.Exec(`UPDATE retention_policy SET name = ?, retention_days = ?, enabled = ?, update_at = ?
+		WHERE policy_id = ?`,
+		policy.Name, policy.RetentionDays, policy.Enabled, policy.UpdateAt, policy.PolicyID)
+	return err
+}
+
+// DeletePolicy 删除保留策略
+func (r *RetentionRepository) DeletePolicy(policyID int64) error {
+	_, err := mysql.MysqlCli.Client.Exec(`DELETE FROM retention_policy WHERE policy_id = ?`, policyID)
+	return err
+}
+
+// CountExpired 统计按策略过期的元数据数量（被保留时间更长的策略覆盖的数据不计入）
+func (r *RetentionRepository) CountExpired(policy *model.RetentionPolicy, longer []*model.RetentionPolicy, now time.Time) (int64, error) {
+	where, args := expiredClause(policy, longer, now)
+	var count int64
+	err := mysql.MysqlCli.Client.QueryRow("SELECT COUNT(*) FROM metadata WHERE "+where, args...).Scan(&count)
+	return count, err
+}
+
+// GetExpiredFiles 获取按策略过期的文件元数据（按时间升序，最多limit条）
+func (r *RetentionRepository) GetExpiredFiles(policy *model.RetentionPolicy, longer []*model.RetentionPolicy, now time.Time, limit int) ([]*model.Metadata, error) {
+	where, args := expiredClause(policy, longer, now)
+	query := `SELECT data_id, dev_id, data_type, quality_score, extra_data, timestamp
+		FROM metadata WHERE ` + where + ` ORDER BY timestamp ASC LIMIT ?`
+	rows, err := mysql.MysqlCli.Client.Query(query, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metadataList := make([]*model.Metadata, 0)
+	for rows.Next() {
+		metadata := &model.Metadata{}
+		var extraDataJSON sql.NullString
+		if err := rows.Scan(&metadata.DataID, &metadata.DevID, &metadata.DataType,
+			&metadata.QualityScore, &extraDataJSON, &metadata.Timestamp); err != nil {
+			return nil, err
+		}
+		if extraDataJSON.Valid {
+			json.Unmarshal([]byte(extraDataJSON.String), &metadata.ExtraData)
+		}
+		metadataList = append(metadataList, metadata)
+	}
+	return metadataList, nil
+}
+
+// DeleteExpiredMetadata 删除按策略过期的元数据（每次最多limit条），返回删除数量
+func (r *RetentionRepository) DeleteExpiredMetadata(policy *model.RetentionPolicy, longer []*model.RetentionPolicy, now time.Time, limit int) (int64, error) {
+	where, args := expiredClause(policy, longer, now)
+	result, err := mysql.MysqlCli.Client.Exec("DELETE FROM metadata WHERE "+where+" LIMIT ?", append(args, limit)...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteMetadataByIDs 按data_id批量删除元数据，返回删除数量
+func (r *RetentionRepository) DeleteMetadataByIDs(dataIDs []int64) (int64, error) {
+	if len(dataIDs) == 0 {
+		return 0, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(dataIDs)), ",")
+	args := make([]interface{}, 0, len(dataIDs))
+	for _, id := range dataIDs {
+		args = append(args, id)
+	}
+	result, err := mysql.MysqlCli.Client.Exec("DELETE FROM metadata WHERE data_id IN ("+placeholders+")", args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CountExpiredArchives 统计按策略过期的时序归档数量（整天早于过期时间点）
+func (r *RetentionRepository) CountExpiredArchives(policy *model.RetentionPolicy, longer []*model.RetentionPolicy, now time.Time) (int64, error) {
+	where, args := archiveExpiredClause(policy, longer, now)
+	var count int64
+	err := mysql.MysqlCli.Client.QueryRow("SELECT COUNT(*) FROM series_archive WHERE "+where, args...).Scan(&count)
+	return count, err
+}
+
+// GetExpiredArchives 获取按策略过期的时序归档（按日期升序，最多limit条）
+func (r *RetentionRepository) GetExpiredArchives(policy *model.RetentionPolicy, longer []*model.RetentionPolicy, now time.Time, limit int) ([]*model.SeriesArchive, error) {
+	where, args := archiveExpiredClause(policy, longer, now)
+	rows, err := mysql.MysqlCli.Client.Query(`SELECT `+seriesArchiveColumns+` FROM series_archive
+		WHERE `+where+` ORDER BY day ASC LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	archives := make([]*model.SeriesArchive, 0)
+	for rows.Next() {
+		a, err := scanSeriesArchive(rows)
+		if err != nil {
+			return nil, err
+		}
+		archives = append(archives, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return archives, nil
+}
+
+// DeleteArchive 删除时序归档清单
+func (r *RetentionRepository) DeleteArchive(archiveID int64) error {
+	_, err := mysql.MysqlCli.Client.Exec(`DELETE FROM series_archive WHERE archive_id = ?`, archiveID)
+	return err
+}
+
+// SetInfluxRetentionPeriod 设置InfluxDB数据库的保留期（InfluxDB 3按数据库过期数据，不支持按条件删除）
+func (r *RetentionRepository) SetInfluxRetentionPeriod(days int) error {
+	if influxdb.InfluxDBCli == nil {
+		return fmt.Errorf("InfluxDB客户端未初始化")
+	}
+	return influxdb.InfluxDBCli.SetRetentionPeriod(fmt.Sprintf("%dd", days))
+}
+
+// policyMatchClause 策略匹配的元数据条件
+func policyMatchClause(policy *model.RetentionPolicy) (string, []interface{}) {
+	clause := "data_type = ?"
+	args := []interface{}{policy.DataType}
+	if policy.DevType != "" {
+		clause += " AND dev_id IN (SELECT dev_id FROM device WHERE dev_type = ?)"
+		args = append(args, policy.DevType)
+	}
+	if policy.Measurement != "" {
+		clause += " AND " + seriesMeasurementExpr + " = ?"
+		args = append(args, policy.Measurement)
+	}
+	if policy.BucketName != "" {
+		clause += " AND " + fileBucketNameExpr + " = ?"
+		args = append(args, policy.BucketName)
+	}
+	return clause, args
+}
+
+// expiredClause 按策略过期、且不在任何保留时间更长的策略保留期内的元数据条件
+func expiredClause(policy *model.RetentionPolicy, longer []*model.RetentionPolicy, now time.Time) (string, []interface{}) {
+	where, args := policyMatchClause(policy)
+	where += " AND timestamp < ?"
+	args = append(args, policy.Cutoff(now))
+	for _, other := range longer {
+		match, matchArgs := policyMatchClause(other)
+		where += " AND NOT (" + match + " AND timestamp >= ?)"
+		args = append(args, matchArgs...)
+		args = append(args, other.Cutoff(now))
+	}
+	return where, args
+}
+
+// archiveMatchClause 时序策略匹配的归档条件
+func archiveMatchClause(policy *model.RetentionPolicy) (string, []interface{}) {
+	clause := "1 = 1"
+	args := []interface{}{}
+	if policy.DevType != "" {
+		clause += " AND dev_id IN (SELECT dev_id FROM device WHERE dev_type = ?)"
+		args = append(args, policy.DevType)
+	}
+	if policy.Measurement != "" {
+		clause += " AND measurement = ?"
+		args = append(args, policy.Measurement)
+	}
+	return clause, args
+}
+
+// archiveExpiredClause 按策略过期（整天早于过期时间点）、且不在任何保留时间更长的策略保留期内的归档条件
+func archiveExpiredClause(policy *model.RetentionPolicy, longer []*model.RetentionPolicy, now time.Time) (string, []interface{}) {
+	where, args := archiveMatchClause(policy)
+	where += " AND day < ?"
+	args = append(args, policy.Cutoff(now).UTC().Format("2006-01-02"))
+	for _, other := range longer {
+		match, matchArgs := archiveMatchClause(other)
+		where += " AND NOT (" + match + " AND day >= ?)"
+		args = append(args, matchArgs...)
+		args = append(args, other.Cutoff(now).UTC().Format("2006-01-02"))
+	}
+	return where, args
+}
+
+// scanRetentionPolicy 扫描保留策略
+func scanRetentionPolicy(row rowScanner) (*model.RetentionPolicy, error) {
+	policy := &model.RetentionPolicy{}
+	err := row.Scan(&policy.PolicyID, &policy.Name, &policy.DevType, &policy.DataType, &policy.Measurement,
+		&policy.BucketName, &policy.RetentionDays, &policy.Enabled, &policy.CreateBy, &policy.CreateAt, &policy.UpdateAt)
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
@@ -0,0 +1,93 @@
+package repo
+
+import (
+	"fmt"
+	"time"
+
+	"backend/internal/db/influxdb"
+	"backend/internal/db/mysql"
+	"backend/internal/model"
+)
+
+type RollupRepository struct{}
+
+func NewRollupRepository() *RollupRepository {
+	return &RollupRepository{}
+}
+
+// GetWatermarks 获取所有汇总水位线
+func (r *RollupRepository) GetWatermarks() ([]model.RollupWatermark, error) {
+	rows, err := mysql.MysqlCli.Client.Query(`SELECT measurement, level, coverage_start, watermark, update_at
+		FROM rollup_watermark ORDER BY measurement, level`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	watermarks := make([]model.RollupWatermark, 0)
+	for rows.Next() {
+		var w model.RollupWatermark
+		if err := rows.Scan(&w.Measurement, &w.Level, &w.CoverageStart, &w.Watermark, &w.UpdateAt); err != nil {
+			return nil, err
+		}
+		watermarks = append(watermarks, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return watermarks, nil
+}
+
+// SaveWatermark 保存汇总水位线（覆盖起点只会向前扩展）
+func (r *RollupRepository) SaveWatermark(w *model.RollupWatermark) error {
+	_, err := mysql.MysqlCli.Client.Exec(`INSERT INTO rollup_watermark (measurement, level, coverage_start, watermark, update_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE coverage_start = LEAST(coverage_start, VALUES(coverage_start)),
+			watermark = VALUES(watermark), update_at = VALUES(update_at)`,
+		w.Measurement, w.Level, w.CoverageStart, w.Watermark, w.UpdateAt)
+	if err != nil {
+		return err
+	}
+	influxdb.SetRollupWatermark(w.Measurement, w.Level, w.CoverageStart, w.Watermark)
+	return nil
+}
+
+// TrimCoverage 将所有汇总的覆盖起点推后到since（早于since的汇总数据已被数据库保留期删除）
+func (r *RollupRepository) TrimCoverage(since time.Time) error {
+	_, err := mysql.MysqlCli.Client.Exec(`UPDATE rollup_watermark SET coverage_start = ? WHERE coverage_start < ?`,
+		since, since)
+	if err != nil {
+		return err
+	}
+	influxdb.TrimRollupCoverage(since)
+	return nil
+}
+
+// RegisterRollup 登记measurement的汇总字段与已有水位线，查询时据此选择汇总数据
+func (r *RollupRepository) RegisterRollup(measurement string, fields []string, watermarks []model.RollupWatermark) {
+	influxdb.RegisterRollup(measurement, fields)
+	for _, w := range watermarks {
+		if w.Measurement == measurement {
+			influxdb.SetRollupWatermark(w.Measurement, w.Level, w.CoverageStart, w.Watermark)
+		}
+	}
+}
+
+// ComputeAndWriteRollup 计算[from, to)内的汇总数据并写入汇总measurement，返回写入的点数
+// source为空时从原始数据计算，否则从更细一级的汇总结果计算
+func (r *RollupRepository) ComputeAndWriteRollup(measurement string, fields []string, source string, level model.RollupLevel, from, to time.Time) (int, error) {
+	if influxdb.InfluxDBCli == nil {
+		return 0, fmt.Errorf("InfluxDB客户端未初始化")
+	}
+	points, err := influxdb.InfluxDBCli.ComputeRollup(measurement, fields, source, level, from, to)
+	if err != nil {
+		return 0, fmt.Errorf("计算汇总数据失败: %v", err)
+	}
+	if len(points) == 0 {
+		return 0, nil
+	}
+	if err := influxdb.InfluxDBCli.WritePoints(points); err != nil {
+		return 0, fmt.Errorf("写入汇总数据失败: %v", err)
+	}
+	return len(points), nil
+}
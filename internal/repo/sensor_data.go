@@ -4,7 +4,6 @@ import (
 	"backend/internal/db/influxdb"
 	"backend/internal/db/minio"
 	"backend/internal/model"
-	"context"
 	"fmt"
 	"io"
 	"time"
@@ -50,32 +49,20 @@ func (r *SensorDataRepository) DownloadFile(bucketName, objectName, filePath str
 	return presignedURL, err
 }
 
-// GetFileLists 获取文件列表
-func (r *SensorDataRepository) GetFileLists(bucketName string) ([]model.FileList, error) {
+// PresignedPreviewURL 生成文件预览用的预签名GET URL（不强制下载）
+func (r *SensorDataRepository) PresignedPreviewURL(bucketName, objectName string) (string, error) {
 	if minio.MinIOCli == nil {
-		return nil, nil // MinIO未初始化时返回nil
+		return "", fmt.Errorf("MinIO客户端未初始化")
 	}
-	fileLists := make([]model.FileList, 0)
-	objectsChan := minio.MinIOCli.ListObjects(bucketName, "", true)
-	for object := range objectsChan {
-		url, err := minio.MinIOCli.Client.PresignedGetObject(context.Background(),
-			bucketName, object.Key, PresignedURLExpiry, nil)
-		if err != nil {
-			return nil, err
-		}
-		// 转换时间格式为字符串
-		lastModifiedStr := object.LastModified.Format(time.RFC3339)
-
-		fileLists = append(fileLists, model.FileList{
-			BucketKey:    object.Key,
-			Name:         object.Key,
-			PreviewUrl:   url.String(),
-			ContentType:  object.ContentType,
-			LastModified: lastModifiedStr,
-			Size:         object.Size, // int64类型
-		})
-	}
-	return fileLists, nil
+	return minio.MinIOCli.PresignedGetObject(bucketName, objectName, PresignedURLExpiry)
+}
+
+// GetObject 获取MinIO对象内容（调用方负责关闭）
+func (r *SensorDataRepository) GetObject(bucketName, objectName string) (io.ReadCloser, error) {
+	if minio.MinIOCli == nil {
+		return nil, fmt.Errorf("MinIO客户端未初始化")
+	}
+	return minio.MinIOCli.GetObjectAsReader(bucketName, objectName)
 }
 
 // CreateSeriesData 创建时间序列数据
@@ -88,6 +75,14 @@ func (r *SensorDataRepository) CreateSeriesData(seriesData *model.SeriesData) er
 	return influxdb.InfluxDBCli.WritePoints(seriesData.Points)
 }
 
+// WriteSeriesBatch 一次性写入一批时序数据点（不重试）
+func (r *SensorDataRepository) WriteSeriesBatch(points []model.Point) error {
+	if influxdb.InfluxDBCli == nil {
+		return fmt.Errorf("InfluxDB客户端未初始化")
+	}
+	return influxdb.InfluxDBCli.WriteBatchOnce(points)
+}
+
 // DeleteObject 从MinIO删除文件
 func (r *SensorDataRepository) DeleteObject(bucketName, objectName string) error {
 	if minio.MinIOCli == nil {
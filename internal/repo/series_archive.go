@@ -0,0 +1,169 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"time"
+
+	"backend/internal/db/influxdb"
+	"backend/internal/db/minio"
+	"backend/internal/db/mysql"
+	"backend/internal/model"
+)
+
+// seriesArchivePartSize 流式上传Parquet的分片大小
+const seriesArchivePartSize = 16 << 20
+
+type SeriesArchiveRepository struct{}
+
+func NewSeriesArchiveRepository() *SeriesArchiveRepository {
+	return &SeriesArchiveRepository{}
+}
+
+const seriesArchiveColumns = `archive_id, measurement, dev_id, day, bucket_name, object_key, row_count, size, create_at`
+
+// SaveArchive 保存归档清单（同一measurement/设备/日期重复归档时覆盖）
+func (r *SeriesArchiveRepository) SaveArchive(a *model.SeriesArchive) error {
+	_, err := mysql.MysqlCli.Client.Exec(`INSERT INTO series_archive (`+seriesArchiveColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE object_key = VALUES(object_key), row_count = VALUES(row_count),
+			size = VALUES(size), create_at = VALUES(create_at)`,
+		a.ArchiveID, a.Measurement, a.DevID, a.Day.Format("2006-01-02"), a.BucketName, a.ObjectKey,
+		a.RowCount, a.Size, a.CreateAt)
+	return err
+}
+
+// ListArchives 获取与[from, to]重叠的归档，按日期排序
+func (r *SeriesArchiveRepository) ListArchives(measurement string, devID int64, from, to time.Time) ([]*model.SeriesArchive, error) {
+	query := `SELECT ` + seriesArchiveColumns + ` FROM series_archive
+		WHERE measurement = ? AND dev_id = ? AND day >= ? AND day <= ? ORDER BY day ASC`
+	rows, err := mysql.MysqlCli.Client.Query(query, measurement, devID,
+		from.UTC().Format("2006-01-02"), to.UTC().Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	archives := make([]*model.SeriesArchive, 0)
+	for rows.Next() {
+		a, err := scanSeriesArchive(rows)
+		if err != nil {
+			return nil, err
+		}
+		archives = append(archives, a)
+	}
+	return archives, nil
+}
+
+// GetWatermark 获取measurement的归档进度，未归档过时返回false
+func (r *SeriesArchiveRepository) GetWatermark(measurement string) (time.Time, bool, error) {
+	var archivedTo time.Time
+	err := mysql.MysqlCli.Client.QueryRow(`SELECT archived_to FROM series_archive_watermark WHERE measurement = ?`,
+		measurement).Scan(&archivedTo)
+	if err == sql.ErrNoRows {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return utcDate(archivedTo), true, nil
+}
+
+// SaveWatermark 保存measurement的归档进度
+func (r *SeriesArchiveRepository) SaveWatermark(w *model.SeriesArchiveWatermark) error {
+	_, err := mysql.MysqlCli.Client.Exec(`INSERT INTO series_archive_watermark (measurement, archived_to, update_at)
+		VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE archived_to = VALUES(archived_to), update_at = VALUES(update_at)`,
+		w.Measurement, w.ArchivedTo.Format("2006-01-02"), w.UpdateAt)
+	return err
+}
+
+// EarliestTime 获取measurement最早的数据时间
+func (r *SeriesArchiveRepository) EarliestTime(measurement string) (time.Time, bool, error) {
+	if influxdb.InfluxDBCli == nil {
+		return time.Time{}, false, fmt.Errorf("InfluxDB客户端未初始化")
+	}
+	return influxdb.InfluxDBCli.EarliestTime(measurement)
+}
+
+// ListDeviceIDs 获取[from, to)内有数据的设备
+func (r *SeriesArchiveRepository) ListDeviceIDs(measurement string, from, to time.Time) ([]string, error) {
+	if influxdb.InfluxDBCli == nil {
+		return nil, fmt.Errorf("InfluxDB客户端未初始化")
+	}
+	return influxdb.InfluxDBCli.ListDeviceIDs(measurement, from, to)
+}
+
+// QueryDevicePoints 获取设备在[from, to)内InfluxDB中的原始数据点
+func (r *SeriesArchiveRepository) QueryDevicePoints(measurement string, devID int64, from, to time.Time) ([]model.Point, error) {
+	if influxdb.InfluxDBCli == nil {
+		return nil, fmt.Errorf("InfluxDB客户端未初始化")
+	}
+	return influxdb.InfluxDBCli.QueryDevicePoints(measurement, fmt.Sprintf("%d", devID), from, to)
+}
+
+// ExportArchive 将[from, to)内某设备的数据导出为Parquet并上传到archive bucket，返回行数与对象大小
+func (r *SeriesArchiveRepository) ExportArchive(ctx context.Context, measurement, devID string, from, to time.Time, objectKey string) (int64, int64, error) {
+	if influxdb.InfluxDBCli == nil {
+		return 0, 0, fmt.Errorf("InfluxDB客户端未初始化")
+	}
+	if minio.MinIOCli == nil {
+		return 0, 0, fmt.Errorf("MinIO客户端未初始化")
+	}
+
+	pr, pw := io.Pipe()
+	rowsCh := make(chan int64, 1)
+	go func() {
+		rows, err := influxdb.InfluxDBCli.ExportParquet(ctx, measurement, devID, from, to, pw)
+		rowsCh <- rows
+		pw.CloseWithError(err)
+	}()
+
+	size, err := minio.MinIOCli.PutObjectStream(model.ArchiveBucketName, objectKey, pr, "application/vnd.apache.parquet", seriesArchivePartSize)
+	pr.CloseWithError(err)
+	rows := <-rowsCh
+	if err != nil {
+		return 0, 0, err
+	}
+	return rows, size, nil
+}
+
+// ReadArchive 读取归档的Parquet文件
+func (r *SeriesArchiveRepository) ReadArchive(ctx context.Context, a *model.SeriesArchive) ([]model.Point, error) {
+	if minio.MinIOCli == nil {
+		return nil, fmt.Errorf("MinIO客户端未初始化")
+	}
+	obj, err := minio.MinIOCli.GetObjectAsReader(a.BucketName, a.ObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	return influxdb.ReadParquetPoints(ctx, obj, a.Measurement)
+}
+
+// DeleteArchiveObject 删除归档文件
+func (r *SeriesArchiveRepository) DeleteArchiveObject(objectKey string) error {
+	if minio.MinIOCli == nil {
+		return fmt.Errorf("MinIO客户端未初始化")
+	}
+	return minio.MinIOCli.DeleteObject(model.ArchiveBucketName, objectKey)
+}
+
+// scanSeriesArchive 扫描归档清单
+func scanSeriesArchive(row rowScanner) (*model.SeriesArchive, error) {
+	a := &model.SeriesArchive{}
+	var day time.Time
+	if err := row.Scan(&a.ArchiveID, &a.Measurement, &a.DevID, &day, &a.BucketName, &a.ObjectKey,
+		&a.RowCount, &a.Size, &a.CreateAt); err != nil {
+		return nil, err
+	}
+	a.Day = utcDate(day)
+	return a, nil
+}
+
+// utcDate DATE列按连接时区解析，取其日期部分作为UTC日期
+func utcDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,274 @@
+package repo
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"backend/internal/db/mysql"
+	"backend/internal/model"
+)
+
+// ErrSeriesOutboxNotOpen 写入记录已完成或已补偿
+var ErrSeriesOutboxNotOpen = errors.New("时序写入记录已完成或已补偿")
+
+type SeriesOutboxRepository struct{}
+
+func NewSeriesOutboxRepository() *SeriesOutboxRepository {
+	return &SeriesOutboxRepository{}
+}
+
+// seriesOutboxPayload 写入记录中保存的完整写入内容
+type seriesOutboxPayload struct {
+	Metadata *model.Metadata `json:"metadata"`
+	Points   []model.Point   `json:"points"`
+}
+
+const seriesOutboxColumns = `data_id, dev_id, status, point_count, min_timestamp, max_timestamp, attempts, last_error,
+	create_at, update_at`
+
+// CreateOutbox 记录写入意图（data_id已存在时返回错误）
+func (r *SeriesOutboxRepository) CreateOutbox(o *model.SeriesWriteOutbox) error {
+	payload, err := json.Marshal(seriesOutboxPayload{Metadata: o.Metadata, Points: o.Points})
+	if err != nil {
+		return err
+	}
+	_, err = mysql.MysqlCli.Client.Exec(`INSERT INTO series_write_outbox (data_id, dev_id, status, point_count,
+		min_timestamp, max_timestamp, attempts, payload, create_at, update_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		o.DataID, o.DevID, o.Status, o.PointCount, o.MinTimestamp, o.MaxTimestamp, o.Attempts, string(payload),
+		o.CreateAt, o.UpdateAt)
+	return err
+}
+
+// MarkWritten InfluxDB写入成功
+func (r *SeriesOutboxRepository) MarkWritten(dataID int64, now time.Time) error {
+	_, err := mysql.MysqlCli.Client.Exec(`UPDATE series_write_outbox SET status = ?, update_at = ?
+		WHERE data_id = ? AND status IN (?, ?)`,
+		model.SeriesOutboxStatusWritten, now, dataID, model.SeriesOutboxStatusQueued, model.SeriesOutboxStatusPending)
+	return err
+}
+
+// ReleaseQueued 将写入队列中的记录交给补偿任务处理（dataIDs为空时处理全部queued记录，用于服务重启）
+func (r *SeriesOutboxRepository) ReleaseQueued(dataIDs []int64, now time.Time) (int64, error) {
+	query := `UPDATE series_write_outbox SET status = ?, update_at = ? WHERE status = ?`
+	args := []any{model.SeriesOutboxStatusPending, now, model.SeriesOutboxStatusQueued}
+	if len(dataIDs) > 0 {
+		query += ` AND data_id IN (?` + strings.Repeat(`, ?`, len(dataIDs)-1) + `)`
+		for _, id := range dataIDs {
+			args = append(args, id)
+		}
+	}
+	result, err := mysql.MysqlCli.Client.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ListQueuedIDs 获取写入队列中（status=queued）的记录ID
+func (r *SeriesOutboxRepository) ListQueuedIDs() ([]int64, error) {
+	rows, err := mysql.MysqlCli.Client.Query(`SELECT data_id FROM series_write_outbox WHERE status = ?`,
+		model.SeriesOutboxStatusQueued)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// DeleteQueued 删除未能进入写入队列的记录
+func (r *SeriesOutboxRepository) DeleteQueued(dataID int64) error {
+	_, err := mysql.MysqlCli.Client.Exec(`DELETE FROM series_write_outbox WHERE data_id = ? AND status = ?`,
+		dataID, model.SeriesOutboxStatusQueued)
+	return err
+}
+
+// CompleteWithMetadata 事务内将写入记录标记为completed并创建metadata
+// 记录已完成或已补偿时返回 ErrSeriesOutboxNotOpen
+func (r *SeriesOutboxRepository) CompleteWithMetadata(metadata *model.Metadata, now time.Time) (err error) {
+	tx, err := mysql.MysqlCli.Client.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	result, err := tx.Exec(`UPDATE series_write_outbox SET status = ?, payload = NULL, last_error = NULL, update_at = ?
+		WHERE data_id = ? AND status IN (?, ?, ?)`,
+		model.SeriesOutboxStatusCompleted, now, metadata.DataID,
+		model.SeriesOutboxStatusQueued, model.SeriesOutboxStatusPending, model.SeriesOutboxStatusWritten)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		err = ErrSeriesOutboxNotOpen
+		return err
+	}
+
+	extraDataJSON, _ := json.Marshal(metadata.ExtraData)
+	_, err = tx.Exec(`INSERT INTO metadata (data_id, dev_id, data_type, quality_score, extra_data, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		metadata.DataID, metadata.DevID, metadata.DataType, metadata.QualityScore,
+		string(extraDataJSON), metadata.Timestamp)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RecordAttempt 记录一次失败的尝试
+func (r *SeriesOutboxRepository) RecordAttempt(dataID int64, attempts int, lastError string, now time.Time) error {
+	_, err := mysql.MysqlCli.Client.Exec(`UPDATE series_write_outbox SET attempts = ?, last_error = ?, update_at = ?
+		WHERE data_id = ?`, attempts, lastError, now, dataID)
+	return err
+}
+
+// Tombstone 补偿：未完成的写入记录标记为tombstoned
+func (r *SeriesOutboxRepository) Tombstone(dataID int64, attempts int, lastError string, now time.Time) error {
+	_, err := mysql.MysqlCli.Client.Exec(`UPDATE series_write_outbox
+		SET status = ?, payload = NULL, attempts = ?, last_error = ?, update_at = ?
+		WHERE data_id = ? AND status IN (?, ?, ?)`,
+		model.SeriesOutboxStatusTombstoned, attempts, lastError, now, dataID,
+		model.SeriesOutboxStatusQueued, model.SeriesOutboxStatusPending, model.SeriesOutboxStatusWritten)
+	return err
+}
+
+// GetStuckOutbox 获取update_at早于before的未完成记录（含写入内容）
+func (r *SeriesOutboxRepository) GetStuckOutbox(before time.Time, limit int) ([]*model.SeriesWriteOutbox, error) {
+	rows, err := mysql.MysqlCli.Client.Query(`SELECT `+seriesOutboxColumns+`, payload FROM series_write_outbox
+		WHERE status IN (?, ?) AND update_at < ? ORDER BY create_at ASC LIMIT ?`,
+		model.SeriesOutboxStatusPending, model.SeriesOutboxStatusWritten, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]*model.SeriesWriteOutbox, 0)
+	for rows.Next() {
+		var payloadJSON sql.NullString
+		e, err := scanSeriesOutbox(rows, &payloadJSON)
+		if err != nil {
+			return nil, err
+		}
+		if payloadJSON.Valid {
+			var payload seriesOutboxPayload
+			if err := json.Unmarshal([]byte(payloadJSON.String), &payload); err == nil {
+				e.Metadata = payload.Metadata
+				e.Points = payload.Points
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// GetTombstonedDataIDs 获取设备在时间范围内被补偿的data_id
+func (r *SeriesOutboxRepository) GetTombstonedDataIDs(devID int64, startTime, endTime int64) (map[string]bool, error) {
+	rows, err := mysql.MysqlCli.Client.Query(`SELECT data_id FROM series_write_outbox
+		WHERE dev_id = ? AND status = ? AND max_timestamp >= ? AND min_timestamp <= ?`,
+		devID, model.SeriesOutboxStatusTombstoned, startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dataIDs := make(map[string]bool)
+	for rows.Next() {
+		var dataID string
+		if err := rows.Scan(&dataID); err != nil {
+			return nil, err
+		}
+		dataIDs[dataID] = true
+	}
+	return dataIDs, nil
+}
+
+// GetStats 统计各状态数量与超过stuckBefore仍未完成的记录
+func (r *SeriesOutboxRepository) GetStats(stuckBefore time.Time, sampleSize int) (*model.SeriesOutboxStats, error) {
+	stats := &model.SeriesOutboxStats{StuckEntries: make([]*model.SeriesWriteOutbox, 0)}
+	rows, err := mysql.MysqlCli.Client.Query(`SELECT status, COUNT(*) FROM series_write_outbox
+		WHERE status <> ? GROUP BY status`, model.SeriesOutboxStatusCompleted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status string
+		var count int64
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		switch status {
+		case model.SeriesOutboxStatusQueued:
+			stats.Queued = count
+		case model.SeriesOutboxStatusPending:
+			stats.Pending = count
+		case model.SeriesOutboxStatusWritten:
+			stats.Written = count
+		case model.SeriesOutboxStatusTombstoned:
+			stats.Tombstoned = count
+		}
+	}
+
+	var oldest sql.NullTime
+	err = mysql.MysqlCli.Client.QueryRow(`SELECT COUNT(*), MIN(create_at) FROM series_write_outbox
+		WHERE status IN (?, ?) AND update_at < ?`,
+		model.SeriesOutboxStatusPending, model.SeriesOutboxStatusWritten, stuckBefore).Scan(&stats.Stuck, &oldest)
+	if err != nil {
+		return nil, err
+	}
+	if oldest.Valid {
+		stats.OldestStuckAt = &oldest.Time
+	}
+
+	if stats.Stuck > 0 {
+		sampleRows, err := mysql.MysqlCli.Client.Query(`SELECT `+seriesOutboxColumns+` FROM series_write_outbox
+			WHERE status IN (?, ?) AND update_at < ? ORDER BY create_at ASC LIMIT ?`,
+			model.SeriesOutboxStatusPending, model.SeriesOutboxStatusWritten, stuckBefore, sampleSize)
+		if err != nil {
+			return nil, err
+		}
+		defer sampleRows.Close()
+		for sampleRows.Next() {
+			e, err := scanSeriesOutbox(sampleRows)
+			if err != nil {
+				return nil, err
+			}
+			stats.StuckEntries = append(stats.StuckEntries, e)
+		}
+	}
+	return stats, nil
+}
+
+// scanSeriesOutbox 扫描写入记录，extra为追加在标准列之后的列
+func scanSeriesOutbox(row rowScanner, extra ...any) (*model.SeriesWriteOutbox, error) {
+	e := &model.SeriesWriteOutbox{}
+	var lastError sql.NullString
+	dest := []any{&e.DataID, &e.DevID, &e.Status, &e.PointCount, &e.MinTimestamp, &e.MaxTimestamp,
+		&e.Attempts, &lastError, &e.CreateAt, &e.UpdateAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	e.LastError = lastError.String
+	return e, nil
+}
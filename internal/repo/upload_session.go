@@ -0,0 +1,286 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"backend/internal/db/minio"
+	"backend/internal/db/mysql"
+	"backend/internal/model"
+)
+
+// ErrUploadSessionNotPending 上传会话已确认或已过期（并发确认时只有一方成功）
+var ErrUploadSessionNotPending = errors.New("上传会话已确认或已过期")
+
+type UploadSessionRepository struct{}
+
+func NewUploadSessionRepository() *UploadSessionRepository {
+	return &UploadSessionRepository{}
+}
+
+const uploadSessionColumns = `upload_id, dev_id, bucket_name, bucket_key, filename, content_type, uid,
+	status, data_id, size, etag, source, sha256, multipart_upload_id, part_size, file_size, create_at, expire_at, completed_at`
+
+// CreateUploadSession 创建上传会话
+func (r *UploadSessionRepository) CreateUploadSession(session *model.UploadSession) error {
+	query := `INSERT INTO upload_session (upload_id, dev_id, bucket_name, bucket_key, filename, content_type, uid,
+		status, sha256, multipart_upload_id, part_size, file_size, create_at, expire_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := mysql.MysqlCli.Client.Exec(query,
+		session.UploadID, session.DevID, session.BucketName, session.BucketKey, session.Filename,
+		session.ContentType, session.UID, session.Status, session.SHA256, session.MultipartUploadID, session.PartSize,
+		session.FileSize, session.CreateAt, session.ExpireAt)
+	return err
+}
+
+// GetUploadSession 获取上传会话
+func (r *UploadSessionRepository) GetUploadSession(uploadID string) (*model.UploadSession, error) {
+	query := `SELECT ` + uploadSessionColumns + ` FROM upload_session WHERE upload_id = ?`
+	session, err := scanUploadSession(mysql.MysqlCli.Client.QueryRow(query, uploadID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("无效的upload_id")
+		}
+		return nil, err
+	}
+	return session, nil
+}
+
+// GetPendingUploadSessionByKey 根据对象位置获取最新的未过期待确认会话
+func (r *UploadSessionRepository) GetPendingUploadSessionByKey(bucketName, bucketKey string, now time.Time) (*model.UploadSession, error) {
+	query := `SELECT ` + uploadSessionColumns + ` FROM upload_session
+		WHERE bucket_name = ? AND bucket_key = ? AND status = ? AND expire_at >= ?
+		ORDER BY create_at DESC
+		LIMIT 1`
+	return scanUploadSession(mysql.MysqlCli.Client.QueryRow(query, bucketName, bucketKey, model.UploadSessionStatusPending, now))
+}
+
+// HasActiveUploadSession 对象位置是否已被未过期的待确认会话占用
+func (r *UploadSessionRepository) HasActiveUploadSession(bucketName, bucketKey string, now time.Time) (bool, error) {
+	var count int64
+	err := mysql.MysqlCli.Client.QueryRow(`SELECT COUNT(*) FROM upload_session
+		WHERE bucket_name = ? AND bucket_key = ? AND status = ? AND expire_at >= ?`,
+		bucketName, bucketKey, model.UploadSessionStatusPending, now).Scan(&count)
+	return count > 0, err
+}
+
+// CompleteUploadSession 确认上传：事务内将会话标记为completed并创建metadata
+// 会话已不是pending状态时返回 ErrUploadSessionNotPending（另一方已确认）
+func (r *UploadSessionRepository) CompleteUploadSession(session *model.UploadSession, metadata *model.Metadata) (err error) {
+	tx, err := mysql.MysqlCli.Client.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	result, err := tx.Exec(`UPDATE upload_session
+		SET status = ?, data_id = ?, size = ?, etag = ?, source = ?, completed_at = ?
+		WHERE upload_id = ? AND status = ?`,
+		model.UploadSessionStatusCompleted, metadata.DataID, session.Size, session.ETag, session.Source,
+		session.CompletedAt, session.UploadID, model.UploadSessionStatusPending)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		err = ErrUploadSessionNotPending
+		return err
+	}
+
+	extraDataJSON, _ := json.Marshal(metadata.ExtraData)
+	_, err = tx.Exec(`INSERT INTO metadata (data_id, dev_id, data_type, quality_score, extra_data, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		metadata.DataID, metadata.DevID, metadata.DataType, metadata.QualityScore,
+		string(extraDataJSON), metadata.Timestamp)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ExpireUploadSessions 将超时未确认的会话标记为expired
+func (r *UploadSessionRepository) ExpireUploadSessions(now time.Time) (int64, error) {
+	result, err := mysql.MysqlCli.Client.Exec(`UPDATE upload_session SET status = ?
+		WHERE status = ? AND expire_at < ?`,
+		model.UploadSessionStatusExpired, model.UploadSessionStatusPending, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// AbortUploadSession 将待确认的会话标记为aborted
+func (r *UploadSessionRepository) AbortUploadSession(uploadID string) error {
+	_, err := mysql.MysqlCli.Client.Exec(`UPDATE upload_session SET status = ? WHERE upload_id = ? AND status = ?`,
+		model.UploadSessionStatusAborted, uploadID, model.UploadSessionStatusPending)
+	return err
+}
+
+// RejectUploadSession 将待确认的会话标记为rejected（内容校验失败）
+func (r *UploadSessionRepository) RejectUploadSession(uploadID string) error {
+	_, err := mysql.MysqlCli.Client.Exec(`UPDATE upload_session SET status = ? WHERE upload_id = ? AND status = ?`,
+		model.UploadSessionStatusRejected, uploadID, model.UploadSessionStatusPending)
+	return err
+}
+
+// StatObject 获取MinIO对象信息（大小、ETag、内容类型）
+func (r *UploadSessionRepository) StatObject(bucketName, bucketKey string) (*model.ObjectStat, error) {
+	if minio.MinIOCli == nil {
+		return nil, fmt.Errorf("MinIO客户端未初始化")
+	}
+	info, err := minio.MinIOCli.GetObjectInfo(bucketName, bucketKey)
+	if err != nil {
+		return nil, err
+	}
+	return &model.ObjectStat{
+		Size:         info.Size,
+		ETag:         info.ETag,
+		ContentType:  info.ContentType,
+		LastModified: info.LastModified,
+	}, nil
+}
+
+// ObjectExists 对象是否存在
+func (r *UploadSessionRepository) ObjectExists(bucketName, bucketKey string) (bool, error) {
+	if minio.MinIOCli == nil {
+		return false, fmt.Errorf("MinIO客户端未初始化")
+	}
+	_, err := minio.MinIOCli.GetObjectInfo(bucketName, bucketKey)
+	if err == nil {
+		return true, nil
+	}
+	if minio.IsNotFound(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// ListenObjectCreated 订阅bucket的对象创建事件，直到ctx取消或连接出错
+func (r *UploadSessionRepository) ListenObjectCreated(ctx context.Context, bucketName string, fn func(model.BucketEventRecord)) error {
+	if minio.MinIOCli == nil {
+		return fmt.Errorf("MinIO客户端未初始化")
+	}
+	for info := range minio.MinIOCli.ListenObjectCreated(ctx, bucketName) {
+		if info.Err != nil {
+			return info.Err
+		}
+		for _, event := range info.Records {
+			var record model.BucketEventRecord
+			record.EventName = event.EventName
+			record.EventTime = event.EventTime
+			record.S3.Bucket.Name = event.S3.Bucket.Name
+			record.S3.Object.Key = event.S3.Object.Key
+			record.S3.Object.Size = event.S3.Object.Size
+			record.S3.Object.ETag = event.S3.Object.ETag
+			record.S3.Object.ContentType = event.S3.Object.ContentType
+			fn(record)
+		}
+	}
+	return ctx.Err()
+}
+
+// NewMultipartUpload 在MinIO中初始化分片上传
+func (r *UploadSessionRepository) NewMultipartUpload(bucketName, bucketKey, contentType string) (string, error) {
+	if minio.MinIOCli == nil {
+		return "", fmt.Errorf("MinIO客户端未初始化")
+	}
+	return minio.MinIOCli.NewMultipartUpload(bucketName, bucketKey, contentType)
+}
+
+// PresignedUploadPart 生成分片的预签名PUT URL
+func (r *UploadSessionRepository) PresignedUploadPart(bucketName, bucketKey, multipartUploadID string, partNumber int, expiry time.Duration) (string, error) {
+	if minio.MinIOCli == nil {
+		return "", fmt.Errorf("MinIO客户端未初始化")
+	}
+	return minio.MinIOCli.PresignedUploadPart(bucketName, bucketKey, multipartUploadID, partNumber, expiry)
+}
+
+// ListUploadedParts 列出已上传的分片（按分片号升序）
+func (r *UploadSessionRepository) ListUploadedParts(bucketName, bucketKey, multipartUploadID string) ([]model.UploadedPart, error) {
+	if minio.MinIOCli == nil {
+		return nil, fmt.Errorf("MinIO客户端未初始化")
+	}
+	objectParts, err := minio.MinIOCli.ListObjectParts(bucketName, bucketKey, multipartUploadID)
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]model.UploadedPart, 0, len(objectParts))
+	for _, p := range objectParts {
+		parts = append(parts, model.UploadedPart{
+			PartNumber:   p.PartNumber,
+			ETag:         strings.Trim(p.ETag, `"`),
+			Size:         p.Size,
+			LastModified: p.LastModified,
+		})
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	return parts, nil
+}
+
+// CompleteMultipartUpload 合并分片
+func (r *UploadSessionRepository) CompleteMultipartUpload(bucketName, bucketKey, multipartUploadID string, parts []model.CompletedPart) error {
+	if minio.MinIOCli == nil {
+		return fmt.Errorf("MinIO客户端未初始化")
+	}
+	etags := make(map[int]string, len(parts))
+	for _, p := range parts {
+		etags[p.PartNumber] = p.ETag
+	}
+	return minio.MinIOCli.CompleteMultipartUpload(bucketName, bucketKey, multipartUploadID, etags)
+}
+
+// AbortMultipartUpload 取消MinIO中的分片上传
+func (r *UploadSessionRepository) AbortMultipartUpload(bucketName, bucketKey, multipartUploadID string) error {
+	if minio.MinIOCli == nil {
+		return fmt.Errorf("MinIO客户端未初始化")
+	}
+	return minio.MinIOCli.AbortMultipartUpload(bucketName, bucketKey, multipartUploadID)
+}
+
+// WalkIncompleteUploads 遍历bucket中未完成的分片上传
+func (r *UploadSessionRepository) WalkIncompleteUploads(bucketName string, fn func(key, multipartUploadID string, initiated time.Time)) error {
+	if minio.MinIOCli == nil {
+		return fmt.Errorf("MinIO客户端未初始化")
+	}
+	for upload := range minio.MinIOCli.ListIncompleteUploads(context.Background(), bucketName) {
+		if upload.Err != nil {
+			return upload.Err
+		}
+		fn(upload.Key, upload.UploadID, upload.Initiated)
+	}
+	return nil
+}
+
+// scanUploadSession 扫描上传会话
+func scanUploadSession(row rowScanner) (*model.UploadSession, error) {
+	session := &model.UploadSession{}
+	var etag, source sql.NullString
+	var completedAt sql.NullTime
+	err := row.Scan(&session.UploadID, &session.DevID, &session.BucketName, &session.BucketKey,
+		&session.Filename, &session.ContentType, &session.UID, &session.Status, &session.DataID,
+		&session.Size, &etag, &source, &session.SHA256, &session.MultipartUploadID, &session.PartSize, &session.FileSize,
+		&session.CreateAt, &session.ExpireAt, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+	session.ETag = etag.String
+	session.Source = source.String
+	if completedAt.Valid {
+		session.CompletedAt = &completedAt.Time
+	}
+	return session, nil
+}
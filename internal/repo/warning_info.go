@@ -146,6 +146,31 @@ func (r *WarningInfoRepository) UpdateWarningStatus(alertID int64, alertStatus s
 	return err
 }
 
+// GetActiveDeviceWarning 获取设备指定类型、指定消息前缀的未解决告警（不存在返回nil）
+func (r *WarningInfoRepository) GetActiveDeviceWarning(devID int64, alertType, messagePrefix string) (*model.WarningInfo, error) {
+	warning := &model.WarningInfo{}
+	var resolvedAt sql.NullTime
+
+	query := `SELECT alert_id, data_id, dev_id, alert_type, alert_message, alert_status, triggered_at, resolved_at
+		FROM alert_event WHERE dev_id = ? AND alert_type = ? AND alert_status = 'active' AND alert_message LIKE ?
+		ORDER BY triggered_at DESC LIMIT 1`
+
+	err := mysql.MysqlCli.Client.QueryRow(query, devID, alertType, messagePrefix+"%").Scan(
+		&warning.AlertID, &warning.DataID, &warning.DevID, &warning.AlertType, &warning.AlertMessage, &warning.AlertStatus,
+		&warning.TriggeredAt, &resolvedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if resolvedAt.Valid {
+		warning.ResolvedAt = &resolvedAt.Time
+	}
+	return warning, nil
+}
+
 // DeleteWarningInfo 删除告警信息
 func (r *WarningInfoRepository) DeleteWarningInfo(alertID int64) error {
 	_, err := mysql.MysqlCli.Client.Exec("DELETE FROM alert_event WHERE alert_id = ?", alertID)
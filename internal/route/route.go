@@ -16,47 +16,173 @@ func RegisterRoutes(router *gin.Engine) {
 		api.POST("/users/login", userHandler.Login)
 		api.GET("/users/all", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), userHandler.GetUsers)
 		api.GET("/users", middleware.JWTAuthMiddleware(), userHandler.GetUser)
-		api.PUT("/users", middleware.JWTAuthMiddleware(), userHandler.UpdateUserInfo)
-		api.PUT("/users/password", middleware.JWTAuthMiddleware(), userHandler.UpdateUserPassword)
-		api.DELETE("/users", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), userHandler.DeleteUser)
+		api.PUT("/users", middleware.JWTAuthMiddleware(), middleware.IdempotencyMiddleware(), userHandler.UpdateUserInfo)
+		api.PUT("/users/password", middleware.JWTAuthMiddleware(), middleware.IdempotencyMiddleware(), userHandler.UpdateUserPassword)
+		api.DELETE("/users", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), middleware.IdempotencyMiddleware(), userHandler.DeleteUser)
 		api.GET("/users/bind_devices", middleware.JWTAuthMiddleware(), userHandler.GetUserDevices)
 
 		// device相关接口
 		deviceHandler := handler.NewDeviceHandler()
-		api.POST("/devices", middleware.JWTAuthMiddleware(), deviceHandler.CreateDevice)
+		api.POST("/devices", middleware.JWTAuthMiddleware(), middleware.IdempotencyMiddleware(), deviceHandler.CreateDevice)
 		api.GET("/devices", middleware.JWTAuthMiddleware(), deviceHandler.GetDevices)
-		api.PUT("/devices", middleware.JWTAuthMiddleware(), deviceHandler.UpdateDevice)
-		api.DELETE("/devices", middleware.JWTAuthMiddleware(), deviceHandler.DeleteDevice)
+		api.PUT("/devices", middleware.JWTAuthMiddleware(), middleware.IdempotencyMiddleware(), deviceHandler.UpdateDevice)
+		api.DELETE("/devices", middleware.JWTAuthMiddleware(), middleware.IdempotencyMiddleware(), deviceHandler.DeleteDevice)
 		api.GET("/devices/statistics", middleware.JWTAuthMiddleware(), deviceHandler.GetDeviceStatistics)
+		api.POST("/devices/token", middleware.JWTAuthMiddleware(), middleware.IdempotencyMiddleware(), deviceHandler.IssueDeviceToken)
+		api.POST("/devices/token/revoke", middleware.JWTAuthMiddleware(), middleware.IdempotencyMiddleware(), deviceHandler.RevokeDeviceTokens)
+
+		// 设备预注册/认领相关接口
+		deviceProvisionHandler := handler.NewDeviceProvisionHandler()
+		api.POST("/devices/provision", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), middleware.IdempotencyMiddleware(), deviceProvisionHandler.ProvisionDevices)
+		api.POST("/devices/claim", middleware.JWTAuthMiddleware(), middleware.IdempotencyMiddleware(), deviceProvisionHandler.ClaimDevice)
+		api.POST("/device/bootstrap", deviceProvisionHandler.Bootstrap)
+
+		// 设备影子相关接口
+		deviceShadowHandler := handler.NewDeviceShadowHandler()
+		api.GET("/devices/:dev_id/shadow", middleware.JWTAuthMiddleware(), deviceShadowHandler.GetDeviceShadow)
+		api.PATCH("/devices/:dev_id/shadow", middleware.JWTAuthMiddleware(), middleware.IdempotencyMiddleware(), deviceShadowHandler.UpdateDeviceShadow)
+		api.GET("/devices/:dev_id/shadow/events", middleware.JWTAuthMiddleware(), deviceShadowHandler.SubscribeDeviceShadow)
+		api.PATCH("/device/shadow", middleware.DeviceAuthMiddleware(), middleware.IdempotencyMiddleware(), deviceShadowHandler.ReportDeviceShadow)
+
+		// 设备健康相关接口
+		deviceHealthHandler := handler.NewDeviceHealthHandler()
+		api.GET("/devices/:dev_id/health", middleware.JWTAuthMiddleware(), deviceHealthHandler.GetDeviceHealth)
+		api.POST("/device/heartbeat", middleware.DeviceAuthMiddleware(), middleware.IdempotencyMiddleware(), deviceHealthHandler.Heartbeat)
+
+		// 设备校准相关接口
+		calibrationHandler := handler.NewCalibrationHandler()
+		api.GET("/devices/:dev_id/calibration", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), calibrationHandler.GetProfiles)
+		api.POST("/devices/:dev_id/calibration", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), middleware.IdempotencyMiddleware(), calibrationHandler.CreateProfile)
+		api.PUT("/devices/:dev_id/calibration", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), middleware.IdempotencyMiddleware(), calibrationHandler.UpdateProfile)
+		api.DELETE("/devices/:dev_id/calibration", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), middleware.IdempotencyMiddleware(), calibrationHandler.DeleteProfile)
+		api.POST("/devices/:dev_id/calibration/recompute", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), middleware.IdempotencyMiddleware(), calibrationHandler.Recompute)
+
+		// 设备命令相关接口
+		deviceCommandHandler := handler.NewDeviceCommandHandler()
+		api.POST("/devices/commands", middleware.JWTAuthMiddleware(), middleware.IdempotencyMiddleware(), deviceCommandHandler.CreateCommand)
+		api.GET("/devices/commands", middleware.JWTAuthMiddleware(), deviceCommandHandler.GetCommands)
+		api.GET("/device/commands/poll", middleware.DeviceAuthMiddleware(), deviceCommandHandler.PollCommands)
+		api.POST("/device/commands/ack", middleware.DeviceAuthMiddleware(), middleware.IdempotencyMiddleware(), deviceCommandHandler.AckCommand)
 
 		// 设备用户绑定相关接口
 		deviceUserHandler := handler.NewDeviceUserHandler()
-		api.POST("/devices/bind_user", middleware.JWTAuthMiddleware(), deviceUserHandler.BindDeviceUser)
-		api.DELETE("/devices/unbind_user", middleware.JWTAuthMiddleware(), deviceUserHandler.UnbindDeviceUser)
+		api.POST("/devices/bind_user", middleware.JWTAuthMiddleware(), middleware.IdempotencyMiddleware(), deviceUserHandler.BindDeviceUser)
+		api.DELETE("/devices/unbind_user", middleware.JWTAuthMiddleware(), middleware.IdempotencyMiddleware(), deviceUserHandler.UnbindDeviceUser)
 		api.GET("/devices/bind_users", middleware.JWTAuthMiddleware(), deviceUserHandler.GetDeviceUsers)
 
 		// sensor data相关接口
 		sensorDataHandler := handler.NewSensorDataHandler()
-		api.POST("/device/data", middleware.JWTAuthMiddleware(), sensorDataHandler.UploadSensorData)
-		api.POST("/device/data/file/presigned_url", middleware.JWTAuthMiddleware(), sensorDataHandler.GetPresignedPutURL)
+		api.POST("/device/data", middleware.JWTAuthMiddleware(), middleware.IdempotencyMiddleware(), sensorDataHandler.UploadSensorData)
+		api.POST("/device/data/file/presigned_url", middleware.JWTAuthMiddleware(), middleware.IdempotencyMiddleware(), sensorDataHandler.GetPresignedPutURL)
 		api.POST("/device/data/timeseries", middleware.JWTAuthMiddleware(), sensorDataHandler.GetSeriesData)
-		api.DELETE("/device/data/timeseries", middleware.JWTAuthMiddleware(), sensorDataHandler.DeleteSeriesData)
+		api.DELETE("/device/data/timeseries", middleware.JWTAuthMiddleware(), middleware.IdempotencyMiddleware(), sensorDataHandler.DeleteSeriesData)
 		api.GET("/device/data/statistic", middleware.JWTAuthMiddleware(), sensorDataHandler.GetSensorDataStatistic)
 		api.GET("/device/data/file/list", middleware.JWTAuthMiddleware(), sensorDataHandler.GetFileList)
 		api.GET("/device/data/file/download", middleware.JWTAuthMiddleware(), sensorDataHandler.DownloadFile)
-		api.DELETE("/device/data/file", middleware.JWTAuthMiddleware(), sensorDataHandler.DeleteFileData)
+		api.GET("/device/data/file/preview", middleware.JWTAuthMiddleware(), sensorDataHandler.GetFilePreview)
+		api.DELETE("/device/data/file", middleware.JWTAuthMiddleware(), middleware.IdempotencyMiddleware(), sensorDataHandler.DeleteFileData)
+
+		// 分片上传相关接口
+		multipartHandler := handler.NewMultipartUploadHandler()
+		api.POST("/device/data/file/multipart", middleware.JWTAuthMiddleware(), middleware.IdempotencyMiddleware(), multipartHandler.InitUpload)
+		api.POST("/device/data/file/multipart/parts", middleware.JWTAuthMiddleware(), middleware.IdempotencyMiddleware(), multipartHandler.PresignParts)
+		api.GET("/device/data/file/multipart/parts", middleware.JWTAuthMiddleware(), multipartHandler.ListParts)
+		api.POST("/device/data/file/multipart/complete", middleware.JWTAuthMiddleware(), middleware.IdempotencyMiddleware(), multipartHandler.CompleteUpload)
+		api.DELETE("/device/data/file/multipart", middleware.JWTAuthMiddleware(), middleware.IdempotencyMiddleware(), multipartHandler.AbortUpload)
+
+		// MinIO存储事件（webhook目标，使用upload_event.webhook_token认证）
+		uploadEventHandler := handler.NewUploadEventHandler()
+		api.POST("/device/data/file/events", uploadEventHandler.HandleBucketEvents)
+
+		// 文件目录相关接口
+		fileCatalogHandler := handler.NewFileCatalogHandler()
+		api.GET("/device/data/file/catalog", middleware.JWTAuthMiddleware(), fileCatalogHandler.SearchFiles)
+		api.POST("/device/data/file/reconcile", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), middleware.IdempotencyMiddleware(), fileCatalogHandler.ReconcileFiles)
+		api.POST("/device/data/file/derivatives", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), middleware.IdempotencyMiddleware(), fileCatalogHandler.GenerateDerivatives)
+
+		// 批量下载相关接口
+		fileArchiveHandler := handler.NewFileArchiveHandler()
+		api.POST("/device/data/file/archive", middleware.JWTAuthMiddleware(), fileArchiveHandler.DownloadArchive)
+		api.POST("/device/data/file/archive/tasks", middleware.JWTAuthMiddleware(), middleware.IdempotencyMiddleware(), fileArchiveHandler.CreateArchiveTask)
+		api.GET("/device/data/file/archive/tasks", middleware.JWTAuthMiddleware(), fileArchiveHandler.GetArchiveTask)
+
+		// 时序汇总相关接口
+		rollupHandler := handler.NewRollupHandler()
+		api.GET("/device/data/rollups", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), rollupHandler.GetStatus)
+		api.POST("/device/data/rollups/backfill", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), middleware.IdempotencyMiddleware(), rollupHandler.Backfill)
+
+		// 时序归档相关接口
+		seriesArchiveHandler := handler.NewSeriesArchiveHandler()
+		api.GET("/device/data/timeseries/archives", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), seriesArchiveHandler.GetArchives)
+
+		// 时序写入补偿相关接口
+		seriesOutboxHandler := handler.NewSeriesOutboxHandler()
+		api.GET("/device/data/timeseries/outbox", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), seriesOutboxHandler.GetStats)
+
+		// 时序写入管道相关接口
+		ingestHandler := handler.NewIngestHandler()
+		api.GET("/device/data/ingest", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), ingestHandler.GetStats)
+
+		// 时序数据schema相关接口
+		schemaHandler := handler.NewMeasurementSchemaHandler()
+		api.GET("/device/data/schemas", middleware.JWTAuthMiddleware(), schemaHandler.GetSchemas)
+		api.POST("/device/data/schemas", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), middleware.IdempotencyMiddleware(), schemaHandler.CreateSchema)
+		api.PUT("/device/data/schemas", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), middleware.IdempotencyMiddleware(), schemaHandler.UpdateSchema)
+		api.DELETE("/device/data/schemas", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), middleware.IdempotencyMiddleware(), schemaHandler.DeleteSchema)
+
+		// 单位相关接口
+		unitHandler := handler.NewUnitHandler()
+		api.GET("/device/data/units", middleware.JWTAuthMiddleware(), unitHandler.GetUnits)
+
+		// 派生字段相关接口（权限按设备类型在service中检查）
+		derivedHandler := handler.NewDerivedFieldHandler()
+		api.GET("/device/data/derived", middleware.JWTAuthMiddleware(), derivedHandler.GetFields)
+		api.POST("/device/data/derived", middleware.JWTAuthMiddleware(), middleware.IdempotencyMiddleware(), derivedHandler.CreateField)
+		api.PUT("/device/data/derived", middleware.JWTAuthMiddleware(), middleware.IdempotencyMiddleware(), derivedHandler.UpdateField)
+		api.DELETE("/device/data/derived", middleware.JWTAuthMiddleware(), middleware.IdempotencyMiddleware(), derivedHandler.DeleteField)
+		api.POST("/device/data/derived/evaluate", middleware.JWTAuthMiddleware(), derivedHandler.EvaluateField)
+
+		// 异常检测相关接口
+		anomalyHandler := handler.NewAnomalyHandler()
+		api.GET("/device/data/anomaly/baselines", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), anomalyHandler.GetBaselines)
+		api.DELETE("/device/data/anomaly/baselines", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), middleware.IdempotencyMiddleware(), anomalyHandler.ResetBaselines)
+
+		// 数据完整性报告相关接口
+		completenessHandler := handler.NewCompletenessHandler()
+		api.GET("/device/data/completeness", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), completenessHandler.GetReport)
+		api.GET("/device/data/completeness/daily", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), completenessHandler.GetDailyReport)
+
+		// 数据保留策略相关接口
+		retentionHandler := handler.NewRetentionHandler()
+		api.POST("/retention/policies", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), middleware.IdempotencyMiddleware(), retentionHandler.CreatePolicy)
+		api.GET("/retention/policies", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), retentionHandler.GetPolicies)
+		api.PUT("/retention/policies", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), middleware.IdempotencyMiddleware(), retentionHandler.UpdatePolicy)
+		api.DELETE("/retention/policies", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), middleware.IdempotencyMiddleware(), retentionHandler.DeletePolicy)
+		api.POST("/retention/enforce", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), middleware.IdempotencyMiddleware(), retentionHandler.EnforcePolicies)
+
+		// 固件/OTA相关接口
+		firmwareHandler := handler.NewFirmwareHandler()
+		api.POST("/firmware", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), middleware.IdempotencyMiddleware(), firmwareHandler.CreateFirmware)
+		api.POST("/firmware/confirm", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), middleware.IdempotencyMiddleware(), firmwareHandler.ConfirmFirmware)
+		api.GET("/firmware", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), firmwareHandler.GetFirmwares)
+		api.DELETE("/firmware", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), middleware.IdempotencyMiddleware(), firmwareHandler.DeleteFirmware)
+		api.POST("/firmware/rollouts", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), middleware.IdempotencyMiddleware(), firmwareHandler.CreateRollout)
+		api.PUT("/firmware/rollouts", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), middleware.IdempotencyMiddleware(), firmwareHandler.UpdateRollout)
+		api.GET("/firmware/rollouts/progress", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), firmwareHandler.GetRolloutProgress)
+		api.GET("/device/firmware/check", middleware.DeviceAuthMiddleware(), firmwareHandler.CheckUpdate)
+		api.POST("/device/firmware/report", middleware.DeviceAuthMiddleware(), middleware.IdempotencyMiddleware(), firmwareHandler.ReportVersion)
 
 		// warning info相关接口
 		warningHandler := handler.NewWarningInfoHandler()
-		api.POST("/warning_info", middleware.JWTAuthMiddleware(), warningHandler.CreateWarningInfo)
+		api.POST("/warning_info", middleware.JWTAuthMiddleware(), middleware.IdempotencyMiddleware(), warningHandler.CreateWarningInfo)
 		api.GET("/warning_info", middleware.JWTAuthMiddleware(), warningHandler.GetWarningInfoList)
-		api.PUT("/warning_info", middleware.JWTAuthMiddleware(), warningHandler.UpdateWarningInfo)
-		api.DELETE("/warning_info", middleware.JWTAuthMiddleware(), warningHandler.DeleteWarningInfo)
+		api.PUT("/warning_info", middleware.JWTAuthMiddleware(), middleware.IdempotencyMiddleware(), warningHandler.UpdateWarningInfo)
+		api.DELETE("/warning_info", middleware.JWTAuthMiddleware(), middleware.IdempotencyMiddleware(), warningHandler.DeleteWarningInfo)
 
 		// 日志相关接口
 		logHandler := handler.NewLogHandler()
-		api.POST("/logs", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), logHandler.CreateLog)
+		api.POST("/logs", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), middleware.IdempotencyMiddleware(), logHandler.CreateLog)
 		api.GET("/logs", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), logHandler.GetLogs)
-		api.DELETE("/logs", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), logHandler.DeleteLog)
+		api.DELETE("/logs", middleware.JWTAuthMiddleware(), middleware.AdminOnlyMiddleware(), middleware.IdempotencyMiddleware(), logHandler.DeleteLog)
 	}
 }
@@ -0,0 +1,375 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/config"
+	"backend/internal/model"
+	"backend/internal/repo"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+)
+
+const (
+	defaultAnomalyAlpha         = 0.05
+	defaultAnomalyZThreshold    = 4.0
+	defaultAnomalyMinSamples    = 30
+	defaultAnomalyQueueSize     = 1000
+	defaultAnomalyFlushInterval = 60 * time.Second
+	// anomalyMinStdRatio 方差过小时标准差至少取均值绝对值的比例，避免恒定数据的微小变化被判定为异常
+	anomalyMinStdRatio = 0.01
+	anomalyMinStd      = 1e-6
+)
+
+// anomalyJob 一次上传的待检测数据点
+type anomalyJob struct {
+	devID  int64
+	dataID int64
+	points []model.Point
+}
+
+// anomalyFinding 一次上传中某个字段的异常汇总（用于创建告警）
+type anomalyFinding struct {
+	measurement string
+	field       string
+	count       int
+	value       float64 // z分数绝对值最大的异常点
+	expected    float64
+	std         float64
+	score       float64
+	seasonal    bool
+	hour        int
+	timestamp   int64
+}
+
+var (
+	// anomalyConfig 异常检测配置（Start时从配置加载）
+	anomalyConfig config.AnomalyConfig
+	anomalyQueue  chan anomalyJob
+	// anomalyMu 保护内存中的基线（检测协程与接口共用）
+	anomalyMu        sync.Mutex
+	anomalyBaselines = make(map[string]*model.AnomalyBaseline) // dev_id|measurement|field
+	anomalyLoaded    = make(map[string]bool)                   // dev_id|measurement，已从数据库加载
+	anomalyDirty     = make(map[string]bool)                   // 未保存的基线
+)
+
+// AnomalyService 时序数据异常检测：按设备、字段维护EWMA滚动基线与按小时的季节性基线，
+// z分数超过阈值的数据点创建告警，评分写入 {measurement}_anomaly 供图表展示
+type AnomalyService struct {
+	anomalyRepo    *repo.AnomalyRepository
+	warningRepo    *repo.WarningInfoRepository
+	sensorDataRepo *repo.SensorDataRepository
+}
+
+func NewAnomalyService() *AnomalyService {
+	return &AnomalyService{
+		anomalyRepo:    repo.NewAnomalyRepository(),
+		warningRepo:    repo.NewWarningInfoRepository(),
+		sensorDataRepo: repo.NewSensorDataRepository(),
+	}
+}
+
+// Observe 提交上传的数据点进行异常检测（异步，队列满时跳过，不影响上传）
+func (s *AnomalyService) Observe(devID, dataID int64, points []model.Point) {
+	if anomalyQueue == nil {
+		return
+	}
+	select {
+	case anomalyQueue <- anomalyJob{devID: devID, dataID: dataID, points: points}:
+	default:
+		logger.L().Warn("异常检测队列已满，跳过本次检测", logger.WithInt64("data_id", dataID))
+	}
+}
+
+// GetBaselines 获取设备的基线（先保存内存中的基线），measurement为空表示全部
+func (s *AnomalyService) GetBaselines(devID int64, measurement string) ([]*model.AnomalyBaseline, error) {
+	s.flush()
+	return s.anomalyRepo.ListBaselines(devID, measurement)
+}
+
+// ResetBaselines 删除设备的基线并重新学习（如更换传感器后），measurement为空表示全部
+func (s *AnomalyService) ResetBaselines(devID int64, measurement string) (int64, error) {
+	anomalyMu.Lock()
+	defer anomalyMu.Unlock()
+	prefix := strconv.FormatInt(devID, 10) + "|"
+	if measurement != "" {
+		prefix += measurement + "|"
+	}
+	for key := range anomalyBaselines {
+		if strings.HasPrefix(key, prefix) {
+			delete(anomalyBaselines, key)
+			delete(anomalyDirty, key)
+		}
+	}
+	return s.anomalyRepo.DeleteBaselines(devID, measurement)
+}
+
+// Start 加载配置并启动检测协程与基线保存任务（ctx取消后保存基线并退出）
+func (s *AnomalyService) Start(ctx context.Context, cfg config.AnomalyConfig) {
+	anomalyConfig = cfg
+	if !cfg.Enabled {
+		return
+	}
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultAnomalyQueueSize
+	}
+	anomalyQueue = make(chan anomalyJob, queueSize)
+	interval := time.Duration(cfg.FlushInterval) * time.Second
+	if interval <= 0 {
+		interval = defaultAnomalyFlushInterval
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				s.flush()
+				return
+			case job := <-anomalyQueue:
+				s.detect(job)
+			case <-ticker.C:
+				s.flush()
+			}
+		}
+	}()
+}
+
+// detect 检测一次上传的数据点：先按当前基线评分，再用数据点更新基线
+func (s *AnomalyService) detect(job anomalyJob) {
+	points := make([]model.Point, len(job.points))
+	copy(points, job.points)
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Timestamp < points[j].Timestamp })
+
+	alpha, threshold, minSamples := anomalyAlpha(), anomalyZThreshold(), anomalyMinSamples()
+	devIDStr := strconv.FormatInt(job.devID, 10)
+	dataIDStr := strconv.FormatInt(job.dataID, 10)
+	now := utils.GetCurrentTime()
+
+	companion := make([]model.Point, 0, len(points))
+	findings := make(map[string]*anomalyFinding)
+	findingOrder := make([]string, 0)
+
+	anomalyMu.Lock()
+	for _, p := range points {
+		if !anomalyMeasurementEnabled(p.Measurement) {
+			continue
+		}
+		if err := s.ensureLoaded(job.devID, p.Measurement); err != nil {
+			logger.L().Warn("加载异常检测基线失败", logger.WithError(err), logger.WithInt64("dev_id", job.devID))
+			continue
+		}
+		hour := time.Unix(p.Timestamp, 0).Hour()
+		fields := make(map[string]any)
+		anomalous := false
+		for _, name := range sortedKeys(p.Fields) {
+			if schemaSystemFields[name] {
+				continue
+			}
+			x, ok := numericValue(p.Fields[name])
+			if !ok {
+				continue
+			}
+			key := anomalyKey(job.devID, p.Measurement, name)
+			b, ok := anomalyBaselines[key]
+			if !ok {
+				b = &model.AnomalyBaseline{DevID: job.devID, Measurement: p.Measurement, Field: name,
+					Hourly: make([]model.AnomalyStat, model.AnomalySeasonBuckets)}
+				anomalyBaselines[key] = b
+			}
+
+			stat, seasonal := &b.Overall, false
+			if b.Hourly[hour].Count >= int64(minSamples) {
+				stat, seasonal = &b.Hourly[hour], true
+			}
+			ready := stat.Count >= int64(minSamples)
+			expected, std := stat.Mean, anomalyStd(stat)
+			z := (x - expected) / std
+
+			updateAnomalyStat(&b.Overall, x, alpha)
+			updateAnomalyStat(&b.Hourly[hour], x, alpha)
+			b.UpdateAt = now
+			anomalyDirty[key] = true
+
+			if !ready {
+				continue
+			}
+			fields[name+"_score"] = roundScore(z)
+			fields[name+"_expected"] = expected
+			if math.Abs(z) <= threshold {
+				continue
+			}
+			anomalous = true
+			fkey := p.Measurement + "." + name
+			f, ok := findings[fkey]
+			if !ok {
+				f = &anomalyFinding{measurement: p.Measurement, field: name}
+				findings[fkey] = f
+				findingOrder = append(findingOrder, fkey)
+			}
+			f.count++
+			if math.Abs(z) > math.Abs(f.score) {
+				f.value, f.expected, f.std, f.score = x, expected, std, z
+				f.seasonal, f.hour, f.timestamp = seasonal, hour, p.Timestamp
+			}
+		}
+		if len(fields) > 0 {
+			fields["anomaly"] = anomalous
+			companion = append(companion, model.Point{
+				Measurement: p.Measurement + model.AnomalyMeasurementSuffix,
+				Tags:        map[string]string{"dev_id": devIDStr, "data_id": dataIDStr},
+				Fields:      fields,
+				Timestamp:   p.Timestamp,
+			})
+		}
+	}
+	anomalyMu.Unlock()
+
+	if len(companion) > 0 {
+		if err := s.sensorDataRepo.CreateSeriesData(&model.SeriesData{Points: companion}); err != nil {
+			logger.L().Warn("写入异常评分失败", logger.WithError(err), logger.WithInt64("data_id", job.dataID))
+		}
+	}
+	for _, fkey := range findingOrder {
+		s.raiseAlert(job, findings[fkey])
+	}
+}
+
+// raiseAlert 创建异常告警（同一设备同一字段只保留一条未解决的异常告警）
+func (s *AnomalyService) raiseAlert(job anomalyJob, f *anomalyFinding) {
+	prefix := fmt.Sprintf("%s: %s.%s=", model.AnomalyAlertPrefix, f.measurement, f.field)
+	active, err := s.warningRepo.GetActiveDeviceWarning(job.devID, "data", prefix)
+	if err != nil {
+		logger.L().Warn("查询异常告警失败", logger.WithError(err), logger.WithInt64("dev_id", job.devID))
+		return
+	}
+	if active != nil {
+		return
+	}
+
+	baseline := "滚动基线"
+	if f.seasonal {
+		baseline = fmt.Sprintf("%02d时季节性基线", f.hour)
+	}
+	warning := &model.WarningInfo{
+		DataID:      job.dataID,
+		DevID:       model.Int64ToID(job.devID),
+		AlertType:   "data",
+		AlertStatus: "active",
+		AlertMessage: fmt.Sprintf("%s%g，预期%.4g±%.4g（%s，z=%.1f，时间%s），本次上传共%d个异常点",
+			prefix, f.value, f.expected, f.std, baseline, f.score,
+			time.Unix(f.timestamp, 0).Format("2006-01-02 15:04:05"), f.count),
+	}
+	if _, err := NewWarningInfoService().CreateWarningInfo(warning); err != nil {
+		logger.L().Warn("创建异常告警失败", logger.WithError(err), logger.WithInt64("dev_id", job.devID))
+	}
+}
+
+// ensureLoaded 首次检测设备的measurement时从数据库加载基线（调用方持有anomalyMu）
+func (s *AnomalyService) ensureLoaded(devID int64, measurement string) error {
+	loadedKey := strconv.FormatInt(devID, 10) + "|" + measurement
+	if anomalyLoaded[loadedKey] {
+		return nil
+	}
+	baselines, err := s.anomalyRepo.ListBaselines(devID, measurement)
+	if err != nil {
+		return err
+	}
+	for _, b := range baselines {
+		if len(b.Hourly) != model.AnomalySeasonBuckets {
+			b.Hourly = make([]model.AnomalyStat, model.AnomalySeasonBuckets)
+		}
+		anomalyBaselines[anomalyKey(devID, measurement, b.Field)] = b
+	}
+	anomalyLoaded[loadedKey] = true
+	return nil
+}
+
+// flush 保存有更新的基线
+func (s *AnomalyService) flush() {
+	anomalyMu.Lock()
+	dirty := make([]*model.AnomalyBaseline, 0, len(anomalyDirty))
+	for key := range anomalyDirty {
+		if b, ok := anomalyBaselines[key]; ok {
+			copied := *b
+			copied.Hourly = append([]model.AnomalyStat(nil), b.Hourly...)
+			dirty = append(dirty, &copied)
+		}
+	}
+	anomalyDirty = make(map[string]bool)
+	anomalyMu.Unlock()
+
+	const batchSize = 200
+	for i := 0; i < len(dirty); i += batchSize {
+		end := min(i+batchSize, len(dirty))
+		if err := s.anomalyRepo.SaveBaselines(dirty[i:end]); err != nil {
+			logger.L().Warn("保存异常检测基线失败", logger.WithError(err), logger.WithInt("count", end-i))
+			// 保存失败的基线下次重新保存
+			anomalyMu.Lock()
+			for _, b := range dirty[i:end] {
+				anomalyDirty[anomalyKey(b.DevID, b.Measurement, b.Field)] = true
+			}
+			anomalyMu.Unlock()
+		}
+	}
+}
+
+// updateAnomalyStat 按EWMA更新均值与方差；样本较少时按累计平均，加快基线收敛
+func updateAnomalyStat(stat *model.AnomalyStat, x, alpha float64) {
+	stat.Count++
+	if stat.Count == 1 {
+		stat.Mean, stat.Variance = x, 0
+		return
+	}
+	a := math.Max(alpha, 1/float64(stat.Count))
+	diff := x - stat.Mean
+	incr := a * diff
+	stat.Mean += incr
+	stat.Variance = (1 - a) * (stat.Variance + diff*incr)
+}
+
+// anomalyStd 基线标准差（不小于均值绝对值的1%）
+func anomalyStd(stat *model.AnomalyStat) float64 {
+	return math.Max(math.Sqrt(stat.Variance), math.Max(math.Abs(stat.Mean)*anomalyMinStdRatio, anomalyMinStd))
+}
+
+func anomalyKey(devID int64, measurement, field string) string {
+	return strconv.FormatInt(devID, 10) + "|" + measurement + "|" + field
+}
+
+func anomalyMeasurementEnabled(measurement string) bool {
+	if len(anomalyConfig.Measurements) == 0 {
+		return true
+	}
+	return containsString(anomalyConfig.Measurements, measurement)
+}
+
+func anomalyAlpha() float64 {
+	if anomalyConfig.Alpha <= 0 || anomalyConfig.Alpha >= 1 {
+		return defaultAnomalyAlpha
+	}
+	return anomalyConfig.Alpha
+}
+
+func anomalyZThreshold() float64 {
+	if anomalyConfig.ZThreshold <= 0 {
+		return defaultAnomalyZThreshold
+	}
+	return anomalyConfig.ZThreshold
+}
+
+func anomalyMinSamples() int {
+	if anomalyConfig.MinSamples <= 0 {
+		return defaultAnomalyMinSamples
+	}
+	return anomalyConfig.MinSamples
+}
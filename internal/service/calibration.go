@@ -0,0 +1,450 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/internal/model"
+	"backend/internal/repo"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+)
+
+// calibrationRecomputeChunk 重新计算历史校准值时每次查询的时间范围
+const calibrationRecomputeChunk = time.Hour
+
+// calibrationRecomputing 正在重新计算的校准配置，避免同一配置同时运行多个任务
+var calibrationRecomputing sync.Map
+
+// CalibrationService 设备校准：按设备字段的校准配置（线性/多项式）在上传时将原始值转换为校准值，
+// 可保留原始值到 {field}_raw，修正系数后可按保留的原始值重新计算历史数据
+type CalibrationService struct {
+	calibrationRepo *repo.CalibrationRepository
+	deviceRepo      *repo.DeviceRepository
+	sensorDataRepo  *repo.SensorDataRepository
+	derivedService  *DerivedFieldService
+	archiveService  *SeriesArchiveService
+	rollupService   *RollupService
+}
+
+func NewCalibrationService() *CalibrationService {
+	return &CalibrationService{
+		calibrationRepo: repo.NewCalibrationRepository(),
+		deviceRepo:      repo.NewDeviceRepository(),
+		sensorDataRepo:  repo.NewSensorDataRepository(),
+		derivedService:  NewDerivedFieldService(),
+		archiveService:  NewSeriesArchiveService(),
+		rollupService:   NewRollupService(),
+	}
+}
+
+// calibrationRecomputeReport 重新计算历史校准值的结果
+type calibrationRecomputeReport struct {
+	updated      int64    // 更新的数据点数量
+	skipped      int64    // 缺少原始值而跳过的数据点数量
+	derived      int64    // 重新写入的ingest派生数据点数量
+	archivedDays []string // 已归档为Parquet、未重新计算的日期（UTC）
+}
+
+// CalibrationResult 一次上传的校准结果
+type CalibrationResult struct {
+	raw     map[int]map[string]float64 // 需要保留的原始值：数据点下标 -> 字段 -> 原始值
+	applied map[int64]model.CalibrationApplied
+}
+
+// CreateProfile 创建校准配置
+func (s *CalibrationService) CreateProfile(devID int64, req *model.CreateCalibrationProfileReq, currentUID int64) (*model.CalibrationProfile, error) {
+	if _, err := s.deviceRepo.GetDevice(devID); err != nil {
+		return nil, errors.New("设备不存在")
+	}
+	if err := checkCalibrationField(req.Field); err != nil {
+		return nil, err
+	}
+	if err := checkCalibrationCoefficients(req.Type, req.Coefficients); err != nil {
+		return nil, err
+	}
+
+	now := utils.GetCurrentTime()
+	validFrom := now
+	if req.ValidFrom > 0 {
+		validFrom = time.Unix(req.ValidFrom, 0)
+	}
+	profile := &model.CalibrationProfile{
+		ProfileID:    utils.GetDefaultSnowflake().Generate(),
+		DevID:        model.Int64ToID(devID),
+		Measurement:  req.Measurement,
+		Field:        req.Field,
+		Type:         req.Type,
+		Coefficients: req.Coefficients,
+		ValidFrom:    validFrom,
+		Version:      1,
+		KeepRaw:      req.KeepRaw,
+		Description:  req.Description,
+		CreateBy:     currentUID,
+		CreateAt:     now,
+		UpdateAt:     now,
+	}
+	if err := s.calibrationRepo.CreateProfile(profile); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// GetProfiles 获取设备的校准配置
+func (s *CalibrationService) GetProfiles(devID int64, measurement, field string) ([]*model.CalibrationProfile, error) {
+	return s.calibrationRepo.ListProfiles(devID, measurement, field)
+}
+
+// UpdateProfile 修正校准配置（类型或系数变化时版本号加1），recompute时异步重新计算历史数据
+func (s *CalibrationService) UpdateProfile(devID int64, req *model.UpdateCalibrationProfileReq) (*model.CalibrationProfile, error) {
+	profile, err := s.getDeviceProfile(devID, req.ProfileID)
+	if err != nil {
+		return nil, err
+	}
+	changed := false
+	if req.Type != nil && *req.Type != profile.Type {
+		profile.Type = *req.Type
+		changed = true
+	}
+	if req.Coefficients != nil {
+		profile.Coefficients = req.Coefficients
+		changed = true
+	}
+	if req.KeepRaw != nil {
+		profile.KeepRaw = *req.KeepRaw
+	}
+	if req.Description != nil {
+		profile.Description = *req.Description
+	}
+	if err := checkCalibrationCoefficients(profile.Type, profile.Coefficients); err != nil {
+		return nil, err
+	}
+	if changed {
+		profile.Version++
+	}
+	profile.UpdateAt = utils.GetCurrentTime()
+
+	if err := s.calibrationRepo.UpdateProfile(profile); err != nil {
+		return nil, err
+	}
+	if req.Recompute {
+		if err := s.startRecompute(profile); err != nil {
+			return nil, err
+		}
+	}
+	return profile, nil
+}
+
+// DeleteProfile 删除校准配置（已写入的校准值不变）
+func (s *CalibrationService) DeleteProfile(devID, profileID int64) error {
+	if _, err := s.getDeviceProfile(devID, profileID); err != nil {
+		return err
+	}
+	return s.calibrationRepo.DeleteProfile(profileID)
+}
+
+// Recompute 异步按当前系数重新计算校准配置有效期内（valid_from到下一个配置的valid_from）的历史数据
+// 只能重新计算保留了原始值（{field}_raw）的数据点
+func (s *CalibrationService) Recompute(devID, profileID int64) error {
+	profile, err := s.getDeviceProfile(devID, profileID)
+	if err != nil {
+		return err
+	}
+	return s.startRecompute(profile)
+}
+
+// Calibrate 按设备的校准配置将数据点的原始值转换为校准值（数据点时间之前生效的最新配置）
+// 没有校准配置时返回nil；字段值不是数值时返回 *SchemaValidationError
+func (s *CalibrationService) Calibrate(devID int64, points []model.Point) (*CalibrationResult, error) {
+	profiles, err := s.calibrationRepo.ListProfiles(devID, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("获取校准配置失败: %v", err)
+	}
+	if len(profiles) == 0 {
+		return nil, nil
+	}
+	// measurement -> 字段 -> 按valid_from升序的配置
+	byField := make(map[string]map[string][]*model.CalibrationProfile)
+	for _, profile := range profiles {
+		if byField[profile.Measurement] == nil {
+			byField[profile.Measurement] = make(map[string][]*model.CalibrationProfile)
+		}
+		byField[profile.Measurement][profile.Field] = append(byField[profile.Measurement][profile.Field], profile)
+	}
+
+	result := &CalibrationResult{raw: make(map[int]map[string]float64), applied: make(map[int64]model.CalibrationApplied)}
+	verr := &SchemaValidationError{}
+	for i := range points {
+		fields := byField[points[i].Measurement]
+		for _, field := range sortedKeys(fields) {
+			value, ok := points[i].Fields[field]
+			if !ok {
+				continue
+			}
+			profile := activeCalibrationProfile(fields[field], points[i].Timestamp)
+			if profile == nil {
+				continue
+			}
+			raw, ok := numericValue(value)
+			if !ok {
+				if len(verr.Violations) < model.MaxSchemaViolations {
+					verr.Violations = append(verr.Violations, model.SchemaViolation{Index: i, Measurement: points[i].Measurement,
+						Field: field, Message: "校准字段的值不是数值"})
+				} else {
+					verr.Truncated = true
+				}
+				continue
+			}
+
+			points[i].Fields[field] = calibrate(profile.Coefficients, raw)
+			if profile.KeepRaw {
+				if result.raw[i] == nil {
+					result.raw[i] = make(map[string]float64)
+				}
+				result.raw[i][field] = raw
+			}
+			result.applied[profile.ProfileID] = model.CalibrationApplied{ProfileID: profile.ProfileID,
+				Measurement: profile.Measurement, Field: profile.Field, Version: profile.Version}
+		}
+	}
+	if len(verr.Violations) > 0 {
+		return nil, verr
+	}
+	return result, nil
+}
+
+// AttachRaw 将保留的原始值写入 {field}_raw（在schema校验之后调用，strict模式不拒绝原始值字段）
+func (r *CalibrationResult) AttachRaw(points []model.Point) {
+	if r == nil {
+		return
+	}
+	for i, fields := range r.raw {
+		for field, raw := range fields {
+			points[i].Fields[field+model.CalibrationRawSuffix] = raw
+		}
+	}
+}
+
+// Applied 使用的校准配置（按measurement、字段排序）
+func (r *CalibrationResult) Applied() []model.CalibrationApplied {
+	applied := make([]model.CalibrationApplied, 0)
+	if r == nil {
+		return applied
+	}
+	for _, a := range r.applied {
+		applied = append(applied, a)
+	}
+	sort.Slice(applied, func(i, j int) bool {
+		if applied[i].Measurement != applied[j].Measurement {
+			return applied[i].Measurement < applied[j].Measurement
+		}
+		if applied[i].Field != applied[j].Field {
+			return applied[i].Field < applied[j].Field
+		}
+		return applied[i].ProfileID < applied[j].ProfileID
+	})
+	return applied
+}
+
+// getDeviceProfile 获取设备的校准配置（不属于该设备时视为不存在）
+func (s *CalibrationService) getDeviceProfile(devID, profileID int64) (*model.CalibrationProfile, error) {
+	profile, err := s.calibrationRepo.GetProfile(profileID)
+	if err != nil {
+		return nil, err
+	}
+	if profile.DevID.Int64() != devID {
+		return nil, errors.New("校准配置不存在")
+	}
+	return profile, nil
+}
+
+// startRecompute 启动重新计算任务
+func (s *CalibrationService) startRecompute(profile *model.CalibrationProfile) error {
+	if _, running := calibrationRecomputing.LoadOrStore(profile.ProfileID, struct{}{}); running {
+		return errors.New("该校准配置正在重新计算历史数据")
+	}
+
+	go func() {
+		defer calibrationRecomputing.Delete(profile.ProfileID)
+		report, err := s.recompute(profile)
+		if err != nil {
+			logger.L().Warn("重新计算历史校准值失败", logger.WithError(err), logger.WithInt64("profile_id", profile.ProfileID),
+				logger.WithInt64("updated", report.updated))
+			return
+		}
+		if len(report.archivedDays) > 0 {
+			// 已归档的日期只存在于Parquet中，无法按原始值重新计算
+			logger.L().Warn("重新计算历史校准值部分完成，已归档的日期未重新计算", logger.WithInt64("profile_id", profile.ProfileID),
+				logger.WithInt("version", profile.Version), logger.WithInt64("updated", report.updated), logger.WithInt64("skipped", report.skipped),
+				logger.WithInt64("derived", report.derived), logger.WithString("archived_days", strings.Join(report.archivedDays, ",")))
+			return
+		}
+		logger.L().Info("重新计算历史校准值完成", logger.WithInt64("profile_id", profile.ProfileID),
+			logger.WithInt("version", profile.Version), logger.WithInt64("updated", report.updated), logger.WithInt64("skipped", report.skipped),
+			logger.WithInt64("derived", report.derived))
+	}()
+	return nil
+}
+
+// recompute 按保留的原始值重新计算并覆盖写入校准值，同时重新写入ingest派生数据点并重建受影响的汇总数据；
+// 已归档为Parquet的日期不在InfluxDB中，跳过并记录在结果中
+func (s *CalibrationService) recompute(profile *model.CalibrationProfile) (calibrationRecomputeReport, error) {
+	var report calibrationRecomputeReport
+	devID := profile.DevID.Int64()
+	device, err := s.deviceRepo.GetDevice(devID)
+	if err != nil {
+		return report, errors.New("设备不存在")
+	}
+	end := utils.GetCurrentTime()
+	profiles, err := s.calibrationRepo.ListProfiles(devID, profile.Measurement, profile.Field)
+	if err != nil {
+		return report, err
+	}
+	for _, p := range profiles {
+		if p.ValidFrom.After(profile.ValidFrom) && p.ValidFrom.Before(end) {
+			end = p.ValidFrom
+			break
+		}
+	}
+
+	archives, err := s.archiveService.GetArchives(profile.Measurement, devID, profile.ValidFrom.Unix(), end.Unix())
+	if err != nil {
+		return report, fmt.Errorf("获取归档清单失败: %v", err)
+	}
+	archived := make(map[int64]bool, len(archives))
+	for _, a := range archives {
+		if !archived[a.Day.Unix()] {
+			archived[a.Day.Unix()] = true
+			report.archivedDays = append(report.archivedDays, a.Day.Format("2006-01-02"))
+		}
+	}
+	sort.Strings(report.archivedDays)
+
+	rawField := profile.Field + model.CalibrationRawSuffix
+	var minTs, maxTs int64
+	for start := profile.ValidFrom; start.Before(end); start = start.Add(calibrationRecomputeChunk) {
+		chunkEnd := start.Add(calibrationRecomputeChunk)
+		if chunkEnd.After(end) {
+			chunkEnd = end
+		}
+		points, err := s.calibrationRepo.QueryDevicePoints(profile.Measurement, devID, start, chunkEnd)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				// measurement不存在（没有数据）
+				return report, nil
+			}
+			return report, err
+		}
+
+		batch := make([]model.Point, 0, len(points))
+		for i, p := range points {
+			if archived[utcDay(time.Unix(p.Timestamp, 0)).Unix()] {
+				continue
+			}
+			raw, ok := numericValue(p.Fields[rawField])
+			if !ok {
+				if _, exists := p.Fields[profile.Field]; exists {
+					report.skipped++
+				}
+				continue
+			}
+			value := calibrate(profile.Coefficients, raw)
+			// 更新查询结果中的校准值，派生字段按新的校准值计算
+			points[i].Fields[profile.Field] = value
+			batch = append(batch, model.Point{
+				Measurement: profile.Measurement,
+				Tags:        p.Tags,
+				Fields:      map[string]any{profile.Field: value},
+				Timestamp:   p.Timestamp,
+			})
+			if minTs == 0 || p.Timestamp < minTs {
+				minTs = p.Timestamp
+			}
+			if p.Timestamp > maxTs {
+				maxTs = p.Timestamp
+			}
+		}
+		if len(batch) == 0 {
+			continue
+		}
+		updated := int64(len(batch))
+		derived := s.derivedService.Materialize(device.DevType, points)
+		for _, p := range derived {
+			if !archived[utcDay(time.Unix(p.Timestamp, 0)).Unix()] {
+				batch = append(batch, p)
+				report.derived++
+			}
+		}
+		if err := s.sensorDataRepo.CreateSeriesData(&model.SeriesData{Points: batch}); err != nil {
+			return report, err
+		}
+		report.updated += updated
+	}
+
+	if report.updated > 0 {
+		// 覆盖写入后重建该范围内的汇总数据（measurement未启用汇总时不处理）
+		if err := s.rollupService.Rebuild(profile.Measurement, time.Unix(minTs, 0), time.Unix(maxTs+1, 0)); err != nil {
+			return report, fmt.Errorf("重建汇总数据失败: %v", err)
+		}
+	}
+	return report, nil
+}
+
+// activeCalibrationProfile 数据点时间（Unix秒）生效的配置，profiles按valid_from升序
+func activeCalibrationProfile(profiles []*model.CalibrationProfile, timestamp int64) *model.CalibrationProfile {
+	var active *model.CalibrationProfile
+	for _, p := range profiles {
+		if p.ValidFrom.Unix() > timestamp {
+			break
+		}
+		active = p
+	}
+	return active
+}
+
+// calibrate 计算多项式（系数按升幂，Horner法）
+func calibrate(coefficients []float64, x float64) float64 {
+	var y float64
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		y = y*x + coefficients[i]
+	}
+	return y
+}
+
+// checkCalibrationCoefficients 校验系数：linear为[offset, gain]，polynomial最高5次
+func checkCalibrationCoefficients(calibrationType string, coefficients []float64) error {
+	for _, c := range coefficients {
+		if math.IsNaN(c) || math.IsInf(c, 0) {
+			return errors.New("校准系数必须是有限的数值")
+		}
+	}
+	switch calibrationType {
+	case model.CalibrationTypeLinear:
+		if len(coefficients) != 2 {
+			return errors.New("线性校准的系数应为[offset, gain]")
+		}
+		if coefficients[1] == 0 {
+			return errors.New("线性校准的gain不能为0")
+		}
+	case model.CalibrationTypePolynomial:
+		if len(coefficients) == 0 || len(coefficients) > model.MaxCalibrationDegree+1 {
+			return fmt.Errorf("多项式校准的系数数量应为1~%d", model.MaxCalibrationDegree+1)
+		}
+	default:
+		return fmt.Errorf("不支持的校准类型: %s", calibrationType)
+	}
+	return nil
+}
+
+// checkCalibrationField 系统字段与原始值字段不能校准
+func checkCalibrationField(field string) error {
+	if schemaSystemFields[field] || strings.HasSuffix(field, model.CalibrationRawSuffix) {
+		return fmt.Errorf("字段%s不能配置校准", field)
+	}
+	return nil
+}
@@ -0,0 +1,418 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math"
+	"mime/multipart"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/config"
+	"backend/internal/model"
+	"backend/internal/repo"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+)
+
+const (
+	defaultCompletenessGapFactor = 3.0
+	defaultCompletenessRunAt     = "01:00"
+	defaultCompletenessMailPort  = 587
+	completenessDevicePageSize   = 200
+)
+
+var (
+	// completenessConfig 数据完整性报告配置（Start时从配置加载）
+	completenessConfig config.CompletenessConfig
+	// completenessMu 避免同时生成多个全量报告
+	completenessMu sync.Mutex
+)
+
+// completenessCSVHeader 报告CSV的列
+var completenessCSVHeader = []string{"dev_id", "dev_name", "dev_type", "measurement", "expected_interval_s", "expected",
+	"received", "completeness_pct", "gap_count", "missing_seconds", "longest_gap_start", "longest_gap_end", "error"}
+
+// CompletenessService 数据完整性报告：按设备的采样频率/上报间隔计算预期数据点数量，扫描InfluxDB统计实际数量与缺口
+type CompletenessService struct {
+	completenessRepo *repo.CompletenessRepository
+	deviceRepo       *repo.DeviceRepository
+	schemaService    *MeasurementSchemaService
+}
+
+func NewCompletenessService() *CompletenessService {
+	return &CompletenessService{
+		completenessRepo: repo.NewCompletenessRepository(),
+		deviceRepo:       repo.NewDeviceRepository(),
+		schemaService:    NewMeasurementSchemaService(),
+	}
+}
+
+// GetReport 生成数据完整性报告
+func (s *CompletenessService) GetReport(query *model.CompletenessQuery) (*model.CompletenessReport, error) {
+	if !query.EndTime.After(query.StartTime) {
+		return nil, errors.New("结束时间必须晚于开始时间")
+	}
+	if query.EndTime.Sub(query.StartTime) > model.MaxCompletenessRangeDays*24*time.Hour {
+		return nil, fmt.Errorf("时间范围不能超过%d天", model.MaxCompletenessRangeDays)
+	}
+
+	var devices []*model.Device
+	if query.DevID != 0 {
+		device, err := s.deviceRepo.GetDevice(query.DevID)
+		if err != nil {
+			return nil, errors.New("设备不存在")
+		}
+		devices = []*model.Device{device}
+	} else {
+		if !completenessMu.TryLock() {
+			return nil, errors.New("完整性报告正在生成，请稍后重试")
+		}
+		defer completenessMu.Unlock()
+		var err error
+		if devices, err = s.listDevices(query.DevType); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &model.CompletenessReport{
+		StartTime: query.StartTime,
+		EndTime:   query.EndTime,
+		Devices:   len(devices),
+		Entries:   make([]model.CompletenessEntry, 0, len(devices)),
+	}
+	schemaCache := make(map[string][]string)
+	for _, device := range devices {
+		measurements, err := s.deviceMeasurements(device, query, schemaCache)
+		if err != nil {
+			logger.L().Warn("获取设备measurement失败", logger.WithError(err), logger.WithInt64("dev_id", device.DevID.Int64()))
+		}
+		for _, m := range measurements {
+			entry := s.checkSeries(device, m, query.StartTime, query.EndTime)
+			if query.Below > 0 && entry.Error == "" && entry.Completeness >= query.Below {
+				continue
+			}
+			report.Entries = append(report.Entries, entry)
+		}
+	}
+	report.GeneratedAt = utils.GetCurrentTime()
+	return report, nil
+}
+
+// GetDailyReportURL 获取每日报告CSV的下载URL（date为YYYY-MM-DD）
+func (s *CompletenessService) GetDailyReportURL(date string) (string, error) {
+	if _, err := time.ParseInLocation("2006-01-02", date, time.Local); err != nil {
+		return "", errors.New("日期格式应为YYYY-MM-DD")
+	}
+	return s.completenessRepo.PresignReport(dailyReportKey(date))
+}
+
+// RunDaily 生成前一天（本地时间）的报告，CSV写入archive bucket，配置了邮件时发送给收件人
+func (s *CompletenessService) RunDaily(now time.Time) error {
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	start := end.AddDate(0, 0, -1)
+	report, err := s.GetReport(&model.CompletenessQuery{StartTime: start, EndTime: end})
+	if err != nil {
+		return err
+	}
+	data, err := CompletenessCSV(report)
+	if err != nil {
+		return err
+	}
+
+	date := start.Format("2006-01-02")
+	if err := s.completenessRepo.SaveReport(dailyReportKey(date), data, "text/csv"); err != nil {
+		return fmt.Errorf("保存完整性报告失败: %v", err)
+	}
+	logger.L().Info("生成数据完整性报告", logger.WithString("date", date), logger.WithInt("entries", len(report.Entries)))
+
+	if completenessConfig.Mail.Host != "" && len(completenessConfig.Mail.To) > 0 {
+		if err := sendCompletenessMail(completenessConfig.Mail, date, report, data); err != nil {
+			return fmt.Errorf("发送完整性报告邮件失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// Start 加载配置并启动每日报告任务（ctx取消后退出）
+func (s *CompletenessService) Start(ctx context.Context, cfg config.CompletenessConfig) {
+	completenessConfig = cfg
+	if !cfg.Daily {
+		return
+	}
+	hour, minute, err := parseRunAt(cfg.RunAt)
+	if err != nil {
+		logger.L().Warn("完整性报告run_at格式错误，使用默认时间", logger.WithError(err))
+		hour, minute, _ = parseRunAt(defaultCompletenessRunAt)
+	}
+
+	go func() {
+		for {
+			now := utils.GetCurrentTime()
+			next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			timer := time.NewTimer(next.Sub(now))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+				if err := s.RunDaily(utils.GetCurrentTime()); err != nil {
+					logger.L().Warn("生成每日完整性报告失败", logger.WithError(err))
+				}
+			}
+		}
+	}()
+}
+
+// checkSeries 计算设备某个measurement在[start, end)内的完整性（设备创建之前的时间不计入）
+func (s *CompletenessService) checkSeries(device *model.Device, measurement string, start, end time.Time) model.CompletenessEntry {
+	entry := model.CompletenessEntry{
+		DevID:       device.DevID,
+		DevName:     device.DevName,
+		DevType:     device.DevType,
+		Measurement: measurement,
+		Gaps:        make([]model.CompletenessGap, 0),
+	}
+	from := start
+	if device.CreateAt.After(from) {
+		from = device.CreateAt
+	}
+	if !end.After(from) {
+		entry.Completeness = 100
+		return entry
+	}
+	devID := device.DevID.Int64()
+
+	received, first, last, err := s.completenessRepo.GetCoverage(measurement, devID, from, end)
+	if err != nil {
+		entry.Error = fmt.Sprintf("查询数据失败: %v", err)
+		return entry
+	}
+	entry.Received = received
+
+	interval := completenessInterval(device)
+	if interval <= 0 {
+		entry.Error = "设备未配置采样频率或上报间隔"
+		return entry
+	}
+	entry.ExpectedInterval = interval
+	entry.Expected = int64(math.Floor(end.Sub(from).Seconds() / interval))
+	entry.Completeness = 100
+	if entry.Expected > 0 {
+		entry.Completeness = roundScore(math.Min(float64(received)/float64(entry.Expected), 1) * 100)
+	}
+
+	threshold := time.Duration(interval * completenessGapFactor() * float64(time.Second))
+	addGap := func(gapStart, gapEnd time.Time) {
+		if gapEnd.Sub(gapStart) <= threshold {
+			return
+		}
+		entry.MissingSeconds += int64(gapEnd.Sub(gapStart).Seconds())
+		if len(entry.Gaps) >= model.MaxCompletenessGaps {
+			entry.GapsTruncated = true
+			return
+		}
+		entry.Gaps = append(entry.Gaps, model.CompletenessGap{Start: gapStart, End: gapEnd, Seconds: int64(gapEnd.Sub(gapStart).Seconds())})
+	}
+
+	if received == 0 {
+		addGap(from, end)
+		return entry
+	}
+	addGap(from, first)
+	gaps, err := s.completenessRepo.FindGaps(measurement, devID, from, end, threshold, model.MaxCompletenessGaps+1)
+	if err != nil {
+		entry.Error = fmt.Sprintf("查询数据缺口失败: %v", err)
+		return entry
+	}
+	for _, g := range gaps {
+		addGap(g[0], g[1])
+	}
+	addGap(last, end)
+	return entry
+}
+
+// deviceMeasurements 设备需要检查的measurement：配置的measurement、设备类型的schema、当期上传过的measurement
+// 都没有时返回默认measurement（time_series），以便报告完全没有上传数据的设备
+func (s *CompletenessService) deviceMeasurements(device *model.Device, query *model.CompletenessQuery, schemaCache map[string][]string) ([]string, error) {
+	if query.Measurement != "" {
+		return []string{query.Measurement}, nil
+	}
+	measurements := make([]string, 0)
+	seen := make(map[string]bool)
+	add := func(names ...string) {
+		for _, name := range names {
+			if name != "" && !seen[name] {
+				seen[name] = true
+				measurements = append(measurements, name)
+			}
+		}
+	}
+	add(completenessConfig.Measurements...)
+
+	schemaNames, ok := schemaCache[device.DevType]
+	if !ok {
+		schemas, err := s.schemaService.GetSchemas(device.DevType, "")
+		if err != nil {
+			return measurements, err
+		}
+		for _, schema := range schemas {
+			schemaNames = append(schemaNames, schema.Measurement)
+		}
+		schemaCache[device.DevType] = schemaNames
+	}
+	add(schemaNames...)
+
+	uploaded, err := s.completenessRepo.ListSeriesMeasurements(device.DevID.Int64(), query.StartTime, query.EndTime)
+	if err != nil {
+		return measurements, err
+	}
+	add(uploaded...)
+
+	if len(measurements) == 0 {
+		add(model.DataTypeSeries)
+	}
+	return measurements, nil
+}
+
+// listDevices 获取全部设备（devType为空表示全部类型）
+func (s *CompletenessService) listDevices(devType string) ([]*model.Device, error) {
+	devices := make([]*model.Device, 0)
+	for page := 1; ; page++ {
+		list, total, err := s.deviceRepo.GetDevices(page, completenessDevicePageSize, devType, nil, "", "", "")
+		if err != nil {
+			return nil, fmt.Errorf("获取设备列表失败: %v", err)
+		}
+		devices = append(devices, list...)
+		if len(list) == 0 || int64(len(devices)) >= total {
+			return devices, nil
+		}
+	}
+}
+
+// CompletenessCSV 将报告转换为CSV（每个设备每个measurement一行，列出最长的缺口）
+func CompletenessCSV(report *model.CompletenessReport) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(completenessCSVHeader); err != nil {
+		return nil, err
+	}
+	for _, e := range report.Entries {
+		var longestStart, longestEnd string
+		var longest int64
+		for _, g := range e.Gaps {
+			if g.Seconds > longest {
+				longest = g.Seconds
+				longestStart, longestEnd = g.Start.Format(time.RFC3339), g.End.Format(time.RFC3339)
+			}
+		}
+		record := []string{
+			e.DevID.String(), e.DevName, e.DevType, e.Measurement,
+			strconv.FormatFloat(e.ExpectedInterval, 'f', -1, 64),
+			strconv.FormatInt(e.Expected, 10), strconv.FormatInt(e.Received, 10),
+			strconv.FormatFloat(e.Completeness, 'f', 2, 64),
+			strconv.Itoa(len(e.Gaps)), strconv.FormatInt(e.MissingSeconds, 10),
+			longestStart, longestEnd, e.Error,
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// sendCompletenessMail 发送每日报告邮件（正文为摘要，CSV为附件）
+func sendCompletenessMail(cfg config.CompletenessMailConfig, date string, report *model.CompletenessReport, data []byte) error {
+	incomplete := 0
+	for _, e := range report.Entries {
+		if e.Error != "" || e.Completeness < 100 {
+			incomplete++
+		}
+	}
+	summary := fmt.Sprintf("%s 数据完整性报告：共%d个设备、%d条记录，其中%d条数据不完整或无法计算，详见附件。",
+		date, report.Devices, len(report.Entries), incomplete)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	header := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: =?UTF-8?B?%s?=\r\nMIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=%s\r\n\r\n",
+		cfg.From, strings.Join(cfg.To, ", "), base64.StdEncoding.EncodeToString([]byte("数据完整性报告 "+date)), mw.Boundary())
+
+	text, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=UTF-8"}, "Content-Transfer-Encoding": {"base64"}})
+	if err != nil {
+		return err
+	}
+	text.Write([]byte(base64.StdEncoding.EncodeToString([]byte(summary))))
+
+	attachment, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/csv; charset=UTF-8"},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {fmt.Sprintf(`attachment; filename="completeness-%s.csv"`, date)},
+	})
+	if err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for i := 0; i < len(encoded); i += 76 {
+		attachment.Write([]byte(encoded[i:min(i+76, len(encoded))] + "\r\n"))
+	}
+	if err := mw.Close(); err != nil {
+		return err
+	}
+
+	port := cfg.Port
+	if port <= 0 {
+		port = defaultCompletenessMailPort
+	}
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	return smtp.SendMail(fmt.Sprintf("%s:%d", cfg.Host, port), auth, cfg.From, cfg.To, append([]byte(header), body.Bytes()...))
+}
+
+// completenessInterval 预期数据点间隔（秒）：优先按采样频率（每秒采样次数），否则按上报间隔（秒）
+// 时间戳精度为秒，间隔不小于1秒
+func completenessInterval(device *model.Device) float64 {
+	if device.SamplingRate > 0 {
+		return math.Max(1/float64(device.SamplingRate), 1)
+	}
+	if device.UploadInterval > 0 {
+		return float64(device.UploadInterval)
+	}
+	return 0
+}
+
+func completenessGapFactor() float64 {
+	if completenessConfig.GapFactor <= 1 {
+		return defaultCompletenessGapFactor
+	}
+	return completenessConfig.GapFactor
+}
+
+func dailyReportKey(date string) string {
+	return fmt.Sprintf("%s/%s.csv", model.CompletenessReportPrefix, date)
+}
+
+// parseRunAt 解析HH:MM
+func parseRunAt(value string) (int, int, error) {
+	if value == "" {
+		value = defaultCompletenessRunAt
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, 0, err
+	}
+	return t.Hour(), t.Minute(), nil
+}
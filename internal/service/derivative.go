@@ -0,0 +1,253 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // 注册GIF解码器
+	"image/jpeg"
+	_ "image/png" // 注册PNG解码器
+	"io"
+	"strings"
+	"sync"
+
+	"backend/internal/model"
+	"backend/internal/repo"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+)
+
+const (
+	maxDerivativeSourceSize = 50 << 20   // 生成派生文件时读取的原始文件上限
+	maxThumbnailPixels      = 50_000_000 // 解码前检查像素数，避免超大图片耗尽内存
+	thumbnailJPEGQuality    = 80
+	derivativeConcurrency   = 2
+)
+
+// thumbnailSizes 缩略图尺寸（长边像素）
+var thumbnailSizes = []int{128, 256, 1024}
+
+// DerivativeProcessor 派生文件处理器：根据原始文件生成缩略图、音频波形、视频封面等
+type DerivativeProcessor interface {
+	// Name 处理器名称，记录在派生文件信息中
+	Name() string
+	// Accept 是否处理该bucket/内容类型的文件
+	Accept(bucketName, contentType string) bool
+	// Process 读取原始文件并生成派生文件
+	Process(src io.Reader) ([]model.DerivativeOutput, error)
+}
+
+var (
+	derivativeProcessors = []DerivativeProcessor{&thumbnailProcessor{sizes: thumbnailSizes}}
+	processorsMu         sync.RWMutex
+	// derivativeSem 限制同时生成派生文件的数量（解码大图占用内存较多）
+	derivativeSem = make(chan struct{}, derivativeConcurrency)
+)
+
+// RegisterDerivativeProcessor 注册派生文件处理器（在服务启动前调用）
+func RegisterDerivativeProcessor(p DerivativeProcessor) {
+	processorsMu.Lock()
+	defer processorsMu.Unlock()
+	derivativeProcessors = append(derivativeProcessors, p)
+}
+
+// DerivativeService 派生文件生成：文件确认上传后生成派生文件写入 derivatives/ 前缀，并记录到metadata
+type DerivativeService struct {
+	metadataRepo   *repo.MetadataRepository
+	sensorDataRepo *repo.SensorDataRepository
+}
+
+func NewDerivativeService() *DerivativeService {
+	return &DerivativeService{
+		metadataRepo:   repo.NewMetadataRepository(),
+		sensorDataRepo: repo.NewSensorDataRepository(),
+	}
+}
+
+// GenerateAsync 后台生成派生文件，失败只记录日志
+func (s *DerivativeService) GenerateAsync(dataID int64, bucketName, bucketKey, contentType string) {
+	if len(acceptedProcessors(bucketName, contentType)) == 0 {
+		return
+	}
+	go func() {
+		if _, err := s.Generate(dataID, bucketName, bucketKey, contentType); err != nil {
+			logger.L().Warn("生成派生文件失败", logger.WithError(err),
+				logger.WithString("bucket_name", bucketName), logger.WithString("bucket_key", bucketKey))
+		}
+	}()
+}
+
+// Generate 为文件生成派生文件并更新 metadata.extra_data.derivatives
+func (s *DerivativeService) Generate(dataID int64, bucketName, bucketKey, contentType string) (map[string]model.Derivative, error) {
+	processors := acceptedProcessors(bucketName, contentType)
+	if len(processors) == 0 {
+		return nil, errors.New("没有适用于该文件类型的派生处理器")
+	}
+
+	derivativeSem <- struct{}{}
+	defer func() { <-derivativeSem }()
+
+	obj, err := s.sensorDataRepo.GetObject(bucketName, bucketKey)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	data, err := io.ReadAll(io.LimitReader(obj, maxDerivativeSourceSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("读取原始文件失败: %v", err)
+	}
+	if len(data) > maxDerivativeSourceSize {
+		return nil, errors.New("原始文件过大，跳过派生文件生成")
+	}
+
+	derivatives := make(map[string]model.Derivative)
+	for _, p := range processors {
+		outputs, err := p.Process(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s处理失败: %v", p.Name(), err)
+		}
+		for _, out := range outputs {
+			key := derivativeKey(bucketKey, out.Name, out.Ext)
+			if err := s.sensorDataRepo.PutFile(bucketName, key, bytes.NewReader(out.Data), int64(len(out.Data)), out.ContentType); err != nil {
+				return nil, fmt.Errorf("上传派生文件失败: %v", err)
+			}
+			derivatives[out.Name] = model.Derivative{
+				Key:         key,
+				ContentType: out.ContentType,
+				Size:        int64(len(out.Data)),
+				Width:       out.Width,
+				Height:      out.Height,
+				Processor:   p.Name(),
+			}
+		}
+	}
+
+	if err := s.metadataRepo.SetFileDerivatives(dataID, derivatives); err != nil {
+		return nil, fmt.Errorf("更新派生文件信息失败: %v", err)
+	}
+	return derivatives, nil
+}
+
+// Regenerate 重新生成已登记文件的派生文件
+func (s *DerivativeService) Regenerate(bucketName, bucketKey string) (map[string]model.Derivative, error) {
+	metadata, err := s.metadataRepo.GetFileMetadataByBucketKey(bucketName, bucketKey)
+	if err != nil {
+		return nil, errors.New("文件元数据不存在")
+	}
+	contentType, _ := metadata.ExtraData["content_type"].(string)
+	if contentType == "" {
+		contentType = getContentTypeByFilePath(bucketKey)
+	}
+	return s.Generate(metadata.DataID, bucketName, bucketKey, contentType)
+}
+
+// ThumbnailURL 根据metadata中的派生文件信息生成默认缩略图的预签名URL（没有缩略图时返回空）
+func (s *DerivativeService) ThumbnailURL(bucketName string, extraData map[string]any) string {
+	derivatives, ok := extraData["derivatives"].(map[string]any)
+	if !ok {
+		return ""
+	}
+	thumb, ok := derivatives[model.DefaultThumbnailName].(map[string]any)
+	if !ok {
+		return ""
+	}
+	key, _ := thumb["key"].(string)
+	if key == "" {
+		return ""
+	}
+	url, err := s.sensorDataRepo.PresignedPreviewURL(bucketName, key)
+	if err != nil {
+		logger.L().Warn("生成缩略图URL失败", logger.WithError(err), logger.WithString("key", key))
+		return ""
+	}
+	return url
+}
+
+// acceptedProcessors 返回适用于该文件的处理器
+func acceptedProcessors(bucketName, contentType string) []DerivativeProcessor {
+	processorsMu.RLock()
+	defer processorsMu.RUnlock()
+
+	var accepted []DerivativeProcessor
+	for _, p := range derivativeProcessors {
+		if p.Accept(bucketName, contentType) {
+			accepted = append(accepted, p)
+		}
+	}
+	return accepted
+}
+
+// derivativeKey 派生文件key：derivatives/{原始key}/{名称}{扩展名}
+func derivativeKey(bucketKey, name, ext string) string {
+	return model.DerivativePrefix + bucketKey + "/" + name + ext
+}
+
+// derivativeSourceKey 从派生文件key解析原始文件key
+func derivativeSourceKey(key string) (string, bool) {
+	if !strings.HasPrefix(key, model.DerivativePrefix) {
+		return "", false
+	}
+	rest := strings.TrimPrefix(key, model.DerivativePrefix)
+	i := strings.LastIndex(rest, "/")
+	if i <= 0 {
+		return "", false
+	}
+	return rest[:i], true
+}
+
+// thumbnailProcessor 图片缩略图（纯Go解码JPEG/PNG/GIF，输出JPEG）
+type thumbnailProcessor struct {
+	sizes []int
+}
+
+func (p *thumbnailProcessor) Name() string {
+	return "thumbnail"
+}
+
+func (p *thumbnailProcessor) Accept(bucketName, contentType string) bool {
+	if bucketName != "image" {
+		return false
+	}
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif":
+		return true
+	}
+	return false
+}
+
+func (p *thumbnailProcessor) Process(src io.Reader) ([]model.DerivativeOutput, error) {
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("解析图片失败: %v", err)
+	}
+	if cfg.Width*cfg.Height > maxThumbnailPixels {
+		return nil, fmt.Errorf("图片尺寸过大: %dx%d", cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("解码图片失败: %v", err)
+	}
+
+	outputs := make([]model.DerivativeOutput, 0, len(p.sizes))
+	for _, size := range p.sizes {
+		thumb := utils.ResizeToFit(img, size)
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: thumbnailJPEGQuality}); err != nil {
+			return nil, fmt.Errorf("编码缩略图失败: %v", err)
+		}
+		outputs = append(outputs, model.DerivativeOutput{
+			Name:        fmt.Sprintf("thumb_%d", size),
+			Ext:         ".jpg",
+			ContentType: "image/jpeg",
+			Data:        buf.Bytes(),
+			Width:       thumb.Bounds().Dx(),
+			Height:      thumb.Bounds().Dy(),
+		})
+	}
+	return outputs, nil
+}
@@ -0,0 +1,478 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"sync"
+
+	"backend/internal/model"
+	"backend/internal/repo"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+)
+
+// ErrDerivedFieldForbidden 没有派生字段所属设备类型的权限
+var ErrDerivedFieldForbidden = errors.New("没有该设备类型的派生字段权限")
+
+// derivedFieldNamePattern 派生字段名称（与查询时的fields参数、InfluxDB字段名兼容）
+var derivedFieldNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// derivedExprCache 已编译的表达式（按表达式原文）
+var derivedExprCache sync.Map
+
+// DerivedFieldService 派生字段：按设备类型定义的表达式，查询时计算（query）或上传时计算并写入 {measurement}_derived（ingest）
+// 管理员可管理全部派生字段；普通用户只能查看和创建自己有读权限的设备类型下的query派生字段，只能修改自己创建的
+type DerivedFieldService struct {
+	derivedRepo    *repo.DerivedFieldRepository
+	deviceUserRepo *repo.DeviceUserRepository
+	schemaService  *MeasurementSchemaService
+}
+
+func NewDerivedFieldService() *DerivedFieldService {
+	return &DerivedFieldService{
+		derivedRepo:    repo.NewDerivedFieldRepository(),
+		deviceUserRepo: repo.NewDeviceUserRepository(),
+		schemaService:  NewMeasurementSchemaService(),
+	}
+}
+
+// DerivedQueryPlan 查询时需要计算的派生字段
+type DerivedQueryPlan struct {
+	fields []*model.DerivedField
+	extra  []string // 为计算派生字段额外查询的字段，计算后从结果中移除
+}
+
+// DerivedEvaluation 试算结果
+type DerivedEvaluation struct {
+	Vars     []string   `json:"vars"`
+	Windowed bool       `json:"windowed"`
+	Values   []*float64 `json:"values"` // 与请求的points对应，无法计算时为null
+}
+
+// CreateField 创建派生字段
+func (s *DerivedFieldService) CreateField(req *model.CreateDerivedFieldReq, currentUID int64, role string) (*model.DerivedField, error) {
+	now := utils.GetCurrentTime()
+	field := &model.DerivedField{
+		FieldID:     utils.GetDefaultSnowflake().Generate(),
+		DevType:     req.DevType,
+		Measurement: req.Measurement,
+		Name:        req.Name,
+		Expression:  req.Expression,
+		Mode:        req.Mode,
+		Unit:        req.Unit,
+		Description: req.Description,
+		CreateBy:    currentUID,
+		CreateAt:    now,
+		UpdateAt:    now,
+	}
+	if field.Mode == "" {
+		field.Mode = model.DerivedModeQuery
+	}
+	if err := s.checkScope(field, currentUID, role); err != nil {
+		return nil, err
+	}
+	if err := s.checkDefinition(field); err != nil {
+		return nil, err
+	}
+
+	if err := s.derivedRepo.CreateField(field); err != nil {
+		return nil, err
+	}
+	return field, nil
+}
+
+// GetFields 获取派生字段列表（普通用户只返回有读权限的设备类型下的派生字段）
+func (s *DerivedFieldService) GetFields(devType, measurement string, currentUID int64, role string) ([]*model.DerivedField, error) {
+	var devTypes []string
+	if devType != "" {
+		devTypes = []string{devType}
+	}
+	if role != "admin" {
+		readable, err := s.deviceUserRepo.GetUserReadableDevTypes(currentUID)
+		if err != nil {
+			return nil, err
+		}
+		if devType != "" && !containsString(readable, devType) {
+			return nil, ErrDerivedFieldForbidden
+		}
+		if len(readable) == 0 {
+			return make([]*model.DerivedField, 0), nil
+		}
+		if devType == "" {
+			devTypes = readable
+		}
+	}
+	return s.derivedRepo.ListFields(devTypes, measurement, "")
+}
+
+// UpdateField 更新派生字段
+func (s *DerivedFieldService) UpdateField(req *model.UpdateDerivedFieldReq, currentUID int64, role string) (*model.DerivedField, error) {
+	field, err := s.derivedRepo.GetField(req.FieldID)
+	if err != nil {
+		return nil, err
+	}
+	if req.Expression != nil {
+		field.Expression = *req.Expression
+	}
+	if req.Mode != nil {
+		field.Mode = *req.Mode
+	}
+	if req.Unit != nil {
+		field.Unit = *req.Unit
+	}
+	if req.Description != nil {
+		field.Description = *req.Description
+	}
+	if err := s.checkScope(field, currentUID, role); err != nil {
+		return nil, err
+	}
+	if err := s.checkDefinition(field); err != nil {
+		return nil, err
+	}
+	field.UpdateAt = utils.GetCurrentTime()
+
+	if err := s.derivedRepo.UpdateField(field); err != nil {
+		return nil, err
+	}
+	return field, nil
+}
+
+// DeleteField 删除派生字段（ingest派生字段已写入的数据保留）
+func (s *DerivedFieldService) DeleteField(fieldID, currentUID int64, role string) error {
+	field, err := s.derivedRepo.GetField(fieldID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkScope(field, currentUID, role); err != nil {
+		return err
+	}
+	return s.derivedRepo.DeleteField(fieldID)
+}
+
+// Evaluate 试算表达式（不保存），points按时间顺序，timestamp缺失时按下标计
+func (s *DerivedFieldService) Evaluate(req *model.EvaluateDerivedFieldReq) (*DerivedEvaluation, error) {
+	expr, err := utils.CompileExpr(req.Expression)
+	if err != nil {
+		return nil, err
+	}
+
+	times := make([]int64, len(req.Points))
+	columns := make(map[string][]float64, len(expr.Vars()))
+	for _, name := range expr.Vars() {
+		columns[name] = make([]float64, len(req.Points))
+	}
+	for i, p := range req.Points {
+		times[i] = int64(i)
+		if ts, ok := exprValue(p["timestamp"]); ok {
+			times[i] = int64(ts)
+		}
+		for name, column := range columns {
+			column[i] = math.NaN()
+			if v, ok := exprValue(p[name]); ok {
+				column[i] = v
+			}
+		}
+	}
+
+	result := &DerivedEvaluation{Vars: expr.Vars(), Windowed: expr.Windowed(), Values: make([]*float64, len(req.Points))}
+	for i, v := range expr.EvalSeries(times, columns) {
+		if !math.IsNaN(v) {
+			result.Values[i] = &v
+		}
+	}
+	return result, nil
+}
+
+// PrepareQuery 查找查询时需要计算的派生字段并改写字段投影
+// fields为空时计算该设备类型与measurement的全部query派生字段；否则只计算fields中指定的派生字段，
+// 并将其替换为表达式依赖的字段（额外查询的字段在计算后移除）
+func (s *DerivedFieldService) PrepareQuery(devType, measurement string, fields map[string]any) (*DerivedQueryPlan, map[string]any, error) {
+	defs, err := s.derivedRepo.ListFields([]string{devType}, measurement, model.DerivedModeQuery)
+	if err != nil {
+		return nil, fields, err
+	}
+	if len(defs) == 0 {
+		return &DerivedQueryPlan{}, fields, nil
+	}
+	// 与已存储字段重名的派生字段（定义后才写入的同名字段）不计算，查询原始字段
+	columns, err := s.derivedRepo.GetMeasurementColumns(measurement)
+	if err != nil {
+		return nil, fields, fmt.Errorf("获取measurement字段失败: %v", err)
+	}
+	plan := &DerivedQueryPlan{}
+	for _, def := range defs {
+		if !columns[def.Name] {
+			plan.fields = append(plan.fields, def)
+		}
+	}
+	if len(plan.fields) == 0 || len(fields) == 0 {
+		return plan, fields, nil
+	}
+
+	byName := make(map[string]*model.DerivedField, len(plan.fields))
+	for _, def := range plan.fields {
+		byName[def.Name] = def
+	}
+	projection := make(map[string]any, len(fields))
+	plan.fields = plan.fields[:0]
+	for name, v := range fields {
+		if def, ok := byName[name]; ok {
+			plan.fields = append(plan.fields, def)
+			continue
+		}
+		projection[name] = v
+	}
+	if len(plan.fields) == 0 {
+		return plan, fields, nil
+	}
+	for _, def := range plan.fields {
+		expr, err := compileDerivedExpr(def.Expression)
+		if err != nil {
+			continue
+		}
+		for _, name := range expr.Vars() {
+			if _, ok := projection[name]; !ok {
+				projection[name] = nil
+				plan.extra = append(plan.extra, name)
+			}
+		}
+	}
+	return plan, projection, nil
+}
+
+// Units 派生字段的单位（未定义单位的派生字段不包含）
+func (p *DerivedQueryPlan) Units() map[string]string {
+	units := make(map[string]string)
+	if p == nil {
+		return units
+	}
+	for _, def := range p.fields {
+		if def.Unit != "" {
+			units[def.Name] = def.Unit
+		}
+	}
+	return units
+}
+
+// ApplyQuery 计算查询结果的派生字段（按时间顺序计算窗口函数，无法计算的点不包含该字段）
+func (s *DerivedFieldService) ApplyQuery(plan *DerivedQueryPlan, points []model.Point) {
+	if plan == nil || len(plan.fields) == 0 || len(points) == 0 {
+		return
+	}
+	order := make([]int, len(points))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return points[order[a]].Timestamp < points[order[b]].Timestamp })
+
+	for _, def := range plan.fields {
+		if err := evalDerivedField(def, points, order, points); err != nil {
+			logger.L().Warn("计算派生字段失败", logger.WithError(err), logger.WithString("name", def.Name))
+		}
+	}
+	for i := range points {
+		for _, name := range plan.extra {
+			delete(points[i].Fields, name)
+		}
+	}
+}
+
+// Materialize 计算设备类型的ingest派生字段，返回写入 {measurement}_derived 的数据点（tag与源数据点相同）
+// 窗口函数只在同一次上传的数据点内计算；获取定义失败时不影响上传
+func (s *DerivedFieldService) Materialize(devType string, points []model.Point) []model.Point {
+	defs, err := s.derivedRepo.ListFields([]string{devType}, "", model.DerivedModeIngest)
+	if err != nil {
+		logger.L().Warn("获取派生字段失败", logger.WithError(err), logger.WithString("dev_type", devType))
+		return nil
+	}
+	if len(defs) == 0 {
+		return nil
+	}
+
+	byMeasurement := make(map[string][]*model.DerivedField)
+	for _, def := range defs {
+		byMeasurement[def.Measurement] = append(byMeasurement[def.Measurement], def)
+	}
+	derived := make([]model.Point, 0)
+	for _, measurement := range sortedKeys(byMeasurement) {
+		order := make([]int, 0)
+		for i := range points {
+			if points[i].Measurement == measurement {
+				order = append(order, i)
+			}
+		}
+		if len(order) == 0 {
+			continue
+		}
+		sort.SliceStable(order, func(a, b int) bool { return points[order[a]].Timestamp < points[order[b]].Timestamp })
+
+		out := make([]model.Point, len(points))
+		for _, i := range order {
+			tags := make(map[string]string, len(points[i].Tags))
+			for k, v := range points[i].Tags {
+				tags[k] = v
+			}
+			out[i] = model.Point{
+				Measurement: measurement + model.DerivedMeasurementSuffix,
+				Tags:        tags,
+				Fields:      make(map[string]any),
+				Timestamp:   points[i].Timestamp,
+			}
+		}
+		for _, def := range byMeasurement[measurement] {
+			if err := evalDerivedField(def, points, order, out); err != nil {
+				logger.L().Warn("计算派生字段失败", logger.WithError(err), logger.WithString("name", def.Name))
+			}
+		}
+		for _, i := range order {
+			if len(out[i].Fields) > 0 {
+				derived = append(derived, out[i])
+			}
+		}
+	}
+	return derived
+}
+
+// checkScope 检查派生字段的权限：ingest派生字段会写入数据，只有管理员可以管理
+func (s *DerivedFieldService) checkScope(field *model.DerivedField, currentUID int64, role string) error {
+	if role == "admin" {
+		return nil
+	}
+	if field.Mode == model.DerivedModeIngest {
+		return fmt.Errorf("%w: 只有管理员可以管理上传时计算的派生字段", ErrDerivedFieldForbidden)
+	}
+	if field.CreateBy != currentUID {
+		return fmt.Errorf("%w: 只能修改自己创建的派生字段", ErrDerivedFieldForbidden)
+	}
+	readable, err := s.deviceUserRepo.GetUserReadableDevTypes(currentUID)
+	if err != nil {
+		return err
+	}
+	if !containsString(readable, field.DevType) {
+		return ErrDerivedFieldForbidden
+	}
+	return nil
+}
+
+// checkDefinition 校验名称与表达式：名称不能与measurement中已存储的字段重名；
+// measurement有schema时，表达式只能引用schema中的数值字段，名称不能与schema字段重名
+func (s *DerivedFieldService) checkDefinition(field *model.DerivedField) error {
+	if !derivedFieldNamePattern.MatchString(field.Name) {
+		return errors.New("派生字段名称只能包含字母、数字和下划线，且不能以数字开头")
+	}
+	if schemaSystemFields[field.Name] || schemaSystemTags[field.Name] {
+		return fmt.Errorf("派生字段名称不能为系统字段%s", field.Name)
+	}
+	expr, err := compileDerivedExpr(field.Expression)
+	if err != nil {
+		return err
+	}
+	if len(expr.Vars()) == 0 {
+		return errors.New("表达式至少需要引用一个字段")
+	}
+	if containsString(expr.Vars(), field.Name) {
+		return errors.New("表达式不能引用派生字段自身")
+	}
+
+	// 与已存储的字段重名时查询结果中的原始值会被遮盖
+	columns, err := s.derivedRepo.GetMeasurementColumns(field.Measurement)
+	if err != nil {
+		return fmt.Errorf("获取measurement字段失败: %v", err)
+	}
+	if columns[field.Name] {
+		return fmt.Errorf("派生字段名称与measurement中已有的字段%s重名", field.Name)
+	}
+
+	schemas, err := s.schemaService.GetSchemas(field.DevType, field.Measurement)
+	if err != nil {
+		return fmt.Errorf("获取schema失败: %v", err)
+	}
+	if len(schemas) == 0 {
+		return nil
+	}
+	types := make(map[string]string, len(schemas[0].Fields))
+	for _, def := range schemas[0].Fields {
+		types[def.Name] = def.Type
+	}
+	if _, ok := types[field.Name]; ok {
+		return fmt.Errorf("派生字段名称与schema字段%s重名", field.Name)
+	}
+	for _, name := range expr.Vars() {
+		switch types[name] {
+		case model.SchemaFieldTypeFloat, model.SchemaFieldTypeInt, model.SchemaFieldTypeBool:
+		default:
+			return fmt.Errorf("表达式引用的字段%s不在schema中或不是数值字段", name)
+		}
+	}
+	return nil
+}
+
+// evalDerivedField 按order（时间顺序的下标）计算派生字段，结果写入out中对应下标的数据点
+func evalDerivedField(def *model.DerivedField, points []model.Point, order []int, out []model.Point) error {
+	expr, err := compileDerivedExpr(def.Expression)
+	if err != nil {
+		return err
+	}
+	times := make([]int64, len(order))
+	columns := make(map[string][]float64, len(expr.Vars()))
+	for _, name := range expr.Vars() {
+		columns[name] = make([]float64, len(order))
+	}
+	for j, i := range order {
+		times[j] = points[i].Timestamp
+		for name, column := range columns {
+			column[j] = math.NaN()
+			if v, ok := exprValue(points[i].Fields[name]); ok {
+				column[j] = v
+			}
+		}
+	}
+	for j, v := range expr.EvalSeries(times, columns) {
+		if math.IsNaN(v) {
+			continue
+		}
+		if out[order[j]].Fields == nil {
+			out[order[j]].Fields = make(map[string]any)
+		}
+		// 不覆盖数据点已有的同名字段
+		if _, exists := out[order[j]].Fields[def.Name]; exists {
+			continue
+		}
+		out[order[j]].Fields[def.Name] = v
+	}
+	return nil
+}
+
+// compileDerivedExpr 编译表达式（缓存编译结果）
+func compileDerivedExpr(src string) (*utils.Expr, error) {
+	if cached, ok := derivedExprCache.Load(src); ok {
+		return cached.(*utils.Expr), nil
+	}
+	expr, err := utils.CompileExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	derivedExprCache.Store(src, expr)
+	return expr, nil
+}
+
+// exprValue 将字段值转换为表达式变量（布尔值为1或0）
+func exprValue(value any) (float64, bool) {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case float32:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	return numericValue(value)
+}
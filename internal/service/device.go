@@ -4,6 +4,7 @@ import (
 	"backend/internal/model"
 	"backend/internal/repo"
 	"backend/pkg/utils"
+	"database/sql"
 	"errors"
 	"fmt"
 )
@@ -12,6 +13,9 @@ const (
 	MaxDeviceUsersCount = 3 // 一个设备最多绑定3个用户
 )
 
+// ErrDeviceTokenRevoked 设备已删除或设备凭证已被吊销
+var ErrDeviceTokenRevoked = errors.New("设备不存在或设备凭证已被吊销")
+
 type DeviceService struct {
 	deviceRepo     *repo.DeviceRepository
 	deviceUserRepo *repo.DeviceUserRepository
@@ -166,3 +170,70 @@ func (s *DeviceService) GetDeviceStatistics(currentUID int64, role string) (map[
 	// 普通用户：只统计自己有权限的设备
 	return s.deviceUserRepo.GetUserDeviceStatistics(currentUID)
 }
+
+// IssueDeviceToken 为设备签发设备凭证（仅管理员或拥有rw权限的用户）
+func (s *DeviceService) IssueDeviceToken(devID int64, currentUID int64, role string) (map[string]any, error) {
+	if err := s.checkTokenPermission(devID, currentUID, role); err != nil {
+		return nil, err
+	}
+
+	version, err := s.deviceRepo.GetDeviceTokenVersion(devID)
+	if err != nil {
+		return nil, errors.New("设备不存在")
+	}
+
+	token, expiresAt, err := utils.GenerateDeviceToken(devID, version)
+	if err != nil {
+		return nil, fmt.Errorf("生成设备凭证失败: %v", err)
+	}
+
+	return map[string]any{
+		"dev_id":     model.Int64ToID(devID),
+		"token":      token,
+		"expires_at": expiresAt,
+	}, nil
+}
+
+// RevokeDeviceTokens 吊销设备已签发的全部设备凭证（仅管理员或拥有rw权限的用户）
+func (s *DeviceService) RevokeDeviceTokens(devID int64, currentUID int64, role string) error {
+	if err := s.checkTokenPermission(devID, currentUID, role); err != nil {
+		return err
+	}
+	if err := s.deviceRepo.IncrDeviceTokenVersion(devID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("设备不存在")
+		}
+		return err
+	}
+	return nil
+}
+
+// ValidateDeviceToken 校验设备凭证：设备仍然存在且凭证版本号未被吊销
+func (s *DeviceService) ValidateDeviceToken(devID int64, tokenVersion int64) error {
+	version, err := s.deviceRepo.GetDeviceTokenVersion(devID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrDeviceTokenRevoked
+		}
+		return err
+	}
+	if version != tokenVersion {
+		return ErrDeviceTokenRevoked
+	}
+	return nil
+}
+
+// checkTokenPermission 签发/吊销设备凭证的权限检查：设备凭证可以上报任意数据，只有管理员和拥有rw权限的用户可以操作
+func (s *DeviceService) checkTokenPermission(devID int64, currentUID int64, role string) error {
+	if role == model.RoleAdmin {
+		return nil
+	}
+	deviceUser, err := s.deviceUserRepo.GetDeviceUser(devID, currentUID)
+	if err != nil {
+		return errors.New("您没有权限访问该设备")
+	}
+	if deviceUser.PermissionLevel != model.PermissionLevelReadWrite {
+		return errors.New("只有拥有rw权限的用户可以管理设备凭证")
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"backend/internal/model"
+	"backend/internal/repo"
+	"backend/pkg/utils"
+	"errors"
+	"time"
+)
+
+const (
+	MaxPollCommandsCount = 50 // 设备单次最多拉取的命令数
+)
+
+type DeviceCommandService struct {
+	commandRepo    *repo.DeviceCommandRepository
+	deviceRepo     *repo.DeviceRepository
+	deviceUserRepo *repo.DeviceUserRepository
+}
+
+func NewDeviceCommandService() *DeviceCommandService {
+	return &DeviceCommandService{
+		commandRepo:    repo.NewDeviceCommandRepository(),
+		deviceRepo:     repo.NewDeviceRepository(),
+		deviceUserRepo: repo.NewDeviceUserRepository(),
+	}
+}
+
+// CreateCommand 创建设备命令（需要写权限）
+func (s *DeviceCommandService) CreateCommand(req *model.CreateDeviceCommandReq, currentUID int64, role string) (*model.DeviceCommand, error) {
+	devID := req.DevID.Int64()
+
+	// 权限检查
+	if role != model.RoleAdmin {
+		deviceUser, err := s.deviceUserRepo.GetDeviceUser(devID, currentUID)
+		if err != nil {
+			return nil, errors.New("您没有权限访问该设备")
+		}
+		// 检查写权限
+		if deviceUser.PermissionLevel != model.PermissionLevelWrite &&
+			deviceUser.PermissionLevel != model.PermissionLevelReadWrite {
+			return nil, errors.New("您没有写权限")
+		}
+	}
+
+	if _, err := s.deviceRepo.GetDevice(devID); err != nil {
+		return nil, errors.New("设备不存在")
+	}
+
+	ttl := req.TTL
+	if ttl <= 0 {
+		ttl = model.DefaultCommandTTL
+	}
+	if ttl > model.MaxCommandTTL {
+		return nil, errors.New("ttl不能超过7天")
+	}
+
+	now := utils.GetCurrentTime()
+	cmd := &model.DeviceCommand{
+		CmdID:    utils.GetDefaultSnowflake().Generate(),
+		DevID:    req.DevID,
+		Command:  req.Command,
+		Payload:  req.Payload,
+		Status:   model.CommandStatusPending,
+		IssuedBy: currentUID,
+		TTL:      ttl,
+		ExpireAt: now.Add(time.Duration(ttl) * time.Second),
+		CreateAt: now,
+	}
+	if cmd.Payload == nil {
+		cmd.Payload = make(map[string]interface{})
+	}
+
+	if err := s.commandRepo.CreateDeviceCommand(cmd); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// GetCommands 获取设备命令历史（需要读权限）
+func (s *DeviceCommandService) GetCommands(devID int64, status string, page, pageSize int, currentUID int64, role string) ([]*model.DeviceCommand, int64, error) {
+	// 权限检查
+	if role != model.RoleAdmin {
+		deviceUser, err := s.deviceUserRepo.GetDeviceUser(devID, currentUID)
+		if err != nil {
+			return nil, 0, errors.New("您没有权限访问该设备")
+		}
+		// 检查读权限
+		if deviceUser.PermissionLevel != model.PermissionLevelRead &&
+			deviceUser.PermissionLevel != model.PermissionLevelReadWrite {
+			return nil, 0, errors.New("您没有读权限")
+		}
+	}
+
+	// 先将超时的命令标记为expired，保证历史视图状态准确
+	if err := s.commandRepo.ExpireDeviceCommands(devID, utils.GetCurrentTime()); err != nil {
+		return nil, 0, err
+	}
+
+	return s.commandRepo.GetDeviceCommands(devID, status, page, pageSize)
+}
+
+// PollCommands 设备拉取待执行命令（FIFO），返回的命令会被标记为delivered
+func (s *DeviceCommandService) PollCommands(devID int64, limit int) ([]*model.DeviceCommand, error) {
+	if limit <= 0 || limit > MaxPollCommandsCount {
+		limit = MaxPollCommandsCount
+	}
+
+	now := utils.GetCurrentTime()
+	if err := s.commandRepo.ExpireDeviceCommands(devID, now); err != nil {
+		return nil, err
+	}
+	return s.commandRepo.DeliverPendingCommands(devID, limit, now)
+}
+
+// AckCommand 设备回执命令执行结果
+func (s *DeviceCommandService) AckCommand(devID int64, req *model.AckDeviceCommandReq) (*model.DeviceCommand, error) {
+	if req.Status != model.CommandStatusSucceeded && req.Status != model.CommandStatusFailed {
+		return nil, errors.New("无效的命令状态，应为: succeeded, failed")
+	}
+
+	now := utils.GetCurrentTime()
+	if err := s.commandRepo.ExpireDeviceCommands(devID, now); err != nil {
+		return nil, err
+	}
+	if err := s.commandRepo.FinishDeviceCommand(req.CmdID, devID, req.Status, req.Result, now); err != nil {
+		return nil, err
+	}
+	return s.commandRepo.GetDeviceCommand(req.CmdID)
+}
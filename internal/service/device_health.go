@@ -0,0 +1,232 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"backend/internal/model"
+	"backend/internal/repo"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+)
+
+// minBatteryPredictPoints 预测电量耗尽时间所需的最少放电数据点
+const minBatteryPredictPoints = 3
+
+// healthFields 参与趋势统计的健康指标
+var healthFields = []string{
+	model.HealthFieldBattery,
+	model.HealthFieldRSSI,
+	model.HealthFieldTemperature,
+	model.HealthFieldUptime,
+}
+
+type DeviceHealthService struct {
+	deviceRepo     *repo.DeviceRepository
+	deviceUserRepo *repo.DeviceUserRepository
+	sensorDataRepo *repo.SensorDataRepository
+	warningRepo    *repo.WarningInfoRepository
+}
+
+func NewDeviceHealthService() *DeviceHealthService {
+	return &DeviceHealthService{
+		deviceRepo:     repo.NewDeviceRepository(),
+		deviceUserRepo: repo.NewDeviceUserRepository(),
+		sensorDataRepo: repo.NewSensorDataRepository(),
+		warningRepo:    repo.NewWarningInfoRepository(),
+	}
+}
+
+// RecordHealth 记录设备健康指标：写入InfluxDB健康measurement，刷新设备在线状态和电量，并检查低电量告警
+// health 为空时只刷新在线状态（纯心跳）
+func (s *DeviceHealthService) RecordHealth(devID int64, health *model.DeviceHealth) error {
+	now := utils.GetCurrentTime()
+
+	var battery *int
+	if !health.IsEmpty() {
+		if health.Timestamp == 0 {
+			health.Timestamp = now.Unix()
+		}
+
+		fields := make(map[string]any)
+		if health.Battery != nil {
+			fields[model.HealthFieldBattery] = *health.Battery
+			b := int(math.Round(*health.Battery))
+			battery = &b
+		}
+		if health.RSSI != nil {
+			fields[model.HealthFieldRSSI] = *health.RSSI
+		}
+		if health.Temperature != nil {
+			fields[model.HealthFieldTemperature] = *health.Temperature
+		}
+		if health.Uptime != nil {
+			fields[model.HealthFieldUptime] = *health.Uptime
+		}
+
+		point := model.Point{
+			Measurement: model.DeviceHealthMeasurement,
+			Tags:        map[string]string{"dev_id": fmt.Sprintf("%d", devID)},
+			Fields:      fields,
+			Timestamp:   health.Timestamp,
+		}
+		if err := s.sensorDataRepo.CreateSeriesData(&model.SeriesData{Points: []model.Point{point}}); err != nil {
+			return fmt.Errorf("写入设备健康指标失败: %v", err)
+		}
+	}
+
+	if err := s.deviceRepo.UpdateDeviceLiveness(devID, model.DevStatusOnline, battery, now); err != nil {
+		return fmt.Errorf("更新设备状态失败: %v", err)
+	}
+
+	if health != nil && health.Battery != nil {
+		s.checkLowBattery(devID, *health.Battery)
+	}
+	return nil
+}
+
+// checkLowBattery 电量低于阈值时创建告警（同一设备只保留一条未解决的低电量告警），电量恢复后自动解除
+func (s *DeviceHealthService) checkLowBattery(devID int64, battery float64) {
+	active, err := s.warningRepo.GetActiveDeviceWarning(devID, "dev", model.LowBatteryAlertPrefix)
+	if err != nil {
+		logger.L().Warn("查询低电量告警失败", logger.WithError(err), logger.WithInt64("dev_id", devID))
+		return
+	}
+
+	switch {
+	case battery <= model.LowBatteryThreshold && active == nil:
+		warning := &model.WarningInfo{
+			DevID:        model.Int64ToID(devID),
+			AlertType:    "dev",
+			AlertStatus:  "active",
+			AlertMessage: fmt.Sprintf("%s: 当前电量%.0f%%，低于阈值%d%%", model.LowBatteryAlertPrefix, battery, model.LowBatteryThreshold),
+		}
+		if _, err := NewWarningInfoService().CreateWarningInfo(warning); err != nil {
+			logger.L().Warn("创建低电量告警失败", logger.WithError(err), logger.WithInt64("dev_id", devID))
+		}
+	case battery >= model.LowBatteryRecoverThreshold && active != nil:
+		now := utils.GetCurrentTime()
+		if err := s.warningRepo.UpdateWarningStatus(active.AlertID, "resolved", &now); err != nil {
+			logger.L().Warn("解除低电量告警失败", logger.WithError(err), logger.WithInt64("dev_id", devID))
+		}
+	}
+}
+
+// GetHealth 获取设备健康历史、趋势和电量耗尽预测（需要读权限）
+func (s *DeviceHealthService) GetHealth(devID int64, startTime, endTime int64, currentUID int64, role string) (*model.DeviceHealthReport, error) {
+	// 权限检查
+	if role != model.RoleAdmin {
+		deviceUser, err := s.deviceUserRepo.GetDeviceUser(devID, currentUID)
+		if err != nil {
+			return nil, errors.New("您没有权限访问该设备")
+		}
+		// 检查读权限
+		if deviceUser.PermissionLevel != model.PermissionLevelRead &&
+			deviceUser.PermissionLevel != model.PermissionLevelReadWrite {
+			return nil, errors.New("您没有读权限")
+		}
+	}
+
+	if endTime <= 0 {
+		endTime = utils.GetCurrentTime().Unix()
+	}
+	if startTime <= 0 {
+		startTime = endTime - model.DefaultHealthRangeSeconds
+	}
+	if startTime >= endTime {
+		return nil, errors.New("start_time必须小于end_time")
+	}
+
+	points, err := s.sensorDataRepo.QuerySeriesData(model.DeviceHealthMeasurement, devID, startTime, endTime,
+		nil, nil, "", "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("查询设备健康历史失败: %v", err)
+	}
+	if points == nil {
+		points = []model.Point{}
+	}
+
+	report := &model.DeviceHealthReport{
+		DevID:     model.Int64ToID(devID),
+		StartTime: startTime,
+		EndTime:   endTime,
+		History:   points,
+		Trends:    make(map[string]*model.HealthMetricTrend),
+	}
+
+	for _, field := range healthFields {
+		ts, values := extractHealthSeries(points, field)
+		if len(values) == 0 {
+			continue
+		}
+		report.Trends[field] = buildHealthTrend(ts, values)
+		if field == model.HealthFieldBattery {
+			report.BatteryEmptyAt = predictBatteryEmpty(ts, values)
+		}
+	}
+
+	return report, nil
+}
+
+// extractHealthSeries 从查询结果中提取单个指标的时间序列（跳过缺失值）
+func extractHealthSeries(points []model.Point, field string) ([]float64, []float64) {
+	ts := make([]float64, 0, len(points))
+	values := make([]float64, 0, len(points))
+	for _, p := range points {
+		v, ok := p.Fields[field]
+		if !ok || v == nil {
+			continue
+		}
+		f, err := utils.ConvertToFloat64(v)
+		if err != nil {
+			continue
+		}
+		ts = append(ts, float64(p.Timestamp))
+		values = append(values, f)
+	}
+	return ts, values
+}
+
+// buildHealthTrend 计算指标的最新值、最值、均值和每小时变化斜率
+func buildHealthTrend(ts, values []float64) *model.HealthMetricTrend {
+	trend := &model.HealthMetricTrend{
+		Latest: values[len(values)-1],
+		Min:    values[0],
+		Max:    values[0],
+		Count:  len(values),
+	}
+	for _, v := range values {
+		trend.Min = math.Min(trend.Min, v)
+		trend.Max = math.Max(trend.Max, v)
+	}
+	trend.Avg = utils.SumFloat64(values) / float64(len(values))
+
+	if slope, _, ok := utils.LinearRegression(ts, values); ok {
+		trend.SlopePerHour = slope * 3600
+	}
+	return trend
+}
+
+// predictBatteryEmpty 根据最近一段连续放电数据的线性斜率预测电量耗尽时间
+// 从最新数据向前回溯，遇到明显回升（充电/换电池）即停止，只用最后一个放电区间拟合
+func predictBatteryEmpty(ts, values []float64) *time.Time {
+	n := len(values)
+	start := n - 1
+	for start > 0 && values[start-1] >= values[start]-1 {
+		start--
+	}
+	if n-start < minBatteryPredictPoints {
+		return nil
+	}
+
+	slope, _, ok := utils.LinearRegression(ts[start:], values[start:])
+	if !ok || slope >= 0 {
+		return nil
+	}
+
+	latest := values[n-1]
+	emptyAt := time.Unix(int64(ts[n-1]+latest/(-slope)), 0)
+	return &emptyAt
+}
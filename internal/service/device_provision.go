@@ -0,0 +1,236 @@
+package service
+
+import (
+	"crypto/subtle"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"backend/internal/model"
+	"backend/internal/repo"
+	"backend/pkg/utils"
+)
+
+// 认领/引导相关错误（handler据此返回对应状态码）
+var (
+	ErrClaimCodeInvalid     = repo.ErrClaimCodeInvalid
+	ErrDeviceAlreadyClaimed = repo.ErrDeviceAlreadyClaimed
+	ErrBootstrapSecretWrong = errors.New("设备ID或引导密钥错误")
+)
+
+// provisionCSVRequiredCols 批量预注册CSV必须包含的列
+var provisionCSVRequiredCols = []string{"dev_type"}
+
+type DeviceProvisionService struct {
+	deviceRepo    *repo.DeviceRepository
+	provisionRepo *repo.DeviceProvisionRepository
+}
+
+func NewDeviceProvisionService() *DeviceProvisionService {
+	return &DeviceProvisionService{
+		deviceRepo:    repo.NewDeviceRepository(),
+		provisionRepo: repo.NewDeviceProvisionRepository(),
+	}
+}
+
+// ProvisionDevices 管理员批量预注册设备，为每个设备生成一次性认领码和引导密钥
+// 明文只在返回结果中出现一次，数据库只保存哈希
+func (s *DeviceProvisionService) ProvisionDevices(items []model.ProvisionDeviceItem, currentUID int64) ([]*model.ProvisionedDevice, error) {
+	if len(items) == 0 {
+		return nil, errors.New("设备列表不能为空")
+	}
+	if len(items) > model.MaxProvisionBatchSize {
+		return nil, fmt.Errorf("单次最多预注册%d个设备", model.MaxProvisionBatchSize)
+	}
+
+	now := utils.GetCurrentTime()
+	devices := make([]*model.Device, 0, len(items))
+	provisions := make([]*model.DeviceProvision, 0, len(items))
+	results := make([]*model.ProvisionedDevice, 0, len(items))
+
+	for i, item := range items {
+		if utils.IsEmpty(item.DevType) {
+			return nil, fmt.Errorf("第%d个设备缺少dev_type", i+1)
+		}
+
+		device := &model.Device{
+			DevID:            model.Int64ToID(utils.GetDefaultSnowflake().Generate()),
+			DevName:          item.DevName,
+			DevStatus:        model.DevStatusOffline,
+			DevType:          item.DevType,
+			Model:            item.Model,
+			Version:          item.Version,
+			SamplingRate:     item.SamplingRate,
+			UploadInterval:   item.UploadInterval,
+			OfflineThreshold: item.OfflineThreshold,
+			ExtendedConfig:   make(map[string]interface{}),
+			CreateAt:         now,
+			UpdateAt:         now,
+		}
+		// 如果DevName为空，设置默认名称 <dev_type>_<dev_id>
+		if device.DevName == "" {
+			device.DevName = fmt.Sprintf("%s_%d", device.DevType, device.DevID.Int64())
+		}
+
+		claimCode, err := utils.GenerateClaimCode(model.ClaimCodeGroups)
+		if err != nil {
+			return nil, fmt.Errorf("生成认领码失败: %v", err)
+		}
+		secret, err := utils.GenerateSecret(model.BootstrapSecretBytes)
+		if err != nil {
+			return nil, fmt.Errorf("生成引导密钥失败: %v", err)
+		}
+
+		devices = append(devices, device)
+		provisions = append(provisions, &model.DeviceProvision{
+			DevID:               device.DevID,
+			ClaimCodeHash:       utils.SHA256Hex(utils.NormalizeClaimCode(claimCode)),
+			BootstrapSecretHash: utils.SHA256Hex(secret),
+			CreateBy:            currentUID,
+			CreateAt:            now,
+		})
+		results = append(results, &model.ProvisionedDevice{
+			DevID:           device.DevID,
+			DevName:         device.DevName,
+			DevType:         device.DevType,
+			ClaimCode:       claimCode,
+			BootstrapSecret: secret,
+			QRPayload:       buildClaimQRPayload(device.DevID, claimCode),
+		})
+	}
+
+	if err := s.provisionRepo.CreateProvisionedDevices(devices, provisions); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// ClaimDevice 用户使用认领码认领设备，认领成功后自动绑定为rw权限
+func (s *DeviceProvisionService) ClaimDevice(claimCode string, currentUID int64) (*model.Device, error) {
+	code := utils.NormalizeClaimCode(claimCode)
+	if code == "" {
+		return nil, ErrClaimCodeInvalid
+	}
+
+	devID, err := s.provisionRepo.ClaimDevice(utils.SHA256Hex(code), currentUID, MaxDeviceUsersCount, utils.GetCurrentTime())
+	if err != nil {
+		return nil, err
+	}
+
+	return s.deviceRepo.GetDevice(devID)
+}
+
+// Bootstrap 设备使用出厂引导密钥换取运行凭证
+func (s *DeviceProvisionService) Bootstrap(req *model.DeviceBootstrapReq) (map[string]any, error) {
+	provision, err := s.provisionRepo.GetDeviceProvision(req.DevID.Int64())
+	if err != nil {
+		return nil, ErrBootstrapSecretWrong
+	}
+
+	hash := utils.SHA256Hex(req.BootstrapSecret)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(provision.BootstrapSecretHash)) != 1 {
+		return nil, ErrBootstrapSecretWrong
+	}
+
+	version, err := s.deviceRepo.GetDeviceTokenVersion(req.DevID.Int64())
+	if err != nil {
+		return nil, ErrBootstrapSecretWrong
+	}
+
+	token, expiresAt, err := utils.GenerateDeviceToken(req.DevID.Int64(), version)
+	if err != nil {
+		return nil, fmt.Errorf("生成设备凭证失败: %v", err)
+	}
+
+	if err := s.provisionRepo.UpdateLastBootstrapAt(req.DevID.Int64(), utils.GetCurrentTime()); err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		"dev_id":     req.DevID,
+		"token":      token,
+		"expires_at": expiresAt,
+	}, nil
+}
+
+// ParseProvisionCSV 解析批量预注册CSV，第一行为表头，列名与JSON字段一致（dev_type必填）
+func ParseProvisionCSV(r io.Reader) ([]model.ProvisionDeviceItem, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("读取CSV表头失败: %v", err)
+	}
+	cols := make(map[string]int, len(header))
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, name := range provisionCSVRequiredCols {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("CSV缺少%s列", name)
+		}
+	}
+
+	get := func(record []string, name string) string {
+		if i, ok := cols[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	getInt := func(record []string, name string, line int) (int, error) {
+		v := get(record, name)
+		if v == "" {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("第%d行%s不是有效的整数: %s", line, name, v)
+		}
+		return n, nil
+	}
+
+	items := make([]model.ProvisionDeviceItem, 0)
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("第%d行解析失败: %v", line, err)
+		}
+
+		item := model.ProvisionDeviceItem{
+			DevName: get(record, "dev_name"),
+			DevType: get(record, "dev_type"),
+			Model:   get(record, "model"),
+			Version: get(record, "version"),
+		}
+		if item.DevType == "" {
+			return nil, fmt.Errorf("第%d行缺少dev_type", line)
+		}
+		if item.SamplingRate, err = getInt(record, "sampling_rate", line); err != nil {
+			return nil, err
+		}
+		if item.UploadInterval, err = getInt(record, "upload_interval", line); err != nil {
+			return nil, err
+		}
+		if item.OfflineThreshold, err = getInt(record, "offline_threshold", line); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// buildClaimQRPayload 生成认领二维码内容
+func buildClaimQRPayload(devID model.DeviceID, claimCode string) string {
+	q := url.Values{}
+	q.Set("dev_id", devID.String())
+	q.Set("code", claimCode)
+	return model.ProvisionQRScheme + "?" + q.Encode()
+}
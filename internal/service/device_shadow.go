@@ -0,0 +1,190 @@
+package service
+
+import (
+	"backend/internal/model"
+	"backend/internal/repo"
+	"backend/pkg/utils"
+	"database/sql"
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrShadowVersionConflict 影子版本冲突（handler据此返回409）
+	ErrShadowVersionConflict = repo.ErrShadowVersionConflict
+	// ErrShadowReportedReadOnly 用户不能修改reported（只能由设备凭证上报）
+	ErrShadowReportedReadOnly = errors.New("state.reported只能由设备上报")
+)
+
+const shadowEventBufferSize = 16 // 每个订阅者的事件缓冲区大小
+
+type DeviceShadowService struct {
+	shadowRepo     *repo.DeviceShadowRepository
+	deviceUserRepo *repo.DeviceUserRepository
+}
+
+func NewDeviceShadowService() *DeviceShadowService {
+	return &DeviceShadowService{
+		shadowRepo:     repo.NewDeviceShadowRepository(),
+		deviceUserRepo: repo.NewDeviceUserRepository(),
+	}
+}
+
+// GetShadow 获取设备影子（需要读权限）
+func (s *DeviceShadowService) GetShadow(devID int64, currentUID int64, role string) (*model.DeviceShadow, error) {
+	if role != model.RoleAdmin {
+		deviceUser, err := s.deviceUserRepo.GetDeviceUser(devID, currentUID)
+		if err != nil {
+			return nil, errors.New("您没有权限访问该设备")
+		}
+		if deviceUser.PermissionLevel != model.PermissionLevelRead &&
+			deviceUser.PermissionLevel != model.PermissionLevelReadWrite {
+			return nil, errors.New("您没有读权限")
+		}
+	}
+
+	shadow, err := s.shadowRepo.GetDeviceShadow(devID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("设备不存在")
+		}
+		return nil, err
+	}
+	shadow.Delta = utils.DiffMap(shadow.Desired, shadow.Reported)
+	return shadow, nil
+}
+
+// UpdateShadow 部分更新设备影子的desired（需要写权限），reported对用户只读，不为空时返回 ErrShadowReportedReadOnly
+// desired 按 JSON Merge Patch 语义合并，值为null的键会被删除
+// version 不为空时需与当前版本一致，否则返回 ErrShadowVersionConflict
+func (s *DeviceShadowService) UpdateShadow(devID int64, req *model.UpdateDeviceShadowReq, currentUID int64, role string) (*model.DeviceShadow, error) {
+	if len(req.State.Reported) > 0 {
+		return nil, ErrShadowReportedReadOnly
+	}
+	if role != model.RoleAdmin {
+		deviceUser, err := s.deviceUserRepo.GetDeviceUser(devID, currentUID)
+		if err != nil {
+			return nil, errors.New("您没有权限访问该设备")
+		}
+		if deviceUser.PermissionLevel != model.PermissionLevelWrite &&
+			deviceUser.PermissionLevel != model.PermissionLevelReadWrite {
+			return nil, errors.New("您没有写权限")
+		}
+	}
+
+	return s.applyShadowUpdate(devID, &req.State, req.Version)
+}
+
+// ReportShadow 设备上报reported状态（设备凭证认证，只能更新自己的影子）
+func (s *DeviceShadowService) ReportShadow(devID int64, req *model.ReportDeviceShadowReq) (*model.DeviceShadow, error) {
+	if len(req.Reported) == 0 {
+		return nil, errors.New("reported不能为空")
+	}
+	return s.applyShadowUpdate(devID, &model.ShadowState{Reported: req.Reported}, req.Version)
+}
+
+// applyShadowUpdate 合并并持久化影子状态，成功后发布变更事件
+func (s *DeviceShadowService) applyShadowUpdate(devID int64, patch *model.ShadowState, expectedVersion *int64) (*model.DeviceShadow, error) {
+	if len(patch.Desired) == 0 && len(patch.Reported) == 0 {
+		return nil, errors.New("state.desired和state.reported不能同时为空")
+	}
+
+	shadow, err := s.shadowRepo.GetDeviceShadow(devID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("设备不存在")
+		}
+		return nil, err
+	}
+	if expectedVersion != nil && *expectedVersion != shadow.Version {
+		return nil, ErrShadowVersionConflict
+	}
+
+	state := &model.ShadowState{
+		Desired:  utils.MergeMap(shadow.Desired, patch.Desired),
+		Reported: utils.MergeMap(shadow.Reported, patch.Reported),
+	}
+	now := utils.GetCurrentTime()
+	if err := s.shadowRepo.UpdateDeviceShadow(devID, state, shadow.Version, now); err != nil {
+		return nil, err
+	}
+
+	updated := &model.DeviceShadow{
+		DevID:    model.Int64ToID(devID),
+		Desired:  state.Desired,
+		Reported: state.Reported,
+		Delta:    utils.DiffMap(state.Desired, state.Reported),
+		Version:  shadow.Version + 1,
+		UpdateAt: now,
+	}
+
+	defaultShadowEventHub.publish(&model.ShadowEvent{
+		Type: model.ShadowEventUpdated, DevID: updated.DevID, Version: updated.Version, Shadow: updated,
+	})
+	if len(updated.Delta) > 0 {
+		defaultShadowEventHub.publish(&model.ShadowEvent{
+			Type: model.ShadowEventDelta, DevID: updated.DevID, Version: updated.Version, Shadow: updated,
+		})
+	}
+
+	return updated, nil
+}
+
+// SubscribeShadow 订阅设备影子变更事件（需要读权限）
+// 返回事件通道和取消订阅函数，调用方必须在结束时调用取消函数
+func (s *DeviceShadowService) SubscribeShadow(devID int64, currentUID int64, role string) (<-chan *model.ShadowEvent, func(), error) {
+	if _, err := s.GetShadow(devID, currentUID, role); err != nil {
+		return nil, nil, err
+	}
+	ch, cancel := defaultShadowEventHub.subscribe(devID)
+	return ch, cancel, nil
+}
+
+// shadowEventHub 进程内的影子事件分发器（按设备ID分组订阅）
+type shadowEventHub struct {
+	mu          sync.RWMutex
+	subscribers map[int64]map[chan *model.ShadowEvent]struct{}
+}
+
+var defaultShadowEventHub = &shadowEventHub{
+	subscribers: make(map[int64]map[chan *model.ShadowEvent]struct{}),
+}
+
+// subscribe 订阅指定设备的事件
+func (h *shadowEventHub) subscribe(devID int64) (<-chan *model.ShadowEvent, func()) {
+	ch := make(chan *model.ShadowEvent, shadowEventBufferSize)
+
+	h.mu.Lock()
+	if h.subscribers[devID] == nil {
+		h.subscribers[devID] = make(map[chan *model.ShadowEvent]struct{})
+	}
+	h.subscribers[devID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subscribers[devID], ch)
+			if len(h.subscribers[devID]) == 0 {
+				delete(h.subscribers, devID)
+			}
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
+
+// publish 发布事件（订阅者缓冲区已满时丢弃，避免阻塞写入路径）
+func (h *shadowEventHub) publish(event *model.ShadowEvent) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for ch := range h.subscribers[event.DevID.Int64()] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package service
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"backend/config"
+	"backend/internal/model"
+	"backend/internal/repo"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+)
+
+const (
+	defaultArchiveRetention = 24 * time.Hour
+	defaultArchiveCleanup   = time.Hour
+	archiveConcurrency      = 2
+	archiveCleanupBatch     = 100
+	archiveMissingFilename  = "MISSING.txt" // 记录无法读取的文件
+)
+
+var (
+	// archiveConfig 批量下载配置（Start时从配置加载）
+	archiveConfig config.FileArchiveConfig
+	// archiveSem 限制同时执行的异步打包任务数量
+	archiveSem = make(chan struct{}, archiveConcurrency)
+)
+
+// FileArchiveService 批量下载：把设备文件打包成ZIP流式返回，或异步打包写入archive bucket
+type FileArchiveService struct {
+	archiveRepo    *repo.FileArchiveRepository
+	catalogRepo    *repo.FileCatalogRepository
+	deviceRepo     *repo.DeviceRepository
+	deviceUserRepo *repo.DeviceUserRepository
+	sensorDataRepo *repo.SensorDataRepository
+}
+
+func NewFileArchiveService() *FileArchiveService {
+	return &FileArchiveService{
+		archiveRepo:    repo.NewFileArchiveRepository(),
+		catalogRepo:    repo.NewFileCatalogRepository(),
+		deviceRepo:     repo.NewDeviceRepository(),
+		deviceUserRepo: repo.NewDeviceUserRepository(),
+		sensorDataRepo: repo.NewSensorDataRepository(),
+	}
+}
+
+// ResolveEntries 检查设备读权限并确定要打包的文件（超过limit时返回错误）
+func (s *FileArchiveService) ResolveEntries(req *model.FileArchiveReq, currentUID int64, role string, limit int) ([]model.ArchiveEntry, error) {
+	devID := req.DevID.Int64()
+	if _, err := s.deviceRepo.GetDevice(devID); err != nil {
+		return nil, errors.New("设备不存在")
+	}
+	if err := s.checkReadPermission(devID, currentUID, role); err != nil {
+		return nil, err
+	}
+	if len(req.Keys) == 0 && req.StartTime == nil && req.EndTime == nil {
+		return nil, errors.New("请指定时间范围或文件key")
+	}
+
+	var metadataList []*model.Metadata
+	if len(req.Keys) > 0 {
+		keys := uniqueStrings(req.Keys)
+		if len(keys) > limit {
+			return nil, fmt.Errorf("文件数量超过上限%d", limit)
+		}
+		metadataByKey, err := s.catalogRepo.GetFileMetadataByKeys(req.BucketName, keys)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			m, ok := metadataByKey[key]
+			if !ok || m.DevID.Int64() != devID {
+				return nil, fmt.Errorf("文件不存在或不属于该设备: %s", key)
+			}
+			metadataList = append(metadataList, m)
+		}
+	} else {
+		var err error
+		metadataList, err = s.catalogRepo.ListDeviceFiles(devID, req.BucketName, req.StartTime, req.EndTime, limit+1)
+		if err != nil {
+			return nil, err
+		}
+		if len(metadataList) > limit {
+			return nil, fmt.Errorf("文件数量超过上限%d，请缩小时间范围或使用异步打包", limit)
+		}
+	}
+	if len(metadataList) == 0 {
+		return nil, errors.New("没有符合条件的文件")
+	}
+
+	// ZIP内路径去掉 dev_id/ 前缀，保留 YYYY/MM/DD/filename
+	devPrefix := fmt.Sprintf("%d/", devID)
+	entries := make([]model.ArchiveEntry, 0, len(metadataList))
+	for _, m := range metadataList {
+		entry := fileEntryFromMetadata(m)
+		entries = append(entries, model.ArchiveEntry{
+			BucketKey:   entry.BucketKey,
+			Name:        strings.TrimPrefix(entry.BucketKey, devPrefix),
+			ContentType: entry.ContentType,
+			Modified:    entry.Timestamp,
+		})
+	}
+	return entries, nil
+}
+
+// WriteArchive 逐个读取MinIO对象写入ZIP（不落盘），返回写入的文件数
+// 无法读取的文件跳过并记录在ZIP内的 MISSING.txt 中；ctx取消时停止
+func (s *FileArchiveService) WriteArchive(ctx context.Context, w io.Writer, bucketName string, entries []model.ArchiveEntry) (int, error) {
+	zw := zip.NewWriter(w)
+	written := 0
+	var missing []string
+
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		ok, err := s.writeArchiveEntry(zw, bucketName, entry)
+		if err != nil {
+			return written, err
+		}
+		if !ok {
+			missing = append(missing, entry.BucketKey)
+			continue
+		}
+		written++
+	}
+
+	if len(missing) > 0 {
+		f, err := zw.Create(archiveMissingFilename)
+		if err != nil {
+			return written, err
+		}
+		if _, err := io.WriteString(f, strings.Join(missing, "\n")+"\n"); err != nil {
+			return written, err
+		}
+	}
+	return written, zw.Close()
+}
+
+// writeArchiveEntry 写入单个文件，对象无法读取时返回false
+func (s *FileArchiveService) writeArchiveEntry(zw *zip.Writer, bucketName string, entry model.ArchiveEntry) (bool, error) {
+	obj, err := s.sensorDataRepo.GetObject(bucketName, entry.BucketKey)
+	if err != nil {
+		logger.L().Warn("打包时读取文件失败", logger.WithError(err), logger.WithString("bucket_key", entry.BucketKey))
+		return false, nil
+	}
+	defer obj.Close()
+
+	// 先读取首部确认对象可读，避免写入ZIP条目头后才发现对象不存在
+	reader := bufio.NewReader(obj)
+	if _, err := reader.Peek(1); err != nil && err != io.EOF {
+		logger.L().Warn("打包时读取文件失败", logger.WithError(err), logger.WithString("bucket_key", entry.BucketKey))
+		return false, nil
+	}
+
+	header := &zip.FileHeader{
+		Name:     entry.Name,
+		Method:   archiveMethod(entry.ContentType),
+		Modified: entry.Modified,
+	}
+	f, err := zw.CreateHeader(header)
+	if err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(f, reader); err != nil {
+		return false, fmt.Errorf("写入%s失败: %v", entry.BucketKey, err)
+	}
+	return true, nil
+}
+
+// CreateTask 创建异步打包任务，ZIP写入archive bucket后可通过任务查询获取下载URL
+func (s *FileArchiveService) CreateTask(req *model.FileArchiveReq, currentUID int64, role string) (*model.FileArchiveTask, error) {
+	entries, err := s.ResolveEntries(req, currentUID, role, model.MaxAsyncArchiveFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	task := &model.FileArchiveTask{
+		TaskID:     utils.GetDefaultSnowflake().Generate(),
+		DevID:      req.DevID,
+		BucketName: req.BucketName,
+		Status:     model.ArchiveTaskStatusPending,
+		FileCount:  len(entries),
+		UID:        currentUID,
+		CreateAt:   utils.GetCurrentTime(),
+	}
+	if err := s.archiveRepo.CreateArchiveTask(task); err != nil {
+		return nil, fmt.Errorf("创建打包任务失败: %v", err)
+	}
+
+	go s.runTask(task, entries)
+	return task, nil
+}
+
+// runTask 执行打包：ZIP通过管道边生成边上传
+func (s *FileArchiveService) runTask(task *model.FileArchiveTask, entries []model.ArchiveEntry) {
+	archiveSem <- struct{}{}
+	defer func() { <-archiveSem }()
+
+	if err := s.archiveRepo.UpdateArchiveTaskStatus(task.TaskID, model.ArchiveTaskStatusRunning); err != nil {
+		logger.L().Warn("更新打包任务状态失败", logger.WithError(err), logger.WithInt64("task_id", task.TaskID))
+	}
+
+	archiveKey := fmt.Sprintf("%d/%d.zip", task.DevID.Int64(), task.TaskID)
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	var written int
+	go func() {
+		defer close(done)
+		var err error
+		written, err = s.WriteArchive(context.Background(), pw, task.BucketName, entries)
+		pw.CloseWithError(err)
+	}()
+
+	size, err := s.archiveRepo.PutArchive(archiveKey, pr)
+	// 上传失败时关闭读端，让写入方退出
+	pr.CloseWithError(err)
+	<-done
+
+	now := utils.GetCurrentTime()
+	task.FinishedAt = &now
+	task.FileCount = written
+	if err != nil {
+		task.Status = model.ArchiveTaskStatusFailed
+		task.ErrorMsg = err.Error()
+		logger.L().Error("打包文件失败", logger.WithError(err), logger.WithInt64("task_id", task.TaskID))
+	} else {
+		task.Status = model.ArchiveTaskStatusSucceeded
+		task.Size = size
+		task.ArchiveKey = archiveKey
+	}
+	if err := s.archiveRepo.FinishArchiveTask(task); err != nil {
+		logger.L().Error("保存打包任务结果失败", logger.WithError(err), logger.WithInt64("task_id", task.TaskID))
+	}
+}
+
+// GetTask 查询打包任务（创建者或管理员），成功的任务返回下载URL
+func (s *FileArchiveService) GetTask(taskID, currentUID int64, role string) (*model.FileArchiveTask, error) {
+	task, err := s.archiveRepo.GetArchiveTask(taskID)
+	if err != nil {
+		return nil, err
+	}
+	if role != model.RoleAdmin && task.UID != currentUID {
+		return nil, errors.New("您没有权限访问该打包任务")
+	}
+	if task.Status == model.ArchiveTaskStatusSucceeded {
+		url, err := s.archiveRepo.PresignedArchiveURL(task.ArchiveKey)
+		if err != nil {
+			return nil, err
+		}
+		task.DownloadURL = url
+	}
+	return task, nil
+}
+
+// CleanupExpired 删除超过保留时间的ZIP，返回删除数量
+func (s *FileArchiveService) CleanupExpired() int {
+	before := utils.GetCurrentTime().Add(-archiveRetention())
+	tasks, err := s.archiveRepo.GetExpiredArchiveTasks(before, archiveCleanupBatch)
+	if err != nil {
+		logger.L().Warn("查询过期打包任务失败", logger.WithError(err))
+		return 0
+	}
+
+	removed := 0
+	for _, task := range tasks {
+		if err := s.archiveRepo.DeleteArchive(task.ArchiveKey); err != nil {
+			logger.L().Warn("删除过期ZIP失败", logger.WithError(err), logger.WithString("archive_key", task.ArchiveKey))
+			continue
+		}
+		task.Status = model.ArchiveTaskStatusExpired
+		if err := s.archiveRepo.FinishArchiveTask(task); err != nil {
+			logger.L().Warn("更新打包任务状态失败", logger.WithError(err), logger.WithInt64("task_id", task.TaskID))
+			continue
+		}
+		removed++
+	}
+	return removed
+}
+
+// Start 加载配置、将重启前未完成的任务标记为失败，并启动过期ZIP清理任务（ctx取消后退出）
+func (s *FileArchiveService) Start(ctx context.Context, cfg config.FileArchiveConfig) {
+	archiveConfig = cfg
+
+	if n, err := s.archiveRepo.FailInterruptedArchiveTasks(utils.GetCurrentTime()); err != nil {
+		logger.L().Warn("标记中断的打包任务失败", logger.WithError(err))
+	} else if n > 0 {
+		logger.L().Info("标记中断的打包任务", logger.WithInt64("count", n))
+	}
+
+	interval := time.Duration(cfg.CleanupInterval) * time.Minute
+	if interval <= 0 {
+		interval = defaultArchiveCleanup
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if removed := s.CleanupExpired(); removed > 0 {
+					logger.L().Info("清理过期的打包文件", logger.WithInt("removed", removed))
+				}
+			}
+		}
+	}()
+}
+
+// checkReadPermission 检查设备读权限（管理员不受限制）
+func (s *FileArchiveService) checkReadPermission(devID, currentUID int64, role string) error {
+	if role == model.RoleAdmin {
+		return nil
+	}
+	deviceUser, err := s.deviceUserRepo.GetDeviceUser(devID, currentUID)
+	if err != nil {
+		return errors.New("您没有权限访问该设备的数据")
+	}
+	// 检查是否有读权限
+	if deviceUser.PermissionLevel != model.PermissionLevelRead &&
+		deviceUser.PermissionLevel != model.PermissionLevelReadWrite {
+		return errors.New("您没有读权限")
+	}
+	return nil
+}
+
+// archiveRetention ZIP保留时间
+func archiveRetention() time.Duration {
+	if archiveConfig.Retention <= 0 {
+		return defaultArchiveRetention
+	}
+	return time.Duration(archiveConfig.Retention) * time.Hour
+}
+
+// archiveMethod 图片/音视频本身已压缩，直接存储；其他文件使用Deflate
+func archiveMethod(contentType string) uint16 {
+	for _, prefix := range []string{"image/", "video/", "audio/"} {
+		if strings.HasPrefix(contentType, prefix) {
+			return zip.Store
+		}
+	}
+	return zip.Deflate
+}
+
+// uniqueStrings 去重并保持原有顺序
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		result = append(result, v)
+	}
+	return result
+}
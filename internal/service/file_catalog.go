@@ -0,0 +1,446 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/config"
+	"backend/internal/model"
+	"backend/internal/repo"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+)
+
+const (
+	defaultOutboxInterval    = 60 * time.Second
+	defaultOrphanGracePeriod = time.Hour
+	outboxBatchSize          = 100
+)
+
+// FileCatalogService 文件目录：以metadata表为准，维护与MinIO对象的一致性
+type FileCatalogService struct {
+	catalogRepo       *repo.FileCatalogRepository
+	metadataRepo      *repo.MetadataRepository
+	deviceRepo        *repo.DeviceRepository
+	deviceUserRepo    *repo.DeviceUserRepository
+	sensorDataRepo    *repo.SensorDataRepository
+	derivativeService *DerivativeService
+}
+
+func NewFileCatalogService() *FileCatalogService {
+	return &FileCatalogService{
+		catalogRepo:       repo.NewFileCatalogRepository(),
+		metadataRepo:      repo.NewMetadataRepository(),
+		deviceRepo:        repo.NewDeviceRepository(),
+		deviceUserRepo:    repo.NewDeviceUserRepository(),
+		sensorDataRepo:    repo.NewSensorDataRepository(),
+		derivativeService: NewDerivativeService(),
+	}
+}
+
+// SearchFiles 从文件目录中查询文件
+// 普通用户：指定dev_id时需要读权限，未指定时只返回有权限设备的文件
+// 管理员：可以查询所有文件
+func (s *FileCatalogService) SearchFiles(query *model.FileCatalogQuery, currentUID int64, role string) ([]*model.FileEntry, int64, error) {
+	var devIDs []int64
+	if role != model.RoleAdmin {
+		if query.DevID > 0 {
+			deviceUser, err := s.deviceUserRepo.GetDeviceUser(query.DevID, currentUID)
+			if err != nil {
+				return nil, 0, errors.New("您没有权限访问该设备的数据")
+			}
+			// 检查是否有读权限
+			if deviceUser.PermissionLevel != model.PermissionLevelRead &&
+				deviceUser.PermissionLevel != model.PermissionLevelReadWrite {
+				return nil, 0, errors.New("您没有读权限")
+			}
+		} else {
+			userDevIDs, err := s.deviceUserRepo.GetUserDeviceIDs(currentUID)
+			if err != nil {
+				return nil, 0, err
+			}
+			// 非nil表示限定设备范围（没有任何设备时返回空列表）
+			devIDs = append([]int64{}, userDevIDs...)
+		}
+	}
+
+	metadataList, total, err := s.catalogRepo.SearchFiles(query, devIDs)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entries := make([]*model.FileEntry, 0, len(metadataList))
+	for _, m := range metadataList {
+		entry := fileEntryFromMetadata(m)
+		entry.ThumbnailURL = s.derivativeService.ThumbnailURL(entry.BucketName, m.ExtraData)
+		entries = append(entries, entry)
+	}
+	return entries, total, nil
+}
+
+// ThumbnailURLs 批量获取文件的默认缩略图URL（没有缩略图的文件不返回）
+func (s *FileCatalogService) ThumbnailURLs(bucketName string, keys []string) (map[string]string, error) {
+	metadataByKey, err := s.catalogRepo.GetFileMetadataByKeys(bucketName, keys)
+	if err != nil {
+		return nil, err
+	}
+	urls := make(map[string]string, len(metadataByKey))
+	for key, m := range metadataByKey {
+		if url := s.derivativeService.ThumbnailURL(bucketName, m.ExtraData); url != "" {
+			urls[key] = url
+		}
+	}
+	return urls, nil
+}
+
+// DeleteFile 删除文件：事务内删除metadata并登记删除补偿记录（含派生文件），随后尝试删除MinIO对象
+// MinIO删除失败不影响返回结果，由补偿任务重试（权限由调用方检查）
+func (s *FileCatalogService) DeleteFile(bucketName, bucketKey string) error {
+	now := utils.GetCurrentTime()
+	outbox := &model.FileDeleteOutbox{
+		ID:         utils.GetDefaultSnowflake().Generate(),
+		BucketName: bucketName,
+		BucketKey:  bucketKey,
+		Status:     model.FileOutboxStatusPending,
+		CreateAt:   now,
+		UpdateAt:   now,
+	}
+	outboxes, err := s.catalogRepo.DeleteFileWithOutbox(outbox)
+	if err != nil {
+		return fmt.Errorf("删除文件元数据失败: %v", err)
+	}
+
+	for _, o := range outboxes {
+		s.processOutboxEntry(o)
+	}
+	return nil
+}
+
+// ProcessOutbox 处理待删除的MinIO对象，返回本轮成功数量
+func (s *FileCatalogService) ProcessOutbox() (int, error) {
+	entries, err := s.catalogRepo.GetPendingOutbox(outboxBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	done := 0
+	for _, e := range entries {
+		if s.processOutboxEntry(e) {
+			done++
+		}
+	}
+	return done, nil
+}
+
+// processOutboxEntry 删除单个对象并更新补偿记录，超过最大重试次数标记为failed
+func (s *FileCatalogService) processOutboxEntry(e *model.FileDeleteOutbox) bool {
+	now := utils.GetCurrentTime()
+	err := s.sensorDataRepo.DeleteObject(e.BucketName, e.BucketKey)
+	if err == nil {
+		if err := s.catalogRepo.UpdateOutboxStatus(e.ID, model.FileOutboxStatusDone, e.Attempts+1, "", now); err != nil {
+			logger.L().Warn("更新删除补偿记录失败", logger.WithError(err), logger.WithInt64("id", e.ID))
+		}
+		return true
+	}
+
+	attempts := e.Attempts + 1
+	status := model.FileOutboxStatusPending
+	if attempts >= model.MaxFileOutboxAttempts {
+		status = model.FileOutboxStatusFailed
+		logger.L().Error("删除MinIO对象多次失败，需要人工处理", logger.WithError(err),
+			logger.WithString("bucket_name", e.BucketName), logger.WithString("bucket_key", e.BucketKey))
+	} else {
+		logger.L().Warn("删除MinIO对象失败，稍后重试", logger.WithError(err),
+			logger.WithString("bucket_name", e.BucketName), logger.WithString("bucket_key", e.BucketKey))
+	}
+	if err := s.catalogRepo.UpdateOutboxStatus(e.ID, status, attempts, err.Error(), now); err != nil {
+		logger.L().Warn("更新删除补偿记录失败", logger.WithError(err), logger.WithInt64("id", e.ID))
+	}
+	return false
+}
+
+// Reconcile 对账：找出MinIO中没有metadata的对象，以及对象已丢失的metadata
+// fix=true时为孤立对象补建metadata（能从key中解析出已存在的设备时），并删除孤立metadata
+// 最近 grace 时间内修改的对象不视为孤立对象（可能仍在上传确认流程中），grace为负数时使用默认宽限期，为0时不跳过
+func (s *FileCatalogService) Reconcile(bucketName string, devID int64, fix bool, grace time.Duration) (*model.ReconcileReport, error) {
+	if bucketName == "" {
+		return nil, errors.New("bucket_name不能为空")
+	}
+	if grace < 0 {
+		grace = defaultOrphanGracePeriod
+	}
+
+	report := &model.ReconcileReport{
+		BucketName:        bucketName,
+		DevID:             model.Int64ToID(devID),
+		OrphanObjects:     []string{},
+		OrphanMetadata:    []model.OrphanMetadata{},
+		OrphanDerivatives: []string{},
+		Fixed:             fix,
+		StartedAt:         utils.GetCurrentTime(),
+	}
+
+	metadataKeys, err := s.catalogRepo.GetFileMetadataKeys(bucketName, devID)
+	if err != nil {
+		return nil, fmt.Errorf("查询文件元数据失败: %v", err)
+	}
+	report.ScannedMetadata = len(metadataKeys)
+
+	pendingDeletes, err := s.catalogRepo.GetPendingOutboxKeys(bucketName)
+	if err != nil {
+		return nil, fmt.Errorf("查询删除补偿记录失败: %v", err)
+	}
+
+	prefix := ""
+	if devID > 0 {
+		prefix = fmt.Sprintf("%d/", devID)
+	}
+	cutoff := report.StartedAt.Add(-grace)
+	seen := make(map[string]bool, len(metadataKeys))
+	type orphanObject struct {
+		key          string
+		size         int64
+		contentType  string
+		lastModified time.Time
+	}
+	var orphans []orphanObject
+	var orphanDerivatives []string
+
+	err = s.catalogRepo.WalkObjects(bucketName, prefix, func(key string, size int64, contentType string, lastModified time.Time) {
+		report.ScannedObjects++
+		if _, ok := metadataKeys[key]; ok {
+			seen[key] = true
+			return
+		}
+		if pendingDeletes[key] || lastModified.After(cutoff) {
+			return
+		}
+		// 派生文件以原始文件的metadata为准，原始文件已没有metadata时视为孤立派生文件
+		if sourceKey, ok := derivativeSourceKey(key); ok {
+			if _, exists := metadataKeys[sourceKey]; !exists {
+				orphanDerivatives = append(orphanDerivatives, key)
+			}
+			return
+		}
+		orphans = append(orphans, orphanObject{key, size, contentType, lastModified})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("列举MinIO对象失败: %v", err)
+	}
+	if devID > 0 {
+		// 指定设备时派生文件不在 dev_id/ 前缀下，单独遍历
+		err = s.catalogRepo.WalkObjects(bucketName, model.DerivativePrefix+prefix, func(key string, size int64, contentType string, lastModified time.Time) {
+			report.ScannedObjects++
+			if pendingDeletes[key] || lastModified.After(cutoff) {
+				return
+			}
+			if sourceKey, ok := derivativeSourceKey(key); ok {
+				if _, exists := metadataKeys[sourceKey]; !exists {
+					orphanDerivatives = append(orphanDerivatives, key)
+				}
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("列举MinIO对象失败: %v", err)
+		}
+	}
+
+	for _, key := range orphanDerivatives {
+		report.OrphanDerivatives = append(report.OrphanDerivatives, key)
+		if !fix {
+			continue
+		}
+		if err := s.sensorDataRepo.DeleteObject(bucketName, key); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", key, err))
+			continue
+		}
+		report.RemovedDerivatives++
+	}
+
+	for _, o := range orphans {
+		report.OrphanObjects = append(report.OrphanObjects, o.key)
+		if !fix {
+			continue
+		}
+		if err := s.adoptObject(bucketName, o.key, o.size, o.contentType, o.lastModified); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", o.key, err))
+			continue
+		}
+		report.AdoptedObjects++
+	}
+
+	for key, m := range metadataKeys {
+		if seen[key] {
+			continue
+		}
+		report.OrphanMetadata = append(report.OrphanMetadata, m)
+		if !fix {
+			continue
+		}
+		if err := s.metadataRepo.DeleteMetadata(m.DataID); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("data_id=%d: %v", m.DataID, err))
+			continue
+		}
+		report.RemovedMetadata++
+	}
+
+	report.FinishedAt = utils.GetCurrentTime()
+	return report, nil
+}
+
+// adoptObject 为孤立对象补建metadata（对象key需为 dev_id/... 且设备存在）
+func (s *FileCatalogService) adoptObject(bucketName, key string, size int64, contentType string, lastModified time.Time) error {
+	parts := strings.SplitN(key, "/", 2)
+	if len(parts) < 2 {
+		return errors.New("无法从key中解析设备ID")
+	}
+	devID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return errors.New("无法从key中解析设备ID")
+	}
+	if _, err := s.deviceRepo.GetDevice(devID); err != nil {
+		return errors.New("设备不存在")
+	}
+	if contentType == "" {
+		contentType = getContentTypeByFilePath(key)
+	}
+
+	metadata := &model.Metadata{
+		DataID:   utils.GetDefaultSnowflake().Generate(),
+		DevID:    model.Int64ToID(devID),
+		DataType: model.DataTypeFileData,
+		ExtraData: map[string]interface{}{
+			"bucket_name":  bucketName,
+			"bucket_key":   key,
+			"filename":     path.Base(key),
+			"content_type": contentType,
+			"size":         size,
+			"source":       "reconcile",
+		},
+		Timestamp: lastModified,
+	}
+	if err := s.metadataRepo.CreateMetadata(metadata); err != nil {
+		return err
+	}
+
+	s.derivativeService.GenerateAsync(metadata.DataID, bucketName, key, contentType)
+	return nil
+}
+
+// Start 启动后台任务：定时重试删除补偿记录、定时对账（ctx取消后退出）
+func (s *FileCatalogService) Start(ctx context.Context, cfg config.FileCatalogConfig) {
+	outboxInterval := time.Duration(cfg.OutboxInterval) * time.Second
+	if outboxInterval <= 0 {
+		outboxInterval = defaultOutboxInterval
+	}
+	grace := time.Duration(cfg.OrphanGracePeriod) * time.Minute
+	if grace <= 0 {
+		grace = defaultOrphanGracePeriod
+	}
+
+	go func() {
+		ticker := time.NewTicker(outboxInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := s.ProcessOutbox(); err != nil {
+					logger.L().Warn("处理删除补偿记录失败", logger.WithError(err))
+				}
+			}
+		}
+	}()
+
+	if cfg.ReconcileInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.ReconcileInterval) * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for _, bucketName := range repo.FileBuckets() {
+					report, err := s.Reconcile(bucketName, 0, cfg.ReconcileAutoFix, grace)
+					if err != nil {
+						logger.L().Warn("文件对账失败", logger.WithError(err), logger.WithString("bucket_name", bucketName))
+						continue
+					}
+					if len(report.OrphanObjects) > 0 || len(report.OrphanMetadata) > 0 || len(report.OrphanDerivatives) > 0 {
+						logger.L().Warn("文件对账发现不一致",
+							logger.WithString("bucket_name", bucketName),
+							logger.WithInt("orphan_objects", len(report.OrphanObjects)),
+							logger.WithInt("orphan_metadata", len(report.OrphanMetadata)),
+							logger.WithInt("orphan_derivatives", len(report.OrphanDerivatives)),
+							logger.WithInt("adopted_objects", report.AdoptedObjects),
+							logger.WithInt("removed_metadata", report.RemovedMetadata))
+					}
+				}
+			}
+		}
+	}()
+}
+
+// ListDeviceFiles 从metadata按bucket_key升序列出设备在bucket中key在(startAfter, endBefore)内的文件
+// keep 用于过滤不符合条件的key（可为nil），返回本页文件以及是否还有更多数据
+func (s *FileCatalogService) ListDeviceFiles(bucketName string, devID int64, startAfter, endBefore string, limit int,
+	keep func(key string) bool) ([]model.FileList, bool, error) {
+	files := make([]model.FileList, 0, limit)
+	cursor := startAfter
+	for {
+		batch, err := s.catalogRepo.ListDeviceFilesAfterKey(bucketName, devID, cursor, endBefore, limit+1)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, m := range batch {
+			entry := fileEntryFromMetadata(m)
+			cursor = entry.BucketKey
+			if keep != nil && !keep(entry.BucketKey) {
+				continue
+			}
+			if len(files) == limit {
+				return files, true, nil
+			}
+			files = append(files, model.FileList{
+				BucketKey:    entry.BucketKey,
+				Name:         entry.BucketKey,
+				ContentType:  entry.ContentType,
+				LastModified: entry.Timestamp.Format(time.RFC3339),
+				Size:         entry.Size,
+			})
+		}
+		if len(batch) <= limit {
+			return files, false, nil
+		}
+	}
+}
+
+// fileEntryFromMetadata 将文件metadata转换为目录条目
+func fileEntryFromMetadata(m *model.Metadata) *model.FileEntry {
+	entry := &model.FileEntry{
+		DataID:       m.DataID,
+		DevID:        m.DevID,
+		QualityScore: m.QualityScore,
+		ExtraData:    m.ExtraData,
+		Timestamp:    m.Timestamp,
+	}
+	if m.ExtraData != nil {
+		entry.BucketName, _ = m.ExtraData["bucket_name"].(string)
+		entry.BucketKey, _ = m.ExtraData["bucket_key"].(string)
+		entry.Filename, _ = m.ExtraData["filename"].(string)
+		entry.ContentType, _ = m.ExtraData["content_type"].(string)
+		if size, err := utils.ConvertToInt64(m.ExtraData["size"]); err == nil {
+			entry.Size = size
+		}
+	}
+	return entry
+}
@@ -0,0 +1,428 @@
+package service
+
+import (
+	"backend/config"
+	"backend/internal/model"
+	"backend/internal/repo"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	FirmwareUploadURLExpiry   = 30 * time.Minute // 固件上传URL有效期
+	FirmwareDownloadURLExpiry = 15 * time.Minute // 固件下载URL有效期
+)
+
+// firmwarePublicKey 固件签名公钥（ConfigureFirmware时从配置加载），为空时不接受带签名的固件
+var firmwarePublicKey ed25519.PublicKey
+
+// ConfigureFirmware 加载固件签名公钥（在服务启动时调用）
+func ConfigureFirmware(cfg config.FirmwareConfig) error {
+	if cfg.PublicKey == "" {
+		firmwarePublicKey = nil
+		return nil
+	}
+	key, err := base64.StdEncoding.DecodeString(cfg.PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return errors.New("固件签名公钥必须是base64编码的Ed25519公钥")
+	}
+	firmwarePublicKey = ed25519.PublicKey(key)
+	return nil
+}
+
+type FirmwareService struct {
+	firmwareRepo *repo.FirmwareRepository
+	deviceRepo   *repo.DeviceRepository
+}
+
+func NewFirmwareService() *FirmwareService {
+	return &FirmwareService{
+		firmwareRepo: repo.NewFirmwareRepository(),
+		deviceRepo:   repo.NewDeviceRepository(),
+	}
+}
+
+// CreateFirmware 创建固件版本并返回上传URL（仅管理员）
+func (s *FirmwareService) CreateFirmware(req *model.CreateFirmwareReq, currentUID int64) (map[string]any, error) {
+	// 配置了公钥时每个固件都必须带签名；未配置时无法校验，不接受签名以免下发未经校验的签名
+	if firmwarePublicKey != nil && req.Signature == "" {
+		return nil, errors.New("固件签名不能为空")
+	}
+	if firmwarePublicKey == nil && req.Signature != "" {
+		return nil, errors.New("未配置固件签名公钥，无法校验签名")
+	}
+
+	fw := &model.Firmware{
+		FwID:        utils.GetDefaultSnowflake().Generate(),
+		DevType:     req.DevType,
+		Model:       req.Model,
+		Version:     req.Version,
+		Checksum:    strings.ToLower(req.Checksum),
+		Signature:   req.Signature,
+		ReleaseNote: req.ReleaseNote,
+		Status:      model.FirmwareStatusUploading,
+		CreateBy:    currentUID,
+		CreateAt:    utils.GetCurrentTime(),
+	}
+
+	// object key 格式: dev_type/model/version/filename（model为空时使用_all）
+	modelDir := fw.Model
+	if modelDir == "" {
+		modelDir = "_all"
+	}
+	fw.BucketKey = fmt.Sprintf("%s/%s/%s/%s", fw.DevType, modelDir, fw.Version, filepath.Base(req.Filename))
+
+	// 上传URL已过期仍未确认的同版本固件视为放弃，删除后允许重新创建
+	if err := s.deleteExpiredUpload(fw); err != nil {
+		return nil, err
+	}
+
+	if err := s.firmwareRepo.CreateFirmware(fw); err != nil {
+		if strings.Contains(err.Error(), "Duplicate entry") {
+			return nil, errors.New("该设备类型/型号下已存在相同版本的固件")
+		}
+		return nil, err
+	}
+
+	uploadURL, err := s.firmwareRepo.PresignedPutFirmware(fw.BucketKey, FirmwareUploadURLExpiry)
+	if err != nil {
+		// 删除未能下发上传URL的记录，否则该版本会一直停留在uploading状态
+		if delErr := s.firmwareRepo.DeleteFirmware(fw.FwID); delErr != nil {
+			logger.L().Warn("删除未上传的固件记录失败", logger.WithInt64("fw_id", fw.FwID), logger.WithError(delErr))
+		}
+		return nil, fmt.Errorf("生成固件上传URL失败: %v", err)
+	}
+
+	return map[string]any{
+		"firmware":      fw,
+		"upload_url":    uploadURL,
+		"upload_method": "PUT",
+		"expires_in":    int(FirmwareUploadURLExpiry.Seconds()),
+	}, nil
+}
+
+// deleteExpiredUpload 删除同一设备类型/型号/版本下上传URL已过期仍处于uploading状态的固件
+func (s *FirmwareService) deleteExpiredUpload(fw *model.Firmware) error {
+	expired, err := s.firmwareRepo.GetExpiredUpload(fw.DevType, fw.Model, fw.Version, fw.CreateAt.Add(-FirmwareUploadURLExpiry))
+	if err != nil || expired == nil {
+		return err
+	}
+	if err := s.firmwareRepo.DeleteFirmware(expired.FwID); err != nil {
+		return err
+	}
+	if expired.BucketKey != fw.BucketKey {
+		s.firmwareRepo.DeleteFirmwareObject(expired.BucketKey)
+	}
+	return nil
+}
+
+// ConfirmFirmware 确认固件上传完成：计算SHA-256与声明的checksum比对，配置了签名公钥时校验签名，通过后标记为ready（仅管理员）
+func (s *FirmwareService) ConfirmFirmware(fwID int64) (*model.Firmware, error) {
+	fw, err := s.firmwareRepo.GetFirmware(fwID)
+	if err != nil {
+		return nil, err
+	}
+	if fw.Status == model.FirmwareStatusReady {
+		return fw, nil
+	}
+
+	obj, err := s.firmwareRepo.OpenFirmware(fw.BucketKey)
+	if err != nil {
+		return nil, fmt.Errorf("固件文件未找到，请确认是否上传成功: %v", err)
+	}
+	defer obj.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, obj)
+	if err != nil {
+		return nil, fmt.Errorf("读取固件文件失败，请确认是否上传成功: %v", err)
+	}
+	digest := hasher.Sum(nil)
+	checksum := hex.EncodeToString(digest)
+	if checksum != fw.Checksum {
+		return nil, fmt.Errorf("固件校验失败: 期望SHA-256为%s，实际为%s", fw.Checksum, checksum)
+	}
+	if err := verifyFirmwareSignature(fw.Signature, digest); err != nil {
+		return nil, err
+	}
+
+	if err := s.firmwareRepo.UpdateFirmwareStatus(fwID, model.FirmwareStatusReady, size); err != nil {
+		return nil, err
+	}
+	fw.Status = model.FirmwareStatusReady
+	fw.Size = size
+	return fw, nil
+}
+
+// GetFirmwares 获取固件版本列表
+func (s *FirmwareService) GetFirmwares(devType, devModel string, page, pageSize int) ([]*model.Firmware, int64, error) {
+	return s.firmwareRepo.GetFirmwares(devType, devModel, page, pageSize)
+}
+
+// DeleteFirmware 删除固件版本及其文件（仅管理员）
+func (s *FirmwareService) DeleteFirmware(fwID int64) error {
+	fw, err := s.firmwareRepo.GetFirmware(fwID)
+	if err != nil {
+		return err
+	}
+	if err := s.firmwareRepo.DeleteFirmware(fwID); err != nil {
+		return err
+	}
+	// 文件删除失败不影响结果（数据库记录已删除，设备不会再获取到该固件）
+	s.firmwareRepo.DeleteFirmwareObject(fw.BucketKey)
+	return nil
+}
+
+// CreateRollout 创建灰度发布（仅管理员）
+func (s *FirmwareService) CreateRollout(req *model.CreateRolloutReq, currentUID int64) (*model.FirmwareRollout, error) {
+	fw, err := s.firmwareRepo.GetFirmware(req.FwID)
+	if err != nil {
+		return nil, err
+	}
+	if fw.Status != model.FirmwareStatusReady {
+		return nil, errors.New("固件尚未上传或未通过校验")
+	}
+	if req.Strategy == model.RolloutStrategyDeviceList && len(req.DevIDs) == 0 {
+		return nil, errors.New("strategy为device_list时dev_ids不能为空")
+	}
+
+	now := utils.GetCurrentTime()
+	rollout := &model.FirmwareRollout{
+		RolloutID:  utils.GetDefaultSnowflake().Generate(),
+		FwID:       req.FwID,
+		Strategy:   req.Strategy,
+		Percentage: req.Percentage,
+		DevIDs:     req.DevIDs,
+		Status:     model.RolloutStatusActive,
+		CreateBy:   currentUID,
+		CreateAt:   now,
+		UpdateAt:   now,
+	}
+	if rollout.Strategy == model.RolloutStrategyDeviceList {
+		rollout.Percentage = 0
+	} else {
+		rollout.DevIDs = []model.DeviceID{}
+	}
+
+	if err := s.firmwareRepo.CreateRollout(rollout); err != nil {
+		return nil, err
+	}
+	return rollout, nil
+}
+
+// UpdateRollout 调整灰度比例或暂停/恢复/结束灰度发布（仅管理员）
+func (s *FirmwareService) UpdateRollout(req *model.UpdateRolloutReq) (*model.FirmwareRollout, error) {
+	rollout, err := s.firmwareRepo.GetRollout(req.RolloutID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Status != "" {
+		rollout.Status = req.Status
+	}
+	if req.Percentage != nil {
+		if rollout.Strategy != model.RolloutStrategyPercentage {
+			return nil, errors.New("只有strategy为percentage的灰度发布可以调整比例")
+		}
+		rollout.Percentage = *req.Percentage
+	}
+	rollout.UpdateAt = utils.GetCurrentTime()
+
+	if err := s.firmwareRepo.UpdateRollout(rollout); err != nil {
+		return nil, err
+	}
+	if err := s.completeIfDone(rollout); err != nil {
+		logger.L().Warn("检查灰度发布是否完成失败", logger.WithInt64("rollout_id", rollout.RolloutID), logger.WithError(err))
+	}
+	return rollout, nil
+}
+
+// GetRolloutProgress 获取灰度发布进度（按设备上报的version统计）
+func (s *FirmwareService) GetRolloutProgress(rolloutID int64) (*model.RolloutProgress, error) {
+	rollout, err := s.firmwareRepo.GetRollout(rolloutID)
+	if err != nil {
+		return nil, err
+	}
+	fw, err := s.firmwareRepo.GetFirmware(rollout.FwID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.rolloutProgress(rollout, fw)
+}
+
+// rolloutProgress 统计灰度发布命中设备的升级进度
+func (s *FirmwareService) rolloutProgress(rollout *model.FirmwareRollout, fw *model.Firmware) (*model.RolloutProgress, error) {
+	devices, err := s.firmwareRepo.GetDeviceVersions(fw.DevType, fw.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	progress := &model.RolloutProgress{RolloutID: rollout.RolloutID, Version: fw.Version, Status: rollout.Status}
+	for _, dev := range devices {
+		if !isDeviceInRollout(rollout, dev.DevID) {
+			continue
+		}
+		progress.Targeted++
+		if utils.CompareVersion(dev.Version, fw.Version) >= 0 {
+			progress.Updated++
+		}
+	}
+	progress.Pending = progress.Targeted - progress.Updated
+	if progress.Targeted > 0 {
+		progress.Percent = float64(progress.Updated) * 100 / float64(progress.Targeted)
+	}
+	return progress, nil
+}
+
+// completeIfDone 全部命中设备已升级时结束灰度（仅对全量发布生效，避免部分比例时提前结束）
+// 在设备上报版本与调整灰度时调用，查询进度不修改灰度状态
+func (s *FirmwareService) completeIfDone(rollout *model.FirmwareRollout) error {
+	if rollout.Status != model.RolloutStatusActive ||
+		(rollout.Strategy != model.RolloutStrategyDeviceList && rollout.Percentage != 100) {
+		return nil
+	}
+	fw, err := s.firmwareRepo.GetFirmware(rollout.FwID)
+	if err != nil {
+		return err
+	}
+	progress, err := s.rolloutProgress(rollout, fw)
+	if err != nil {
+		return err
+	}
+	if progress.Targeted == 0 || progress.Pending > 0 {
+		return nil
+	}
+	rollout.Status = model.RolloutStatusCompleted
+	rollout.UpdateAt = utils.GetCurrentTime()
+	return s.firmwareRepo.UpdateRollout(rollout)
+}
+
+// CheckUpdate 设备检查固件更新，有可用更新时返回预签名下载URL
+func (s *FirmwareService) CheckUpdate(devID int64) (map[string]any, error) {
+	device, err := s.deviceRepo.GetDevice(devID)
+	if err != nil {
+		return nil, errors.New("设备不存在")
+	}
+
+	rollouts, err := s.firmwareRepo.GetActiveRollouts(device.DevType, device.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	// 选择命中灰度且版本高于当前版本的最新固件
+	var target *model.Firmware
+	for _, rollout := range rollouts {
+		if !isDeviceInRollout(rollout, devID) {
+			continue
+		}
+		fw, err := s.firmwareRepo.GetFirmware(rollout.FwID)
+		if err != nil {
+			continue
+		}
+		if utils.CompareVersion(fw.Version, device.Version) <= 0 {
+			continue
+		}
+		if target == nil || utils.CompareVersion(fw.Version, target.Version) > 0 {
+			target = fw
+		}
+	}
+
+	if target == nil {
+		return map[string]any{
+			"update_available": false,
+			"current_version":  device.Version,
+		}, nil
+	}
+
+	downloadURL, err := s.firmwareRepo.PresignedGetFirmware(target.BucketKey, FirmwareDownloadURLExpiry)
+	if err != nil {
+		return nil, fmt.Errorf("生成固件下载URL失败: %v", err)
+	}
+
+	return map[string]any{
+		"update_available": true,
+		"current_version":  device.Version,
+		"fw_id":            target.FwID,
+		"version":          target.Version,
+		"size":             target.Size,
+		"checksum":         target.Checksum,
+		"signature":        target.Signature,
+		"release_note":     target.ReleaseNote,
+		"download_url":     downloadURL,
+		"expires_in":       int(FirmwareDownloadURLExpiry.Seconds()),
+	}, nil
+}
+
+// ReportVersion 设备上报当前固件版本
+func (s *FirmwareService) ReportVersion(devID int64, version string) error {
+	device, err := s.deviceRepo.GetDevice(devID)
+	if err != nil {
+		return errors.New("设备不存在")
+	}
+	if err := s.firmwareRepo.UpdateDeviceVersion(devID, version, utils.GetCurrentTime()); err != nil {
+		return err
+	}
+
+	// 设备升级到灰度版本时检查该灰度是否已全部完成，失败不影响上报结果
+	rollouts, err := s.firmwareRepo.GetActiveRollouts(device.DevType, device.Model)
+	if err != nil {
+		logger.L().Warn("获取进行中的灰度发布失败", logger.WithInt64("dev_id", devID), logger.WithError(err))
+		return nil
+	}
+	for _, rollout := range rollouts {
+		if !isDeviceInRollout(rollout, devID) {
+			continue
+		}
+		if err := s.completeIfDone(rollout); err != nil {
+			logger.L().Warn("检查灰度发布是否完成失败", logger.WithInt64("rollout_id", rollout.RolloutID), logger.WithError(err))
+		}
+	}
+	return nil
+}
+
+// verifyFirmwareSignature 校验固件签名：base64编码的Ed25519签名，签名内容为固件的SHA-256摘要（32字节）
+func verifyFirmwareSignature(signature string, digest []byte) error {
+	if firmwarePublicKey == nil {
+		if signature != "" {
+			return errors.New("未配置固件签名公钥，无法校验签名")
+		}
+		return nil
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || !ed25519.Verify(firmwarePublicKey, digest, sig) {
+		return errors.New("固件签名校验失败")
+	}
+	return nil
+}
+
+// isDeviceInRollout 判断设备是否命中灰度发布
+// percentage策略按 (rollout_id, dev_id) 的哈希值分桶，保证同一设备在比例调大时始终保持命中
+func isDeviceInRollout(rollout *model.FirmwareRollout, devID int64) bool {
+	switch rollout.Strategy {
+	case model.RolloutStrategyDeviceList:
+		for _, id := range rollout.DevIDs {
+			if id.Int64() == devID {
+				return true
+			}
+		}
+		return false
+	case model.RolloutStrategyPercentage:
+		h := fnv.New32a()
+		fmt.Fprintf(h, "%d:%d", rollout.RolloutID, devID)
+		return int(h.Sum32()%100) < rollout.Percentage
+	default:
+		return false
+	}
+}
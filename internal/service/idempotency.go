@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"backend/config"
+	"backend/internal/model"
+	"backend/internal/repo"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+)
+
+const (
+	defaultIdempotencyTTL             = 24 * time.Hour
+	defaultIdempotencyWaitTimeout     = 10 * time.Second
+	defaultIdempotencyCleanupInterval = time.Hour
+	defaultIdempotencyLease           = 60 * time.Second
+	idempotencyPollInterval           = 100 * time.Millisecond
+	idempotencyCleanupBatchSize       = 1000
+	// MaxIdempotentResponseSize 保存的响应最大字节数，更大的响应不保存（同一幂等键可重新执行）
+	MaxIdempotentResponseSize = 1 << 20
+	// MaxIdempotentRequestSize 携带幂等键的请求体最大字节数（需读入内存计算请求摘要）
+	MaxIdempotentRequestSize = 32 << 20
+)
+
+var (
+	ErrIdempotencyKeyMismatch = errors.New("幂等键已用于不同的请求")
+	ErrIdempotencyInProgress  = errors.New("相同幂等键的请求正在处理，请稍后重试")
+)
+
+// idempotencyConfig 幂等键配置（Start时从配置加载）
+var idempotencyConfig config.IdempotencyConfig
+
+// IdempotencyService 幂等键：保存同一调用方同一幂等键首次请求的响应，重复请求直接返回保存的响应
+type IdempotencyService struct {
+	idempotencyRepo *repo.IdempotencyRepository
+}
+
+func NewIdempotencyService() *IdempotencyService {
+	return &IdempotencyService{
+		idempotencyRepo: repo.NewIdempotencyRepository(),
+	}
+}
+
+// Begin 开始处理带幂等键的请求
+// 返回nil表示已占用幂等键，由本次请求处理；返回记录表示重复请求，应直接返回保存的响应
+// 相同幂等键的请求正在处理时等待其完成（最多wait_timeout），请求内容不同时返回 ErrIdempotencyKeyMismatch
+func (s *IdempotencyService) Begin(scope, key, method, path, requestHash string) (*model.IdempotencyRecord, error) {
+	deadline := utils.GetCurrentTime().Add(idempotencyWaitTimeout())
+	for {
+		now := utils.GetCurrentTime()
+		rec := &model.IdempotencyRecord{
+			Scope:       scope,
+			Key:         key,
+			Method:      method,
+			Path:        path,
+			RequestHash: requestHash,
+			CreateAt:    now,
+			LockedUntil: now.Add(idempotencyLease()),
+			ExpireAt:    now.Add(idempotencyTTL()),
+		}
+		reserved, err := s.idempotencyRepo.Reserve(rec)
+		if err != nil {
+			return nil, err
+		}
+		if reserved {
+			return nil, nil
+		}
+
+		existing, err := s.idempotencyRepo.Get(scope, key)
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			// 首次请求失败后已释放，重新占用
+			continue
+		}
+		if existing.RequestHash != requestHash {
+			return nil, ErrIdempotencyKeyMismatch
+		}
+		if existing.Status == model.IdempotencyStatusCompleted {
+			return existing, nil
+		}
+		if now.After(deadline) {
+			return nil, ErrIdempotencyInProgress
+		}
+		time.Sleep(idempotencyPollInterval)
+	}
+}
+
+// Hold 处理请求期间定期续期处理租约，返回停止续期的函数（在Finish之前调用）
+func (s *IdempotencyService) Hold(scope, key string) (stop func()) {
+	lease := idempotencyLease()
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := s.idempotencyRepo.Renew(scope, key, utils.GetCurrentTime().Add(lease)); err != nil {
+					logger.L().Warn("续期幂等键处理租约失败", logger.WithError(err), logger.WithString("scope", scope))
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// Finish 保存首次请求的响应；服务端错误、限流或响应过大时释放幂等键，允许客户端重试
+func (s *IdempotencyService) Finish(scope, key string, code int, contentType string, body []byte) error {
+	if code >= http.StatusInternalServerError || code == http.StatusTooManyRequests || len(body) > MaxIdempotentResponseSize {
+		return s.idempotencyRepo.Release(scope, key)
+	}
+	return s.idempotencyRepo.Complete(scope, key, code, contentType, body)
+}
+
+// Start 加载配置并启动过期记录清理任务（ctx取消后退出）
+func (s *IdempotencyService) Start(ctx context.Context, cfg config.IdempotencyConfig) {
+	idempotencyConfig = cfg
+	interval := time.Duration(cfg.CleanupInterval) * time.Minute
+	if interval <= 0 {
+		interval = defaultIdempotencyCleanupInterval
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				deleted, err := s.idempotencyRepo.DeleteExpired(utils.GetCurrentTime(), idempotencyCleanupBatchSize)
+				if err != nil {
+					logger.L().Warn("清理过期幂等键失败", logger.WithError(err))
+					continue
+				}
+				if deleted > 0 {
+					logger.L().Info("清理过期幂等键", logger.WithInt64("deleted", deleted))
+				}
+			}
+		}
+	}()
+}
+
+func idempotencyTTL() time.Duration {
+	if idempotencyConfig.TTL <= 0 {
+		return defaultIdempotencyTTL
+	}
+	return time.Duration(idempotencyConfig.TTL) * time.Hour
+}
+
+func idempotencyLease() time.Duration {
+	if idempotencyConfig.ProcessingLease <= 0 {
+		return defaultIdempotencyLease
+	}
+	return time.Duration(idempotencyConfig.ProcessingLease) * time.Second
+}
+
+func idempotencyWaitTimeout() time.Duration {
+	if idempotencyConfig.WaitTimeout <= 0 {
+		return defaultIdempotencyWaitTimeout
+	}
+	return time.Duration(idempotencyConfig.WaitTimeout) * time.Second
+}
@@ -0,0 +1,324 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"backend/config"
+	"backend/internal/model"
+	"backend/internal/repo"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+)
+
+const (
+	defaultIngestQueueSize     = 10000
+	defaultIngestWorkers       = 2
+	defaultIngestBatchSize     = 5000
+	defaultIngestFlushInterval = time.Second
+	defaultIngestWALDir        = "data/ingest_wal"
+	defaultIngestWALMaxSize    = 1024 // MB
+	defaultIngestRetryInterval = 10 * time.Second
+)
+
+var (
+	ErrIngestQueueFull   = errors.New("写入队列已满，请稍后重试")
+	ErrIngestUnavailable = errors.New("时序数据库不可用且暂存空间已满，请稍后重试")
+)
+
+var (
+	// ingestConfig 写入管道配置（Start时从配置加载）
+	ingestConfig config.IngestConfig
+	// ingestQueue 写入队列，为nil表示写入管道未启动（同步写入）
+	ingestQueue chan *model.IngestJob
+	ingestWAL   *repo.IngestWALRepository
+	// ingestWALBytes WAL当前占用的字节数
+	ingestWALBytes atomic.Int64
+	// ingestInfluxDown 最近一次写入InfluxDB失败，新的批次直接写入WAL，由重放任务探测恢复
+	ingestInfluxDown atomic.Bool
+)
+
+// IngestService 时序数据异步写入管道：上传请求校验后进入队列，写入协程跨请求合并数据点批量写入InfluxDB，
+// InfluxDB不可用时整批暂存到磁盘WAL并定时重新写入；队列满时返回429，WAL满时返回503
+type IngestService struct {
+	outboxService  *SeriesOutboxService
+	schemaService  *MeasurementSchemaService
+	sensorDataRepo *repo.SensorDataRepository
+}
+
+func NewIngestService() *IngestService {
+	return &IngestService{
+		outboxService:  NewSeriesOutboxService(),
+		schemaService:  NewMeasurementSchemaService(),
+		sensorDataRepo: repo.NewSensorDataRepository(),
+	}
+}
+
+// Enabled 写入管道是否已启动
+func (s *IngestService) Enabled() bool {
+	return ingestQueue != nil
+}
+
+// Submit 记录写入意图并放入写入队列
+func (s *IngestService) Submit(metadata *model.Metadata, points []model.Point) error {
+	if ingestWALBytes.Load() >= ingestWALMaxBytes() {
+		return ErrIngestUnavailable
+	}
+	if len(ingestQueue) >= cap(ingestQueue) {
+		return ErrIngestQueueFull
+	}
+
+	if err := s.outboxService.RecordQueued(metadata, points); err != nil {
+		return err
+	}
+	select {
+	case ingestQueue <- &model.IngestJob{Metadata: metadata, Points: points}:
+		return nil
+	default:
+		if err := s.outboxService.Discard(metadata.DataID); err != nil {
+			logger.L().Warn("删除时序写入记录失败", logger.WithError(err), logger.WithInt64("data_id", metadata.DataID))
+		}
+		return ErrIngestQueueFull
+	}
+}
+
+// GetStats 获取写入管道状态
+func (s *IngestService) GetStats() (*model.IngestStats, error) {
+	stats := &model.IngestStats{
+		Workers:     ingestWorkers(),
+		WALBytes:    ingestWALBytes.Load(),
+		WALMaxBytes: ingestWALMaxBytes(),
+		InfluxDown:  ingestInfluxDown.Load(),
+	}
+	if ingestQueue != nil {
+		stats.QueueLength = len(ingestQueue)
+		stats.QueueCapacity = cap(ingestQueue)
+	}
+	if ingestWAL != nil {
+		segments, err := ingestWAL.List()
+		if err != nil {
+			return nil, err
+		}
+		stats.WALSegments = len(segments)
+	}
+	return stats, nil
+}
+
+// Start 加载配置，启动写入协程与WAL重放任务（ctx取消后退出）
+func (s *IngestService) Start(ctx context.Context, cfg config.IngestConfig) {
+	ingestConfig = cfg
+	walDir := cfg.WALDir
+	if walDir == "" {
+		walDir = defaultIngestWALDir
+	}
+	ingestWAL = repo.NewIngestWALRepository(walDir)
+
+	segments, err := ingestWAL.List()
+	if err != nil {
+		logger.L().Warn("读取写入WAL失败", logger.WithError(err), logger.WithString("dir", walDir))
+	}
+	var walBytes int64
+	for _, seg := range segments {
+		walBytes += seg.Size
+	}
+	ingestWALBytes.Store(walBytes)
+
+	// 上次运行时队列中未写入的记录交给补偿任务；数据仍在WAL中的记录保持queued，由重放任务完成，
+	// 避免补偿任务在InfluxDB不可用时将其补偿后，重放写入的数据没有metadata
+	if err == nil {
+		inWAL := make(map[int64]bool)
+		for _, seg := range segments {
+			batch, err := ingestWAL.Read(seg.Name)
+			if err != nil {
+				// 无法解析的文件在重放时删除，其中的记录交给补偿任务
+				continue
+			}
+			for _, job := range batch.Jobs {
+				if job.Metadata != nil {
+					inWAL[job.Metadata.DataID] = true
+				}
+			}
+		}
+		if released, err := s.outboxService.ReleaseExcept(inWAL); err != nil {
+			logger.L().Warn("处理未完成的写入队列记录失败", logger.WithError(err))
+		} else if released > 0 {
+			logger.L().Info("未完成的写入队列记录已交给补偿任务", logger.WithInt64("count", released))
+		}
+	}
+
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultIngestQueueSize
+	}
+	ingestQueue = make(chan *model.IngestJob, queueSize)
+	for i := 0; i < ingestWorkers(); i++ {
+		go s.worker(ctx)
+	}
+
+	go func() {
+		retryInterval := time.Duration(cfg.RetryInterval) * time.Second
+		if retryInterval <= 0 {
+			retryInterval = defaultIngestRetryInterval
+		}
+		ticker := time.NewTicker(retryInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.replayWAL()
+			}
+		}
+	}()
+}
+
+// worker 从队列中取出上传并合并，达到batch_size或flush_interval时写入
+func (s *IngestService) worker(ctx context.Context) {
+	flushInterval := time.Duration(ingestConfig.FlushInterval) * time.Millisecond
+	if flushInterval <= 0 {
+		flushInterval = defaultIngestFlushInterval
+	}
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var jobs []*model.IngestJob
+	points := 0
+	for {
+		select {
+		case <-ctx.Done():
+			if len(jobs) > 0 {
+				s.flush(jobs)
+			}
+			return
+		case job := <-ingestQueue:
+			jobs = append(jobs, job)
+			points += len(job.Points)
+			if points >= ingestBatchSize() {
+				s.flush(jobs)
+				jobs, points = nil, 0
+			}
+		case <-ticker.C:
+			if len(jobs) > 0 {
+				s.flush(jobs)
+				jobs, points = nil, 0
+			}
+		}
+	}
+}
+
+// flush 写入一批上传；InfluxDB不可用时写入WAL，WAL也无法写入时交给补偿任务
+func (s *IngestService) flush(jobs []*model.IngestJob) {
+	batch := &model.IngestBatch{Jobs: jobs, CreateAt: utils.GetCurrentTime()}
+	if !ingestInfluxDown.Load() {
+		err := s.writeBatch(batch)
+		if err == nil {
+			s.complete(batch)
+			return
+		}
+		ingestInfluxDown.Store(true)
+		logger.L().Warn("写入InfluxDB失败，数据暂存到WAL", logger.WithError(err), logger.WithInt("jobs", len(jobs)))
+	}
+
+	if ingestWALBytes.Load() < ingestWALMaxBytes() {
+		size, err := ingestWAL.Append(batch)
+		if err == nil {
+			ingestWALBytes.Add(size)
+			return
+		}
+		logger.L().Error("写入WAL失败", logger.WithError(err))
+	}
+
+	dataIDs := make([]int64, 0, len(jobs))
+	for _, job := range jobs {
+		dataIDs = append(dataIDs, job.Metadata.DataID)
+	}
+	if _, err := s.outboxService.Release(dataIDs); err != nil {
+		logger.L().Error("将写入交给补偿任务失败", logger.WithError(err), logger.WithInt("jobs", len(jobs)))
+	}
+}
+
+// replayWAL 按写入顺序重新写入WAL中的批次，遇到失败时停止，等待下次重试
+func (s *IngestService) replayWAL() {
+	segments, err := ingestWAL.List()
+	if err != nil {
+		logger.L().Warn("读取写入WAL失败", logger.WithError(err))
+		return
+	}
+	for _, seg := range segments {
+		batch, err := ingestWAL.Read(seg.Name)
+		if err == nil {
+			for _, job := range batch.Jobs {
+				s.schemaService.NormalizePoints(job.Points)
+			}
+			if err := s.writeBatch(batch); err != nil {
+				ingestInfluxDown.Store(true)
+				return
+			}
+			s.complete(batch)
+		} else {
+			// 无法解析的文件不会再成功，其中的记录在服务重启时交给补偿任务
+			logger.L().Error("WAL文件损坏，已删除", logger.WithError(err), logger.WithString("name", seg.Name))
+		}
+		if err := ingestWAL.Remove(seg.Name); err != nil {
+			logger.L().Warn("删除WAL文件失败", logger.WithError(err), logger.WithString("name", seg.Name))
+			return
+		}
+		ingestWALBytes.Add(-seg.Size)
+	}
+	if ingestInfluxDown.Swap(false) && len(segments) > 0 {
+		logger.L().Info("WAL中的数据已写入InfluxDB", logger.WithInt("segments", len(segments)))
+	}
+}
+
+// writeBatch 合并批次中的数据点，按batch_size分批写入
+func (s *IngestService) writeBatch(batch *model.IngestBatch) error {
+	batchSize := ingestBatchSize()
+	points := make([]model.Point, 0, batchSize)
+	for _, job := range batch.Jobs {
+		for _, p := range job.Points {
+			points = append(points, p)
+			if len(points) >= batchSize {
+				if err := s.sensorDataRepo.WriteSeriesBatch(points); err != nil {
+					return err
+				}
+				points = points[:0]
+			}
+		}
+	}
+	if len(points) > 0 {
+		return s.sensorDataRepo.WriteSeriesBatch(points)
+	}
+	return nil
+}
+
+// complete 批次写入成功后为每个上传创建metadata
+func (s *IngestService) complete(batch *model.IngestBatch) {
+	for _, job := range batch.Jobs {
+		s.outboxService.Complete(job.Metadata, job.Points)
+	}
+}
+
+func ingestWorkers() int {
+	if ingestConfig.Workers <= 0 {
+		return defaultIngestWorkers
+	}
+	return ingestConfig.Workers
+}
+
+func ingestBatchSize() int {
+	if ingestConfig.BatchSize <= 0 {
+		return defaultIngestBatchSize
+	}
+	return ingestConfig.BatchSize
+}
+
+func ingestWALMaxBytes() int64 {
+	size := ingestConfig.WALMaxSize
+	if size <= 0 {
+		size = defaultIngestWALMaxSize
+	}
+	return int64(size) << 20
+}
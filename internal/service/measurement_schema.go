@@ -0,0 +1,445 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"backend/internal/model"
+	"backend/internal/repo"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+)
+
+// 系统写入的tag/字段，不按schema校验
+var (
+	schemaSystemTags   = map[string]bool{"dev_id": true, "data_id": true, "quality_score": true}
+	schemaSystemFields = map[string]bool{"quality_score": true}
+)
+
+// SchemaValidationError 数据点不符合schema
+type SchemaValidationError struct {
+	Violations []model.SchemaViolation
+	Truncated  bool // 错误数量超过 model.MaxSchemaViolations，只返回前面的错误
+}
+
+func (e *SchemaValidationError) Error() string {
+	if len(e.Violations) == 0 {
+		return "时序数据不符合schema"
+	}
+	v := e.Violations[0]
+	name := v.Field
+	if name == "" {
+		name = v.Tag
+	}
+	return fmt.Sprintf("时序数据不符合schema: 第%d个数据点 %s: %s（共%d个错误）", v.Index, name, v.Message, len(e.Violations))
+}
+
+// MeasurementSchemaService 时序数据schema：按设备类型与measurement校验上传的字段与tag
+type MeasurementSchemaService struct {
+	schemaRepo *repo.MeasurementSchemaRepository
+	deviceRepo *repo.DeviceRepository
+}
+
+func NewMeasurementSchemaService() *MeasurementSchemaService {
+	return &MeasurementSchemaService{
+		schemaRepo: repo.NewMeasurementSchemaRepository(),
+		deviceRepo: repo.NewDeviceRepository(),
+	}
+}
+
+// CreateSchema 创建schema
+func (s *MeasurementSchemaService) CreateSchema(req *model.CreateMeasurementSchemaReq, currentUID int64) (*model.MeasurementSchema, error) {
+	tags := req.Tags
+	if tags == nil {
+		tags = make([]model.SchemaTag, 0)
+	}
+	if err := checkSchemaDefinition(req.Fields, tags); err != nil {
+		return nil, err
+	}
+
+	now := utils.GetCurrentTime()
+	schema := &model.MeasurementSchema{
+		SchemaID:    utils.GetDefaultSnowflake().Generate(),
+		DevType:     req.DevType,
+		Measurement: req.Measurement,
+		Description: req.Description,
+		Fields:      req.Fields,
+		Tags:        tags,
+		Strict:      req.Strict,
+		Coerce:      req.Coerce,
+		Version:     1,
+		CreateBy:    currentUID,
+		CreateAt:    now,
+		UpdateAt:    now,
+	}
+	if err := s.schemaRepo.CreateSchema(schema); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// GetSchemas 获取schema列表
+func (s *MeasurementSchemaService) GetSchemas(devType, measurement string) ([]*model.MeasurementSchema, error) {
+	return s.schemaRepo.ListSchemas(devType, measurement)
+}
+
+// GetDeviceSchemas 获取设备所属类型的schema列表
+func (s *MeasurementSchemaService) GetDeviceSchemas(devID int64, measurement string) ([]*model.MeasurementSchema, error) {
+	device, err := s.deviceRepo.GetDevice(devID)
+	if err != nil {
+		return nil, errors.New("设备不存在")
+	}
+	return s.schemaRepo.ListSchemas(device.DevType, measurement)
+}
+
+// UpdateSchema 更新schema
+func (s *MeasurementSchemaService) UpdateSchema(req *model.UpdateMeasurementSchemaReq) (*model.MeasurementSchema, error) {
+	schema, err := s.schemaRepo.GetSchema(req.SchemaID)
+	if err != nil {
+		return nil, err
+	}
+	if req.Description != nil {
+		schema.Description = *req.Description
+	}
+	if req.Fields != nil {
+		schema.Fields = req.Fields
+	}
+	if req.Tags != nil {
+		schema.Tags = req.Tags
+	}
+	if req.Strict != nil {
+		schema.Strict = *req.Strict
+	}
+	if req.Coerce != nil {
+		schema.Coerce = *req.Coerce
+	}
+	if err := checkSchemaDefinition(schema.Fields, schema.Tags); err != nil {
+		return nil, err
+	}
+	schema.Version++
+	schema.UpdateAt = utils.GetCurrentTime()
+
+	if err := s.schemaRepo.UpdateSchema(schema); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// DeleteSchema 删除schema（之后该measurement不再校验）
+func (s *MeasurementSchemaService) DeleteSchema(schemaID int64) error {
+	if _, err := s.schemaRepo.GetSchema(schemaID); err != nil {
+		return err
+	}
+	return s.schemaRepo.DeleteSchema(schemaID)
+}
+
+// ValidatePoints 按设备类型的schema校验并规范化数据点（coerce开启时转换字段值，int字段统一为int64）
+// 返回按measurement索引的schema；不符合schema时返回 *SchemaValidationError
+func (s *MeasurementSchemaService) ValidatePoints(devType string, points []model.Point) (map[string]*model.MeasurementSchema, error) {
+	schemas, err := s.schemaRepo.ListSchemas(devType, "")
+	if err != nil {
+		return nil, fmt.Errorf("获取schema失败: %v", err)
+	}
+	byMeasurement := make(map[string]*model.MeasurementSchema, len(schemas))
+	for _, schema := range schemas {
+		byMeasurement[schema.Measurement] = schema
+	}
+
+	verr := &SchemaValidationError{}
+	for i := range points {
+		schema, ok := byMeasurement[points[i].Measurement]
+		if !ok {
+			continue
+		}
+		for _, v := range validatePoint(schema, &points[i]) {
+			if len(verr.Violations) >= model.MaxSchemaViolations {
+				verr.Truncated = true
+				break
+			}
+			v.Index = i
+			verr.Violations = append(verr.Violations, v)
+		}
+	}
+	if len(verr.Violations) > 0 {
+		return byMeasurement, verr
+	}
+	return byMeasurement, nil
+}
+
+// NormalizePoints 按schema恢复字段类型（JSON中转后整数变为浮点数），用于重新写入WAL或补偿记录中的数据点
+// 按数据点的dev_id tag查找设备类型，查找失败或不符合schema的值保持不变
+func (s *MeasurementSchemaService) NormalizePoints(points []model.Point) {
+	schemasByDev := make(map[string]map[string]*model.MeasurementSchema)
+	for i := range points {
+		devID := points[i].Tags["dev_id"]
+		schemas, ok := schemasByDev[devID]
+		if !ok {
+			schemas = s.loadDeviceSchemas(devID)
+			schemasByDev[devID] = schemas
+		}
+		schema, ok := schemas[points[i].Measurement]
+		if !ok {
+			continue
+		}
+		for _, def := range schema.Fields {
+			value, ok := points[i].Fields[def.Name]
+			if !ok {
+				continue
+			}
+			if converted, err := convertFieldValue(def.Type, value, false); err == nil {
+				points[i].Fields[def.Name] = converted
+			}
+		}
+	}
+}
+
+// loadDeviceSchemas 获取设备所属类型的schema（按measurement）
+func (s *MeasurementSchemaService) loadDeviceSchemas(devIDStr string) map[string]*model.MeasurementSchema {
+	schemas := make(map[string]*model.MeasurementSchema)
+	devID, err := strconv.ParseInt(devIDStr, 10, 64)
+	if err != nil {
+		return schemas
+	}
+	list, err := s.GetDeviceSchemas(devID, "")
+	if err != nil {
+		logger.L().Warn("获取设备schema失败", logger.WithError(err), logger.WithInt64("dev_id", devID))
+		return schemas
+	}
+	for _, schema := range list {
+		schemas[schema.Measurement] = schema
+	}
+	return schemas
+}
+
+// validatePoint 校验单个数据点，通过校验的字段值替换为转换后的值
+func validatePoint(schema *model.MeasurementSchema, p *model.Point) []model.SchemaViolation {
+	violations := make([]model.SchemaViolation, 0)
+	fieldViolation := func(field, msg string) {
+		violations = append(violations, model.SchemaViolation{Measurement: p.Measurement, Field: field, Message: msg})
+	}
+	tagViolation := func(tag, msg string) {
+		violations = append(violations, model.SchemaViolation{Measurement: p.Measurement, Tag: tag, Message: msg})
+	}
+
+	defined := make(map[string]bool, len(schema.Fields))
+	for _, def := range schema.Fields {
+		defined[def.Name] = true
+		value, ok := p.Fields[def.Name]
+		if !ok || value == nil {
+			if def.Required {
+				fieldViolation(def.Name, "缺少必填字段")
+			}
+			continue
+		}
+		converted, err := convertFieldValue(def.Type, value, schema.Coerce)
+		if err != nil {
+			fieldViolation(def.Name, err.Error())
+			continue
+		}
+		if msg := checkFieldRange(def, converted); msg != "" {
+			fieldViolation(def.Name, msg)
+			continue
+		}
+		p.Fields[def.Name] = converted
+	}
+	if schema.Strict {
+		for _, name := range sortedKeys(p.Fields) {
+			if !defined[name] && !schemaSystemFields[name] {
+				fieldViolation(name, "未定义的字段")
+			}
+		}
+	}
+
+	definedTags := make(map[string]bool, len(schema.Tags))
+	for _, def := range schema.Tags {
+		definedTags[def.Name] = true
+		value, ok := p.Tags[def.Name]
+		if !ok || value == "" {
+			if def.Required {
+				tagViolation(def.Name, "缺少必填tag")
+			}
+			continue
+		}
+		if len(def.Values) > 0 && !containsString(def.Values, value) {
+			tagViolation(def.Name, fmt.Sprintf("取值%q不在允许范围内", value))
+		}
+	}
+	if schema.Strict {
+		for _, name := range sortedKeys(p.Tags) {
+			if !definedTags[name] && !schemaSystemTags[name] {
+				tagViolation(name, "未定义的tag")
+			}
+		}
+	}
+	return violations
+}
+
+// convertFieldValue 将字段值转换为schema类型，coerce为false时只接受同类值（JSON数字可作为int/float）
+func convertFieldValue(fieldType string, value any, coerce bool) (any, error) {
+	switch fieldType {
+	case model.SchemaFieldTypeFloat:
+		switch v := value.(type) {
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return nil, errors.New("不是有效的数值")
+			}
+			return v, nil
+		case int64:
+			return float64(v), nil
+		case int:
+			return float64(v), nil
+		case string:
+			if coerce {
+				f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+				if err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+					return f, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("应为float类型，实际为%s", fieldValueType(value))
+	case model.SchemaFieldTypeInt:
+		switch v := value.(type) {
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+				return int64(v), nil
+			}
+			return nil, errors.New("应为整数")
+		case int64:
+			return v, nil
+		case int:
+			return int64(v), nil
+		case string:
+			if coerce {
+				if n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+					return n, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("应为int类型，实际为%s", fieldValueType(value))
+	case model.SchemaFieldTypeBool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if coerce {
+				if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+					return b, nil
+				}
+			}
+		case float64:
+			if coerce && (v == 0 || v == 1) {
+				return v == 1, nil
+			}
+		}
+		return nil, fmt.Errorf("应为bool类型，实际为%s", fieldValueType(value))
+	case model.SchemaFieldTypeString:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case float64:
+			if coerce {
+				return strconv.FormatFloat(v, 'f', -1, 64), nil
+			}
+		case int64:
+			if coerce {
+				return strconv.FormatInt(v, 10), nil
+			}
+		case bool:
+			if coerce {
+				return strconv.FormatBool(v), nil
+			}
+		}
+		return nil, fmt.Errorf("应为string类型，实际为%s", fieldValueType(value))
+	}
+	return nil, fmt.Errorf("不支持的字段类型%s", fieldType)
+}
+
+// checkFieldRange 检查数值字段的取值范围
+func checkFieldRange(def model.SchemaField, value any) string {
+	var f float64
+	switch v := value.(type) {
+	case float64:
+		f = v
+	case int64:
+		f = float64(v)
+	default:
+		return ""
+	}
+	if def.Min != nil && f < *def.Min {
+		return fmt.Sprintf("取值%v小于最小值%v", value, *def.Min)
+	}
+	if def.Max != nil && f > *def.Max {
+		return fmt.Sprintf("取值%v大于最大值%v", value, *def.Max)
+	}
+	return ""
+}
+
+// checkSchemaDefinition 检查schema定义：字段/tag名称不能重复，范围只能用于数值字段
+func checkSchemaDefinition(fields []model.SchemaField, tags []model.SchemaTag) error {
+	names := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		if names[f.Name] {
+			return fmt.Errorf("字段%s重复定义", f.Name)
+		}
+		names[f.Name] = true
+		hasRange := f.Min != nil || f.Max != nil || f.NormalMin != nil || f.NormalMax != nil
+		if hasRange && f.Type != model.SchemaFieldTypeFloat && f.Type != model.SchemaFieldTypeInt {
+			return fmt.Errorf("字段%s不是数值类型，不能设置取值范围", f.Name)
+		}
+		if f.Min != nil && f.Max != nil && *f.Min > *f.Max {
+			return fmt.Errorf("字段%s的最小值大于最大值", f.Name)
+		}
+		if f.NormalMin != nil && f.NormalMax != nil && *f.NormalMin > *f.NormalMax {
+			return fmt.Errorf("字段%s的正常范围下限大于上限", f.Name)
+		}
+	}
+	tagNames := make(map[string]bool, len(tags))
+	for _, t := range tags {
+		if tagNames[t.Name] {
+			return fmt.Errorf("tag%s重复定义", t.Name)
+		}
+		if schemaSystemTags[t.Name] {
+			return fmt.Errorf("tag%s由系统写入，不能定义", t.Name)
+		}
+		tagNames[t.Name] = true
+	}
+	return nil
+}
+
+// fieldValueType 字段值的类型名称（用于错误信息）
+func fieldValueType(value any) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case float64, int64, int:
+		return "number"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// sortedKeys 按名称排序的键（错误信息顺序稳定）
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
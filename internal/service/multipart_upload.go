@@ -0,0 +1,341 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"backend/config"
+	"backend/internal/model"
+	"backend/internal/repo"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+)
+
+const (
+	minMultipartPartSize    = 5 << 20 // S3要求除最后一个分片外每片至少5MB
+	defaultMultipartPartMB  = 16
+	maxMultipartParts       = 10000
+	defaultMultipartTTL     = 24 * time.Hour
+	defaultMultipartCleanup = time.Hour
+	uploadPartURLExpiry     = 15 * time.Minute
+)
+
+// multipartConfig 分片上传配置（Start时从配置加载）
+var multipartConfig config.MultipartUploadConfig
+
+// MultipartUploadService 大文件分片上传：初始化、按需签发分片URL、断点续传、完成/取消及清理
+type MultipartUploadService struct {
+	sessionRepo    *repo.UploadSessionRepository
+	deviceRepo     *repo.DeviceRepository
+	deviceUserRepo *repo.DeviceUserRepository
+	uploadService  *UploadSessionService
+}
+
+func NewMultipartUploadService() *MultipartUploadService {
+	return &MultipartUploadService{
+		sessionRepo:    repo.NewUploadSessionRepository(),
+		deviceRepo:     repo.NewDeviceRepository(),
+		deviceUserRepo: repo.NewDeviceUserRepository(),
+		uploadService:  NewUploadSessionService(),
+	}
+}
+
+// InitUpload 初始化分片上传（需要设备写权限），返回上传ID与分片大小
+func (s *MultipartUploadService) InitUpload(req *model.InitMultipartUploadReq, currentUID int64, role string) (*model.MultipartUploadInfo, error) {
+	devID := req.DevID.Int64()
+	if _, err := s.deviceRepo.GetDevice(devID); err != nil {
+		return nil, errors.New("设备不存在")
+	}
+	if err := s.checkWritePermission(devID, currentUID, role); err != nil {
+		return nil, err
+	}
+
+	partSize := multipartPartSize(req.FileSize)
+	partCount := int((req.FileSize + partSize - 1) / partSize)
+
+	bucketName := req.BucketName
+	if bucketName == "" {
+		bucketName = getBucketNameByFilePath(req.Filename)
+	}
+	contentType := req.ContentType
+	if contentType == "" {
+		contentType = getContentTypeByFilePath(req.Filename)
+	}
+
+	// 重复内容检测
+	if req.SHA256 != "" && !req.AllowDuplicate {
+		dup, err := s.uploadService.FindDuplicate(devID, req.SHA256)
+		if err != nil {
+			return nil, fmt.Errorf("查询重复文件失败: %v", err)
+		}
+		if dup != nil {
+			dupBucket, _ := dup.ExtraData["bucket_name"].(string)
+			dupKey, _ := dup.ExtraData["bucket_key"].(string)
+			return &model.MultipartUploadInfo{BucketName: dupBucket, BucketKey: dupKey, Duplicate: true, DataID: dup.DataID}, nil
+		}
+	}
+
+	// object key与单文件上传一致（格式: dev_id/YYYY/MM/DD/filename），同名时追加上传ID前缀
+	now := utils.GetCurrentTime()
+	baseKey := fmt.Sprintf("%d/%d/%02d/%02d/%s", devID, now.Year(), now.Month(), now.Day(), req.Filename)
+	uploadID := generateUploadID(devID, baseKey, currentUID)
+	objectKey, err := s.uploadService.AllocateObjectKey(bucketName, baseKey, uploadID)
+	if err != nil {
+		return nil, fmt.Errorf("分配对象key失败: %v", err)
+	}
+
+	multipartUploadID, err := s.sessionRepo.NewMultipartUpload(bucketName, objectKey, contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &model.UploadSession{
+		UploadID:          uploadID,
+		DevID:             req.DevID,
+		BucketName:        bucketName,
+		BucketKey:         objectKey,
+		Filename:          req.Filename,
+		ContentType:       contentType,
+		UID:               currentUID,
+		Status:            model.UploadSessionStatusPending,
+		SHA256:            strings.ToLower(req.SHA256),
+		MultipartUploadID: multipartUploadID,
+		PartSize:          partSize,
+		FileSize:          req.FileSize,
+		CreateAt:          now,
+		ExpireAt:          now.Add(multipartSessionTTL()),
+	}
+	if err := s.sessionRepo.CreateUploadSession(session); err != nil {
+		// 会话保存失败时取消MinIO中的分片上传，避免遗留
+		if abortErr := s.sessionRepo.AbortMultipartUpload(bucketName, objectKey, multipartUploadID); abortErr != nil {
+			logger.L().Warn("取消分片上传失败", logger.WithError(abortErr), logger.WithString("bucket_key", objectKey))
+		}
+		return nil, fmt.Errorf("保存上传会话失败: %v", err)
+	}
+
+	return &model.MultipartUploadInfo{
+		UploadID:   session.UploadID,
+		BucketName: bucketName,
+		BucketKey:  objectKey,
+		PartSize:   partSize,
+		PartCount:  partCount,
+		ExpireAt:   session.ExpireAt,
+	}, nil
+}
+
+// PresignParts 按需签发分片上传URL
+func (s *MultipartUploadService) PresignParts(req *model.PresignUploadPartsReq, currentUID int64, role string) ([]model.UploadPartURL, error) {
+	session, err := s.getPendingSession(req.UploadID, currentUID, role)
+	if err != nil {
+		return nil, err
+	}
+
+	urls := make([]model.UploadPartURL, 0, len(req.PartNumbers))
+	for _, partNumber := range req.PartNumbers {
+		if partNumber < 1 || partNumber > maxMultipartParts {
+			return nil, fmt.Errorf("分片号必须在1-%d之间", maxMultipartParts)
+		}
+		url, err := s.sessionRepo.PresignedUploadPart(session.BucketName, session.BucketKey,
+			session.MultipartUploadID, partNumber, uploadPartURLExpiry)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, model.UploadPartURL{PartNumber: partNumber, URL: url})
+	}
+	return urls, nil
+}
+
+// ListParts 列出已上传的分片，客户端据此跳过已完成的分片继续上传
+func (s *MultipartUploadService) ListParts(uploadID string, currentUID int64, role string) (*model.UploadSession, []model.UploadedPart, error) {
+	session, err := s.getPendingSession(uploadID, currentUID, role)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parts, err := s.sessionRepo.ListUploadedParts(session.BucketName, session.BucketKey, session.MultipartUploadID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return session, parts, nil
+}
+
+// Complete 合并分片并确认上传（创建metadata），返回data_id
+func (s *MultipartUploadService) Complete(req *model.CompleteMultipartUploadReq, currentUID int64, role string) (int64, error) {
+	session, err := s.getPendingSession(req.UploadID, currentUID, role)
+	if err != nil {
+		return 0, err
+	}
+
+	parts := req.Parts
+	if len(parts) == 0 {
+		// 未指定分片时使用服务端已上传的全部分片
+		uploaded, err := s.sessionRepo.ListUploadedParts(session.BucketName, session.BucketKey, session.MultipartUploadID)
+		if err != nil {
+			return 0, err
+		}
+		for _, p := range uploaded {
+			parts = append(parts, model.CompletedPart{PartNumber: p.PartNumber, ETag: p.ETag})
+		}
+	}
+	if len(parts) == 0 {
+		return 0, errors.New("没有已上传的分片")
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+
+	if err := s.sessionRepo.CompleteMultipartUpload(session.BucketName, session.BucketKey, session.MultipartUploadID, parts); err != nil {
+		return 0, err
+	}
+
+	// 与单文件上传共用确认流程（存储事件可能已先完成确认）
+	uploadReq := &model.UploadSensorDataRequest{
+		Metadata: model.Metadata{
+			DevID:        session.DevID,
+			DataType:     model.DataTypeFileData,
+			QualityScore: req.QualityScore,
+			ExtraData:    req.ExtraData,
+		},
+		FileData: model.FileData{UploadID: session.UploadID},
+	}
+	if uploadReq.Metadata.ExtraData == nil {
+		uploadReq.Metadata.ExtraData = make(map[string]any)
+	}
+	uploadReq.Metadata.ExtraData["part_count"] = len(parts)
+	if err := s.uploadService.ConfirmUpload(uploadReq, currentUID, role); err != nil {
+		return 0, err
+	}
+	return uploadReq.Metadata.DataID, nil
+}
+
+// Abort 取消分片上传，清理已上传的分片
+func (s *MultipartUploadService) Abort(uploadID string, currentUID int64, role string) error {
+	session, err := s.getPendingSession(uploadID, currentUID, role)
+	if err != nil {
+		return err
+	}
+
+	if err := s.sessionRepo.AbortMultipartUpload(session.BucketName, session.BucketKey, session.MultipartUploadID); err != nil {
+		return err
+	}
+	return s.sessionRepo.AbortUploadSession(uploadID)
+}
+
+// CleanupAbandoned 取消超过会话有效期仍未完成的分片上传（包括没有会话记录的），返回取消数量
+// 过期会话的状态由 UploadSessionService 的定时任务标记
+func (s *MultipartUploadService) CleanupAbandoned() int {
+	cutoff := utils.GetCurrentTime().Add(-multipartSessionTTL())
+	aborted := 0
+	for _, bucketName := range repo.FileBuckets() {
+		err := s.sessionRepo.WalkIncompleteUploads(bucketName, func(key, multipartUploadID string, initiated time.Time) {
+			if initiated.After(cutoff) {
+				return
+			}
+			if err := s.sessionRepo.AbortMultipartUpload(bucketName, key, multipartUploadID); err != nil {
+				logger.L().Warn("清理未完成的分片上传失败", logger.WithError(err),
+					logger.WithString("bucket_name", bucketName), logger.WithString("bucket_key", key))
+				return
+			}
+			aborted++
+		})
+		if err != nil {
+			logger.L().Warn("列举未完成的分片上传失败", logger.WithError(err), logger.WithString("bucket_name", bucketName))
+		}
+	}
+	return aborted
+}
+
+// Start 加载分片上传配置并启动清理任务（ctx取消后退出）
+func (s *MultipartUploadService) Start(ctx context.Context, cfg config.MultipartUploadConfig) {
+	multipartConfig = cfg
+
+	interval := time.Duration(cfg.CleanupInterval) * time.Minute
+	if interval <= 0 {
+		interval = defaultMultipartCleanup
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if aborted := s.CleanupAbandoned(); aborted > 0 {
+					logger.L().Info("清理未完成的分片上传", logger.WithInt("aborted", aborted))
+				}
+			}
+		}
+	}()
+}
+
+// getPendingSession 获取待完成的分片上传会话并检查设备写权限
+func (s *MultipartUploadService) getPendingSession(uploadID string, currentUID int64, role string) (*model.UploadSession, error) {
+	session, err := s.sessionRepo.GetUploadSession(uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if session.MultipartUploadID == "" {
+		return nil, errors.New("该上传不是分片上传")
+	}
+	if err := s.checkWritePermission(session.DevID.Int64(), currentUID, role); err != nil {
+		return nil, err
+	}
+
+	switch session.Status {
+	case model.UploadSessionStatusCompleted:
+		return nil, errors.New("分片上传已完成")
+	case model.UploadSessionStatusAborted:
+		return nil, errors.New("分片上传已取消")
+	case model.UploadSessionStatusRejected:
+		return nil, ErrContentChecksumMismatch
+	}
+	if session.Status == model.UploadSessionStatusExpired || utils.GetCurrentTime().After(session.ExpireAt) {
+		return nil, errors.New("上传会话已过期")
+	}
+	return session, nil
+}
+
+// checkWritePermission 检查设备写权限（管理员不受限制）
+func (s *MultipartUploadService) checkWritePermission(devID, currentUID int64, role string) error {
+	if role == model.RoleAdmin {
+		return nil
+	}
+	deviceUser, err := s.deviceUserRepo.GetDeviceUser(devID, currentUID)
+	if err != nil {
+		return errors.New("您没有权限访问该设备")
+	}
+	// 检查写权限
+	if deviceUser.PermissionLevel != model.PermissionLevelWrite &&
+		deviceUser.PermissionLevel != model.PermissionLevelReadWrite {
+		return errors.New("您没有写权限")
+	}
+	return nil
+}
+
+// multipartPartSize 计算分片大小：默认使用配置值，超过最大分片数时按MB向上取整放大
+func multipartPartSize(fileSize int64) int64 {
+	partSize := int64(multipartConfig.PartSize) << 20
+	if partSize <= 0 {
+		partSize = defaultMultipartPartMB << 20
+	}
+	if partSize < minMultipartPartSize {
+		partSize = minMultipartPartSize
+	}
+	if fileSize > partSize*maxMultipartParts {
+		minSize := (fileSize + maxMultipartParts - 1) / maxMultipartParts
+		partSize = (minSize + (1 << 20) - 1) >> 20 << 20
+	}
+	return partSize
+}
+
+// multipartSessionTTL 分片上传会话有效期
+func multipartSessionTTL() time.Duration {
+	if multipartConfig.SessionTTL <= 0 {
+		return defaultMultipartTTL
+	}
+	return time.Duration(multipartConfig.SessionTTL) * time.Hour
+}
@@ -0,0 +1,371 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"backend/config"
+	"backend/internal/model"
+)
+
+const (
+	defaultFlatlineMinRun  = 10
+	defaultSpikeThreshold  = 6.0
+	defaultJitterTolerance = 0.5
+	minSpikeSamples        = 5
+	spikeWindow            = 5 // 突变检测的窗口半径（样本数）
+)
+
+// qualityWeights 默认评分模型各检查项的权重
+var qualityWeights = map[string]float64{
+	model.QualityCheckCompleteness: 0.3,
+	model.QualityCheckRange:        0.25,
+	model.QualityCheckFlatline:     0.15,
+	model.QualityCheckSpike:        0.15,
+	model.QualityCheckJitter:       0.15,
+}
+
+// QualityScorer 数据质量评分模型：根据一次上传的数据点计算0-100的评分
+type QualityScorer interface {
+	// Name 模型名称，记录在评分结果中
+	Name() string
+	// Score 计算评分与各检查项明细
+	Score(input *model.QualityInput) *model.QualityReport
+}
+
+var (
+	// qualityConfig 质量评分配置（ConfigureQuality时从配置加载）
+	qualityConfig   config.QualityConfig
+	qualityScorer   QualityScorer = &defaultQualityScorer{}
+	qualityScorerMu sync.RWMutex
+)
+
+// ConfigureQuality 加载质量评分配置（在服务启动时调用）
+func ConfigureQuality(cfg config.QualityConfig) {
+	qualityConfig = cfg
+}
+
+// SetQualityScorer 替换质量评分模型（在服务启动前调用）
+func SetQualityScorer(scorer QualityScorer) {
+	qualityScorerMu.Lock()
+	defer qualityScorerMu.Unlock()
+	qualityScorer = scorer
+}
+
+// QualityService 数据质量评分：上传时序数据时由服务端计算quality_score
+type QualityService struct{}
+
+func NewQualityService() *QualityService {
+	return &QualityService{}
+}
+
+// Enabled 是否由服务端计算质量评分（关闭时使用客户端提供的quality_score）
+func (s *QualityService) Enabled() bool {
+	return qualityConfig.Enabled
+}
+
+// Score 使用当前评分模型计算质量评分
+func (s *QualityService) Score(input *model.QualityInput) *model.QualityReport {
+	qualityScorerMu.RLock()
+	scorer := qualityScorer
+	qualityScorerMu.RUnlock()
+
+	report := scorer.Score(input)
+	report.Model = scorer.Name()
+	report.Score = math.Max(0, math.Min(100, roundScore(report.Score)))
+	return report
+}
+
+// FormatQualityScore 评分写入metadata.quality_score与InfluxDB tag的格式
+func FormatQualityScore(score float64) string {
+	return strconv.FormatFloat(score, 'f', 2, 64)
+}
+
+// defaultQualityScorer 默认评分模型：按序列（measurement + tag）检查缺失采样、超出正常范围、
+// 数值卡死、突变与采样间隔抖动，各检查项的合格比例按权重加权
+type defaultQualityScorer struct{}
+
+func (d *defaultQualityScorer) Name() string {
+	return "default"
+}
+
+func (d *defaultQualityScorer) Score(input *model.QualityInput) *model.QualityReport {
+	series := groupQualitySeries(input.Points)
+	interval := expectedSampleInterval(input.Device)
+
+	checks := []model.QualityCheck{
+		checkCompleteness(series, interval),
+		checkNormalRange(input.Points, input.Schemas),
+		checkFlatline(series, qualityFlatlineMinRun()),
+		checkSpike(series, qualitySpikeThreshold()),
+		checkJitter(series, interval, qualityJitterTolerance()),
+	}
+
+	report := &model.QualityReport{Score: 100, PointCount: len(input.Points), Checks: make([]model.QualityCheck, 0, len(checks))}
+	var weighted, totalWeight float64
+	for _, check := range checks {
+		if check.Checked == 0 {
+			continue
+		}
+		check.Weight = qualityWeights[check.Name]
+		check.Score = roundScore(100 * float64(check.Checked-check.Failed) / float64(check.Checked))
+		weighted += check.Weight * check.Score
+		totalWeight += check.Weight
+		report.Checks = append(report.Checks, check)
+	}
+	if totalWeight > 0 {
+		report.Score = weighted / totalWeight
+	}
+	return report
+}
+
+// qualitySeries 同一measurement、同一组tag的数据点（按时间升序）
+type qualitySeries struct {
+	timestamps []int64
+	values     map[string][]float64 // 数值字段，按数据点顺序（缺失的点不计入）
+}
+
+// groupQualitySeries 按measurement与tag（不含data_id/quality_score）分组
+func groupQualitySeries(points []model.Point) []*qualitySeries {
+	sorted := make([]model.Point, len(points))
+	copy(sorted, points)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Timestamp < sorted[j].Timestamp })
+
+	index := make(map[string]*qualitySeries)
+	order := make([]*qualitySeries, 0)
+	for _, p := range sorted {
+		key := qualitySeriesKey(p)
+		s, ok := index[key]
+		if !ok {
+			s = &qualitySeries{values: make(map[string][]float64)}
+			index[key] = s
+			order = append(order, s)
+		}
+		s.timestamps = append(s.timestamps, p.Timestamp)
+		for name, value := range p.Fields {
+			if schemaSystemFields[name] {
+				continue
+			}
+			if f, ok := numericValue(value); ok {
+				s.values[name] = append(s.values[name], f)
+			}
+		}
+	}
+	return order
+}
+
+func qualitySeriesKey(p model.Point) string {
+	var b strings.Builder
+	b.WriteString(p.Measurement)
+	for _, name := range sortedKeys(p.Tags) {
+		if name == "data_id" || name == "quality_score" {
+			continue
+		}
+		b.WriteString("," + name + "=" + p.Tags[name])
+	}
+	return b.String()
+}
+
+// expectedSampleInterval 按设备采样频率（每秒采样次数）推算的采样间隔（秒），未配置时返回0
+// 时间戳精度为秒，高于1Hz的设备按1秒计算
+func expectedSampleInterval(device *model.Device) float64 {
+	if device == nil || device.SamplingRate <= 0 {
+		return 0
+	}
+	return math.Max(1/float64(device.SamplingRate), 1)
+}
+
+// checkCompleteness 缺失采样：按采样间隔推算每个序列首尾时间之间应有的点数
+func checkCompleteness(series []*qualitySeries, interval float64) model.QualityCheck {
+	check := model.QualityCheck{Name: model.QualityCheckCompleteness}
+	if interval <= 0 {
+		return check
+	}
+	actual := 0
+	for _, s := range series {
+		span := float64(s.timestamps[len(s.timestamps)-1] - s.timestamps[0])
+		expected := int(math.Floor(span/interval)) + 1
+		check.Checked += expected
+		actual += len(s.timestamps)
+		if missing := expected - len(s.timestamps); missing > 0 {
+			check.Failed += missing
+		}
+	}
+	check.Detail = fmt.Sprintf("预期%d个采样，实际%d个", check.Checked, actual)
+	return check
+}
+
+// checkNormalRange 超出schema字段正常范围（normal_min/normal_max）的数值
+func checkNormalRange(points []model.Point, schemas map[string]*model.MeasurementSchema) model.QualityCheck {
+	check := model.QualityCheck{Name: model.QualityCheckRange}
+	for _, p := range points {
+		schema, ok := schemas[p.Measurement]
+		if !ok {
+			continue
+		}
+		for _, def := range schema.Fields {
+			if def.NormalMin == nil && def.NormalMax == nil {
+				continue
+			}
+			f, ok := numericValue(p.Fields[def.Name])
+			if !ok {
+				continue
+			}
+			check.Checked++
+			if (def.NormalMin != nil && f < *def.NormalMin) || (def.NormalMax != nil && f > *def.NormalMax) {
+				check.Failed++
+			}
+		}
+	}
+	if check.Checked > 0 {
+		check.Detail = fmt.Sprintf("%d个数值超出正常范围", check.Failed)
+	}
+	return check
+}
+
+// checkFlatline 数值卡死：连续minRun个及以上相同数值的样本均视为不合格
+func checkFlatline(series []*qualitySeries, minRun int) model.QualityCheck {
+	check := model.QualityCheck{Name: model.QualityCheckFlatline}
+	for _, s := range series {
+		for _, values := range s.values {
+			if len(values) < minRun {
+				continue
+			}
+			check.Checked += len(values)
+			run := 1
+			for i := 1; i <= len(values); i++ {
+				if i < len(values) && values[i] == values[i-1] {
+					run++
+					continue
+				}
+				if run >= minRun {
+					check.Failed += run
+				}
+				run = 1
+			}
+		}
+	}
+	if check.Checked > 0 {
+		check.Detail = fmt.Sprintf("%d个样本处于连续%d次及以上不变的区间", check.Failed, minRun)
+	}
+	return check
+}
+
+// checkSpike 突变（Hampel滤波）：样本与前后各spikeWindow个样本的中位数之差，
+// 按窗口内中位数绝对偏差（MAD）计算的稳健z分数超过阈值；窗口内MAD为0时不判定
+func checkSpike(series []*qualitySeries, threshold float64) model.QualityCheck {
+	check := model.QualityCheck{Name: model.QualityCheckSpike}
+	for _, s := range series {
+		for _, values := range s.values {
+			if len(values) < minSpikeSamples {
+				continue
+			}
+			check.Checked += len(values)
+			for i, v := range values {
+				lo, hi := max(0, i-spikeWindow), min(len(values), i+spikeWindow+1)
+				window := values[lo:hi]
+				median := medianOf(window)
+				deviations := make([]float64, len(window))
+				for j, w := range window {
+					deviations[j] = math.Abs(w - median)
+				}
+				mad := medianOf(deviations)
+				if mad > 0 && 0.6745*math.Abs(v-median)/mad > threshold {
+					check.Failed++
+				}
+			}
+		}
+	}
+	if check.Checked > 0 {
+		check.Detail = fmt.Sprintf("%d个突变样本", check.Failed)
+	}
+	return check
+}
+
+// checkJitter 采样间隔抖动：相邻采样间隔与预期间隔（未配置采样频率时为间隔中位数）的偏差超过容差
+// 时间戳精度为秒，预期间隔小于1秒时不检查
+func checkJitter(series []*qualitySeries, interval, tolerance float64) model.QualityCheck {
+	check := model.QualityCheck{Name: model.QualityCheckJitter}
+	if interval > 0 && interval < 1 {
+		return check
+	}
+	for _, s := range series {
+		if len(s.timestamps) < 3 {
+			continue
+		}
+		gaps := make([]float64, 0, len(s.timestamps)-1)
+		for i := 1; i < len(s.timestamps); i++ {
+			gaps = append(gaps, float64(s.timestamps[i]-s.timestamps[i-1]))
+		}
+		expected := interval
+		if expected <= 0 {
+			expected = medianOf(gaps)
+		}
+		if expected <= 0 {
+			continue
+		}
+		for _, gap := range gaps {
+			check.Checked++
+			if math.Abs(gap-expected)/expected > tolerance {
+				check.Failed++
+			}
+		}
+	}
+	if check.Checked > 0 {
+		check.Detail = fmt.Sprintf("%d个采样间隔偏离预期超过%.0f%%", check.Failed, tolerance*100)
+	}
+	return check
+}
+
+// numericValue 数值字段转换为float64（bool与字符串不参与数值检查）
+func numericValue(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, !math.IsNaN(v) && !math.IsInf(v, 0)
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func medianOf(values []float64) float64 {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+func roundScore(score float64) float64 {
+	return math.Round(score*100) / 100
+}
+
+func qualityFlatlineMinRun() int {
+	if qualityConfig.FlatlineMinRun <= 1 {
+		return defaultFlatlineMinRun
+	}
+	return qualityConfig.FlatlineMinRun
+}
+
+func qualitySpikeThreshold() float64 {
+	if qualityConfig.SpikeThreshold <= 0 {
+		return defaultSpikeThreshold
+	}
+	return qualityConfig.SpikeThreshold
+}
+
+func qualityJitterTolerance() float64 {
+	if qualityConfig.JitterTolerance <= 0 {
+		return defaultJitterTolerance
+	}
+	return qualityConfig.JitterTolerance
+}
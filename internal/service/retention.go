@@ -0,0 +1,382 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"backend/config"
+	"backend/internal/model"
+	"backend/internal/repo"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+)
+
+const (
+	defaultRetentionBatchSize = 500
+	retentionSampleKeys       = 20 // dry_run报告中每个策略列出的过期文件数量
+)
+
+var (
+	// retentionConfig 数据保留配置（Start时从配置加载）
+	retentionConfig config.RetentionConfig
+	// retentionMu 避免定时执行与手动执行同时删除
+	retentionMu sync.Mutex
+)
+
+// RetentionService 数据保留策略：按设备类型/数据类型/measurement/bucket删除过期的元数据、MinIO文件及时序归档
+type RetentionService struct {
+	retentionRepo  *repo.RetentionRepository
+	archiveRepo    *repo.SeriesArchiveRepository
+	catalogService *FileCatalogService
+	archiveService *SeriesArchiveService
+	rollupService  *RollupService
+}
+
+func NewRetentionService() *RetentionService {
+	return &RetentionService{
+		retentionRepo:  repo.NewRetentionRepository(),
+		archiveRepo:    repo.NewSeriesArchiveRepository(),
+		catalogService: NewFileCatalogService(),
+		archiveService: NewSeriesArchiveService(),
+		rollupService:  NewRollupService(),
+	}
+}
+
+// CreatePolicy 创建保留策略
+func (s *RetentionService) CreatePolicy(req *model.CreateRetentionPolicyReq, currentUID int64) (*model.RetentionPolicy, error) {
+	if req.DataType == model.DataTypeSeries && req.BucketName != "" {
+		return nil, errors.New("时序数据策略不能指定bucket_name")
+	}
+	if req.DataType == model.DataTypeFileData && req.Measurement != "" {
+		return nil, errors.New("文件数据策略不能指定measurement")
+	}
+
+	now := utils.GetCurrentTime()
+	policy := &model.RetentionPolicy{
+		PolicyID:      utils.GetDefaultSnowflake().Generate(),
+		Name:          req.Name,
+		DevType:       req.DevType,
+		DataType:      req.DataType,
+		Measurement:   req.Measurement,
+		BucketName:    req.BucketName,
+		RetentionDays: req.RetentionDays,
+		Enabled:       req.Enabled == nil || *req.Enabled,
+		CreateBy:      currentUID,
+		CreateAt:      now,
+		UpdateAt:      now,
+	}
+	if err := s.retentionRepo.CreatePolicy(policy); err != nil {
+		return nil, fmt.Errorf("创建保留策略失败: %v", err)
+	}
+	return policy, nil
+}
+
+// GetPolicies 获取全部保留策略
+func (s *RetentionService) GetPolicies() ([]*model.RetentionPolicy, error) {
+	return s.retentionRepo.ListPolicies(false)
+}
+
+// UpdatePolicy 更新保留策略
+func (s *RetentionService) UpdatePolicy(req *model.UpdateRetentionPolicyReq) (*model.RetentionPolicy, error) {
+	policy, err := s.retentionRepo.GetPolicy(req.PolicyID)
+	if err != nil {
+		return nil, err
+	}
+	if req.Name != nil {
+		policy.Name = *req.Name
+	}
+	if req.RetentionDays != nil {
+		policy.RetentionDays = *req.RetentionDays
+	}
+	if req.Enabled != nil {
+		policy.Enabled = *req.Enabled
+	}
+	policy.UpdateAt = utils.GetCurrentTime()
+
+	if err := s.retentionRepo.UpdatePolicy(policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// DeletePolicy 删除保留策略
+func (s *RetentionService) DeletePolicy(policyID int64) error {
+	if _, err := s.retentionRepo.GetPolicy(policyID); err != nil {
+		return err
+	}
+	return s.retentionRepo.DeletePolicy(policyID)
+}
+
+// Enforce 执行所有启用的保留策略，dryRun为true时只统计过期数据
+// 时序数据只删除元数据（InfluxDB 3不支持按条件删除），sync_influxdb开启时同步数据库保留期
+func (s *RetentionService) Enforce(dryRun bool) (*model.RetentionReport, error) {
+	if !retentionMu.TryLock() {
+		return nil, errors.New("保留策略正在执行")
+	}
+	defer retentionMu.Unlock()
+
+	policies, err := s.retentionRepo.ListPolicies(true)
+	if err != nil {
+		return nil, err
+	}
+
+	now := utils.GetCurrentTime()
+	report := &model.RetentionReport{DryRun: dryRun, StartedAt: now, Policies: make([]model.RetentionPolicyReport, 0, len(policies))}
+	for _, policy := range policies {
+		result := model.RetentionPolicyReport{
+			PolicyID: policy.PolicyID,
+			Name:     policy.Name,
+			DataType: policy.DataType,
+			Cutoff:   policy.Cutoff(now),
+		}
+		longer := longerPolicies(policy, policies)
+		err := s.enforcePolicy(policy, longer, now, dryRun, &result)
+		if err == nil && policy.DataType == model.DataTypeSeries {
+			err = s.enforceArchives(policy, longer, now, dryRun, &result)
+		}
+		if err != nil {
+			result.Error = err.Error()
+			logger.L().Warn("执行保留策略失败", logger.WithError(err), logger.WithInt64("policy_id", policy.PolicyID))
+		}
+		report.Policies = append(report.Policies, result)
+	}
+
+	if retentionConfig.SyncInfluxDB {
+		if days := influxRetentionDays(policies); days > 0 {
+			if err := s.checkInfluxRetention(days, now); err != nil {
+				report.InfluxError = err.Error()
+			} else {
+				report.InfluxPeriod = fmt.Sprintf("%dd", days)
+				if !dryRun {
+					if err := s.setInfluxRetention(days); err != nil {
+						report.InfluxError = err.Error()
+						logger.L().Warn("同步InfluxDB保留期失败", logger.WithError(err))
+					}
+				}
+			}
+		}
+	}
+
+	report.FinishedAt = utils.GetCurrentTime()
+	return report, nil
+}
+
+// enforcePolicy 执行单个策略
+func (s *RetentionService) enforcePolicy(policy *model.RetentionPolicy, longer []*model.RetentionPolicy, now time.Time, dryRun bool, result *model.RetentionPolicyReport) error {
+	expired, err := s.retentionRepo.CountExpired(policy, longer, now)
+	if err != nil {
+		return err
+	}
+	result.ExpiredMetadata = expired
+	if expired == 0 {
+		return nil
+	}
+
+	if dryRun {
+		if policy.DataType == model.DataTypeFileData {
+			files, err := s.retentionRepo.GetExpiredFiles(policy, longer, now, retentionSampleKeys)
+			if err != nil {
+				return err
+			}
+			for _, m := range files {
+				if key, ok := m.ExtraData["bucket_key"].(string); ok {
+					result.SampleKeys = append(result.SampleKeys, key)
+				}
+			}
+		}
+		return nil
+	}
+
+	batchSize := retentionBatchSize()
+	if policy.DataType == model.DataTypeFileData {
+		// 文件通过删除补偿流程删除（元数据、MinIO对象及派生文件）
+		for {
+			files, err := s.retentionRepo.GetExpiredFiles(policy, longer, now, batchSize)
+			if err != nil {
+				return err
+			}
+			deleted := 0
+			var keyless []int64
+			for _, m := range files {
+				entry := fileEntryFromMetadata(m)
+				if entry.BucketKey == "" {
+					// 缺少bucket_key的记录没有对应的对象，直接删除元数据，避免每批都查到同样的记录
+					keyless = append(keyless, m.DataID)
+					continue
+				}
+				if err := s.catalogService.DeleteFile(entry.BucketName, entry.BucketKey); err != nil {
+					return err
+				}
+				deleted++
+			}
+			removed, err := s.retentionRepo.DeleteMetadataByIDs(keyless)
+			if err != nil {
+				return err
+			}
+			result.DeletedMetadata += int64(deleted) + removed
+			result.DeletedFiles += deleted
+			if len(files) < batchSize || int64(deleted)+removed == 0 {
+				return nil
+			}
+		}
+	}
+
+	for {
+		deleted, err := s.retentionRepo.DeleteExpiredMetadata(policy, longer, now, batchSize)
+		if err != nil {
+			return err
+		}
+		result.DeletedMetadata += deleted
+		if deleted < int64(batchSize) {
+			return nil
+		}
+	}
+}
+
+// enforceArchives 删除按策略过期的时序归档（Parquet文件及归档清单）
+func (s *RetentionService) enforceArchives(policy *model.RetentionPolicy, longer []*model.RetentionPolicy, now time.Time, dryRun bool, result *model.RetentionPolicyReport) error {
+	expired, err := s.retentionRepo.CountExpiredArchives(policy, longer, now)
+	if err != nil {
+		return err
+	}
+	result.ExpiredArchives = expired
+	if expired == 0 || dryRun {
+		return nil
+	}
+
+	batchSize := retentionBatchSize()
+	for {
+		archives, err := s.retentionRepo.GetExpiredArchives(policy, longer, now, batchSize)
+		if err != nil {
+			return err
+		}
+		for _, a := range archives {
+			// 先删除对象再删除清单，中断时下次执行重新删除
+			if err := s.archiveRepo.DeleteArchiveObject(a.ObjectKey); err != nil {
+				return fmt.Errorf("删除归档文件失败: %v", err)
+			}
+			if err := s.retentionRepo.DeleteArchive(a.ArchiveID); err != nil {
+				return err
+			}
+			result.DeletedArchives++
+		}
+		if len(archives) < batchSize {
+			return nil
+		}
+	}
+}
+
+// checkInfluxRetention 数据库保留期会删除所有measurement中过期的数据，启用归档时必须晚于归档阈值，
+// 且保留期之前的数据已全部导出，否则尚未归档的数据永久丢失
+func (s *RetentionService) checkInfluxRetention(days int, now time.Time) error {
+	if !seriesArchiveEnabled() {
+		return nil
+	}
+	if seriesArchiveConfig.ExpireInfluxDB {
+		return errors.New("InfluxDB保留期由series_archive.expire_influxdb管理，未同步")
+	}
+	if olderThan := seriesArchiveOlderThan(); days <= olderThan+seriesArchiveExpireMargin {
+		return fmt.Errorf("时序保留期%d天未超过归档阈值%d天加%d天余量，未同步InfluxDB保留期", days, olderThan, seriesArchiveExpireMargin)
+	}
+	pending, err := s.archiveService.PendingBefore(now.AddDate(0, 0, -days))
+	if err != nil {
+		return err
+	}
+	if pending != "" {
+		return fmt.Errorf("measurement %s 在保留期之前还有未归档的数据，未同步InfluxDB保留期", pending)
+	}
+	return nil
+}
+
+// setInfluxRetention 设置InfluxDB数据库保留期（对数据库中的所有measurement生效，包括汇总、派生、健康与异常数据），
+// 并将汇总覆盖起点推后到保留期内
+func (s *RetentionService) setInfluxRetention(days int) error {
+	if err := s.retentionRepo.SetInfluxRetentionPeriod(days); err != nil {
+		return err
+	}
+	if err := s.rollupService.TrimCoverage(days); err != nil {
+		return fmt.Errorf("更新汇总覆盖起点失败: %v", err)
+	}
+	return nil
+}
+
+// Start 加载配置并启动定时执行任务（interval为0时不定时执行，ctx取消后退出）
+func (s *RetentionService) Start(ctx context.Context, cfg config.RetentionConfig) {
+	retentionConfig = cfg
+	if cfg.Interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.Interval) * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				report, err := s.Enforce(cfg.DryRun)
+				if err != nil {
+					logger.L().Warn("执行保留策略失败", logger.WithError(err))
+					continue
+				}
+				for _, p := range report.Policies {
+					if p.ExpiredMetadata == 0 && p.Error == "" {
+						continue
+					}
+					logger.L().Info("执行保留策略",
+						logger.WithInt64("policy_id", p.PolicyID),
+						logger.WithString("name", p.Name),
+						logger.WithInt64("expired_metadata", p.ExpiredMetadata),
+						logger.WithInt64("deleted_metadata", p.DeletedMetadata),
+						logger.WithInt("deleted_files", p.DeletedFiles),
+						logger.WithString("error", p.Error))
+				}
+			}
+		}
+	}()
+}
+
+// longerPolicies 与policy覆盖范围重叠且保留时间更长的策略（这些策略保留期内的数据不删除）
+func longerPolicies(policy *model.RetentionPolicy, policies []*model.RetentionPolicy) []*model.RetentionPolicy {
+	var longer []*model.RetentionPolicy
+	for _, other := range policies {
+		if other.PolicyID != policy.PolicyID && other.RetentionDays > policy.RetentionDays && policy.Overlaps(other) {
+			longer = append(longer, other)
+		}
+	}
+	return longer
+}
+
+// influxRetentionDays InfluxDB数据库保留期：只有存在覆盖全部时序数据的策略时才同步，
+// 取所有时序策略中最长的天数，避免提前删除保留时间更长的数据
+func influxRetentionDays(policies []*model.RetentionPolicy) int {
+	hasGlobal := false
+	days := 0
+	for _, p := range policies {
+		if p.DataType != model.DataTypeSeries {
+			continue
+		}
+		if p.DevType == "" && p.Measurement == "" {
+			hasGlobal = true
+		}
+		if p.RetentionDays > days {
+			days = p.RetentionDays
+		}
+	}
+	if !hasGlobal {
+		return 0
+	}
+	return days
+}
+
+// retentionBatchSize 每批删除的数量
+func retentionBatchSize() int {
+	if retentionConfig.DeleteBatchSize <= 0 {
+		return defaultRetentionBatchSize
+	}
+	return retentionConfig.DeleteBatchSize
+}
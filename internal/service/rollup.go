@@ -0,0 +1,388 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"backend/config"
+	"backend/internal/model"
+	"backend/internal/repo"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+)
+
+const (
+	defaultRollupLag             = 2   // 分钟
+	defaultRollupInitialLookback = 24  // 小时
+	rollupChunkBuckets           = 360 // 每次查询计算的汇总窗口数量
+)
+
+var (
+	// rollupConfig 时序汇总配置（Start时从配置加载）
+	rollupConfig config.RollupConfig
+	// rollupMu 避免定时汇总与回填同时写入
+	rollupMu sync.Mutex
+	// rollupDirty 已写入但可能早于水位线的数据范围（设备时间戳的批量上传、补偿重试、WAL重放），
+	// 下次定时汇总时重新计算：measurement -> UTC日期（Unix秒） -> 范围
+	rollupDirty   = make(map[string]map[int64]*rollupSpan)
+	rollupDirtyMu sync.Mutex
+)
+
+// rollupSpan 需要重新计算的时间范围[start, end]（Unix秒）
+type rollupSpan struct {
+	start int64
+	end   int64
+}
+
+// RollupService 时序数据汇总：按1m/1h/1d计算各设备的min/max/mean/count，
+// 写入{measurement}_rollup_{level}，并通过水位线记录已完成的范围
+type RollupService struct {
+	rollupRepo *repo.RollupRepository
+}
+
+func NewRollupService() *RollupService {
+	return &RollupService{
+		rollupRepo: repo.NewRollupRepository(),
+	}
+}
+
+// RunOnce 将所有配置的measurement汇总到当前时间（减去延迟）
+func (s *RollupService) RunOnce() error {
+	rollupMu.Lock()
+	defer rollupMu.Unlock()
+
+	watermarks, err := s.watermarkMap()
+	if err != nil {
+		return fmt.Errorf("获取汇总水位线失败: %v", err)
+	}
+
+	upper := utils.GetCurrentTime().Add(-rollupLag())
+	for _, m := range rollupConfig.Measurements {
+		if err := s.rollupMeasurement(m.Name, rollupFields(m), watermarks, upper); err != nil {
+			logger.L().Warn("时序数据汇总失败", logger.WithError(err), logger.WithString("measurement", m.Name))
+		}
+	}
+
+	// 重新计算水位线之前写入的数据所在的汇总窗口，失败的范围留到下次
+	rollupDirtyMu.Lock()
+	dirty := rollupDirty
+	rollupDirty = make(map[string]map[int64]*rollupSpan)
+	rollupDirtyMu.Unlock()
+	for measurement, days := range dirty {
+		m, ok := rollupMeasurementConfig(measurement)
+		if !ok {
+			continue
+		}
+		for _, span := range days {
+			if err := s.rebuild(m, watermarks, time.Unix(span.start, 0), time.Unix(span.end+1, 0)); err != nil {
+				logger.L().Warn("重新计算迟到数据的汇总失败", logger.WithError(err), logger.WithString("measurement", measurement))
+				s.markDirty(measurement, span.start, span.end)
+			}
+		}
+	}
+	return nil
+}
+
+// MarkDirty 记录已写入的数据点范围（按measurement与UTC日期合并），
+// 早于水位线的部分由下次定时汇总重新计算，否则这些数据不会进入汇总
+func (s *RollupService) MarkDirty(points []model.Point) {
+	for _, p := range points {
+		if _, ok := rollupMeasurementConfig(p.Measurement); ok {
+			s.markDirty(p.Measurement, p.Timestamp, p.Timestamp)
+		}
+	}
+}
+
+func (s *RollupService) markDirty(measurement string, start, end int64) {
+	rollupDirtyMu.Lock()
+	defer rollupDirtyMu.Unlock()
+
+	days, ok := rollupDirty[measurement]
+	if !ok {
+		days = make(map[int64]*rollupSpan)
+		rollupDirty[measurement] = days
+	}
+	day := utcDay(time.Unix(start, 0)).Unix()
+	if span, ok := days[day]; ok {
+		span.start = min(span.start, start)
+		span.end = max(span.end, end)
+		return
+	}
+	days[day] = &rollupSpan{start: start, end: end}
+}
+
+// rollupMeasurement 由细到粗依次推进各粒度的水位线，粗粒度不超过上一级的覆盖范围
+func (s *RollupService) rollupMeasurement(measurement string, fields []string, watermarks map[string]model.RollupWatermark, upper time.Time) error {
+	for i, level := range model.RollupLevels {
+		to := upper.Truncate(level.Every)
+		source := ""
+		var finerStart time.Time
+		if i > 0 {
+			finer := model.RollupLevels[i-1].Name
+			finerWatermark, ok := watermarks[rollupKey(measurement, finer)]
+			if !ok {
+				return nil
+			}
+			if limit := finerWatermark.Watermark.Truncate(level.Every); limit.Before(to) {
+				to = limit
+			}
+			finerStart = finerWatermark.CoverageStart
+			source = finer
+		}
+
+		current, ok := watermarks[rollupKey(measurement, level.Name)]
+		from, coverageStart := current.Watermark, current.CoverageStart
+		if !ok {
+			from = to.Add(-rollupInitialLookback()).Truncate(level.Every)
+			// 首个窗口不能早于上一级的覆盖起点，否则由不完整的上一级数据计算
+			if from.Before(finerStart) {
+				from = ceilTime(finerStart, level.Every)
+			}
+			coverageStart = from
+		}
+		if !from.Before(to) {
+			continue
+		}
+
+		err := s.computeRange(measurement, fields, source, level, from, to, func(end time.Time) error {
+			w := &model.RollupWatermark{
+				Measurement:   measurement,
+				Level:         level.Name,
+				CoverageStart: coverageStart,
+				Watermark:     end,
+				UpdateAt:      utils.GetCurrentTime(),
+			}
+			if err := s.rollupRepo.SaveWatermark(w); err != nil {
+				return fmt.Errorf("保存汇总水位线失败: %v", err)
+			}
+			watermarks[rollupKey(measurement, level.Name)] = *w
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("汇总%s失败: %v", level.Name, err)
+		}
+	}
+	return nil
+}
+
+// computeRange 按块计算[from, to)内的汇总数据，每块完成后调用done
+func (s *RollupService) computeRange(measurement string, fields []string, source string, level model.RollupLevel, from, to time.Time, done func(end time.Time) error) error {
+	chunk := level.Every * rollupChunkBuckets
+	for start := from; start.Before(to); {
+		end := start.Add(chunk)
+		if end.After(to) {
+			end = to
+		}
+		if _, err := s.rollupRepo.ComputeAndWriteRollup(measurement, fields, source, level, start, end); err != nil {
+			return err
+		}
+		if done != nil {
+			if err := done(end); err != nil {
+				return err
+			}
+		}
+		start = end
+	}
+	return nil
+}
+
+// Backfill 异步重新计算指定时间范围内的汇总数据（用于迟到的数据或首次启用前的历史数据）
+func (s *RollupService) Backfill(req *model.RollupBackfillReq) error {
+	m, ok := rollupMeasurementConfig(req.Measurement)
+	if !ok {
+		return errors.New("该measurement未启用汇总")
+	}
+	if req.EndTime <= req.StartTime {
+		return errors.New("结束时间必须大于开始时间")
+	}
+
+	go func() {
+		if err := s.Rebuild(m.Name, time.Unix(req.StartTime, 0), time.Unix(req.EndTime, 0)); err != nil {
+			logger.L().Warn("回填汇总数据失败", logger.WithError(err), logger.WithString("measurement", m.Name))
+			return
+		}
+		logger.L().Info("回填汇总数据完成", logger.WithString("measurement", m.Name),
+			logger.WithInt64("start_time", req.StartTime), logger.WithInt64("end_time", req.EndTime))
+	}()
+	return nil
+}
+
+// Rebuild 重新计算[start, end)内的汇总数据（measurement未启用汇总时不处理），
+// 只重算各粒度水位线之前的部分，水位线之后的数据由定时任务计算；
+// 回填范围与已覆盖范围相连时向前扩展覆盖起点，查询才会使用这部分汇总数据
+func (s *RollupService) Rebuild(measurement string, start, end time.Time) error {
+	m, ok := rollupMeasurementConfig(measurement)
+	if !ok {
+		return nil
+	}
+
+	rollupMu.Lock()
+	defer rollupMu.Unlock()
+
+	watermarks, err := s.watermarkMap()
+	if err != nil {
+		return fmt.Errorf("获取汇总水位线失败: %v", err)
+	}
+	return s.rebuild(m, watermarks, start, end)
+}
+
+// rebuild 重新计算[start, end)内水位线之前的汇总数据（调用方持有rollupMu）
+func (s *RollupService) rebuild(m config.RollupMeasurementConfig, watermarks map[string]model.RollupWatermark, start, end time.Time) error {
+	fields := rollupFields(m)
+	for i, level := range model.RollupLevels {
+		current, ok := watermarks[rollupKey(m.Name, level.Name)]
+		if !ok {
+			return nil
+		}
+		from := start.Truncate(level.Every)
+		to := ceilTime(end, level.Every)
+		if current.Watermark.Before(to) {
+			to = current.Watermark
+		}
+		source := ""
+		if i > 0 {
+			finer := watermarks[rollupKey(m.Name, model.RollupLevels[i-1].Name)]
+			// 由上一级汇总计算，不能早于上一级的覆盖起点
+			if from.Before(finer.CoverageStart) {
+				from = ceilTime(finer.CoverageStart, level.Every)
+			}
+			source = model.RollupLevels[i-1].Name
+		}
+		if !from.Before(to) {
+			continue
+		}
+		if err := s.computeRange(m.Name, fields, source, level, from, to, nil); err != nil {
+			return fmt.Errorf("汇总%s失败: %v", level.Name, err)
+		}
+		if from.Before(current.CoverageStart) && !to.Before(current.CoverageStart) {
+			current.CoverageStart = from
+			current.UpdateAt = utils.GetCurrentTime()
+			if err := s.rollupRepo.SaveWatermark(&current); err != nil {
+				return fmt.Errorf("保存汇总覆盖起点失败: %v", err)
+			}
+			watermarks[rollupKey(m.Name, level.Name)] = current
+		}
+	}
+	return nil
+}
+
+// TrimCoverage InfluxDB数据库保留期为days天时，将汇总覆盖起点推后到保留期内，
+// 更早的范围查询原始数据（及归档），不使用已过期的汇总数据
+func (s *RollupService) TrimCoverage(days int) error {
+	rollupMu.Lock()
+	defer rollupMu.Unlock()
+	since := utils.GetCurrentTime().AddDate(0, 0, -days).Truncate(24 * time.Hour).Add(24 * time.Hour)
+	return s.rollupRepo.TrimCoverage(since)
+}
+
+// GetStatus 获取各measurement的汇总字段与水位线
+func (s *RollupService) GetStatus() ([]model.RollupStatus, error) {
+	watermarks, err := s.rollupRepo.GetWatermarks()
+	if err != nil {
+		return nil, fmt.Errorf("获取汇总水位线失败: %v", err)
+	}
+
+	statuses := make([]model.RollupStatus, 0, len(rollupConfig.Measurements))
+	for _, m := range rollupConfig.Measurements {
+		status := model.RollupStatus{Measurement: m.Name, Fields: rollupFields(m), Watermarks: make([]model.RollupWatermark, 0)}
+		for _, w := range watermarks {
+			if w.Measurement == m.Name {
+				status.Watermarks = append(status.Watermarks, w)
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Start 加载配置、登记汇总的measurement并启动定时汇总任务（interval为0时不执行，ctx取消后退出）
+func (s *RollupService) Start(ctx context.Context, cfg config.RollupConfig) {
+	rollupConfig = cfg
+	if cfg.Interval <= 0 || len(cfg.Measurements) == 0 {
+		return
+	}
+
+	watermarks, err := s.rollupRepo.GetWatermarks()
+	if err != nil {
+		logger.L().Warn("获取汇总水位线失败", logger.WithError(err))
+	}
+	for _, m := range cfg.Measurements {
+		s.rollupRepo.RegisterRollup(m.Name, rollupFields(m), watermarks)
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.Interval) * time.Minute)
+		defer ticker.Stop()
+		for {
+			if err := s.RunOnce(); err != nil {
+				logger.L().Warn("时序数据汇总失败", logger.WithError(err))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// watermarkMap 以measurement/level为键的水位线
+func (s *RollupService) watermarkMap() (map[string]model.RollupWatermark, error) {
+	watermarks, err := s.rollupRepo.GetWatermarks()
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]model.RollupWatermark, len(watermarks))
+	for _, w := range watermarks {
+		result[rollupKey(w.Measurement, w.Level)] = w
+	}
+	return result, nil
+}
+
+// ceilTime 向上取整到d的整数倍
+func ceilTime(t time.Time, d time.Duration) time.Time {
+	truncated := t.Truncate(d)
+	if truncated.Before(t) {
+		return truncated.Add(d)
+	}
+	return truncated
+}
+
+func rollupKey(measurement, level string) string {
+	return measurement + "/" + level
+}
+
+// rollupMeasurementConfig 查找measurement的汇总配置
+func rollupMeasurementConfig(measurement string) (config.RollupMeasurementConfig, bool) {
+	for _, m := range rollupConfig.Measurements {
+		if m.Name == measurement {
+			return m, true
+		}
+	}
+	return config.RollupMeasurementConfig{}, false
+}
+
+// rollupFields 汇总的字段，默认只汇总value
+func rollupFields(m config.RollupMeasurementConfig) []string {
+	if len(m.Fields) == 0 {
+		return []string{"value"}
+	}
+	return m.Fields
+}
+
+func rollupLag() time.Duration {
+	if rollupConfig.Lag <= 0 {
+		return defaultRollupLag * time.Minute
+	}
+	return time.Duration(rollupConfig.Lag) * time.Minute
+}
+
+func rollupInitialLookback() time.Duration {
+	if rollupConfig.InitialLookback <= 0 {
+		return defaultRollupInitialLookback * time.Hour
+	}
+	return time.Duration(rollupConfig.InitialLookback) * time.Hour
+}
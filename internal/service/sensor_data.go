@@ -3,6 +3,7 @@ package service
 import (
 	"backend/internal/model"
 	"backend/internal/repo"
+	"backend/pkg/logger"
 	"backend/pkg/utils"
 	"crypto/md5"
 	"encoding/hex"
@@ -11,31 +12,29 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 )
 
+// ErrHealthForbidden 上传数据时携带健康指标需要管理员或设备写权限
+var ErrHealthForbidden = errors.New("您没有权限上报该设备的健康指标")
+
 type SensorDataService struct {
 	metadataRepo   *repo.MetadataRepository
 	sensorDataRepo *repo.SensorDataRepository
 	deviceUserRepo *repo.DeviceUserRepository
 	deviceRepo     *repo.DeviceRepository
-	// 用于临时存储上传信息的map（生产环境应该使用Redis）
-	uploadSessions map[string]*UploadSession
-	mu             sync.RWMutex
-}
-
-// UploadSession 上传会话信息
-type UploadSession struct {
-	UploadID    string
-	DevID       int64
-	BucketName  string
-	BucketKey   string
-	Filename    string
-	ContentType string
-	UID         int64
-	CreatedAt   time.Time
-	ExpiresAt   time.Time
+	healthService  *DeviceHealthService
+	catalogService *FileCatalogService
+	uploadService  *UploadSessionService
+	archiveService *SeriesArchiveService
+	outboxService  *SeriesOutboxService
+	ingestService  *IngestService
+	schemaService  *MeasurementSchemaService
+	qualityService *QualityService
+	anomalyService *AnomalyService
+	derivedService *DerivedFieldService
+	unitService    *UnitService
+	calibService   *CalibrationService
 }
 
 func NewSensorDataService() *SensorDataService {
@@ -44,34 +43,84 @@ func NewSensorDataService() *SensorDataService {
 		sensorDataRepo: repo.NewSensorDataRepository(),
 		deviceUserRepo: repo.NewDeviceUserRepository(),
 		deviceRepo:     repo.NewDeviceRepository(),
-		uploadSessions: make(map[string]*UploadSession),
+		healthService:  NewDeviceHealthService(),
+		catalogService: NewFileCatalogService(),
+		uploadService:  NewUploadSessionService(),
+		archiveService: NewSeriesArchiveService(),
+		outboxService:  NewSeriesOutboxService(),
+		ingestService:  NewIngestService(),
+		schemaService:  NewMeasurementSchemaService(),
+		qualityService: NewQualityService(),
+		anomalyService: NewAnomalyService(),
+		derivedService: NewDerivedFieldService(),
+		unitService:    NewUnitService(),
+		calibService:   NewCalibrationService(),
 	}
 }
 
 // GetPresignedPutURL 生成预签名PUT URL
-func (s *SensorDataService) GetPresignedPutURL(devID int64, filename, bucketName, contentType string, uid int64) (map[string]any, error) {
+// 提供sha256且设备已有相同内容的文件时（除非allow_duplicate），返回已有文件而不签发上传URL
+func (s *SensorDataService) GetPresignedPutURL(devID int64, req *model.GetPresignedPutURLReq, uid int64, role string) (map[string]any, error) {
 	// 检查设备是否存在
 	_, err := s.deviceRepo.GetDevice(devID)
 	if err != nil {
 		return nil, errors.New("设备不存在")
 	}
 
+	// 权限判断：普通用户需要有设备的写权限（重复检测会返回已有文件的位置），管理员不需要
+	if role != model.RoleAdmin {
+		deviceUser, err := s.deviceUserRepo.GetDeviceUser(devID, uid)
+		if err != nil {
+			return nil, errors.New("您没有权限访问该设备")
+		}
+		if deviceUser.PermissionLevel != model.PermissionLevelWrite &&
+			deviceUser.PermissionLevel != model.PermissionLevelReadWrite {
+			return nil, errors.New("您没有写权限")
+		}
+	}
+
 	// 确定bucket名称（如果为空，根据文件类型推断）
+	bucketName := req.BucketName
 	if bucketName == "" {
-		bucketName = getBucketNameByFilePath(filename)
+		bucketName = getBucketNameByFilePath(req.Filename)
+	}
+
+	// 重复内容检测
+	if req.SHA256 != "" && !req.AllowDuplicate {
+		dup, err := s.uploadService.FindDuplicate(devID, req.SHA256)
+		if err != nil {
+			return nil, fmt.Errorf("查询重复文件失败: %v", err)
+		}
+		if dup != nil {
+			dupBucket, _ := dup.ExtraData["bucket_name"].(string)
+			dupKey, _ := dup.ExtraData["bucket_key"].(string)
+			return map[string]any{
+				"duplicate":   true,
+				"data_id":     dup.DataID,
+				"bucket_name": dupBucket,
+				"bucket_key":  dupKey,
+			}, nil
+		}
 	}
 
 	// 生成object key（格式: dev_id/YYYY/MM/DD/filename）
 	now := time.Now()
-	objectKey := fmt.Sprintf("%d/%d/%02d/%02d/%s", devID, now.Year(), now.Month(), now.Day(), filename)
+	baseKey := fmt.Sprintf("%d/%d/%02d/%02d/%s", devID, now.Year(), now.Month(), now.Day(), req.Filename)
 
 	// 如果没有提供content_type，根据文件扩展名推断
+	contentType := req.ContentType
 	if contentType == "" {
-		contentType = getContentTypeByFilePath(filename)
+		contentType = getContentTypeByFilePath(req.Filename)
 	}
 
 	// 生成上传ID（使用MD5哈希）
-	uploadID := generateUploadID(devID, objectKey, uid)
+	uploadID := generateUploadID(devID, baseKey, uid)
+
+	// 同名文件已存在或正在上传时使用不冲突的key，避免覆盖
+	objectKey, err := s.uploadService.AllocateObjectKey(bucketName, baseKey, uploadID)
+	if err != nil {
+		return nil, fmt.Errorf("分配对象key失败: %v", err)
+	}
 
 	// 生成预签名PUT URL（有效期15分钟）
 	presignedURL, err := s.sensorDataRepo.PresignedPutObject(bucketName, objectKey, 15*time.Minute)
@@ -79,50 +128,24 @@ func (s *SensorDataService) GetPresignedPutURL(devID int64, filename, bucketName
 		return nil, fmt.Errorf("生成预签名URL失败: %v", err)
 	}
 
-	// 保存上传会话信息（生产环境应该使用Redis）
-	session := &UploadSession{
-		UploadID:    uploadID,
-		DevID:       devID,
-		BucketName:  bucketName,
-		BucketKey:   objectKey,
-		Filename:    filename,
-		ContentType: contentType,
-		UID:         uid,
-		CreatedAt:   now,
-		ExpiresAt:   now.Add(30 * time.Minute), // 会话有效期30分钟
+	// 保存上传会话信息：对象上传完成后由存储事件自动确认，或由客户端调用file_data确认
+	if _, err := s.uploadService.CreateSession(uploadID, devID, bucketName, objectKey, req.Filename, contentType, req.SHA256, uid); err != nil {
+		return nil, err
 	}
 
-	s.mu.Lock()
-	s.uploadSessions[uploadID] = session
-	s.mu.Unlock()
-
-	// 启动后台清理过期会话的goroutine
-	go s.cleanExpiredSessions()
-
 	return map[string]any{
+		"duplicate":     false,
 		"upload_id":     uploadID,
 		"upload_url":    presignedURL,
 		"bucket_name":   bucketName,
 		"bucket_key":    objectKey,
 		"content_type":  contentType,
+		"sha256":        strings.ToLower(req.SHA256),
 		"expires_in":    900,
 		"upload_method": "PUT",
 	}, nil
 }
 
-// cleanExpiredSessions 清理过期的上传会话
-func (s *SensorDataService) cleanExpiredSessions() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	now := time.Now()
-	for id, session := range s.uploadSessions {
-		if now.After(session.ExpiresAt) {
-			delete(s.uploadSessions, id)
-		}
-	}
-}
-
 // generateUploadID 生成上传ID
 func generateUploadID(devID int64, objectKey string, uid int64) string {
 	data := fmt.Sprintf("%d-%s-%d-%d", devID, objectKey, uid, time.Now().UnixNano())
@@ -131,33 +154,61 @@ func generateUploadID(devID int64, objectKey string, uid int64) string {
 }
 
 // UploadSensorData 上传传感器数据（统一接口）
-func (s *SensorDataService) UploadSensorData(req *model.UploadSensorDataRequest) (int64, error) {
+func (s *SensorDataService) UploadSensorData(req *model.UploadSensorDataRequest, currentUID int64, role string) (int64, error) {
 	// 检查设备是否存在
-	_, err := s.deviceRepo.GetDevice(req.Metadata.DevID.Int64())
+	device, err := s.deviceRepo.GetDevice(req.Metadata.DevID.Int64())
 	if err != nil {
 		return 0, errors.New("设备不存在")
 	}
 
+	// 健康指标会更新设备电量/在线状态并触发低电量告警，在写入数据前检查权限
+	if req.Health != nil && !s.canWriteDevice(req.Metadata.DevID.Int64(), currentUID, role) {
+		return 0, ErrHealthForbidden
+	}
+
 	// 生成data_id
 	if req.Metadata.DataID == 0 {
 		req.Metadata.DataID = utils.GetDefaultSnowflake().Generate()
 	}
 	if req.Metadata.DataType == model.DataTypeSeries {
-		if err := s.uploadSeriesData(req); err != nil {
+		if err := s.uploadSeriesData(req, device); err != nil {
 			return 0, err
 		}
-		return req.Metadata.DataID, nil
 	} else if req.Metadata.DataType == model.DataTypeFileData {
-		if err := s.uploadFileData(req); err != nil {
+		if err := s.uploadFileData(req, currentUID, role); err != nil {
 			return 0, err
 		}
-		return req.Metadata.DataID, nil
+	} else {
+		return 0, errors.New("不支持的data_type")
+	}
+
+	// 随数据上报的健康指标，记录失败不影响数据上传结果
+	if req.Health != nil {
+		if req.Health.Timestamp == 0 && !req.Metadata.Timestamp.IsZero() {
+			req.Health.Timestamp = req.Metadata.Timestamp.Unix()
+		}
+		if err := s.healthService.RecordHealth(req.Metadata.DevID.Int64(), req.Health); err != nil {
+			logger.L().Warn("记录设备健康指标失败", logger.WithError(err), logger.WithInt64("dev_id", req.Metadata.DevID.Int64()))
+		}
+	}
+	return req.Metadata.DataID, nil
+}
+
+// canWriteDevice 当前用户是否为管理员或拥有设备写权限
+func (s *SensorDataService) canWriteDevice(devID int64, currentUID int64, role string) bool {
+	if role == model.RoleAdmin {
+		return true
+	}
+	deviceUser, err := s.deviceUserRepo.GetDeviceUser(devID, currentUID)
+	if err != nil {
+		return false
 	}
-	return 0, errors.New("不支持的data_type")
+	return deviceUser.PermissionLevel == model.PermissionLevelWrite ||
+		deviceUser.PermissionLevel == model.PermissionLevelReadWrite
 }
 
-// uploadSeriesData 上传时序数据
-func (s *SensorDataService) uploadSeriesData(req *model.UploadSensorDataRequest) error {
+// uploadSeriesData 上传时序数据（按设备类型的schema校验，不符合时返回 *SchemaValidationError）
+func (s *SensorDataService) uploadSeriesData(req *model.UploadSensorDataRequest, device *model.Device) error {
 	if len(req.SeriesData.Points) == 0 {
 		return errors.New("时序数据点不能为空")
 	}
@@ -218,121 +269,143 @@ func (s *SensorDataService) uploadSeriesData(req *model.UploadSensorDataRequest)
 		}
 	}
 
-	// 先写入InfluxDB，成功后再创建元数据，保证原子性
-	if err := s.sensorDataRepo.CreateSeriesData(&req.SeriesData); err != nil {
-		return fmt.Errorf("写入InfluxDB失败: %v", err)
+	// 如果timestamp为空，使用当前时间
+	if req.Metadata.Timestamp.IsZero() {
+		req.Metadata.Timestamp = time.Now()
 	}
 
-	// InfluxDB写入成功，再创建元数据
-	if err := s.createMetadata(&req.Metadata); err != nil {
-		// 元数据创建失败，需要回滚InfluxDB中的数据
-		// 注意：这里简化处理，实际生产环境可能需要更复杂的补偿机制
-		return fmt.Errorf("创建元数据失败: %v（时序数据已写入InfluxDB）", err)
+	// 按metadata声明的单位转换为存储单位（在schema校验之前，范围按存储单位检查）
+	if err := s.unitService.NormalizeUpload(device, &req.Metadata, req.SeriesData.Points); err != nil {
+		return err
 	}
 
-	return nil
-}
-
-// uploadFileData 验证文件上传并创建元数据
-func (s *SensorDataService) uploadFileData(req *model.UploadSensorDataRequest) error {
-	uploadID := req.FileData.UploadID
-	if uploadID == "" {
-		return errors.New("file_data.upload_id不能为空")
-	}
-
-	// 获取上传会话信息
-	s.mu.RLock()
-	session, exists := s.uploadSessions[uploadID]
-	s.mu.RUnlock()
-
-	if !exists {
-		return errors.New("无效的upload_id或上传会话已过期")
+	// 按设备的校准配置将原始值转换为校准值（系数按存储单位，校准值参与schema校验与质量评分）
+	calibration, err := s.calibService.Calibrate(device.DevID.Int64(), req.SeriesData.Points)
+	if err != nil {
+		return err
 	}
-
-	// 验证会话是否过期
-	if time.Now().After(session.ExpiresAt) {
-		s.mu.Lock()
-		delete(s.uploadSessions, uploadID)
-		s.mu.Unlock()
-		return errors.New("上传会话已过期")
+	if calibration != nil {
+		if req.Metadata.ExtraData == nil {
+			req.Metadata.ExtraData = make(map[string]interface{})
+		}
+		req.Metadata.ExtraData[model.CalibrationMetadataKey] = calibration.Applied()
 	}
 
-	// 验证设备ID匹配
-	if session.DevID != req.Metadata.DevID.Int64() {
-		return errors.New("设备ID不匹配")
+	// 按schema校验字段与tag（coerce开启时转换字段值）
+	schemas, err := s.schemaService.ValidatePoints(device.DevType, req.SeriesData.Points)
+	if err != nil {
+		return err
 	}
 
-	// 使用会话中的bucket信息（如果客户端指定了bucket_name，则使用客户端的）
-	bucketName := req.FileData.BucketName
-	if bucketName == "" {
-		bucketName = session.BucketName
+	// 服务端计算质量评分，替换客户端提供的quality_score，评分明细记录在extra_data.quality
+	if s.qualityService.Enabled() {
+		report := s.qualityService.Score(&model.QualityInput{Device: device, Points: req.SeriesData.Points, Schemas: schemas})
+		req.Metadata.QualityScore = FormatQualityScore(report.Score)
+		if req.Metadata.ExtraData == nil {
+			req.Metadata.ExtraData = make(map[string]interface{})
+		}
+		req.Metadata.ExtraData["quality"] = report
+		for i := range req.SeriesData.Points {
+			req.SeriesData.Points[i].Tags["quality_score"] = req.Metadata.QualityScore
+		}
 	}
 
-	// 使用会话中的bucket_key（如果客户端指定了bucket_key，则使用客户端的）
-	bucketKey := req.FileData.BucketKey
-	if bucketKey == "" {
-		bucketKey = session.BucketKey
-	}
+	// 保留的原始值写入 {field}_raw，修正校准系数后可据此重新计算
+	calibration.AttachRaw(req.SeriesData.Points)
 
-	// 验证文件是否存在于MinIO（确认客户端上传成功）
-	_, err := s.sensorDataRepo.GetObjectInfo(bucketName, bucketKey)
-	if err != nil {
-		return fmt.Errorf("文件未找到，请确认是否上传成功: %v", err)
-	}
+	// 上传时计算的派生字段写入 {measurement}_derived，与源数据点一起写入
+	req.SeriesData.Points = append(req.SeriesData.Points, s.derivedService.Materialize(device.DevType, req.SeriesData.Points)...)
 
-	// 更新元数据
-	if req.Metadata.ExtraData == nil {
-		req.Metadata.ExtraData = make(map[string]any)
+	if s.ingestService.Enabled() {
+		// 写入管道已启动时异步写入（队列满返回ErrIngestQueueFull，暂存已满返回ErrIngestUnavailable）
+		err = s.ingestService.Submit(&req.Metadata, req.SeriesData.Points)
+	} else {
+		// 通过写入记录保证InfluxDB与元数据一致：InfluxDB写入失败时补偿，元数据创建失败时由后台任务重试
+		err = s.outboxService.Write(&req.Metadata, &req.SeriesData)
 	}
-	req.Metadata.ExtraData["bucket_name"] = bucketName
-	req.Metadata.ExtraData["bucket_key"] = bucketKey
-	req.Metadata.ExtraData["filename"] = session.Filename
-	req.Metadata.ExtraData["content_type"] = session.ContentType
-
-	// 创建元数据
-	if err := s.createMetadata(&req.Metadata); err != nil {
-		return fmt.Errorf("创建元数据失败: %v", err)
+	if err != nil {
+		return err
 	}
 
-	// 删除上传会话
-	s.mu.Lock()
-	delete(s.uploadSessions, uploadID)
-	s.mu.Unlock()
-
+	// 异常检测（异步，不影响上传结果）
+	s.anomalyService.Observe(req.Metadata.DevID.Int64(), req.Metadata.DataID, req.SeriesData.Points)
 	return nil
 }
 
-// createMetadata 创建元数据
-func (s *SensorDataService) createMetadata(metadata *model.Metadata) error {
-	// 如果data_id未提供，生成新的
-	if metadata.DataID == 0 {
-		metadata.DataID = utils.GetDefaultSnowflake().Generate()
-	}
-	// 如果timestamp为空，使用当前时间
-	if metadata.Timestamp.IsZero() {
-		metadata.Timestamp = time.Now()
-	}
-	return s.metadataRepo.CreateMetadata(metadata)
+// AsyncIngest 时序数据是否异步写入（上传成功只表示已进入写入队列）
+func (s *SensorDataService) AsyncIngest() bool {
+	return s.ingestService.Enabled()
 }
 
-// GetSeriesData 查询时序数据
+// uploadFileData 验证文件上传并创建元数据（存储事件已自动确认时返回已有的data_id）
+func (s *SensorDataService) uploadFileData(req *model.UploadSensorDataRequest, currentUID int64, role string) error {
+	return s.uploadService.ConfirmUpload(req, currentUID, role)
+}
+
+// GetSeriesData 查询时序数据，units指定字段需要转换的单位（字段 -> 单位），同时返回结果中各字段的单位
 func (s *SensorDataService) GetSeriesData(measurement string, devID int64, currentUID int64, startTime, endTime int64,
-	tags map[string]string, fields map[string]any, downSampleInterval string, aggregate string, limitPoints int, role string) ([]model.Point, error) {
+	tags map[string]string, fields map[string]any, downSampleInterval string, aggregate string, limitPoints int,
+	units map[string]string, role string) ([]model.Point, map[string]string, error) {
 
 	// 权限判断：普通用户需要检查设备权限，管理员不需要
 	if role != "admin" {
 		deviceUser, err := s.deviceUserRepo.GetDeviceUser(devID, currentUID)
 		if err != nil {
-			return nil, errors.New("您没有权限访问该设备的数据")
+			return nil, nil, errors.New("您没有权限访问该设备的数据")
 		}
 		// 检查是否有读权限
 		if deviceUser.PermissionLevel != model.PermissionLevelRead &&
 			deviceUser.PermissionLevel != model.PermissionLevelReadWrite {
-			return nil, errors.New("您没有读权限")
+			return nil, nil, errors.New("您没有读权限")
 		}
 	}
 
-	return s.sensorDataRepo.QuerySeriesData(measurement, devID, startTime, endTime, tags, fields, downSampleInterval, aggregate, limitPoints)
+	device, err := s.deviceRepo.GetDevice(devID)
+	if err != nil {
+		return nil, nil, errors.New("设备不存在")
+	}
+
+	// 查询时计算的派生字段（fields中的派生字段替换为表达式依赖的字段）
+	plan, fields, err := s.derivedService.PrepareQuery(device.DevType, measurement, fields)
+	if err != nil {
+		logger.L().Warn("获取派生字段失败", logger.WithError(err), logger.WithInt64("dev_id", devID))
+	}
+
+	// 字段的存储单位（派生字段使用定义的单位），请求的单位无法转换时在查询前返回错误
+	fieldUnits, err := s.unitService.FieldUnits(device.DevType, devID, measurement)
+	if err != nil {
+		return nil, nil, err
+	}
+	for name, unit := range plan.Units() {
+		fieldUnits[name] = unit
+	}
+	if _, err := ConvertPoints(nil, fieldUnits, units, aggregate); err != nil {
+		return nil, nil, err
+	}
+
+	points, err := s.sensorDataRepo.QuerySeriesData(measurement, devID, startTime, endTime, tags, fields, downSampleInterval, aggregate, limitPoints)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 合并已归档到Parquet的数据
+	points, err = s.archiveService.MergeArchived(points, measurement, devID, startTime, endTime, tags, fields, downSampleInterval, aggregate, limitPoints)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 过滤已补偿（写入未完成）的数据点
+	points, err = s.outboxService.FilterTombstoned(points, devID, startTime, endTime)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.derivedService.ApplyQuery(plan, points)
+
+	resultUnits, err := ConvertPoints(points, fieldUnits, units, aggregate)
+	if err != nil {
+		return nil, nil, err
+	}
+	return points, resultUnits, nil
 }
 
 // GetSensorDataStatistic 获取时序数据统计信息
@@ -354,68 +427,159 @@ func (s *SensorDataService) GetSensorDataStatistic(devID int64, measurement stri
 }
 
 // GetFileList 获取文件列表
-// bucketName: bucket名称（如image、video、audio等）
-// devID: 设备ID，用于过滤文件（文件key格式为dev_id/YYYY/MM/DD/filename）
-// role: 用户角色（"admin"或普通用户），用于权限判断
-// currentUID: 当前用户ID，普通用户只能查询有权限的设备数据
-func (s *SensorDataService) GetFileList(page, pageSize int, bucketName string, devID int64, role string, currentUID int64) ([]model.FileList, int64, error) {
+// 只列举 dev_id/ 前缀下的对象，使用start-after游标分页；日期范围利用 dev_id/YYYY/MM/DD/ 的key布局直接定位起止位置
+// 预览URL只在 WithPreview 时为本页文件生成
+func (s *SensorDataService) GetFileList(query *model.FileListQuery, role string, currentUID int64) (*model.FileListPage, error) {
 	// 权限判断：普通用户需要检查设备权限，管理员不需要
 	if role != "admin" {
-		deviceUser, err := s.deviceUserRepo.GetDeviceUser(devID, currentUID)
+		deviceUser, err := s.deviceUserRepo.GetDeviceUser(query.DevID, currentUID)
 		if err != nil {
-			return nil, 0, errors.New("您没有权限访问该设备的数据")
+			return nil, errors.New("您没有权限访问该设备的数据")
 		}
 		// 检查是否有读权限
 		if deviceUser.PermissionLevel != model.PermissionLevelRead &&
 			deviceUser.PermissionLevel != model.PermissionLevelReadWrite {
-			return nil, 0, errors.New("您没有读权限")
+			return nil, errors.New("您没有读权限")
 		}
 	}
 
 	// 验证bucket名称
-	if bucketName == "" {
-		return nil, 0, errors.New("bucket_name不能为空")
+	if query.BucketName == "" {
+		return nil, errors.New("bucket_name不能为空")
 	}
 
-	// 从MinIO获取文件列表
-	allFiles, err := s.sensorDataRepo.GetFileLists(bucketName)
-	if err != nil {
-		return nil, 0, fmt.Errorf("获取文件列表失败: %v", err)
+	prefix := fmt.Sprintf("%d/", query.DevID)
+	startAfter := query.StartAfter
+
+	// 日期范围：起始位置为 dev_id/YYYY/MM/DD（该天所有key都排在其后），结束位置为结束日期次日
+	var endBefore string
+	var startDate, endDate time.Time
+	var err error
+	if query.StartDate != "" {
+		if startDate, err = parseFileKeyDate(query.StartDate); err != nil {
+			return nil, fmt.Errorf("start_date格式错误: %v", err)
+		}
+		if lower := prefix + startDate.Format(fileKeyDateLayout); startAfter < lower {
+			startAfter = lower
+		}
+	}
+	if query.EndDate != "" {
+		if endDate, err = parseFileKeyDate(query.EndDate); err != nil {
+			return nil, fmt.Errorf("end_date格式错误: %v", err)
+		}
+		if !startDate.IsZero() && endDate.Before(startDate) {
+			return nil, errors.New("end_date不能早于start_date")
+		}
+		endBefore = prefix + endDate.AddDate(0, 0, 1).Format(fileKeyDateLayout)
 	}
 
-	// 根据dev_id过滤文件（文件key格式为dev_id/YYYY/MM/DD/filename 或 dev_id/filename）
-	filteredFiles := make([]model.FileList, 0)
-	prefix := fmt.Sprintf("%d/", devID)
-	for _, file := range allFiles {
-		// 检查文件key是否以 "dev_id/" 开头
-		if strings.HasPrefix(file.BucketKey, prefix) {
-			filteredFiles = append(filteredFiles, file)
+	// 指定了日期范围时，跳过不符合 dev_id/YYYY/MM/DD/ 布局的key
+	var keep func(string) bool
+	if query.StartDate != "" || query.EndDate != "" {
+		keep = func(key string) bool {
+			_, ok := fileKeyDate(key)
+			return ok
 		}
 	}
 
-	// 分页处理
-	total := int64(len(filteredFiles))
-	start := (page - 1) * pageSize
-	end := start + pageSize
+	// 以metadata为文件目录（与对账、删除保持一致），按bucket_key游标分页
+	files, hasMore, err := s.catalogService.ListDeviceFiles(query.BucketName, query.DevID, startAfter, endBefore, query.PageSize, keep)
+	if err != nil {
+		return nil, fmt.Errorf("获取文件列表失败: %v", err)
+	}
 
-	if start >= len(filteredFiles) {
-		return []model.FileList{}, total, nil
+	// 缩略图信息记录在metadata中，按本页key批量查询
+	var thumbnails map[string]string
+	if query.WithPreview && len(files) > 0 {
+		keys := make([]string, 0, len(files))
+		for _, f := range files {
+			keys = append(keys, f.BucketKey)
+		}
+		if thumbnails, err = s.catalogService.ThumbnailURLs(query.BucketName, keys); err != nil {
+			logger.L().Warn("获取缩略图失败", logger.WithError(err))
+		}
 	}
-	if end > len(filteredFiles) {
-		end = len(filteredFiles)
+
+	for i := range files {
+		if files[i].ContentType == "" {
+			files[i].ContentType = getContentTypeByFilePath(files[i].BucketKey)
+		}
+		if query.WithPreview {
+			url, err := s.sensorDataRepo.PresignedPreviewURL(query.BucketName, files[i].BucketKey)
+			if err != nil {
+				return nil, fmt.Errorf("生成预览URL失败: %v", err)
+			}
+			files[i].PreviewUrl = url
+			files[i].ThumbnailURL = thumbnails[files[i].BucketKey]
+		}
 	}
 
-	return filteredFiles[start:end], total, nil
+	page := &model.FileListPage{Items: files, HasMore: hasMore}
+	if hasMore && len(files) > 0 {
+		page.NextStartAfter = files[len(files)-1].BucketKey
+	}
+	return page, nil
 }
 
-// DownloadFile 下载文件
-func (s *SensorDataService) DownloadFile(bucketName, objectKey string) (string, error) {
+// DownloadFile 下载文件（需要对文件所属设备有读权限）
+func (s *SensorDataService) DownloadFile(bucketName, objectKey string, currentUID int64, role string) (string, error) {
 	if bucketName == "" || objectKey == "" {
 		return "", errors.New("bucket_name和bucket_key不能为空")
 	}
+	if err := s.checkFileReadPermission(bucketName, objectKey, currentUID, role); err != nil {
+		return "", err
+	}
 	return s.sensorDataRepo.DownloadFile(bucketName, objectKey, "")
 }
 
+// GetFilePreviewURL 获取单个文件的预览URL（需要对文件所属设备有读权限）
+func (s *SensorDataService) GetFilePreviewURL(bucketName, objectKey string, currentUID int64, role string) (string, error) {
+	if bucketName == "" || objectKey == "" {
+		return "", errors.New("bucket_name和bucket_key不能为空")
+	}
+	if err := s.checkFileReadPermission(bucketName, objectKey, currentUID, role); err != nil {
+		return "", err
+	}
+	return s.sensorDataRepo.PresignedPreviewURL(bucketName, objectKey)
+}
+
+// checkFileReadPermission 检查用户对文件所属设备的读权限
+func (s *SensorDataService) checkFileReadPermission(bucketName, objectKey string, currentUID int64, role string) error {
+	devID, err := s.resolveFileDevID(bucketName, objectKey)
+	if err != nil {
+		return err
+	}
+
+	// 权限判断：普通用户需要检查设备权限，管理员不需要
+	if role != "admin" {
+		deviceUser, err := s.deviceUserRepo.GetDeviceUser(devID, currentUID)
+		if err != nil {
+			return errors.New("您没有权限访问该设备的数据")
+		}
+		// 检查是否有读权限
+		if deviceUser.PermissionLevel != model.PermissionLevelRead &&
+			deviceUser.PermissionLevel != model.PermissionLevelReadWrite {
+			return errors.New("您没有读权限")
+		}
+	}
+	return nil
+}
+
+// resolveFileDevID 确定文件所属设备：优先从key（dev_id/...）中解析，否则查询metadata记录
+func (s *SensorDataService) resolveFileDevID(bucketName, objectKey string) (int64, error) {
+	if parts := strings.SplitN(objectKey, "/", 2); len(parts) == 2 {
+		if devID, err := strconv.ParseInt(parts[0], 10, 64); err == nil && devID > 0 {
+			return devID, nil
+		}
+	}
+
+	metadata, err := s.metadataRepo.GetFileMetadataByBucketKey(bucketName, objectKey)
+	if err != nil {
+		return 0, errors.New("无法确定文件所属设备")
+	}
+	return metadata.DevID.Int64(), nil
+}
+
 // DeleteSeriesData 删除某设备在某时间范围内的时序数据元数据（软删除）
 // 注意：InfluxDB v3 不支持删除数据，此操作只删除元数据
 // InfluxDB 中的时序数据会通过保留策略自动过期删除
@@ -451,14 +615,10 @@ func (s *SensorDataService) DeleteFileData(bucketName, bucketKey string, current
 		return errors.New("bucket_name和bucket_key不能为空")
 	}
 
-	// 从bucket_key中提取dev_id（格式为：dev_id/filename）
-	parts := strings.Split(bucketKey, "/")
-	if len(parts) < 2 {
-		return errors.New("bucket_key格式错误，应为dev_id/filename")
-	}
-	devID, err := strconv.ParseInt(parts[0], 10, 64)
+	// 确定文件所属设备（key格式为：dev_id/...，或从metadata记录中查找）
+	devID, err := s.resolveFileDevID(bucketName, bucketKey)
 	if err != nil {
-		return errors.New("无法从bucket_key中提取dev_id")
+		return err
 	}
 
 	// 权限判断：普通用户需要检查设备权限，管理员不需要
@@ -474,11 +634,29 @@ func (s *SensorDataService) DeleteFileData(bucketName, bucketKey string, current
 		}
 	}
 
-	if err := s.sensorDataRepo.DeleteObject(bucketName, bucketKey); err != nil {
-		return fmt.Errorf("删除文件失败: %v", err)
+	// 先删除metadata并登记删除补偿记录，再删除MinIO对象（失败由补偿任务重试）
+	return s.catalogService.DeleteFile(bucketName, bucketKey)
+}
+
+// fileKeyDateLayout 文件key中的日期布局（dev_id/YYYY/MM/DD/filename）
+const fileKeyDateLayout = "2006/01/02"
+
+// parseFileKeyDate 解析日期过滤参数，支持 YYYY-MM-DD 和 YYYY/MM/DD
+func parseFileKeyDate(value string) (time.Time, error) {
+	return time.ParseInLocation(fileKeyDateLayout, strings.ReplaceAll(value, "-", "/"), time.Local)
+}
+
+// fileKeyDate 从 dev_id/YYYY/MM/DD/filename 格式的key中解析日期
+func fileKeyDate(key string) (time.Time, bool) {
+	parts := strings.SplitN(key, "/", 5)
+	if len(parts) < 5 {
+		return time.Time{}, false
 	}
-	// TODO: 从metadata表删除对应记录
-	return nil
+	t, err := time.ParseInLocation(fileKeyDateLayout, parts[1]+"/"+parts[2]+"/"+parts[3], time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
 }
 
 // getContentTypeByFilePath 根据文件路径获取contentType
@@ -0,0 +1,434 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/config"
+	"backend/internal/model"
+	"backend/internal/repo"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+)
+
+const (
+	defaultSeriesArchiveOlderThan = 30 // 天
+	defaultSeriesArchiveMaxDays   = 7
+	seriesArchiveExpireMargin     = 2    // InfluxDB保留期至少比归档阈值多的天数，留给归档任务完成导出
+	defaultSeriesQueryLimit       = 6000 // 与InfluxDB查询的默认点数一致
+)
+
+var (
+	// seriesArchiveConfig 时序归档配置（Start时从配置加载）
+	seriesArchiveConfig config.SeriesArchiveConfig
+	// seriesArchiveMu 避免归档任务重复执行
+	seriesArchiveMu sync.Mutex
+)
+
+// SeriesArchiveService 时序数据冷存储：将早于阈值的数据按设备、按天导出为Parquet写入archive bucket，
+// 查询时序数据时合并归档数据与InfluxDB中的数据
+type SeriesArchiveService struct {
+	archiveRepo   *repo.SeriesArchiveRepository
+	retentionRepo *repo.RetentionRepository
+	rollupService *RollupService
+}
+
+func NewSeriesArchiveService() *SeriesArchiveService {
+	return &SeriesArchiveService{
+		archiveRepo:   repo.NewSeriesArchiveRepository(),
+		retentionRepo: repo.NewRetentionRepository(),
+		rollupService: NewRollupService(),
+	}
+}
+
+// RunOnce 归档所有配置的measurement
+func (s *SeriesArchiveService) RunOnce(ctx context.Context) error {
+	if !seriesArchiveMu.TryLock() {
+		return errors.New("时序归档正在执行")
+	}
+	defer seriesArchiveMu.Unlock()
+
+	cutoff := utcDay(utils.GetCurrentTime().AddDate(0, 0, -seriesArchiveOlderThan()))
+
+	for _, measurement := range seriesArchiveConfig.Measurements {
+		if err := s.archiveMeasurement(ctx, measurement, cutoff); err != nil {
+			logger.L().Warn("时序数据归档失败", logger.WithError(err), logger.WithString("measurement", measurement))
+		}
+	}
+
+	if seriesArchiveConfig.ExpireInfluxDB {
+		if err := s.expireInfluxDB(); err != nil {
+			logger.L().Warn("设置InfluxDB保留期失败", logger.WithError(err))
+		}
+	}
+	return nil
+}
+
+// expireInfluxDB 所有measurement都已归档到保留期之前时，将InfluxDB数据库保留期设为older_than加余量天数，
+// 使已归档的数据从InfluxDB过期（InfluxDB 3不支持按条件删除）；保留期内还有未归档的数据时不设置
+func (s *SeriesArchiveService) expireInfluxDB() error {
+	days := seriesArchiveOlderThan() + seriesArchiveExpireMargin
+	pending, err := s.PendingBefore(utils.GetCurrentTime().AddDate(0, 0, -days))
+	if err != nil {
+		return err
+	}
+	if pending != "" {
+		logger.L().Info("归档尚未完成，暂不设置InfluxDB保留期", logger.WithString("measurement", pending))
+		return nil
+	}
+	if err := s.retentionRepo.SetInfluxRetentionPeriod(days); err != nil {
+		return err
+	}
+	// 汇总数据同样过期，覆盖起点推后到保留期内
+	return s.rollupService.TrimCoverage(days)
+}
+
+// archiveMeasurement 从归档进度开始逐天归档到cutoff（不含）
+func (s *SeriesArchiveService) archiveMeasurement(ctx context.Context, measurement string, cutoff time.Time) error {
+	day, ok, err := s.archiveRepo.GetWatermark(measurement)
+	if err != nil {
+		return fmt.Errorf("获取归档进度失败: %v", err)
+	}
+	if !ok {
+		earliest, found, err := s.archiveRepo.EarliestTime(measurement)
+		if err != nil {
+			return fmt.Errorf("获取最早数据时间失败: %v", err)
+		}
+		if !found {
+			return nil
+		}
+		day = utcDay(earliest)
+	}
+
+	maxDays := seriesArchiveConfig.MaxDaysPerRun
+	if maxDays <= 0 {
+		maxDays = defaultSeriesArchiveMaxDays
+	}
+	for n := 0; n < maxDays && day.Before(cutoff); n++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		next := day.AddDate(0, 0, 1)
+		if err := s.archiveDay(ctx, measurement, day, next); err != nil {
+			return fmt.Errorf("归档%s失败: %v", day.Format("2006-01-02"), err)
+		}
+		w := &model.SeriesArchiveWatermark{Measurement: measurement, ArchivedTo: next, UpdateAt: utils.GetCurrentTime()}
+		if err := s.archiveRepo.SaveWatermark(w); err != nil {
+			return fmt.Errorf("保存归档进度失败: %v", err)
+		}
+		day = next
+	}
+	return nil
+}
+
+// archiveDay 将一天的数据按设备导出为Parquet并记录清单
+func (s *SeriesArchiveService) archiveDay(ctx context.Context, measurement string, day, next time.Time) error {
+	devIDs, err := s.archiveRepo.ListDeviceIDs(measurement, day, next)
+	if err != nil {
+		return err
+	}
+	for _, devIDStr := range devIDs {
+		devID, err := strconv.ParseInt(devIDStr, 10, 64)
+		if err != nil {
+			continue
+		}
+		key := seriesArchiveKey(measurement, devID, day)
+		rows, size, err := s.archiveRepo.ExportArchive(ctx, measurement, devIDStr, day, next, key)
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			if err := s.archiveRepo.DeleteArchiveObject(key); err != nil {
+				logger.L().Warn("删除空归档文件失败", logger.WithError(err), logger.WithString("object_key", key))
+			}
+			continue
+		}
+
+		archive := &model.SeriesArchive{
+			ArchiveID:   utils.GetDefaultSnowflake().Generate(),
+			Measurement: measurement,
+			DevID:       model.DeviceID(devID),
+			Day:         day,
+			BucketName:  model.ArchiveBucketName,
+			ObjectKey:   key,
+			RowCount:    rows,
+			Size:        size,
+			CreateAt:    utils.GetCurrentTime(),
+		}
+		if err := s.archiveRepo.SaveArchive(archive); err != nil {
+			return fmt.Errorf("保存归档清单失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// PendingBefore 返回归档进度尚未到达cutoff（cutoff之前还有未导出数据）的measurement，全部已归档时返回空
+func (s *SeriesArchiveService) PendingBefore(cutoff time.Time) (string, error) {
+	for _, measurement := range seriesArchiveConfig.Measurements {
+		archivedTo, ok, err := s.archiveRepo.GetWatermark(measurement)
+		if err != nil {
+			return "", fmt.Errorf("获取归档进度失败: %v", err)
+		}
+		if ok {
+			if archivedTo.Before(utcDay(cutoff)) {
+				return measurement, nil
+			}
+			continue
+		}
+		earliest, found, err := s.archiveRepo.EarliestTime(measurement)
+		if err != nil {
+			return "", fmt.Errorf("获取最早数据时间失败: %v", err)
+		}
+		if found && earliest.Before(cutoff) {
+			return measurement, nil
+		}
+	}
+	return "", nil
+}
+
+// GetArchives 获取某设备在时间范围内的归档清单
+func (s *SeriesArchiveService) GetArchives(measurement string, devID int64, startTime, endTime int64) ([]*model.SeriesArchive, error) {
+	return s.archiveRepo.ListArchives(measurement, devID, time.Unix(startTime, 0), time.Unix(endTime, 0))
+}
+
+// MergeArchived 将查询范围内已归档日期的数据替换为Parquet中的数据，
+// 聚合查询时按与InfluxDB相同的下采样间隔在内存中聚合value字段
+func (s *SeriesArchiveService) MergeArchived(live []model.Point, measurement string, devID int64, startTime, endTime int64,
+	tags map[string]string, fields map[string]any, downSampleInterval string, aggregate string, limitPoints int) ([]model.Point, error) {
+	archives, err := s.GetArchives(measurement, devID, startTime, endTime)
+	if err != nil {
+		return nil, fmt.Errorf("获取归档清单失败: %v", err)
+	}
+	if len(archives) == 0 {
+		return live, nil
+	}
+
+	if limitPoints <= 0 {
+		limitPoints = defaultSeriesQueryLimit
+	}
+	archivedDays := make(map[int64]bool, len(archives))
+	var archived []model.Point
+	for _, a := range archives {
+		archivedDays[a.Day.Unix()] = true
+		points, err := s.archiveRepo.ReadArchive(context.Background(), a)
+		if err != nil {
+			return nil, fmt.Errorf("读取归档数据失败: %v", err)
+		}
+		for _, p := range points {
+			if p.Timestamp < startTime || p.Timestamp > endTime || !matchTags(p.Tags, tags) {
+				continue
+			}
+			if len(fields) > 0 {
+				for name := range p.Fields {
+					if _, ok := fields[name]; !ok {
+						delete(p.Fields, name)
+					}
+				}
+			}
+			archived = append(archived, p)
+		}
+	}
+
+	// keepLive InfluxDB的结果是否保留：原始数据按所在日期判断，聚合结果的窗口须完全不在已归档日期内
+	keepLive := func(p model.Point) bool { return !archivedDays[utcDay(time.Unix(p.Timestamp, 0)).Unix()] }
+	if aggregate != "" {
+		every, err := seriesDownsampleEvery(downSampleInterval, startTime, endTime, limitPoints)
+		if err != nil {
+			return nil, err
+		}
+		step := max(int64(every/time.Second), 1)
+
+		// 下采样间隔不整除一天时，跨越已归档/未归档日期边界的窗口由两部分原始数据合并后聚合，
+		// 否则同一窗口会分别从InfluxDB与归档各输出一次且都不完整
+		boundary := make(map[int64]bool)
+		for _, a := range archives {
+			dayStart := a.Day.Unix()
+			for _, t := range []int64{dayStart, dayStart + 86400 - 1} {
+				ts := t - ((t%step)+step)%step
+				if seriesWindowMixed(ts, step, archivedDays) {
+					boundary[ts] = true
+				}
+			}
+		}
+		for ts := range boundary {
+			from, to := max(ts, startTime), min(ts+step, endTime+1)
+			if from >= to {
+				continue
+			}
+			points, err := s.archiveRepo.QueryDevicePoints(measurement, devID, time.Unix(from, 0), time.Unix(to, 0))
+			if err != nil && !strings.Contains(err.Error(), "not found") {
+				return nil, fmt.Errorf("查询边界窗口数据失败: %v", err)
+			}
+			for _, p := range points {
+				if !archivedDays[utcDay(time.Unix(p.Timestamp, 0)).Unix()] && matchTags(p.Tags, tags) {
+					archived = append(archived, p)
+				}
+			}
+		}
+		keepLive = func(p model.Point) bool {
+			ts := p.Timestamp - ((p.Timestamp%step)+step)%step
+			return !boundary[ts] && !archivedDays[utcDay(time.Unix(ts, 0)).Unix()]
+		}
+
+		if archived, err = aggregatePoints(archived, every, aggregate); err != nil {
+			return nil, err
+		}
+	}
+
+	merged := make([]model.Point, 0, len(live)+len(archived))
+	for _, p := range live {
+		if keepLive(p) {
+			merged = append(merged, p)
+		}
+	}
+	merged = append(merged, archived...)
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Timestamp < merged[j].Timestamp })
+	if len(merged) > limitPoints {
+		merged = merged[:limitPoints]
+	}
+	return merged, nil
+}
+
+// Start 加载配置并启动定时归档任务（interval为0时不执行，ctx取消后退出）
+func (s *SeriesArchiveService) Start(ctx context.Context, cfg config.SeriesArchiveConfig) {
+	seriesArchiveConfig = cfg
+	if cfg.Interval <= 0 || len(cfg.Measurements) == 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.Interval) * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.RunOnce(ctx); err != nil {
+					logger.L().Warn("时序数据归档失败", logger.WithError(err))
+				}
+			}
+		}
+	}()
+}
+
+// seriesArchiveKey 归档文件key：timeseries/{measurement}/{dev_id}/YYYY/MM/DD.parquet
+func seriesArchiveKey(measurement string, devID int64, day time.Time) string {
+	return fmt.Sprintf("%s/%s/%d/%s.parquet", model.SeriesArchivePrefix, measurement, devID, day.Format("2006/01/02"))
+}
+
+// seriesWindowMixed 下采样窗口[ts, ts+step)是否同时包含已归档与未归档的日期
+func seriesWindowMixed(ts, step int64, archivedDays map[int64]bool) bool {
+	first := archivedDays[utcDay(time.Unix(ts, 0)).Unix()]
+	for day := utcDay(time.Unix(ts, 0)).AddDate(0, 0, 1); day.Unix() < ts+step; day = day.AddDate(0, 0, 1) {
+		if archivedDays[day.Unix()] != first {
+			return true
+		}
+	}
+	return false
+}
+
+// seriesArchiveEnabled 是否配置了需要归档的measurement
+func seriesArchiveEnabled() bool {
+	return seriesArchiveConfig.Interval > 0 && len(seriesArchiveConfig.Measurements) > 0
+}
+
+// seriesArchiveOlderThan 归档早于多少天的数据
+func seriesArchiveOlderThan() int {
+	if seriesArchiveConfig.OlderThan <= 0 {
+		return defaultSeriesArchiveOlderThan
+	}
+	return seriesArchiveConfig.OlderThan
+}
+
+// utcDay 时间所在的UTC日期
+func utcDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// matchTags 数据点是否满足查询的tag条件
+func matchTags(pointTags, tags map[string]string) bool {
+	for k, v := range tags {
+		if pointTags[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// seriesDownsampleEvery 下采样间隔：未指定时与InfluxDB查询一致，按点数限制自动计算
+func seriesDownsampleEvery(downSampleInterval string, startTime, endTime int64, limitPoints int) (time.Duration, error) {
+	if downSampleInterval != "" {
+		every, err := time.ParseDuration(downSampleInterval)
+		if err != nil {
+			return 0, fmt.Errorf("下采样间隔格式错误: %v", err)
+		}
+		return every, nil
+	}
+	return time.Duration(endTime-startTime) * time.Second / time.Duration(limitPoints), nil
+}
+
+// aggregatePoints 按下采样间隔聚合value字段（时间戳为窗口起点，秒级）
+func aggregatePoints(points []model.Point, every time.Duration, aggregate string) ([]model.Point, error) {
+	step := int64(every / time.Second)
+	if step < 1 {
+		step = 1
+	}
+
+	type bucketStat struct {
+		sum, min, max float64
+		count         int64
+	}
+	buckets := make(map[int64]*bucketStat)
+	for _, p := range points {
+		value, err := utils.ConvertToFloat64(p.Fields["value"])
+		if err != nil {
+			continue
+		}
+		ts := p.Timestamp - ((p.Timestamp%step)+step)%step
+		b, ok := buckets[ts]
+		if !ok {
+			b = &bucketStat{min: value, max: value}
+			buckets[ts] = b
+		}
+		b.sum += value
+		b.count++
+		if value < b.min {
+			b.min = value
+		}
+		if value > b.max {
+			b.max = value
+		}
+	}
+
+	result := make([]model.Point, 0, len(buckets))
+	for ts, b := range buckets {
+		var value any
+		switch strings.ToLower(aggregate) {
+		case "mean", "avg":
+			value = b.sum / float64(b.count)
+		case "max":
+			value = b.max
+		case "min":
+			value = b.min
+		case "sum":
+			value = b.sum
+		case "count":
+			value = b.count
+		default:
+			return nil, fmt.Errorf("归档数据不支持聚合方式: %s", aggregate)
+		}
+		result = append(result, model.Point{
+			Timestamp: ts,
+			Tags:      make(map[string]string),
+			Fields:    map[string]interface{}{"value": value},
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,292 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"backend/config"
+	"backend/internal/model"
+	"backend/internal/repo"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+)
+
+const (
+	defaultSeriesOutboxInterval   = 30 * time.Second
+	defaultSeriesOutboxStuckAfter = 2 * time.Minute
+	seriesOutboxBatchSize         = 100
+	seriesOutboxStatsSampleSize   = 20
+)
+
+// seriesOutboxConfig 时序写入补偿配置（Start时从配置加载）
+var seriesOutboxConfig config.SeriesOutboxConfig
+
+// SeriesOutboxService 时序数据跨存储写入：先在MySQL记录写入意图，再写InfluxDB，
+// 最后在同一事务内创建metadata并标记完成；中断的写入由后台任务重试或补偿
+type SeriesOutboxService struct {
+	outboxRepo     *repo.SeriesOutboxRepository
+	sensorDataRepo *repo.SensorDataRepository
+	schemaService  *MeasurementSchemaService
+	rollupService  *RollupService
+}
+
+func NewSeriesOutboxService() *SeriesOutboxService {
+	return &SeriesOutboxService{
+		outboxRepo:     repo.NewSeriesOutboxRepository(),
+		sensorDataRepo: repo.NewSensorDataRepository(),
+		schemaService:  NewMeasurementSchemaService(),
+		rollupService:  NewRollupService(),
+	}
+}
+
+// Write 写入时序数据并创建metadata
+// InfluxDB写入失败时直接补偿并返回错误；InfluxDB写入成功后metadata创建失败由后台任务重试
+func (s *SeriesOutboxService) Write(metadata *model.Metadata, series *model.SeriesData) error {
+	outbox, err := s.record(metadata, series.Points, model.SeriesOutboxStatusPending)
+	if err != nil {
+		return err
+	}
+
+	if err := s.sensorDataRepo.CreateSeriesData(series); err != nil {
+		// 分批写入可能已部分成功，标记为tombstoned，已写入的数据点在查询时过滤
+		if terr := s.outboxRepo.Tombstone(outbox.DataID, 1, err.Error(), utils.GetCurrentTime()); terr != nil {
+			logger.L().Warn("补偿时序写入失败", logger.WithError(terr), logger.WithInt64("data_id", outbox.DataID))
+		}
+		return fmt.Errorf("写入InfluxDB失败: %v", err)
+	}
+
+	s.Complete(metadata, series.Points)
+	return nil
+}
+
+// RecordQueued 记录进入写入队列的上传（由写入管道写入InfluxDB，不参与补偿任务）
+func (s *SeriesOutboxService) RecordQueued(metadata *model.Metadata, points []model.Point) error {
+	_, err := s.record(metadata, points, model.SeriesOutboxStatusQueued)
+	return err
+}
+
+// record 记录写入意图（data_id已存在时返回错误）
+func (s *SeriesOutboxService) record(metadata *model.Metadata, points []model.Point, status string) (*model.SeriesWriteOutbox, error) {
+	now := utils.GetCurrentTime()
+	outbox := &model.SeriesWriteOutbox{
+		DataID:     metadata.DataID,
+		DevID:      metadata.DevID,
+		Status:     status,
+		PointCount: len(points),
+		CreateAt:   now,
+		UpdateAt:   now,
+		Metadata:   metadata,
+		Points:     points,
+	}
+	for i, p := range points {
+		if i == 0 || p.Timestamp < outbox.MinTimestamp {
+			outbox.MinTimestamp = p.Timestamp
+		}
+		if i == 0 || p.Timestamp > outbox.MaxTimestamp {
+			outbox.MaxTimestamp = p.Timestamp
+		}
+	}
+	if err := s.outboxRepo.CreateOutbox(outbox); err != nil {
+		if strings.Contains(err.Error(), "Duplicate entry") {
+			return nil, errors.New("data_id已存在")
+		}
+		return nil, fmt.Errorf("记录时序写入失败: %v", err)
+	}
+	return outbox, nil
+}
+
+// Complete InfluxDB写入成功后创建metadata（并记录需要重新汇总的范围），失败时由补偿任务重试
+func (s *SeriesOutboxService) Complete(metadata *model.Metadata, points []model.Point) {
+	if err := s.outboxRepo.MarkWritten(metadata.DataID, utils.GetCurrentTime()); err != nil {
+		logger.L().Warn("更新时序写入记录失败", logger.WithError(err), logger.WithInt64("data_id", metadata.DataID))
+	}
+	err := s.outboxRepo.CompleteWithMetadata(metadata, utils.GetCurrentTime())
+	if err == nil {
+		s.rollupService.MarkDirty(points)
+		return
+	}
+	if errors.Is(err, repo.ErrSeriesOutboxNotOpen) {
+		return
+	}
+	logger.L().Warn("创建元数据失败，等待补偿任务重试", logger.WithError(err), logger.WithInt64("data_id", metadata.DataID))
+	if rerr := s.outboxRepo.RecordAttempt(metadata.DataID, 1, err.Error(), utils.GetCurrentTime()); rerr != nil {
+		logger.L().Warn("更新时序写入记录失败", logger.WithError(rerr), logger.WithInt64("data_id", metadata.DataID))
+	}
+}
+
+// Release 写入管道无法处理的上传交给补偿任务（dataIDs为空时处理全部队列中的记录），返回处理的数量
+func (s *SeriesOutboxService) Release(dataIDs []int64) (int64, error) {
+	return s.outboxRepo.ReleaseQueued(dataIDs, utils.GetCurrentTime())
+}
+
+// ReleaseExcept 服务重启时将队列中的记录交给补偿任务，keep中的记录（数据仍在WAL中，由重放任务完成）除外
+func (s *SeriesOutboxService) ReleaseExcept(keep map[int64]bool) (int64, error) {
+	ids, err := s.outboxRepo.ListQueuedIDs()
+	if err != nil {
+		return 0, err
+	}
+	release := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !keep[id] {
+			release = append(release, id)
+		}
+	}
+
+	var released int64
+	for start := 0; start < len(release); start += seriesOutboxBatchSize {
+		end := start + seriesOutboxBatchSize
+		if end > len(release) {
+			end = len(release)
+		}
+		n, err := s.outboxRepo.ReleaseQueued(release[start:end], utils.GetCurrentTime())
+		released += n
+		if err != nil {
+			return released, err
+		}
+	}
+	return released, nil
+}
+
+// Discard 删除未能进入写入队列的记录
+func (s *SeriesOutboxService) Discard(dataID int64) error {
+	return s.outboxRepo.DeleteQueued(dataID)
+}
+
+// ProcessStuck 重试超过stuck_after仍未完成的写入，超过最大重试次数时补偿，返回本轮完成的数量
+func (s *SeriesOutboxService) ProcessStuck() (int, error) {
+	entries, err := s.outboxRepo.GetStuckOutbox(utils.GetCurrentTime().Add(-seriesOutboxStuckAfter()), seriesOutboxBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	completed := 0
+	for _, e := range entries {
+		if s.processEntry(e) {
+			completed++
+		}
+	}
+	return completed, nil
+}
+
+// processEntry 处理单条未完成的写入：pending重新写入InfluxDB（相同时间戳与tag覆盖写入），再创建metadata
+func (s *SeriesOutboxService) processEntry(e *model.SeriesWriteOutbox) bool {
+	attempts := e.Attempts + 1
+	err := s.retryEntry(e)
+	if err == nil || errors.Is(err, repo.ErrSeriesOutboxNotOpen) {
+		return err == nil
+	}
+
+	now := utils.GetCurrentTime()
+	if attempts >= model.MaxSeriesOutboxAttempts || e.Metadata == nil {
+		logger.L().Warn("时序写入超过最大重试次数，已补偿", logger.WithError(err),
+			logger.WithInt64("data_id", e.DataID), logger.WithInt("attempts", attempts))
+		if terr := s.outboxRepo.Tombstone(e.DataID, attempts, err.Error(), now); terr != nil {
+			logger.L().Warn("补偿时序写入失败", logger.WithError(terr), logger.WithInt64("data_id", e.DataID))
+		}
+		return false
+	}
+	if rerr := s.outboxRepo.RecordAttempt(e.DataID, attempts, err.Error(), now); rerr != nil {
+		logger.L().Warn("更新时序写入记录失败", logger.WithError(rerr), logger.WithInt64("data_id", e.DataID))
+	}
+	return false
+}
+
+func (s *SeriesOutboxService) retryEntry(e *model.SeriesWriteOutbox) error {
+	if e.Metadata == nil {
+		return errors.New("写入记录缺少写入内容")
+	}
+	if e.Status == model.SeriesOutboxStatusPending {
+		s.schemaService.NormalizePoints(e.Points)
+		if err := s.sensorDataRepo.CreateSeriesData(&model.SeriesData{Points: e.Points}); err != nil {
+			return fmt.Errorf("写入InfluxDB失败: %v", err)
+		}
+		if err := s.outboxRepo.MarkWritten(e.DataID, utils.GetCurrentTime()); err != nil {
+			return err
+		}
+	}
+	if err := s.outboxRepo.CompleteWithMetadata(e.Metadata, utils.GetCurrentTime()); err != nil {
+		return err
+	}
+	s.rollupService.MarkDirty(e.Points)
+	return nil
+}
+
+// FilterTombstoned 过滤已补偿写入的数据点（按data_id tag，聚合查询的结果不含data_id，不过滤）
+func (s *SeriesOutboxService) FilterTombstoned(points []model.Point, devID int64, startTime, endTime int64) ([]model.Point, error) {
+	hasDataID := false
+	for _, p := range points {
+		if p.Tags["data_id"] != "" {
+			hasDataID = true
+			break
+		}
+	}
+	if !hasDataID {
+		return points, nil
+	}
+
+	tombstoned, err := s.outboxRepo.GetTombstonedDataIDs(devID, startTime, endTime)
+	if err != nil {
+		return nil, fmt.Errorf("获取补偿记录失败: %v", err)
+	}
+	if len(tombstoned) == 0 {
+		return points, nil
+	}
+	filtered := make([]model.Point, 0, len(points))
+	for _, p := range points {
+		if !tombstoned[p.Tags["data_id"]] {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered, nil
+}
+
+// GetStats 获取写入补偿统计（未完成、已补偿数量与卡住的记录）
+func (s *SeriesOutboxService) GetStats() (*model.SeriesOutboxStats, error) {
+	return s.outboxRepo.GetStats(utils.GetCurrentTime().Add(-seriesOutboxStuckAfter()), seriesOutboxStatsSampleSize)
+}
+
+// Start 加载配置并启动补偿任务（ctx取消后退出）
+func (s *SeriesOutboxService) Start(ctx context.Context, cfg config.SeriesOutboxConfig) {
+	seriesOutboxConfig = cfg
+	interval := time.Duration(cfg.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultSeriesOutboxInterval
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				completed, err := s.ProcessStuck()
+				if err != nil {
+					logger.L().Warn("处理时序写入补偿失败", logger.WithError(err))
+					continue
+				}
+				if completed > 0 {
+					logger.L().Info("时序写入补偿完成", logger.WithInt("completed", completed))
+				}
+				if stats, err := s.GetStats(); err == nil && stats.Stuck > 0 {
+					logger.L().Warn("存在未完成的时序写入",
+						logger.WithInt64("stuck", stats.Stuck),
+						logger.WithInt64("pending", stats.Pending),
+						logger.WithInt64("written", stats.Written))
+				}
+			}
+		}
+	}()
+}
+
+// seriesOutboxStuckAfter 超过该时间仍未完成的写入视为中断
+func seriesOutboxStuckAfter() time.Duration {
+	if seriesOutboxConfig.StuckAfter <= 0 {
+		return defaultSeriesOutboxStuckAfter
+	}
+	return time.Duration(seriesOutboxConfig.StuckAfter) * time.Second
+}
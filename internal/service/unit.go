@@ -0,0 +1,231 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"backend/internal/model"
+	"backend/internal/repo"
+	"backend/pkg/utils"
+)
+
+// ErrUnitConversion 查询时请求的单位无法转换
+var ErrUnitConversion = errors.New("单位转换失败")
+
+// UnitService 字段单位：schema定义的单位优先，否则以设备首次在metadata.extra_data.units中声明的单位为存储单位
+// 上传时将声明的单位转换为存储单位写入，查询时可按请求的单位转换
+type UnitService struct {
+	unitRepo      *repo.FieldUnitRepository
+	schemaService *MeasurementSchemaService
+}
+
+func NewUnitService() *UnitService {
+	return &UnitService{
+		unitRepo:      repo.NewFieldUnitRepository(),
+		schemaService: NewMeasurementSchemaService(),
+	}
+}
+
+// NormalizeUpload 按metadata声明的单位将数据点的字段值转换为存储单位，并将extra_data.units改为存储单位
+// 单位无法转换或字段值不是数值时返回 *SchemaValidationError
+func (s *UnitService) NormalizeUpload(device *model.Device, metadata *model.Metadata, points []model.Point) error {
+	declared := declaredUnits(metadata.ExtraData)
+	if len(declared) == 0 {
+		return nil
+	}
+
+	schemas, err := s.schemaService.GetSchemas(device.DevType, "")
+	if err != nil {
+		return fmt.Errorf("获取schema失败: %v", err)
+	}
+	schemaFields := make(map[string]map[string]model.SchemaField, len(schemas))
+	for _, schema := range schemas {
+		fields := make(map[string]model.SchemaField, len(schema.Fields))
+		for _, def := range schema.Fields {
+			fields[def.Name] = def
+		}
+		schemaFields[schema.Measurement] = fields
+	}
+
+	devID := device.DevID.Int64()
+	storedByMeasurement := make(map[string]map[string]string)
+	newUnits := make([]model.FieldUnit, 0)
+	storage := make(map[string]string, len(declared))
+	verr := &SchemaValidationError{}
+	for i := range points {
+		measurement := points[i].Measurement
+		stored, ok := storedByMeasurement[measurement]
+		if !ok {
+			if stored, err = s.unitRepo.GetFieldUnits(devID, measurement); err != nil {
+				return fmt.Errorf("获取字段单位失败: %v", err)
+			}
+			storedByMeasurement[measurement] = stored
+		}
+
+		for _, field := range sortedKeys(declared) {
+			value, ok := points[i].Fields[field]
+			if !ok {
+				continue
+			}
+			unit := declared[field]
+			def := schemaFields[measurement][field]
+			target := def.Unit
+			if target == "" {
+				target = stored[field]
+			}
+			if target == "" {
+				// 首次声明的单位作为存储单位
+				stored[field] = unit
+				target = unit
+				newUnits = append(newUnits, model.FieldUnit{DevID: devID, Measurement: measurement, Field: field,
+					Unit: unit, CreateAt: utils.GetCurrentTime()})
+			}
+			storage[field] = target
+			if sameUnit(unit, target) {
+				continue
+			}
+
+			message := ""
+			if v, ok := numericValue(value); !ok {
+				message = fmt.Sprintf("字段值不是数值，无法从%s转换为%s", unit, target)
+			} else if converted, err := utils.ConvertUnit(v, unit, target); err != nil {
+				message = err.Error()
+			} else if def.Type == model.SchemaFieldTypeInt {
+				points[i].Fields[field] = int64(math.Round(converted))
+			} else {
+				points[i].Fields[field] = converted
+			}
+			if message != "" && len(verr.Violations) < model.MaxSchemaViolations {
+				verr.Violations = append(verr.Violations, model.SchemaViolation{Index: i, Measurement: measurement,
+					Field: field, Message: message})
+			} else if message != "" {
+				verr.Truncated = true
+			}
+		}
+	}
+	if len(verr.Violations) > 0 {
+		return verr
+	}
+
+	if err := s.unitRepo.SaveFieldUnits(newUnits); err != nil {
+		return fmt.Errorf("记录字段单位失败: %v", err)
+	}
+	metadata.ExtraData[model.MetadataUnitsKey] = storage
+	return nil
+}
+
+// FieldUnits 获取设备measurement各字段的存储单位（schema单位优先）
+func (s *UnitService) FieldUnits(devType string, devID int64, measurement string) (map[string]string, error) {
+	units, err := s.unitRepo.GetFieldUnits(devID, measurement)
+	if err != nil {
+		return nil, fmt.Errorf("获取字段单位失败: %v", err)
+	}
+	schemas, err := s.schemaService.GetSchemas(devType, measurement)
+	if err != nil {
+		return nil, fmt.Errorf("获取schema失败: %v", err)
+	}
+	for _, schema := range schemas {
+		for _, def := range schema.Fields {
+			if def.Unit != "" {
+				units[def.Name] = def.Unit
+			}
+		}
+	}
+	return units, nil
+}
+
+// 聚合结果的单位换算方式
+const (
+	unitAggregateValue = "value" // 与原始值同单位，按绝对值转换
+	unitAggregateDelta = "delta" // 与原始值同单位的差值或累加值，只按比例转换
+	unitAggregateNone  = "none"  // 没有单位（如count）或无法换算
+)
+
+// unitAggregateKind 聚合结果的单位换算方式（aggregate为空表示原始数据点）
+func unitAggregateKind(aggregate string) string {
+	switch strings.ToLower(aggregate) {
+	case "", "mean", "avg", "max", "min", "median", "first_value", "last_value", "first", "last":
+		return unitAggregateValue
+	case "sum", "spread", "stddev", "stddev_pop", "stddev_samp":
+		return unitAggregateDelta
+	}
+	return unitAggregateNone
+}
+
+// ConvertPoints 将数据点（或aggregate聚合结果）的字段从存储单位转换为targets指定的单位（字段 -> 单位）
+// 返回结果中各字段的单位：count等没有单位的聚合结果不转换也不返回单位；
+// sum、spread、stddev只按比例转换（不加偏移）；请求转换的字段没有单位、单位无法转换或聚合结果无法换算时返回 ErrUnitConversion
+func ConvertPoints(points []model.Point, stored, targets map[string]string, aggregate string) (map[string]string, error) {
+	kind := unitAggregateKind(aggregate)
+	result := make(map[string]string, len(stored))
+	if strings.ToLower(aggregate) == "count" {
+		return result, nil
+	}
+	if kind == unitAggregateNone {
+		if len(targets) > 0 {
+			return nil, fmt.Errorf("%w: 聚合%s的结果无法转换单位", ErrUnitConversion, aggregate)
+		}
+		return result, nil
+	}
+	for field, unit := range stored {
+		result[field] = unit
+	}
+	convert := utils.ConvertUnit
+	if kind == unitAggregateDelta {
+		convert = utils.ConvertUnitDelta
+	}
+
+	for _, field := range sortedKeys(targets) {
+		target := targets[field]
+		from, ok := stored[field]
+		if !ok {
+			return nil, fmt.Errorf("%w: 字段%s没有单位信息，无法转换为%s", ErrUnitConversion, field, target)
+		}
+		if sameUnit(from, target) {
+			continue
+		}
+		if _, err := convert(0, from, target); err != nil {
+			return nil, fmt.Errorf("%w: 字段%s: %v", ErrUnitConversion, field, err)
+		}
+		for i := range points {
+			v, ok := numericValue(points[i].Fields[field])
+			if !ok {
+				continue
+			}
+			converted, _ := convert(v, from, target)
+			points[i].Fields[field] = converted
+		}
+		if normalized, ok := utils.NormalizeUnit(target); ok {
+			target = normalized
+		}
+		result[field] = target
+	}
+	return result, nil
+}
+
+// declaredUnits 读取metadata.extra_data.units
+func declaredUnits(extraData map[string]interface{}) map[string]string {
+	raw, ok := extraData[model.MetadataUnitsKey].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	units := make(map[string]string, len(raw))
+	for field, v := range raw {
+		if unit, ok := v.(string); ok && unit != "" {
+			units[field] = unit
+		}
+	}
+	return units
+}
+
+// sameUnit 两个单位是否相同（支持的单位按标准写法比较）
+func sameUnit(a, b string) bool {
+	na, okA := utils.NormalizeUnit(a)
+	nb, okB := utils.NormalizeUnit(b)
+	if okA && okB {
+		return na == nb
+	}
+	return a == b
+}
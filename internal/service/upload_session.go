@@ -0,0 +1,413 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"backend/config"
+	"backend/internal/model"
+	"backend/internal/repo"
+	"backend/pkg/logger"
+	"backend/pkg/utils"
+)
+
+var (
+	// ErrContentChecksumMismatch 上传内容与声明的SHA-256不一致
+	ErrContentChecksumMismatch = errors.New("文件SHA-256校验失败")
+	// ErrUploadLocationMismatch 确认时指定的对象位置与上传会话签发的不一致
+	ErrUploadLocationMismatch = errors.New("file_data的bucket_name/bucket_key与上传会话不一致")
+	// ErrUploadConfirmForbidden 确认上传的用户既不是会话创建者也没有设备写权限
+	ErrUploadConfirmForbidden = errors.New("您没有权限确认该上传")
+)
+
+const (
+	maxAutoHashSize             = 256 << 20        // 未声明SHA-256时，只为不超过该大小的文件计算哈希
+	uploadSessionTTL            = 30 * time.Minute // 上传会话有效期（预签名URL为15分钟）
+	uploadSessionExpireInterval = 5 * time.Minute
+	bucketListenRetryInterval   = 10 * time.Second
+)
+
+// webhookToken MinIO webhook的认证令牌（Start时从配置加载，为空表示不接收webhook）
+var webhookToken string
+
+// UploadSessionService 文件上传会话：客户端显式确认或MinIO存储事件自动确认，二者以会话状态互斥
+type UploadSessionService struct {
+	sessionRepo       *repo.UploadSessionRepository
+	deviceRepo        *repo.DeviceRepository
+	deviceUserRepo    *repo.DeviceUserRepository
+	metadataRepo      *repo.MetadataRepository
+	sensorDataRepo    *repo.SensorDataRepository
+	derivativeService *DerivativeService
+}
+
+func NewUploadSessionService() *UploadSessionService {
+	return &UploadSessionService{
+		sessionRepo:       repo.NewUploadSessionRepository(),
+		deviceRepo:        repo.NewDeviceRepository(),
+		deviceUserRepo:    repo.NewDeviceUserRepository(),
+		metadataRepo:      repo.NewMetadataRepository(),
+		sensorDataRepo:    repo.NewSensorDataRepository(),
+		derivativeService: NewDerivativeService(),
+	}
+}
+
+// FindDuplicate 查找设备中内容相同（SHA-256一致）的已有文件，没有时返回nil
+func (s *UploadSessionService) FindDuplicate(devID int64, sha256 string) (*model.Metadata, error) {
+	if sha256 == "" {
+		return nil, nil
+	}
+	metadata, err := s.metadataRepo.GetFileMetadataBySHA256(devID, strings.ToLower(sha256))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return metadata, err
+}
+
+// AllocateObjectKey 分配不冲突的对象key：同名对象已存在或已被其他上传占用时，在文件名后追加上传ID前缀
+func (s *UploadSessionService) AllocateObjectKey(bucketName, baseKey, uploadID string) (string, error) {
+	taken, err := s.isObjectKeyTaken(bucketName, baseKey)
+	if err != nil {
+		return "", err
+	}
+	if !taken {
+		return baseKey, nil
+	}
+
+	ext := path.Ext(baseKey)
+	key := fmt.Sprintf("%s_%s%s", strings.TrimSuffix(baseKey, ext), uploadID[:8], ext)
+	if taken, err = s.isObjectKeyTaken(bucketName, key); err != nil {
+		return "", err
+	}
+	if taken {
+		key = fmt.Sprintf("%s_%s%s", strings.TrimSuffix(baseKey, ext), uploadID, ext)
+	}
+	return key, nil
+}
+
+// isObjectKeyTaken 对象已存在或已有未过期的上传会话
+func (s *UploadSessionService) isObjectKeyTaken(bucketName, key string) (bool, error) {
+	exists, err := s.sessionRepo.ObjectExists(bucketName, key)
+	if err != nil || exists {
+		return exists, err
+	}
+	return s.sessionRepo.HasActiveUploadSession(bucketName, key, utils.GetCurrentTime())
+}
+
+// CreateSession 创建上传会话（sha256为客户端声明的内容哈希，可为空）
+func (s *UploadSessionService) CreateSession(uploadID string, devID int64, bucketName, bucketKey, filename, contentType, sha256 string, uid int64) (*model.UploadSession, error) {
+	now := utils.GetCurrentTime()
+	session := &model.UploadSession{
+		UploadID:    uploadID,
+		DevID:       model.Int64ToID(devID),
+		BucketName:  bucketName,
+		BucketKey:   bucketKey,
+		Filename:    filename,
+		ContentType: contentType,
+		UID:         uid,
+		Status:      model.UploadSessionStatusPending,
+		SHA256:      strings.ToLower(sha256),
+		CreateAt:    now,
+		ExpireAt:    now.Add(uploadSessionTTL),
+	}
+	if err := s.sessionRepo.CreateUploadSession(session); err != nil {
+		return nil, fmt.Errorf("保存上传会话失败: %v", err)
+	}
+	return session, nil
+}
+
+// ConfirmUpload 客户端显式确认上传并创建metadata（写回req.Metadata.DataID）
+// 会话已被存储事件自动确认时直接返回已创建的data_id；只有会话创建者、管理员或有设备写权限的用户可以确认
+func (s *UploadSessionService) ConfirmUpload(req *model.UploadSensorDataRequest, currentUID int64, role string) error {
+	uploadID := req.FileData.UploadID
+	if uploadID == "" {
+		return errors.New("file_data.upload_id不能为空")
+	}
+
+	session, err := s.sessionRepo.GetUploadSession(uploadID)
+	if err != nil {
+		return errors.New("无效的upload_id或上传会话已过期")
+	}
+
+	// 验证设备ID匹配
+	if session.DevID != req.Metadata.DevID {
+		return errors.New("设备ID不匹配")
+	}
+	if session.UID != currentUID && role != model.RoleAdmin {
+		deviceUser, err := s.deviceUserRepo.GetDeviceUser(session.DevID.Int64(), currentUID)
+		if err != nil || (deviceUser.PermissionLevel != model.PermissionLevelWrite &&
+			deviceUser.PermissionLevel != model.PermissionLevelReadWrite) {
+			return ErrUploadConfirmForbidden
+		}
+	}
+
+	switch session.Status {
+	case model.UploadSessionStatusCompleted:
+		req.Metadata.DataID = session.DataID
+		return nil
+	case model.UploadSessionStatusExpired:
+		return errors.New("上传会话已过期")
+	case model.UploadSessionStatusAborted:
+		return errors.New("上传已取消")
+	case model.UploadSessionStatusRejected:
+		return ErrContentChecksumMismatch
+	}
+	if utils.GetCurrentTime().After(session.ExpireAt) {
+		return errors.New("上传会话已过期")
+	}
+
+	// 只能确认会话签发的对象（校验失败时会删除该对象），客户端指定的bucket_name/bucket_key必须与会话一致
+	if (req.FileData.BucketName != "" && req.FileData.BucketName != session.BucketName) ||
+		(req.FileData.BucketKey != "" && req.FileData.BucketKey != session.BucketKey) {
+		return ErrUploadLocationMismatch
+	}
+
+	// 验证文件是否存在于MinIO（确认客户端上传成功）
+	stat, err := s.sessionRepo.StatObject(session.BucketName, session.BucketKey)
+	if err != nil {
+		return fmt.Errorf("文件未找到，请确认是否上传成功: %v", err)
+	}
+
+	if req.Metadata.DataID == 0 {
+		req.Metadata.DataID = utils.GetDefaultSnowflake().Generate()
+	}
+	if req.Metadata.Timestamp.IsZero() {
+		req.Metadata.Timestamp = time.Now()
+	}
+	err = s.complete(session, stat, &req.Metadata, model.UploadSourceConfirm)
+	if errors.Is(err, ErrContentChecksumMismatch) {
+		return err
+	}
+	if errors.Is(err, repo.ErrUploadSessionNotPending) {
+		// 并发情况下存储事件先完成了确认
+		latest, getErr := s.sessionRepo.GetUploadSession(uploadID)
+		if getErr == nil && latest.Status == model.UploadSessionStatusCompleted {
+			req.Metadata.DataID = latest.DataID
+			return nil
+		}
+		return errors.New("上传会话已过期")
+	}
+	if err != nil {
+		return fmt.Errorf("创建元数据失败: %v", err)
+	}
+	return nil
+}
+
+// HandleBucketEvents 处理MinIO存储事件：对象创建时自动确认对应的上传会话，返回确认数量
+func (s *UploadSessionService) HandleBucketEvents(records []model.BucketEventRecord) int {
+	completed := 0
+	for _, record := range records {
+		if !strings.HasPrefix(record.EventName, "s3:ObjectCreated:") {
+			continue
+		}
+		if s.handleObjectCreated(record) {
+			completed++
+		}
+	}
+	return completed
+}
+
+// handleObjectCreated 根据对象位置找到待确认会话并创建metadata
+func (s *UploadSessionService) handleObjectCreated(record model.BucketEventRecord) bool {
+	bucketName := record.S3.Bucket.Name
+	// 事件中的key是URL编码的
+	bucketKey, err := url.QueryUnescape(record.S3.Object.Key)
+	if err != nil {
+		bucketKey = record.S3.Object.Key
+	}
+
+	session, err := s.sessionRepo.GetPendingUploadSessionByKey(bucketName, bucketKey, utils.GetCurrentTime())
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.L().Warn("查询上传会话失败", logger.WithError(err),
+				logger.WithString("bucket_name", bucketName), logger.WithString("bucket_key", bucketKey))
+		}
+		// 没有对应会话（非预签名上传或已确认），交给对账任务处理
+		return false
+	}
+
+	stat := &model.ObjectStat{
+		Size:        record.S3.Object.Size,
+		ETag:        record.S3.Object.ETag,
+		ContentType: record.S3.Object.ContentType,
+	}
+	if stat.ETag == "" {
+		if stat, err = s.sessionRepo.StatObject(bucketName, bucketKey); err != nil {
+			logger.L().Warn("获取对象信息失败", logger.WithError(err),
+				logger.WithString("bucket_name", bucketName), logger.WithString("bucket_key", bucketKey))
+			return false
+		}
+	}
+
+	timestamp := time.Now()
+	if t, err := time.Parse(time.RFC3339, record.EventTime); err == nil {
+		timestamp = t
+	}
+	metadata := &model.Metadata{
+		DataID:    utils.GetDefaultSnowflake().Generate(),
+		DevID:     session.DevID,
+		DataType:  model.DataTypeFileData,
+		Timestamp: timestamp,
+	}
+
+	err = s.complete(session, stat, metadata, model.UploadSourceEvent)
+	if errors.Is(err, repo.ErrUploadSessionNotPending) {
+		return false
+	}
+	if errors.Is(err, ErrContentChecksumMismatch) {
+		logger.L().Warn("上传内容校验失败，已删除对象", logger.WithString("upload_id", session.UploadID),
+			logger.WithString("bucket_name", bucketName), logger.WithString("bucket_key", bucketKey))
+		return false
+	}
+	if err != nil {
+		logger.L().Error("自动确认上传失败", logger.WithError(err), logger.WithString("upload_id", session.UploadID))
+		return false
+	}
+	logger.L().Info("存储事件自动确认上传", logger.WithString("upload_id", session.UploadID),
+		logger.WithInt64("data_id", metadata.DataID))
+	return true
+}
+
+// complete 校验内容哈希、补全文件metadata并在事务内完成会话确认，成功后触发派生文件生成
+// 声明了SHA-256但内容不一致时删除对象并将会话标记为rejected
+func (s *UploadSessionService) complete(session *model.UploadSession, stat *model.ObjectStat, metadata *model.Metadata, source string) error {
+	contentType := session.ContentType
+	if contentType == "" {
+		contentType = stat.ContentType
+	}
+
+	var checksum string
+	if session.SHA256 != "" || stat.Size <= maxAutoHashSize {
+		var err error
+		if checksum, err = s.objectSHA256(session.BucketName, session.BucketKey); err != nil {
+			return fmt.Errorf("计算文件SHA-256失败: %v", err)
+		}
+	}
+	if session.SHA256 != "" && checksum != session.SHA256 {
+		if err := s.sessionRepo.RejectUploadSession(session.UploadID); err != nil {
+			logger.L().Warn("标记上传会话失败", logger.WithError(err), logger.WithString("upload_id", session.UploadID))
+		}
+		if err := s.sensorDataRepo.DeleteObject(session.BucketName, session.BucketKey); err != nil {
+			logger.L().Warn("删除校验失败的对象失败", logger.WithError(err), logger.WithString("bucket_key", session.BucketKey))
+		}
+		return ErrContentChecksumMismatch
+	}
+
+	metadata.DataType = model.DataTypeFileData
+	if metadata.ExtraData == nil {
+		metadata.ExtraData = make(map[string]any)
+	}
+	metadata.ExtraData["bucket_name"] = session.BucketName
+	metadata.ExtraData["bucket_key"] = session.BucketKey
+	metadata.ExtraData["filename"] = session.Filename
+	metadata.ExtraData["content_type"] = contentType
+	metadata.ExtraData["size"] = stat.Size
+	metadata.ExtraData["etag"] = strings.Trim(stat.ETag, `"`)
+	metadata.ExtraData["source"] = source
+	if checksum != "" {
+		metadata.ExtraData["sha256"] = checksum
+		// 设备已有相同内容的文件时记录重复关系
+		dup, err := s.FindDuplicate(session.DevID.Int64(), checksum)
+		if err != nil {
+			logger.L().Warn("查询重复文件失败", logger.WithError(err), logger.WithString("upload_id", session.UploadID))
+		} else if dup != nil && dup.DataID != metadata.DataID {
+			metadata.ExtraData["duplicate_of"] = dup.DataID
+		}
+	}
+
+	now := utils.GetCurrentTime()
+	session.Size = stat.Size
+	session.ETag = strings.Trim(stat.ETag, `"`)
+	session.Source = source
+	session.CompletedAt = &now
+	if err := s.sessionRepo.CompleteUploadSession(session, metadata); err != nil {
+		return err
+	}
+
+	// 生成缩略图等派生文件（后台执行，不影响确认结果）
+	s.derivativeService.GenerateAsync(metadata.DataID, session.BucketName, session.BucketKey, contentType)
+	return nil
+}
+
+// objectSHA256 流式计算对象内容的SHA-256（十六进制）
+func (s *UploadSessionService) objectSHA256(bucketName, bucketKey string) (string, error) {
+	obj, err := s.sensorDataRepo.GetObject(bucketName, bucketKey)
+	if err != nil {
+		return "", err
+	}
+	defer obj.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, obj); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// VerifyWebhookToken 校验MinIO webhook的Authorization（支持 "Bearer <token>" 与裸token）
+func VerifyWebhookToken(authorization string) bool {
+	if webhookToken == "" {
+		return false
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+	return subtle.ConstantTimeCompare([]byte(token), []byte(webhookToken)) == 1
+}
+
+// Start 启动后台任务：定时标记过期会话；listen=true时订阅各bucket的对象创建事件（ctx取消后退出）
+func (s *UploadSessionService) Start(ctx context.Context, cfg config.UploadEventConfig) {
+	webhookToken = cfg.WebhookToken
+
+	go func() {
+		ticker := time.NewTicker(uploadSessionExpireInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := s.sessionRepo.ExpireUploadSessions(utils.GetCurrentTime()); err != nil {
+					logger.L().Warn("标记过期上传会话失败", logger.WithError(err))
+				}
+			}
+		}
+	}()
+
+	if !cfg.Listen {
+		return
+	}
+	buckets := cfg.Buckets
+	if len(buckets) == 0 {
+		buckets = repo.FileBuckets()
+	}
+	for _, bucketName := range buckets {
+		go s.listenBucket(ctx, bucketName)
+	}
+}
+
+// listenBucket 订阅单个bucket的存储事件，连接断开后自动重连
+func (s *UploadSessionService) listenBucket(ctx context.Context, bucketName string) {
+	for {
+		err := s.sessionRepo.ListenObjectCreated(ctx, bucketName, func(record model.BucketEventRecord) {
+			s.HandleBucketEvents([]model.BucketEventRecord{record})
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		logger.L().Warn("订阅存储事件中断，稍后重连", logger.WithError(err), logger.WithString("bucket_name", bucketName))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(bucketListenRetryInterval):
+		}
+	}
+}
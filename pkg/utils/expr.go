@@ -0,0 +1,700 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 表达式限制
+const (
+	MaxExprLength = 1024 // 表达式最大长度
+	MaxExprWindow = 1000 // 窗口函数的最大窗口（数据点数）
+	maxExprDepth  = 32   // 最大嵌套层数
+)
+
+// Expr 编译后的数值表达式
+//
+// 支持：数字、变量（字段名，特殊字符用反引号包围）、+ - * / % ^、比较（结果为1或0）、&& || !、括号，
+// 函数 abs sqrt exp ln（log） log10 pow min max round floor ceil sin cos tan atan2 clamp if coalesce，
+// 以及按数据点序列计算的窗口函数 mavg msum mmin mmax mrms mstd（第二个参数为窗口点数）、delta rate prev。
+// 缺失值与无效结果（如除以0）为NaN，参与运算的结果也为NaN；coalesce(x, v) 在x为NaN时返回v
+type Expr struct {
+	src      string
+	root     exprNode
+	vars     []string
+	windowed bool
+}
+
+// CompileExpr 解析表达式
+func CompileExpr(src string) (*Expr, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, fmt.Errorf("表达式不能为空")
+	}
+	if len(src) > MaxExprLength {
+		return nil, fmt.Errorf("表达式长度不能超过%d", MaxExprLength)
+	}
+	tokens, err := tokenizeExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens, vars: make(map[string]bool)}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != exprTokenEOF {
+		return nil, fmt.Errorf("表达式位置%d: 多余的内容 %q", p.peek().pos, p.peek().text)
+	}
+
+	vars := make([]string, 0, len(p.vars))
+	for name := range p.vars {
+		vars = append(vars, name)
+	}
+	sort.Strings(vars)
+	return &Expr{src: src, root: root, vars: vars, windowed: p.windowed}, nil
+}
+
+// String 返回表达式原文
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Vars 表达式引用的变量（已排序）
+func (e *Expr) Vars() []string {
+	return e.vars
+}
+
+// Windowed 是否使用了窗口函数（结果依赖前面的数据点）
+func (e *Expr) Windowed() bool {
+	return e.windowed
+}
+
+// Eval 计算单个数据点（窗口函数只包含当前点）
+func (e *Expr) Eval(vars map[string]float64) float64 {
+	series := make(map[string][]float64, len(vars))
+	for name, v := range vars {
+		series[name] = []float64{v}
+	}
+	return e.EvalSeries([]int64{0}, series)[0]
+}
+
+// EvalSeries 按时间顺序计算数据点序列，times为Unix秒，vars的每一列与times等长（缺失值为NaN）
+func (e *Expr) EvalSeries(times []int64, vars map[string][]float64) []float64 {
+	ctx := &exprContext{n: len(times), times: times, vars: vars}
+	return e.root.eval(ctx)
+}
+
+// ==================== 求值 ====================
+
+type exprContext struct {
+	n     int
+	times []int64
+	vars  map[string][]float64
+}
+
+type exprNode interface {
+	eval(ctx *exprContext) []float64
+}
+
+type exprNumber float64
+
+func (n exprNumber) eval(ctx *exprContext) []float64 {
+	out := make([]float64, ctx.n)
+	for i := range out {
+		out[i] = float64(n)
+	}
+	return out
+}
+
+type exprVar string
+
+func (v exprVar) eval(ctx *exprContext) []float64 {
+	out := make([]float64, ctx.n)
+	column := ctx.vars[string(v)]
+	for i := range out {
+		if i < len(column) {
+			out[i] = column[i]
+		} else {
+			out[i] = math.NaN()
+		}
+	}
+	return out
+}
+
+type exprUnary struct {
+	op string
+	x  exprNode
+}
+
+func (u *exprUnary) eval(ctx *exprContext) []float64 {
+	out := u.x.eval(ctx)
+	for i, v := range out {
+		switch u.op {
+		case "-":
+			out[i] = -v
+		case "!":
+			if !math.IsNaN(v) {
+				out[i] = boolValue(v == 0)
+			}
+		}
+	}
+	return out
+}
+
+type exprBinary struct {
+	op   string
+	l, r exprNode
+}
+
+func (b *exprBinary) eval(ctx *exprContext) []float64 {
+	l, r := b.l.eval(ctx), b.r.eval(ctx)
+	for i := range l {
+		x, y := l[i], r[i]
+		if math.IsNaN(x) || math.IsNaN(y) {
+			l[i] = math.NaN()
+			continue
+		}
+		var v float64
+		switch b.op {
+		case "+":
+			v = x + y
+		case "-":
+			v = x - y
+		case "*":
+			v = x * y
+		case "/":
+			v = x / y
+		case "%":
+			v = math.Mod(x, y)
+		case "^":
+			v = math.Pow(x, y)
+		case "<":
+			v = boolValue(x < y)
+		case "<=":
+			v = boolValue(x <= y)
+		case ">":
+			v = boolValue(x > y)
+		case ">=":
+			v = boolValue(x >= y)
+		case "==":
+			v = boolValue(x == y)
+		case "!=":
+			v = boolValue(x != y)
+		case "&&":
+			v = boolValue(x != 0 && y != 0)
+		case "||":
+			v = boolValue(x != 0 || y != 0)
+		}
+		if math.IsInf(v, 0) {
+			v = math.NaN()
+		}
+		l[i] = v
+	}
+	return l
+}
+
+type exprCall struct {
+	name   string
+	args   []exprNode
+	window int // 窗口函数的窗口点数
+}
+
+func (c *exprCall) eval(ctx *exprContext) []float64 {
+	if fn, ok := exprWindowFuncs[c.name]; ok {
+		return fn.eval(ctx, c.args[0].eval(ctx), c.window)
+	}
+
+	args := make([][]float64, len(c.args))
+	for i, arg := range c.args {
+		args[i] = arg.eval(ctx)
+	}
+	fn := exprScalarFuncs[c.name]
+	out := make([]float64, ctx.n)
+	values := make([]float64, len(args))
+	for i := range out {
+		for j := range args {
+			values[j] = args[j][i]
+		}
+		v := fn.call(values)
+		if math.IsInf(v, 0) {
+			v = math.NaN()
+		}
+		out[i] = v
+	}
+	return out
+}
+
+// ==================== 函数 ====================
+
+type exprScalarFunc struct {
+	minArgs, maxArgs int // maxArgs为-1表示不限
+	call             func(args []float64) float64
+}
+
+// exprScalarFuncs 逐点计算的函数（coalesce与if自行处理NaN，其他函数参数有NaN时结果为NaN）
+var exprScalarFuncs = map[string]exprScalarFunc{
+	"abs":   {1, 1, nanGuard(func(a []float64) float64 { return math.Abs(a[0]) })},
+	"sqrt":  {1, 1, nanGuard(func(a []float64) float64 { return math.Sqrt(a[0]) })},
+	"exp":   {1, 1, nanGuard(func(a []float64) float64 { return math.Exp(a[0]) })},
+	"ln":    {1, 1, nanGuard(func(a []float64) float64 { return math.Log(a[0]) })},
+	"log":   {1, 1, nanGuard(func(a []float64) float64 { return math.Log(a[0]) })},
+	"log10": {1, 1, nanGuard(func(a []float64) float64 { return math.Log10(a[0]) })},
+	"pow":   {2, 2, nanGuard(func(a []float64) float64 { return math.Pow(a[0], a[1]) })},
+	"floor": {1, 1, nanGuard(func(a []float64) float64 { return math.Floor(a[0]) })},
+	"ceil":  {1, 1, nanGuard(func(a []float64) float64 { return math.Ceil(a[0]) })},
+	"sin":   {1, 1, nanGuard(func(a []float64) float64 { return math.Sin(a[0]) })},
+	"cos":   {1, 1, nanGuard(func(a []float64) float64 { return math.Cos(a[0]) })},
+	"tan":   {1, 1, nanGuard(func(a []float64) float64 { return math.Tan(a[0]) })},
+	"atan2": {2, 2, nanGuard(func(a []float64) float64 { return math.Atan2(a[0], a[1]) })},
+	"round": {1, 2, nanGuard(func(a []float64) float64 {
+		if len(a) == 1 {
+			return math.Round(a[0])
+		}
+		scale := math.Pow(10, math.Trunc(a[1]))
+		return math.Round(a[0]*scale) / scale
+	})},
+	"min": {2, -1, nanGuard(func(a []float64) float64 {
+		v := a[0]
+		for _, x := range a[1:] {
+			v = math.Min(v, x)
+		}
+		return v
+	})},
+	"max": {2, -1, nanGuard(func(a []float64) float64 {
+		v := a[0]
+		for _, x := range a[1:] {
+			v = math.Max(v, x)
+		}
+		return v
+	})},
+	"clamp": {3, 3, nanGuard(func(a []float64) float64 { return math.Min(math.Max(a[0], a[1]), a[2]) })},
+	"if": {3, 3, func(a []float64) float64 {
+		if math.IsNaN(a[0]) {
+			return math.NaN()
+		}
+		if a[0] != 0 {
+			return a[1]
+		}
+		return a[2]
+	}},
+	"coalesce": {2, -1, func(a []float64) float64 {
+		for _, x := range a {
+			if !math.IsNaN(x) {
+				return x
+			}
+		}
+		return math.NaN()
+	}},
+}
+
+type exprWindowFunc struct {
+	sized bool // 是否需要窗口点数参数
+	eval  func(ctx *exprContext, x []float64, window int) []float64
+}
+
+// exprWindowFuncs 按数据点序列计算的函数，窗口内的NaN不参与计算，窗口不足时使用已有的点
+var exprWindowFuncs = map[string]exprWindowFunc{
+	"mavg": {true, windowReduce(func(w []float64) float64 { return sumFloat(w) / float64(len(w)) })},
+	"msum": {true, windowReduce(sumFloat)},
+	"mmin": {true, windowReduce(func(w []float64) float64 {
+		v := w[0]
+		for _, x := range w[1:] {
+			v = math.Min(v, x)
+		}
+		return v
+	})},
+	"mmax": {true, windowReduce(func(w []float64) float64 {
+		v := w[0]
+		for _, x := range w[1:] {
+			v = math.Max(v, x)
+		}
+		return v
+	})},
+	"mrms": {true, windowReduce(func(w []float64) float64 {
+		var sq float64
+		for _, x := range w {
+			sq += x * x
+		}
+		return math.Sqrt(sq / float64(len(w)))
+	})},
+	"mstd": {true, windowReduce(func(w []float64) float64 {
+		mean := sumFloat(w) / float64(len(w))
+		var sq float64
+		for _, x := range w {
+			sq += (x - mean) * (x - mean)
+		}
+		return math.Sqrt(sq / float64(len(w)))
+	})},
+	"prev":  {false, previousDiff(func(cur, prev float64, dt int64) float64 { return prev })},
+	"delta": {false, previousDiff(func(cur, prev float64, dt int64) float64 { return cur - prev })},
+	"rate": {false, previousDiff(func(cur, prev float64, dt int64) float64 {
+		if dt <= 0 {
+			return math.NaN()
+		}
+		return (cur - prev) / float64(dt)
+	})},
+}
+
+func nanGuard(fn func(args []float64) float64) func(args []float64) float64 {
+	return func(args []float64) float64 {
+		for _, a := range args {
+			if math.IsNaN(a) {
+				return math.NaN()
+			}
+		}
+		return fn(args)
+	}
+}
+
+// windowReduce 对每个点前面（含）最多window个有效值计算
+func windowReduce(reduce func(w []float64) float64) func(ctx *exprContext, x []float64, window int) []float64 {
+	return func(ctx *exprContext, x []float64, window int) []float64 {
+		out := make([]float64, len(x))
+		buf := make([]float64, 0, window)
+		for i := range x {
+			buf = buf[:0]
+			for j := max(0, i-window+1); j <= i; j++ {
+				if !math.IsNaN(x[j]) {
+					buf = append(buf, x[j])
+				}
+			}
+			if len(buf) == 0 {
+				out[i] = math.NaN()
+				continue
+			}
+			out[i] = reduce(buf)
+		}
+		return out
+	}
+}
+
+// previousDiff 与前一个有效值比较（dt为时间差，秒）
+func previousDiff(fn func(cur, prev float64, dt int64) float64) func(ctx *exprContext, x []float64, window int) []float64 {
+	return func(ctx *exprContext, x []float64, window int) []float64 {
+		out := make([]float64, len(x))
+		last := -1
+		for i := range x {
+			out[i] = math.NaN()
+			if math.IsNaN(x[i]) {
+				continue
+			}
+			if last >= 0 {
+				out[i] = fn(x[i], x[last], ctx.times[i]-ctx.times[last])
+			}
+			last = i
+		}
+		return out
+	}
+}
+
+func sumFloat(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// ==================== 解析 ====================
+
+type exprTokenKind int
+
+const (
+	exprTokenEOF exprTokenKind = iota
+	exprTokenNumber
+	exprTokenIdent
+	exprTokenOp
+)
+
+type exprToken struct {
+	kind exprTokenKind
+	text string
+	pos  int
+}
+
+// tokenizeExpr 词法分析
+func tokenizeExpr(src string) ([]exprToken, error) {
+	tokens := make([]exprToken, 0)
+	for i := 0; i < len(src); {
+		ch := src[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+		case ch >= '0' && ch <= '9' || ch == '.':
+			start := i
+			for i < len(src) && (src[i] >= '0' && src[i] <= '9' || src[i] == '.') {
+				i++
+			}
+			// 科学计数法
+			if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+				j := i + 1
+				if j < len(src) && (src[j] == '+' || src[j] == '-') {
+					j++
+				}
+				if j < len(src) && src[j] >= '0' && src[j] <= '9' {
+					for j < len(src) && src[j] >= '0' && src[j] <= '9' {
+						j++
+					}
+					i = j
+				}
+			}
+			tokens = append(tokens, exprToken{kind: exprTokenNumber, text: src[start:i], pos: start})
+		case ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z':
+			start := i
+			for i < len(src) && (src[i] == '_' || src[i] >= 'a' && src[i] <= 'z' || src[i] >= 'A' && src[i] <= 'Z' || src[i] >= '0' && src[i] <= '9') {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: exprTokenIdent, text: src[start:i], pos: start})
+		case ch == '`':
+			end := strings.IndexByte(src[i+1:], '`')
+			if end <= 0 {
+				return nil, fmt.Errorf("表达式位置%d: 反引号未闭合或变量名为空", i)
+			}
+			tokens = append(tokens, exprToken{kind: exprTokenIdent, text: src[i+1 : i+1+end], pos: i})
+			i += end + 2
+		default:
+			op := ""
+			if i+1 < len(src) {
+				switch two := src[i : i+2]; two {
+				case "<=", ">=", "==", "!=", "&&", "||":
+					op = two
+				}
+			}
+			if op == "" && strings.IndexByte("+-*/%^<>!(),", ch) >= 0 {
+				op = string(ch)
+			}
+			if op == "" {
+				return nil, fmt.Errorf("表达式位置%d: 不支持的字符 %q", i, ch)
+			}
+			tokens = append(tokens, exprToken{kind: exprTokenOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, exprToken{kind: exprTokenEOF, pos: len(src)}), nil
+}
+
+type exprParser struct {
+	tokens   []exprToken
+	pos      int
+	depth    int
+	vars     map[string]bool
+	windowed bool
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	t := p.tokens[p.pos]
+	if t.kind != exprTokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// acceptOp 下一个token是给定运算符之一时消费并返回
+func (p *exprParser) acceptOp(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != exprTokenOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) expectOp(op string) error {
+	if _, ok := p.acceptOp(op); !ok {
+		t := p.peek()
+		return fmt.Errorf("表达式位置%d: 缺少 %q", t.pos, op)
+	}
+	return nil
+}
+
+// parseBinary 解析左结合的二元运算
+func (p *exprParser) parseBinary(operand func() (exprNode, error), ops ...string) (exprNode, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.acceptOp(ops...)
+		if !ok {
+			return left, nil
+		}
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &exprBinary{op: op, l: left, r: right}
+	}
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxExprDepth {
+		return nil, fmt.Errorf("表达式嵌套不能超过%d层", maxExprDepth)
+	}
+	return p.parseBinary(p.parseAnd, "||")
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	return p.parseBinary(p.parseCompare, "&&")
+}
+
+func (p *exprParser) parseCompare() (exprNode, error) {
+	left, err := p.parseAdd()
+	if err != nil {
+		return nil, err
+	}
+	if op, ok := p.acceptOp("<", "<=", ">", ">=", "==", "!="); ok {
+		right, err := p.parseAdd()
+		if err != nil {
+			return nil, err
+		}
+		return &exprBinary{op: op, l: left, r: right}, nil
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAdd() (exprNode, error) {
+	return p.parseBinary(p.parseMul, "+", "-")
+}
+
+func (p *exprParser) parseMul() (exprNode, error) {
+	return p.parseBinary(p.parseUnary, "*", "/", "%")
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if op, ok := p.acceptOp("-", "+", "!"); ok {
+		p.depth++
+		defer func() { p.depth-- }()
+		if p.depth > maxExprDepth {
+			return nil, fmt.Errorf("表达式嵌套不能超过%d层", maxExprDepth)
+		}
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if op == "+" {
+			return x, nil
+		}
+		return &exprUnary{op: op, x: x}, nil
+	}
+	return p.parsePow()
+}
+
+// parsePow 乘方为右结合，优先级高于一元负号（-2^2 = -4）
+func (p *exprParser) parsePow() (exprNode, error) {
+	base, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.acceptOp("^"); ok {
+		exponent, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &exprBinary{op: "^", l: base, r: exponent}, nil
+	}
+	return base, nil
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case exprTokenNumber:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("表达式位置%d: 无效的数字 %q", t.pos, t.text)
+		}
+		return exprNumber(v), nil
+	case exprTokenIdent:
+		if _, ok := p.acceptOp("("); ok {
+			return p.parseCall(t)
+		}
+		p.vars[t.text] = true
+		return exprVar(t.text), nil
+	case exprTokenOp:
+		if t.text == "(" {
+			x, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			return x, nil
+		}
+		return nil, fmt.Errorf("表达式位置%d: 意外的 %q", t.pos, t.text)
+	default:
+		return nil, fmt.Errorf("表达式不完整")
+	}
+}
+
+// parseCall 解析函数调用（已消费左括号）
+func (p *exprParser) parseCall(name exprToken) (exprNode, error) {
+	args := make([]exprNode, 0)
+	if _, ok := p.acceptOp(")"); !ok {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if _, ok := p.acceptOp(","); ok {
+				continue
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	if fn, ok := exprWindowFuncs[name.text]; ok {
+		call := &exprCall{name: name.text, args: args}
+		want := 1
+		if fn.sized {
+			want = 2
+		}
+		if len(args) != want {
+			return nil, fmt.Errorf("表达式位置%d: %s需要%d个参数", name.pos, name.text, want)
+		}
+		if fn.sized {
+			n, ok := args[1].(exprNumber)
+			if !ok || float64(n) != math.Trunc(float64(n)) || n < 1 || n > MaxExprWindow {
+				return nil, fmt.Errorf("表达式位置%d: %s的窗口应为1~%d的整数", name.pos, name.text, MaxExprWindow)
+			}
+			call.window = int(n)
+			call.args = args[:1]
+		}
+		p.windowed = true
+		return call, nil
+	}
+
+	fn, ok := exprScalarFuncs[name.text]
+	if !ok {
+		return nil, fmt.Errorf("表达式位置%d: 未知函数 %s", name.pos, name.text)
+	}
+	if len(args) < fn.minArgs || fn.maxArgs >= 0 && len(args) > fn.maxArgs {
+		return nil, fmt.Errorf("表达式位置%d: %s的参数数量错误", name.pos, name.text)
+	}
+	return &exprCall{name: name.text, args: args}, nil
+}
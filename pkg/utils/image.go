@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+)
+
+// ResizeToFit 将图片等比缩小到长边不超过 maxSide（区域平均采样，不放大）
+func ResizeToFit(src image.Image, maxSide int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if maxSide <= 0 || w == 0 || h == 0 || (w <= maxSide && h <= maxSide) {
+		return flattenImage(src)
+	}
+
+	dw, dh := maxSide, maxSide
+	if w >= h {
+		dh = max(1, h*maxSide/w)
+	} else {
+		dw = max(1, w*maxSide/h)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		// 目标像素对应的源区域 [sy0, sy1) x [sx0, sx1)
+		sy0 := b.Min.Y + y*h/dh
+		sy1 := max(sy0+1, b.Min.Y+(y+1)*h/dh)
+		for x := 0; x < dw; x++ {
+			sx0 := b.Min.X + x*w/dw
+			sx1 := max(sx0+1, b.Min.X+(x+1)*w/dw)
+
+			var r, g, bl, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					bl += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, flattenColor(r/n, g/n, bl/n, a/n))
+		}
+	}
+	return dst
+}
+
+// flattenImage 将图片合成到白色背景上（用于输出不支持透明度的格式）
+func flattenImage(src image.Image) image.Image {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := src.At(x, y).RGBA()
+			dst.Set(x-b.Min.X, y-b.Min.Y, flattenColor(uint64(r), uint64(g), uint64(bl), uint64(a)))
+		}
+	}
+	return dst
+}
+
+// flattenColor 预乘alpha的16位颜色与白色背景合成为不透明的8位颜色
+func flattenColor(r, g, b, a uint64) color.RGBA {
+	bg := 0xffff - a
+	return color.RGBA{
+		R: uint8((r + bg) >> 8),
+		G: uint8((g + bg) >> 8),
+		B: uint8((b + bg) >> 8),
+		A: 0xff,
+	}
+}
@@ -131,3 +131,53 @@ func IsValidJSONBytes(jsonBytes []byte) bool {
 	var v interface{}
 	return json.Unmarshal(jsonBytes, &v) == nil
 }
+
+// MergeMap 按 JSON Merge Patch（RFC 7396）语义将 patch 合并到 dst，返回新的 map
+// patch 中值为 nil 的键会从结果中删除，两侧都是 map 的键递归合并，其余直接覆盖
+func MergeMap(dst, patch map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(dst)+len(patch))
+	for k, v := range dst {
+		result[k] = v
+	}
+	for k, pv := range patch {
+		if pv == nil {
+			delete(result, k)
+			continue
+		}
+		pm, pIsMap := pv.(map[string]interface{})
+		dm, dIsMap := result[k].(map[string]interface{})
+		if pIsMap && dIsMap {
+			result[k] = MergeMap(dm, pm)
+		} else if pIsMap {
+			result[k] = MergeMap(nil, pm)
+		} else {
+			result[k] = pv
+		}
+	}
+	return result
+}
+
+// DiffMap 计算 want 中与 have 不一致的部分（嵌套 map 递归比较）
+// 返回的 map 只包含 want 中存在且值与 have 不同的键，全部一致时返回空 map
+func DiffMap(want, have map[string]interface{}) map[string]interface{} {
+	diff := make(map[string]interface{})
+	for k, wv := range want {
+		hv, exists := have[k]
+		if !exists {
+			diff[k] = wv
+			continue
+		}
+		wm, wIsMap := wv.(map[string]interface{})
+		hm, hIsMap := hv.(map[string]interface{})
+		if wIsMap && hIsMap {
+			if sub := DiffMap(wm, hm); len(sub) > 0 {
+				diff[k] = sub
+			}
+			continue
+		}
+		if !DeepEqual(wv, hv) {
+			diff[k] = wv
+		}
+	}
+	return diff
+}
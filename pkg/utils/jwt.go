@@ -11,10 +11,15 @@ import (
 
 var jwtSecret = []byte("your-secret-key-change-in-production") // TODO: 从配置文件读取
 
+const DeviceTokenExpiry = 30 * 24 * time.Hour // 设备凭证有效期30天
+
 // JWTClaims JWT声明
 type JWTClaims struct {
-	UID  int64  `json:"uid"`
-	Role string `json:"role"`
+	UID   int64  `json:"uid"`
+	Role  string `json:"role"`
+	DevID int64  `json:"dev_id,omitempty"` // 仅设备凭证（role=device）使用
+	// TokenVersion 设备凭证版本号，与设备当前的token_version不一致时凭证失效
+	TokenVersion int64 `json:"token_version,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -43,6 +48,29 @@ func GenerateToken(user *model.User) (string, error) {
 	return token.SignedString(jwtSecret)
 }
 
+// GenerateDeviceToken 生成设备凭证（role=device），用于设备端接口认证，tokenVersion为设备当前的凭证版本号
+func GenerateDeviceToken(devID int64, tokenVersion int64) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(DeviceTokenExpiry)
+
+	claims := JWTClaims{
+		Role:         model.RoleDevice,
+		DevID:        devID,
+		TokenVersion: tokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    "sensor_manage_hub",
+			Subject:   "device:" + ConvertToString(devID),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString(jwtSecret)
+	return signed, expiresAt, err
+}
+
 // ParseToken 解析JWT token
 func ParseToken(tokenString string) (*JWTClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
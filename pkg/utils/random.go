@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"strings"
+)
+
+// claimCodeAlphabet 认领码字符集（去掉易混淆的 0/O/1/I/L）
+const claimCodeAlphabet = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+
+// GenerateClaimCode 生成形如 XXXX-XXXX-XXXX 的随机认领码（groups 为分组数，每组4个字符）
+func GenerateClaimCode(groups int) (string, error) {
+	if groups <= 0 {
+		groups = 3
+	}
+	alphabetSize := big.NewInt(int64(len(claimCodeAlphabet)))
+
+	var sb strings.Builder
+	for i := 0; i < groups*4; i++ {
+		if i > 0 && i%4 == 0 {
+			sb.WriteByte('-')
+		}
+		// rand.Int 均匀取值，避免按字节取模时前几个字符概率偏高
+		n, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(claimCodeAlphabet[n.Int64()])
+	}
+	return sb.String(), nil
+}
+
+// NormalizeClaimCode 规范化认领码（去掉分隔符和空白并转为大写），用于比对
+func NormalizeClaimCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, code)
+}
+
+// GenerateSecret 生成 nBytes 字节的随机密钥（十六进制字符串）
+func GenerateSecret(nBytes int) (string, error) {
+	if nBytes <= 0 {
+		nBytes = 32
+	}
+	buf := make([]byte, nBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// SHA256Hex 计算字符串的 SHA-256（十六进制）
+// 适用于高熵随机值（认领码、设备密钥等），用户密码请使用 CreatePasswordHash
+func SHA256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
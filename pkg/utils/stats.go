@@ -0,0 +1,33 @@
+package utils
+
+// LinearRegression 最小二乘线性回归，返回 y = slope*x + intercept
+// 点数少于2或x全部相同时 ok 为 false
+func LinearRegression(xs, ys []float64) (slope, intercept float64, ok bool) {
+	n := len(xs)
+	if n < 2 || n != len(ys) {
+		return 0, 0, false
+	}
+
+	var sumX, sumY float64
+	for i := 0; i < n; i++ {
+		sumX += xs[i]
+		sumY += ys[i]
+	}
+	meanX := sumX / float64(n)
+	meanY := sumY / float64(n)
+
+	// 先中心化再求和，避免时间戳等大数值相乘损失精度
+	var sxx, sxy float64
+	for i := 0; i < n; i++ {
+		dx := xs[i] - meanX
+		sxx += dx * dx
+		sxy += dx * (ys[i] - meanY)
+	}
+	if sxx == 0 {
+		return 0, 0, false
+	}
+
+	slope = sxy / sxx
+	intercept = meanY - slope*meanX
+	return slope, intercept, true
+}
@@ -0,0 +1,232 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// unitDef 单位定义：基准单位的值 = 值*factor + offset
+type unitDef struct {
+	symbol    string
+	dimension string
+	factor    float64
+	offset    float64
+}
+
+// 量纲
+const (
+	UnitDimensionTemperature  = "temperature"
+	UnitDimensionLength       = "length"
+	UnitDimensionMass         = "mass"
+	UnitDimensionPressure     = "pressure"
+	UnitDimensionSpeed        = "speed"
+	UnitDimensionAcceleration = "acceleration"
+	UnitDimensionVolume       = "volume"
+	UnitDimensionEnergy       = "energy"
+	UnitDimensionPower        = "power"
+	UnitDimensionVoltage      = "voltage"
+	UnitDimensionCurrent      = "current"
+	UnitDimensionFrequency    = "frequency"
+	UnitDimensionTime         = "time"
+	UnitDimensionAngle        = "angle"
+	UnitDimensionRatio        = "ratio"
+)
+
+// units 支持的单位（基准单位：K、m、kg、Pa、m/s、m/s²、m³、J、W、V、A、Hz、s、rad、1）
+var units = []unitDef{
+	{"°C", UnitDimensionTemperature, 1, 273.15},
+	{"°F", UnitDimensionTemperature, 5.0 / 9, 459.67 * 5 / 9},
+	{"K", UnitDimensionTemperature, 1, 0},
+
+	{"m", UnitDimensionLength, 1, 0},
+	{"km", UnitDimensionLength, 1e3, 0},
+	{"cm", UnitDimensionLength, 1e-2, 0},
+	{"mm", UnitDimensionLength, 1e-3, 0},
+	{"μm", UnitDimensionLength, 1e-6, 0},
+	{"in", UnitDimensionLength, 0.0254, 0},
+	{"ft", UnitDimensionLength, 0.3048, 0},
+	{"yd", UnitDimensionLength, 0.9144, 0},
+	{"mi", UnitDimensionLength, 1609.344, 0},
+
+	{"kg", UnitDimensionMass, 1, 0},
+	{"g", UnitDimensionMass, 1e-3, 0},
+	{"mg", UnitDimensionMass, 1e-6, 0},
+	{"t", UnitDimensionMass, 1e3, 0},
+	{"lb", UnitDimensionMass, 0.45359237, 0},
+	{"oz", UnitDimensionMass, 0.028349523125, 0},
+
+	{"Pa", UnitDimensionPressure, 1, 0},
+	{"hPa", UnitDimensionPressure, 1e2, 0},
+	{"kPa", UnitDimensionPressure, 1e3, 0},
+	{"MPa", UnitDimensionPressure, 1e6, 0},
+	{"bar", UnitDimensionPressure, 1e5, 0},
+	{"mbar", UnitDimensionPressure, 1e2, 0},
+	{"atm", UnitDimensionPressure, 101325, 0},
+	{"psi", UnitDimensionPressure, 6894.757293168, 0},
+	{"mmHg", UnitDimensionPressure, 133.322387415, 0},
+	{"inHg", UnitDimensionPressure, 3386.389, 0},
+
+	{"m/s", UnitDimensionSpeed, 1, 0},
+	{"km/h", UnitDimensionSpeed, 1 / 3.6, 0},
+	{"mph", UnitDimensionSpeed, 0.44704, 0},
+	{"kn", UnitDimensionSpeed, 1852.0 / 3600, 0},
+
+	{"m/s²", UnitDimensionAcceleration, 1, 0},
+	{"g0", UnitDimensionAcceleration, 9.80665, 0},
+
+	{"m³", UnitDimensionVolume, 1, 0},
+	{"L", UnitDimensionVolume, 1e-3, 0},
+	{"mL", UnitDimensionVolume, 1e-6, 0},
+	{"gal", UnitDimensionVolume, 0.003785411784, 0},
+
+	{"J", UnitDimensionEnergy, 1, 0},
+	{"kJ", UnitDimensionEnergy, 1e3, 0},
+	{"Wh", UnitDimensionEnergy, 3600, 0},
+	{"kWh", UnitDimensionEnergy, 3.6e6, 0},
+	{"cal", UnitDimensionEnergy, 4.184, 0},
+	{"kcal", UnitDimensionEnergy, 4184, 0},
+
+	{"W", UnitDimensionPower, 1, 0},
+	{"mW", UnitDimensionPower, 1e-3, 0},
+	{"kW", UnitDimensionPower, 1e3, 0},
+	{"MW", UnitDimensionPower, 1e6, 0},
+	{"hp", UnitDimensionPower, 745.69987158227, 0},
+
+	{"V", UnitDimensionVoltage, 1, 0},
+	{"mV", UnitDimensionVoltage, 1e-3, 0},
+	{"μV", UnitDimensionVoltage, 1e-6, 0},
+	{"kV", UnitDimensionVoltage, 1e3, 0},
+
+	{"A", UnitDimensionCurrent, 1, 0},
+	{"mA", UnitDimensionCurrent, 1e-3, 0},
+	{"μA", UnitDimensionCurrent, 1e-6, 0},
+
+	{"Hz", UnitDimensionFrequency, 1, 0},
+	{"kHz", UnitDimensionFrequency, 1e3, 0},
+	{"MHz", UnitDimensionFrequency, 1e6, 0},
+	{"rpm", UnitDimensionFrequency, 1.0 / 60, 0},
+
+	{"s", UnitDimensionTime, 1, 0},
+	{"ms", UnitDimensionTime, 1e-3, 0},
+	{"min", UnitDimensionTime, 60, 0},
+	{"h", UnitDimensionTime, 3600, 0},
+
+	{"rad", UnitDimensionAngle, 1, 0},
+	{"°", UnitDimensionAngle, math.Pi / 180, 0},
+
+	{"%", UnitDimensionRatio, 1e-2, 0},
+	{"‰", UnitDimensionRatio, 1e-3, 0},
+	{"ppm", UnitDimensionRatio, 1e-6, 0},
+	{"ppb", UnitDimensionRatio, 1e-9, 0},
+}
+
+// unitAliases 单位的其他写法
+var unitAliases = map[string]string{
+	"℃": "°C", "C": "°C", "degC": "°C", "celsius": "°C", "Celsius": "°C",
+	"℉": "°F", "F": "°F", "degF": "°F", "fahrenheit": "°F", "Fahrenheit": "°F",
+	"kelvin": "K", "Kelvin": "K",
+	"um": "μm", "µm": "μm", "inch": "in", "feet": "ft",
+	"lbs": "lb",
+	"hpa": "hPa", "kpa": "kPa", "mpa": "MPa", "millibar": "mbar",
+	"mps": "m/s", "kph": "km/h", "kmh": "km/h", "knot": "kn", "kt": "kn",
+	"m/s2": "m/s²", "m/s^2": "m/s²", "gn": "g0",
+	"m3": "m³", "m^3": "m³", "l": "L", "ml": "mL",
+	"kwh": "kWh", "wh": "Wh",
+	"uV": "μV", "µV": "μV", "uA": "μA", "µA": "μA",
+	"hz": "Hz", "khz": "kHz", "RPM": "rpm",
+	"sec": "s", "hr": "h",
+	"deg": "°", "degree": "°", "degrees": "°",
+	"percent": "%", "pct": "%",
+}
+
+var unitIndex = func() map[string]*unitDef {
+	index := make(map[string]*unitDef, len(units)+len(unitAliases))
+	for i := range units {
+		index[units[i].symbol] = &units[i]
+	}
+	for alias, symbol := range unitAliases {
+		index[alias] = index[symbol]
+	}
+	return index
+}()
+
+// NormalizeUnit 返回单位的标准写法（如 "degC" -> "°C"），不支持的单位 ok 为 false
+func NormalizeUnit(unit string) (string, bool) {
+	def, ok := unitIndex[strings.TrimSpace(unit)]
+	if !ok {
+		return "", false
+	}
+	return def.symbol, true
+}
+
+// UnitDimension 返回单位的量纲，不支持的单位返回空字符串
+func UnitDimension(unit string) string {
+	if def, ok := unitIndex[strings.TrimSpace(unit)]; ok {
+		return def.dimension
+	}
+	return ""
+}
+
+// ConvertUnit 单位转换（如 ConvertUnit(212, "°F", "°C") = 100），单位不支持或量纲不同时返回错误
+func ConvertUnit(value float64, from, to string) (float64, error) {
+	src, dst, err := unitPair(from, to)
+	if err != nil {
+		return 0, err
+	}
+	if src == dst {
+		return value, nil
+	}
+	// 保留12位有效数字，避免 212°F 转换为 100.00000000000006°C
+	return roundSignificant((value*src.factor+src.offset-dst.offset)/dst.factor, 12), nil
+}
+
+// ConvertUnitDelta 转换差值或累加值（只按比例转换，不加偏移，如 ConvertUnitDelta(9, "°F", "°C") = 5）
+// 用于温差、求和、极差、标准差等不能按绝对值转换的量
+func ConvertUnitDelta(value float64, from, to string) (float64, error) {
+	src, dst, err := unitPair(from, to)
+	if err != nil {
+		return 0, err
+	}
+	if src == dst {
+		return value, nil
+	}
+	return roundSignificant(value*src.factor/dst.factor, 12), nil
+}
+
+// unitPair 查找两个单位的定义，单位不支持或量纲不同时返回错误
+func unitPair(from, to string) (*unitDef, *unitDef, error) {
+	src, ok := unitIndex[strings.TrimSpace(from)]
+	if !ok {
+		return nil, nil, fmt.Errorf("不支持的单位: %s", from)
+	}
+	dst, ok := unitIndex[strings.TrimSpace(to)]
+	if !ok {
+		return nil, nil, fmt.Errorf("不支持的单位: %s", to)
+	}
+	if src.dimension != dst.dimension {
+		return nil, nil, fmt.Errorf("单位%s无法转换为%s", src.symbol, dst.symbol)
+	}
+	return src, dst, nil
+}
+
+func roundSignificant(value float64, digits int) float64 {
+	if value == 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+		return value
+	}
+	scale := math.Pow(10, float64(digits-1)-math.Floor(math.Log10(math.Abs(value))))
+	return math.Round(value*scale) / scale
+}
+
+// SupportedUnits 按量纲列出支持的单位（标准写法）
+func SupportedUnits() map[string][]string {
+	result := make(map[string][]string)
+	for _, def := range units {
+		result[def.dimension] = append(result[def.dimension], def.symbol)
+	}
+	for _, symbols := range result {
+		sort.Strings(symbols)
+	}
+	return result
+}
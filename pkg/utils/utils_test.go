@@ -2,6 +2,10 @@ package utils
 
 import (
 	"encoding/json"
+	"image"
+	"image/color"
+	"math"
+	"strings"
 	"testing"
 )
 
@@ -330,6 +334,62 @@ func TestIsValidJSON(t *testing.T) {
 	}
 }
 
+func TestMergeMap(t *testing.T) {
+	dst := map[string]interface{}{
+		"led":  "off",
+		"mode": "auto",
+		"net":  map[string]interface{}{"ssid": "a", "channel": float64(6)},
+	}
+	patch := map[string]interface{}{
+		"led":  "on",
+		"mode": nil,
+		"net":  map[string]interface{}{"channel": float64(11)},
+	}
+
+	result := MergeMap(dst, patch)
+	if result["led"] != "on" {
+		t.Errorf("Expected led=on, got %v", result["led"])
+	}
+	if _, exists := result["mode"]; exists {
+		t.Error("Expected mode to be removed")
+	}
+	net := result["net"].(map[string]interface{})
+	if net["ssid"] != "a" || net["channel"] != float64(11) {
+		t.Errorf("Expected nested merge, got %v", net)
+	}
+	if dst["led"] != "off" {
+		t.Error("MergeMap should not modify dst")
+	}
+}
+
+func TestDiffMap(t *testing.T) {
+	want := map[string]interface{}{
+		"led": "on",
+		"fw":  "1.2.0",
+		"net": map[string]interface{}{"ssid": "a", "channel": float64(11)},
+	}
+	have := map[string]interface{}{
+		"led": "on",
+		"net": map[string]interface{}{"ssid": "a", "channel": float64(6)},
+	}
+
+	diff := DiffMap(want, have)
+	if _, exists := diff["led"]; exists {
+		t.Error("Expected led to be in sync")
+	}
+	if diff["fw"] != "1.2.0" {
+		t.Errorf("Expected fw=1.2.0, got %v", diff["fw"])
+	}
+	net, ok := diff["net"].(map[string]interface{})
+	if !ok || len(net) != 1 || net["channel"] != float64(11) {
+		t.Errorf("Expected net.channel=11 only, got %v", diff["net"])
+	}
+
+	if len(DiffMap(have, have)) != 0 {
+		t.Error("Expected empty diff for identical maps")
+	}
+}
+
 func TestPrettyJSON(t *testing.T) {
 	m := map[string]interface{}{
 		"name": "Alice",
@@ -556,3 +616,216 @@ func TestMapString(t *testing.T) {
 		}
 	}
 }
+
+func TestCompareVersion(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.2.0", "1.2.0", 0},
+		{"1.2", "1.2.0", 0},
+		{"v1.2.10", "1.2.9", 1},
+		{"1.2.9", "1.10.0", -1},
+		{"2.0.0", "1.99.99", 1},
+		{"", "0.0.1", -1},
+	}
+
+	for _, tt := range tests {
+		result := CompareVersion(tt.a, tt.b)
+		if result != tt.expected {
+			t.Errorf("CompareVersion(%q, %q) = %d, want %d", tt.a, tt.b, result, tt.expected)
+		}
+	}
+}
+
+func TestGenerateClaimCode(t *testing.T) {
+	code, err := GenerateClaimCode(3)
+	if err != nil {
+		t.Fatalf("GenerateClaimCode failed: %v", err)
+	}
+	if len(code) != 14 || code[4] != '-' || code[9] != '-' {
+		t.Errorf("Unexpected claim code format: %s", code)
+	}
+
+	normalized := NormalizeClaimCode(" " + strings.ToLower(code) + " ")
+	if normalized != strings.ReplaceAll(code, "-", "") {
+		t.Errorf("NormalizeClaimCode(%s) = %s", code, normalized)
+	}
+
+	other, _ := GenerateClaimCode(3)
+	if code == other {
+		t.Errorf("Generated claim codes should be different: %s == %s", code, other)
+	}
+}
+
+func TestLinearRegression(t *testing.T) {
+	// y = -2x + 100
+	xs := []float64{1700000000, 1700003600, 1700007200, 1700010800}
+	ys := make([]float64, len(xs))
+	for i, x := range xs {
+		ys[i] = -2*(x-1700000000)/3600 + 100
+	}
+
+	slope, intercept, ok := LinearRegression(xs, ys)
+	if !ok {
+		t.Fatal("LinearRegression should succeed")
+	}
+	if diff := slope*3600 + 2; diff > 1e-9 || diff < -1e-9 {
+		t.Errorf("Unexpected slope: %v", slope*3600)
+	}
+	if got := slope*1700000000 + intercept; got-100 > 1e-6 || got-100 < -1e-6 {
+		t.Errorf("Unexpected value at x0: %v", got)
+	}
+
+	if _, _, ok := LinearRegression([]float64{1, 1}, []float64{1, 2}); ok {
+		t.Error("LinearRegression with identical xs should fail")
+	}
+	if _, _, ok := LinearRegression([]float64{1}, []float64{1}); ok {
+		t.Error("LinearRegression with single point should fail")
+	}
+}
+
+func TestResizeToFit(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			src.Set(x, y, color.NRGBA{R: 255, A: 255})
+		}
+	}
+
+	dst := ResizeToFit(src, 100)
+	if b := dst.Bounds(); b.Dx() != 100 || b.Dy() != 50 {
+		t.Fatalf("Unexpected size: %dx%d", b.Dx(), b.Dy())
+	}
+	if r, g, b, _ := dst.At(50, 25).RGBA(); r>>8 != 255 || g>>8 != 0 || b>>8 != 0 {
+		t.Errorf("Unexpected color: %d,%d,%d", r>>8, g>>8, b>>8)
+	}
+
+	// 不放大，透明像素合成到白色背景
+	small := image.NewNRGBA(image.Rect(0, 0, 10, 20))
+	dst = ResizeToFit(small, 100)
+	if b := dst.Bounds(); b.Dx() != 10 || b.Dy() != 20 {
+		t.Fatalf("Unexpected size: %dx%d", b.Dx(), b.Dy())
+	}
+	if r, g, b, _ := dst.At(0, 0).RGBA(); r>>8 != 255 || g>>8 != 255 || b>>8 != 255 {
+		t.Errorf("Transparent pixel should be white: %d,%d,%d", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestCompileExpr(t *testing.T) {
+	expr, err := CompileExpr("round(temp * 1.8 + 32, 1) + -2^2 + `rel-hum` % 7")
+	if err != nil {
+		t.Fatalf("CompileExpr failed: %v", err)
+	}
+	if got := expr.Eval(map[string]float64{"temp": 25, "rel-hum": 50}); got != 77+(-4)+1 {
+		t.Errorf("Unexpected value: %v", got)
+	}
+	if vars := expr.Vars(); len(vars) != 2 || vars[0] != "rel-hum" || vars[1] != "temp" {
+		t.Errorf("Unexpected vars: %v", vars)
+	}
+	if expr.Windowed() {
+		t.Error("Expression should not be windowed")
+	}
+
+	// 缺失值与除以0为NaN
+	expr, _ = CompileExpr("a / b")
+	if got := expr.Eval(map[string]float64{"a": 1, "b": 0}); !math.IsNaN(got) {
+		t.Errorf("Division by zero should be NaN: %v", got)
+	}
+	if got := expr.Eval(map[string]float64{"a": 1}); !math.IsNaN(got) {
+		t.Errorf("Missing var should be NaN: %v", got)
+	}
+	expr, _ = CompileExpr("coalesce(a, 0) + if(b > 1 && !c, 10, 20)")
+	if got := expr.Eval(map[string]float64{"b": 2, "c": 0}); got != 10 {
+		t.Errorf("Unexpected value: %v", got)
+	}
+
+	invalid := []string{"", "1 +", "(1", "foo(1)", "abs(1, 2)", "mavg(x, 0)", "mavg(x, n)", "1 $ 2", "a b", strings.Repeat("(", 40) + "1" + strings.Repeat(")", 40)}
+	for _, src := range invalid {
+		if _, err := CompileExpr(src); err == nil {
+			t.Errorf("CompileExpr(%q) should fail", src)
+		}
+	}
+}
+
+func TestExprEvalSeries(t *testing.T) {
+	expr, err := CompileExpr("mavg(x, 3)")
+	if err != nil {
+		t.Fatalf("CompileExpr failed: %v", err)
+	}
+	if !expr.Windowed() {
+		t.Error("Expression should be windowed")
+	}
+	times := []int64{0, 10, 20, 30, 40}
+	nan := math.NaN()
+	got := expr.EvalSeries(times, map[string][]float64{"x": {1, 2, nan, 6, 4}})
+	want := []float64{1, 1.5, 1.5, 4, 5}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("mavg[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	expr, _ = CompileExpr("rate(x)")
+	got = expr.EvalSeries(times, map[string][]float64{"x": {1, 2, nan, 6, 4}})
+	if !math.IsNaN(got[0]) || got[1] != 0.1 || !math.IsNaN(got[2]) || got[3] != 0.2 || got[4] != -0.2 {
+		t.Errorf("Unexpected rate: %v", got)
+	}
+
+	expr, _ = CompileExpr("mrms(x, 2)")
+	got = expr.EvalSeries(times[:2], map[string][]float64{"x": {3, 4}})
+	if math.Abs(got[1]-math.Sqrt(12.5)) > 1e-12 {
+		t.Errorf("Unexpected rms: %v", got[1])
+	}
+}
+
+func TestConvertUnit(t *testing.T) {
+	tests := []struct {
+		value    float64
+		from, to string
+		want     float64
+	}{
+		{212, "°F", "°C", 100},
+		{0, "degC", "K", 273.15},
+		{-40, "C", "F", -40},
+		{1, "atm", "hPa", 1013.25},
+		{36, "km/h", "m/s", 10},
+		{50, "%", "ppm", 500000},
+	}
+	for _, tt := range tests {
+		got, err := ConvertUnit(tt.value, tt.from, tt.to)
+		if err != nil {
+			t.Errorf("ConvertUnit(%v, %s, %s) failed: %v", tt.value, tt.from, tt.to, err)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-9*math.Max(1, math.Abs(tt.want)) {
+			t.Errorf("ConvertUnit(%v, %s, %s) = %v, want %v", tt.value, tt.from, tt.to, got, tt.want)
+		}
+	}
+
+	if _, err := ConvertUnit(1, "m", "°C"); err == nil {
+		t.Error("Converting between dimensions should fail")
+	}
+	if _, err := ConvertUnit(1, "furlong", "m"); err == nil {
+		t.Error("Unknown unit should fail")
+	}
+	if unit, ok := NormalizeUnit("℃"); !ok || unit != "°C" {
+		t.Errorf("Unexpected normalized unit: %s", unit)
+	}
+
+	deltas := []struct {
+		value    float64
+		from, to string
+		want     float64
+	}{
+		{9, "°F", "°C", 5},
+		{10, "K", "°C", 10},
+		{1000, "m", "km", 1},
+	}
+	for _, tt := range deltas {
+		got, err := ConvertUnitDelta(tt.value, tt.from, tt.to)
+		if err != nil || math.Abs(got-tt.want) > 1e-9*math.Max(1, math.Abs(tt.want)) {
+			t.Errorf("ConvertUnitDelta(%v, %s, %s) = %v, %v, want %v", tt.value, tt.from, tt.to, got, err, tt.want)
+		}
+	}
+}
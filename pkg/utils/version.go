@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompareVersion 比较两个版本号（如 1.2.10 与 v1.3），按数字逐段比较
+// 返回 -1 表示 a < b，0 表示相等，1 表示 a > b；非数字段按字符串比较
+func CompareVersion(a, b string) int {
+	as := splitVersion(a)
+	bs := splitVersion(b)
+
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var av, bv string
+		if i < len(as) {
+			av = as[i]
+		}
+		if i < len(bs) {
+			bv = bs[i]
+		}
+
+		an, aErr := strconv.Atoi(defaultVersionPart(av))
+		bn, bErr := strconv.Atoi(defaultVersionPart(bv))
+		if aErr == nil && bErr == nil {
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+			continue
+		}
+		if c := strings.Compare(av, bv); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// splitVersion 去掉前缀v并按 . - + 分割版本号
+func splitVersion(v string) []string {
+	v = strings.TrimPrefix(strings.TrimSpace(strings.ToLower(v)), "v")
+	if v == "" {
+		return nil
+	}
+	return strings.FieldsFunc(v, func(r rune) bool {
+		return r == '.' || r == '-' || r == '+'
+	})
+}
+
+// defaultVersionPart 缺失的版本段按0处理
+func defaultVersionPart(s string) string {
+	if s == "" {
+		return "0"
+	}
+	return s
+}
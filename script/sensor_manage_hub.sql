@@ -52,6 +52,9 @@ CREATE TABLE `device` (
     `offline_threshold` int UNSIGNED DEFAULT NULL COMMENT '离线判断阈值',
     `upload_interval` int UNSIGNED DEFAULT NULL COMMENT '数据上报间隔',
     `extended_config` json DEFAULT NULL COMMENT '扩展配置',
+    `shadow` json DEFAULT NULL COMMENT '设备影子(desired/reported)',
+    `shadow_version` bigint UNSIGNED NOT NULL DEFAULT 0 COMMENT '设备影子版本号',
+    `token_version` bigint UNSIGNED NOT NULL DEFAULT 0 COMMENT '设备凭证版本号(递增后已签发的凭证失效)',
     `create_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
     `update_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
     PRIMARY KEY (`dev_id`),
@@ -60,6 +63,86 @@ CREATE TABLE `device` (
     KEY `idx_dev_type` (`dev_type`),
     KEY `idx_create_at` (`create_at`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='传感器设备表';
+-- ==============================================
+-- DeviceCommand表 (设备下行命令表)
+-- ==============================================
+DROP TABLE IF EXISTS `device_command`;
+CREATE TABLE `device_command` (
+    `cmd_id` bigint NOT NULL COMMENT '命令ID',
+    `dev_id` bigint NOT NULL COMMENT '设备ID',
+    `command` varchar(50) NOT NULL COMMENT '命令名称',
+    `payload` json DEFAULT NULL COMMENT '命令参数',
+    `status` enum('pending','delivered','succeeded','failed','expired') NOT NULL DEFAULT 'pending' COMMENT '命令状态',
+    `result` json DEFAULT NULL COMMENT '设备回执结果',
+    `issued_by` bigint NOT NULL COMMENT '下发用户ID',
+    `ttl` int UNSIGNED NOT NULL COMMENT '有效期(秒)',
+    `expire_at` datetime NOT NULL COMMENT '过期时间',
+    `create_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    `delivered_at` datetime DEFAULT NULL COMMENT '下发时间',
+    `finished_at` datetime DEFAULT NULL COMMENT '结束时间',
+    PRIMARY KEY (`cmd_id`),
+    KEY `idx_dev_status` (`dev_id`, `status`),
+    KEY `idx_expire_at` (`expire_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='设备下行命令表';
+
+-- ==============================================
+-- Device_Provision表 (设备预注册表)
+-- ==============================================
+DROP TABLE IF EXISTS `device_provision`;
+CREATE TABLE `device_provision` (
+    `dev_id` bigint NOT NULL COMMENT '设备ID',
+    `claim_code_hash` char(64) NOT NULL COMMENT '认领码SHA-256',
+    `bootstrap_secret_hash` char(64) NOT NULL COMMENT '引导密钥SHA-256',
+    `claimed_by` bigint DEFAULT NULL COMMENT '认领用户ID',
+    `claimed_at` datetime DEFAULT NULL COMMENT '认领时间',
+    `last_bootstrap_at` datetime DEFAULT NULL COMMENT '最近引导时间',
+    `create_by` bigint NOT NULL COMMENT '预注册管理员ID',
+    `create_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    PRIMARY KEY (`dev_id`),
+    UNIQUE KEY `uk_claim_code_hash` (`claim_code_hash`),
+    KEY `idx_claimed_by` (`claimed_by`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='设备预注册表';
+
+-- ==============================================
+-- Firmware表 (固件版本表)
+-- ==============================================
+DROP TABLE IF EXISTS `firmware`;
+CREATE TABLE `firmware` (
+    `fw_id` bigint NOT NULL COMMENT '固件ID',
+    `dev_type` varchar(30) NOT NULL COMMENT '适用设备类型',
+    `model` varchar(50) NOT NULL DEFAULT '' COMMENT '适用硬件型号(空表示全部型号)',
+    `version` varchar(20) NOT NULL COMMENT '固件版本',
+    `bucket_key` varchar(255) NOT NULL COMMENT 'MinIO对象key(firmware bucket)',
+    `size` bigint UNSIGNED NOT NULL DEFAULT 0 COMMENT '文件大小(字节)',
+    `checksum` char(64) NOT NULL COMMENT 'SHA-256',
+    `signature` text COMMENT '固件签名',
+    `release_note` text COMMENT '发布说明',
+    `status` enum('uploading','ready') NOT NULL DEFAULT 'uploading' COMMENT '固件状态',
+    `create_by` bigint NOT NULL COMMENT '创建用户ID',
+    `create_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    PRIMARY KEY (`fw_id`),
+    UNIQUE KEY `uk_type_model_version` (`dev_type`, `model`, `version`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='固件版本表';
+
+-- ==============================================
+-- FirmwareRollout表 (固件灰度发布表)
+-- ==============================================
+DROP TABLE IF EXISTS `firmware_rollout`;
+CREATE TABLE `firmware_rollout` (
+    `rollout_id` bigint NOT NULL COMMENT '灰度发布ID',
+    `fw_id` bigint NOT NULL COMMENT '固件ID',
+    `strategy` enum('percentage','device_list') NOT NULL COMMENT '灰度策略',
+    `percentage` tinyint UNSIGNED NOT NULL DEFAULT 0 COMMENT '灰度比例0-100',
+    `dev_ids` json DEFAULT NULL COMMENT '灰度设备列表',
+    `status` enum('active','paused','completed') NOT NULL DEFAULT 'active' COMMENT '发布状态',
+    `create_by` bigint NOT NULL COMMENT '创建用户ID',
+    `create_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    `update_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    PRIMARY KEY (`rollout_id`),
+    KEY `idx_fw_id` (`fw_id`),
+    KEY `idx_status` (`status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='固件灰度发布表';
+
 -- ==============================================
 -- AlertEvent表 (告警事件表)
 -- ==============================================
@@ -99,6 +182,272 @@ CREATE TABLE `metadata` (
     KEY `idx_timestamp` (`timestamp`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='元数据表';
 
+-- ==============================================
+-- Upload_Session表 (文件上传会话表)
+-- ==============================================
+DROP TABLE IF EXISTS `upload_session`;
+CREATE TABLE `upload_session` (
+    `upload_id` varchar(32) NOT NULL COMMENT '上传ID',
+    `dev_id` bigint NOT NULL COMMENT '设备ID',
+    `bucket_name` varchar(63) NOT NULL COMMENT 'bucket名称',
+    `bucket_key` varchar(1024) NOT NULL COMMENT '对象key',
+    `filename` varchar(255) NOT NULL COMMENT '文件名',
+    `content_type` varchar(128) NOT NULL DEFAULT '' COMMENT '内容类型',
+    `uid` bigint NOT NULL COMMENT '申请上传的用户ID',
+    `status` enum('pending','completed','expired','aborted','rejected') NOT NULL DEFAULT 'pending' COMMENT '状态',
+    `data_id` bigint NOT NULL DEFAULT 0 COMMENT '确认后生成的元数据ID',
+    `size` bigint NOT NULL DEFAULT 0 COMMENT '对象大小（字节）',
+    `etag` varchar(128) DEFAULT NULL COMMENT '对象ETag',
+    `source` varchar(16) DEFAULT NULL COMMENT '确认来源: confirm/event',
+    `sha256` varchar(64) NOT NULL DEFAULT '' COMMENT '客户端声明的SHA-256（十六进制）',
+    `multipart_upload_id` varchar(255) NOT NULL DEFAULT '' COMMENT 'MinIO分片上传ID（为空表示单个PUT上传）',
+    `part_size` bigint NOT NULL DEFAULT 0 COMMENT '分片大小（字节）',
+    `file_size` bigint NOT NULL DEFAULT 0 COMMENT '声明的文件大小（字节）',
+    `create_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    `expire_at` datetime NOT NULL COMMENT '过期时间',
+    `completed_at` datetime DEFAULT NULL COMMENT '确认时间',
+    PRIMARY KEY (`upload_id`),
+    KEY `idx_bucket_key` (`bucket_name`, `bucket_key`(255)),
+    KEY `idx_status_expire_at` (`status`, `expire_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='文件上传会话表';
+
+-- ==============================================
+-- File_Delete_Outbox表 (文件删除补偿表)
+-- ==============================================
+DROP TABLE IF EXISTS `file_delete_outbox`;
+CREATE TABLE `file_delete_outbox` (
+    `id` bigint NOT NULL COMMENT '记录ID',
+    `data_id` bigint NOT NULL DEFAULT 0 COMMENT '已删除的元数据ID',
+    `bucket_name` varchar(63) NOT NULL COMMENT 'bucket名称',
+    `bucket_key` varchar(1024) NOT NULL COMMENT '对象key',
+    `status` enum('pending','done','failed') NOT NULL DEFAULT 'pending' COMMENT '状态',
+    `attempts` int UNSIGNED NOT NULL DEFAULT 0 COMMENT '已尝试次数',
+    `last_error` text DEFAULT NULL COMMENT '最近一次错误',
+    `create_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    `update_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    PRIMARY KEY (`id`),
+    KEY `idx_status` (`status`),
+    KEY `idx_bucket_name` (`bucket_name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='文件删除补偿表';
+
+-- ==============================================
+-- File_Archive_Task表 (文件打包任务表)
+-- ==============================================
+DROP TABLE IF EXISTS `file_archive_task`;
+CREATE TABLE `file_archive_task` (
+    `task_id` bigint NOT NULL COMMENT '任务ID',
+    `dev_id` bigint NOT NULL COMMENT '设备ID',
+    `bucket_name` varchar(63) NOT NULL COMMENT '打包的bucket',
+    `status` enum('pending','running','succeeded','failed','expired') NOT NULL DEFAULT 'pending' COMMENT '状态',
+    `file_count` int UNSIGNED NOT NULL DEFAULT 0 COMMENT '文件数量',
+    `size` bigint NOT NULL DEFAULT 0 COMMENT 'ZIP大小（字节）',
+    `archive_key` varchar(255) NOT NULL DEFAULT '' COMMENT 'archive bucket中的对象key',
+    `error_msg` text NOT NULL COMMENT '失败原因',
+    `uid` bigint NOT NULL COMMENT '创建任务的用户ID',
+    `create_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    `finished_at` datetime DEFAULT NULL COMMENT '完成时间',
+    PRIMARY KEY (`task_id`),
+    KEY `idx_status_finished_at` (`status`, `finished_at`),
+    KEY `idx_uid` (`uid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='文件打包任务表';
+
+-- ==============================================
+-- Retention_Policy表 (数据保留策略表)
+-- ==============================================
+DROP TABLE IF EXISTS `retention_policy`;
+CREATE TABLE `retention_policy` (
+    `policy_id` bigint NOT NULL COMMENT '策略ID',
+    `name` varchar(100) NOT NULL COMMENT '策略名称',
+    `dev_type` varchar(30) NOT NULL DEFAULT '' COMMENT '设备类型（为空表示所有设备）',
+    `data_type` enum('time_series','file_data') NOT NULL COMMENT '数据类型',
+    `measurement` varchar(100) NOT NULL DEFAULT '' COMMENT 'measurement（时序数据，为空表示全部）',
+    `bucket_name` varchar(63) NOT NULL DEFAULT '' COMMENT 'bucket（文件数据，为空表示全部）',
+    `retention_days` int UNSIGNED NOT NULL COMMENT '保留天数',
+    `enabled` tinyint(1) NOT NULL DEFAULT 1 COMMENT '是否启用',
+    `create_by` bigint NOT NULL COMMENT '创建者用户ID',
+    `create_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    `update_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    PRIMARY KEY (`policy_id`),
+    KEY `idx_data_type` (`data_type`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='数据保留策略表';
+
+-- ==============================================
+-- Rollup_Watermark表 (时序汇总水位线表)
+-- ==============================================
+DROP TABLE IF EXISTS `rollup_watermark`;
+CREATE TABLE `rollup_watermark` (
+    `measurement` varchar(100) NOT NULL COMMENT '原始measurement',
+    `level` varchar(10) NOT NULL COMMENT '汇总粒度（1m/1h/1d）',
+    `coverage_start` datetime NOT NULL COMMENT '覆盖起点（该时间到水位线之间的汇总已完成）',
+    `watermark` datetime NOT NULL COMMENT '水位线（该时间之前的汇总已完成）',
+    `update_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    PRIMARY KEY (`measurement`, `level`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='时序汇总水位线表';
+
+-- ==============================================
+-- Series_Archive表 (时序归档清单表)
+-- ==============================================
+DROP TABLE IF EXISTS `series_archive`;
+CREATE TABLE `series_archive` (
+    `archive_id` bigint NOT NULL COMMENT '归档ID',
+    `measurement` varchar(100) NOT NULL COMMENT 'measurement',
+    `dev_id` bigint NOT NULL COMMENT '设备ID',
+    `day` date NOT NULL COMMENT '数据日期（UTC）',
+    `bucket_name` varchar(63) NOT NULL COMMENT 'bucket名称',
+    `object_key` varchar(512) NOT NULL COMMENT 'Parquet文件key',
+    `row_count` bigint NOT NULL DEFAULT 0 COMMENT '行数',
+    `size` bigint NOT NULL DEFAULT 0 COMMENT '文件大小（字节）',
+    `create_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '归档时间',
+    PRIMARY KEY (`archive_id`),
+    UNIQUE KEY `uk_measurement_dev_day` (`measurement`, `dev_id`, `day`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='时序归档清单表';
+
+-- ==============================================
+-- Series_Archive_Watermark表 (时序归档进度表)
+-- ==============================================
+DROP TABLE IF EXISTS `series_archive_watermark`;
+CREATE TABLE `series_archive_watermark` (
+    `measurement` varchar(100) NOT NULL COMMENT 'measurement',
+    `archived_to` date NOT NULL COMMENT '该日期（UTC）之前的数据已归档',
+    `update_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    PRIMARY KEY (`measurement`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='时序归档进度表';
+
+-- ==============================================
+-- Series_Write_Outbox表 (时序写入补偿表)
+-- ==============================================
+DROP TABLE IF EXISTS `series_write_outbox`;
+CREATE TABLE `series_write_outbox` (
+    `data_id` bigint NOT NULL COMMENT '数据ID（与metadata一致）',
+    `dev_id` bigint NOT NULL COMMENT '设备ID',
+    `status` enum('queued','pending','written','completed','tombstoned') NOT NULL DEFAULT 'pending' COMMENT '状态',
+    `point_count` int UNSIGNED NOT NULL DEFAULT 0 COMMENT '数据点数量',
+    `min_timestamp` bigint NOT NULL DEFAULT 0 COMMENT '最早数据点时间（Unix秒）',
+    `max_timestamp` bigint NOT NULL DEFAULT 0 COMMENT '最晚数据点时间（Unix秒）',
+    `attempts` int UNSIGNED NOT NULL DEFAULT 0 COMMENT '已尝试次数',
+    `last_error` text DEFAULT NULL COMMENT '最近一次错误',
+    `payload` mediumtext DEFAULT NULL COMMENT '写入内容（metadata与数据点JSON），完成或补偿后清空',
+    `create_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    `update_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    PRIMARY KEY (`data_id`),
+    KEY `idx_status_update_at` (`status`, `update_at`),
+    KEY `idx_dev_id_status` (`dev_id`, `status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='时序写入补偿表';
+
+-- ==============================================
+-- Idempotency_Key表 (幂等键表)
+-- ==============================================
+DROP TABLE IF EXISTS `idempotency_key`;
+CREATE TABLE `idempotency_key` (
+    `scope` varchar(64) NOT NULL COMMENT '调用方（u:用户ID 或 d:设备ID）',
+    `idem_key` varchar(255) NOT NULL COMMENT '客户端提供的Idempotency-Key',
+    `method` varchar(10) NOT NULL COMMENT '请求方法',
+    `path` varchar(255) NOT NULL COMMENT '请求路由',
+    `request_hash` char(64) NOT NULL COMMENT '请求方法、路径与请求体的SHA-256',
+    `status` enum('processing','completed') NOT NULL DEFAULT 'processing' COMMENT '状态',
+    `response_code` int NOT NULL DEFAULT 0 COMMENT '首次请求的HTTP状态码',
+    `response_body` mediumblob DEFAULT NULL COMMENT '首次请求的响应体',
+    `content_type` varchar(100) NOT NULL DEFAULT '' COMMENT '响应Content-Type',
+    `create_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    `locked_until` datetime NOT NULL COMMENT '处理租约到期时间（processing记录超过该时间可被接管）',
+    `expire_at` datetime NOT NULL COMMENT '过期时间',
+    PRIMARY KEY (`scope`, `idem_key`),
+    KEY `idx_expire_at` (`expire_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='幂等键表';
+
+-- ==============================================
+-- Measurement_Schema表 (时序数据schema表)
+-- ==============================================
+DROP TABLE IF EXISTS `measurement_schema`;
+CREATE TABLE `measurement_schema` (
+    `schema_id` bigint NOT NULL COMMENT 'schema ID',
+    `dev_type` varchar(30) NOT NULL COMMENT '设备类型',
+    `measurement` varchar(100) NOT NULL COMMENT 'measurement名称',
+    `description` varchar(255) NOT NULL DEFAULT '' COMMENT '说明',
+    `fields` json NOT NULL COMMENT '字段定义（名称、类型、单位、范围、是否必填）',
+    `tags` json NOT NULL COMMENT 'tag定义（名称、允许取值、是否必填）',
+    `strict` tinyint(1) NOT NULL DEFAULT 0 COMMENT '是否拒绝未定义的字段与tag',
+    `coerce` tinyint(1) NOT NULL DEFAULT 0 COMMENT '是否转换字段值类型',
+    `version` int UNSIGNED NOT NULL DEFAULT 1 COMMENT '版本号，每次更新加1',
+    `create_by` bigint NOT NULL DEFAULT 0 COMMENT '创建人',
+    `create_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    `update_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    PRIMARY KEY (`schema_id`),
+    UNIQUE KEY `uk_dev_type_measurement` (`dev_type`, `measurement`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='时序数据schema表';
+
+-- ==============================================
+-- Anomaly_Baseline表 (异常检测基线表)
+-- ==============================================
+DROP TABLE IF EXISTS `anomaly_baseline`;
+CREATE TABLE `anomaly_baseline` (
+    `dev_id` bigint NOT NULL COMMENT '设备ID',
+    `measurement` varchar(100) NOT NULL COMMENT 'measurement名称',
+    `field` varchar(64) NOT NULL COMMENT '字段名称',
+    `mean` double NOT NULL DEFAULT 0 COMMENT '滚动基线EWMA均值',
+    `variance` double NOT NULL DEFAULT 0 COMMENT '滚动基线EWMA方差',
+    `sample_count` bigint NOT NULL DEFAULT 0 COMMENT '已学习的样本数',
+    `hourly` json NOT NULL COMMENT '按小时的季节性基线（24个均值/方差/样本数）',
+    `update_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '更新时间',
+    PRIMARY KEY (`dev_id`, `measurement`, `field`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='异常检测基线表';
+
+-- ==============================================
+-- Derived_Field表 (派生字段表)
+-- ==============================================
+DROP TABLE IF EXISTS `derived_field`;
+CREATE TABLE `derived_field` (
+    `field_id` bigint NOT NULL COMMENT '派生字段ID',
+    `dev_type` varchar(30) NOT NULL COMMENT '设备类型',
+    `measurement` varchar(100) NOT NULL COMMENT '源measurement',
+    `name` varchar(64) NOT NULL COMMENT '派生字段名称',
+    `expression` varchar(1024) NOT NULL COMMENT '表达式',
+    `mode` varchar(10) NOT NULL DEFAULT 'query' COMMENT '计算方式：query（查询时计算）、ingest（上传时计算并写入{measurement}_derived）',
+    `unit` varchar(20) NOT NULL DEFAULT '' COMMENT '单位',
+    `description` varchar(255) NOT NULL DEFAULT '' COMMENT '说明',
+    `create_by` bigint NOT NULL DEFAULT 0 COMMENT '创建人',
+    `create_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    `update_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    PRIMARY KEY (`field_id`),
+    UNIQUE KEY `uk_dev_type_measurement_name` (`dev_type`, `measurement`, `name`),
+    KEY `idx_create_by` (`create_by`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='派生字段表';
+
+-- ==============================================
+-- Field_Unit表 (字段单位表)
+-- ==============================================
+DROP TABLE IF EXISTS `field_unit`;
+CREATE TABLE `field_unit` (
+    `dev_id` bigint NOT NULL COMMENT '设备ID',
+    `measurement` varchar(100) NOT NULL COMMENT 'measurement名称',
+    `field` varchar(64) NOT NULL COMMENT '字段名称',
+    `unit` varchar(20) NOT NULL COMMENT '存储单位（设备首次声明的单位）',
+    `create_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    PRIMARY KEY (`dev_id`, `measurement`, `field`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='字段单位表';
+
+-- ==============================================
+-- Calibration_Profile表 (校准配置表)
+-- ==============================================
+DROP TABLE IF EXISTS `calibration_profile`;
+CREATE TABLE `calibration_profile` (
+    `profile_id` bigint NOT NULL COMMENT '校准配置ID',
+    `dev_id` bigint NOT NULL COMMENT '设备ID',
+    `measurement` varchar(100) NOT NULL COMMENT 'measurement名称',
+    `field` varchar(64) NOT NULL COMMENT '字段名称',
+    `type` varchar(20) NOT NULL COMMENT '校准类型：linear、polynomial',
+    `coefficients` json NOT NULL COMMENT '系数（升幂，linear为[offset, gain]）',
+    `valid_from` datetime NOT NULL COMMENT '生效时间（数据点时间）',
+    `version` int UNSIGNED NOT NULL DEFAULT 1 COMMENT '版本号，每次修正系数加1',
+    `keep_raw` tinyint(1) NOT NULL DEFAULT 0 COMMENT '是否保留原始值（写入{field}_raw）',
+    `description` varchar(255) NOT NULL DEFAULT '' COMMENT '说明',
+    `create_by` bigint NOT NULL DEFAULT 0 COMMENT '创建人',
+    `create_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    `update_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    PRIMARY KEY (`profile_id`),
+    UNIQUE KEY `uk_dev_field_valid_from` (`dev_id`, `measurement`, `field`, `valid_from`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='校准配置表';
+
 -- ==============================================
 -- SystemLog表 (系统日志表)
 -- ==============================================